@@ -0,0 +1,956 @@
+package integration_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	sfclient "github.com/MASA-JAPAN/go-salesforce-api-client"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+)
+
+// TestDeterministicTokens tests reproducible access tokens from a seed
+func TestDeterministicTokens(t *testing.T) {
+	issue := func(seed int64) []string {
+		emu := emulator.New(emulator.WithDeterministicTokens(seed))
+		emu.Start()
+		defer emu.Stop()
+		return []string{emu.CreateTestSession(), emu.CreateTestSession()}
+	}
+
+	first := issue(42)
+	second := issue(42)
+	other := issue(7)
+
+	for i := range first {
+		if first[i] != second[i] {
+			t.Errorf("Token %d differs for the same seed: %s vs %s", i, first[i], second[i])
+		}
+		if _, err := hex.DecodeString(first[i]); err != nil || len(first[i]) != 64 {
+			t.Errorf("Expected a 64-character hex token, got %s", first[i])
+		}
+	}
+	if first[0] == first[1] {
+		t.Error("Expected successive tokens to differ")
+	}
+	if first[0] == other[0] {
+		t.Error("Expected different seeds to produce different tokens")
+	}
+}
+
+// TestTokenResponseScopeAndExpiry tests the scope and expires_in token fields
+func TestTokenResponseScopeAndExpiry(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_, token := requestToken(t, baseURL, passwordForm())
+	if token["scope"] != "api refresh_token" {
+		t.Errorf("Expected default scope, got %v", token["scope"])
+	}
+	if _, ok := token["expires_in"]; ok {
+		t.Errorf("Expected expires_in to be omitted by default, got %v", token["expires_in"])
+	}
+
+	emu2 := emulator.New(
+		emulator.WithOAuthScope("api web"),
+		emulator.WithExpiresIn(),
+		emulator.WithTokenLifetime(30*time.Minute),
+	)
+	baseURL2 := emu2.Start()
+	defer emu2.Stop()
+
+	_, token = requestToken(t, baseURL2, passwordForm())
+	if token["scope"] != "api web" {
+		t.Errorf("Expected configured scope, got %v", token["scope"])
+	}
+	if token["expires_in"] != float64(1800) {
+		t.Errorf("Expected expires_in=1800, got %v", token["expires_in"])
+	}
+}
+
+// passwordForm returns a password grant form for the default credentials
+func passwordForm() url.Values {
+	clientID, clientSecret, username, password := emulator.GetDefaultCredentials()
+	return url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"username":      {username},
+		"password":      {password},
+	}
+}
+
+// requestToken posts a form to the token endpoint and decodes the JSON response
+func requestToken(t *testing.T, baseURL string, form url.Values) (*http.Response, map[string]interface{}) {
+	resp, err := http.PostForm(baseURL+"/services/oauth2/token", form)
+	if err != nil {
+		t.Fatalf("Token request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode token response: %v", err)
+	}
+	return resp, body
+}
+
+// TestSetAuthError tests forcing an OAuth error on the next auth attempt
+func TestSetAuthError(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	clientID, _, _, _ := emulator.GetDefaultCredentials()
+	emu.SetAuthError(clientID, "user_is_locked")
+
+	resp, body := requestToken(t, baseURL, passwordForm())
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", resp.StatusCode)
+	}
+	if body["error"] != "user_is_locked" {
+		t.Errorf("Expected user_is_locked, got %v", body["error"])
+	}
+
+	// The forced error only applies to the next attempt
+	resp, body = requestToken(t, baseURL, passwordForm())
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after forced error, got %d: %v", resp.StatusCode, body)
+	}
+}
+
+// TestLoginLockout tests locking a user out after repeated failed logins
+func TestLoginLockout(t *testing.T) {
+	emu := emulator.New(emulator.WithLoginLockout(2))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	badForm := passwordForm()
+	badForm.Set("password", "wrong")
+	for i := 0; i < 2; i++ {
+		_, body := requestToken(t, baseURL, badForm)
+		if body["error"] != "invalid_grant" {
+			t.Fatalf("Expected invalid_grant, got %v", body["error"])
+		}
+	}
+
+	// Correct credentials are rejected once locked out
+	resp, body := requestToken(t, baseURL, passwordForm())
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "user_is_locked" {
+		t.Errorf("Expected 400 user_is_locked, got %d %v", resp.StatusCode, body["error"])
+	}
+
+	emu.ResetLoginAttempts()
+
+	resp, body = requestToken(t, baseURL, passwordForm())
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after reset, got %d: %v", resp.StatusCode, body)
+	}
+}
+
+// TestPublicClient tests password logins for clients without a secret
+func TestPublicClient(t *testing.T) {
+	emu := emulator.New(emulator.WithPublicClient("mobile_app", "mobile@example.com", "mobilepass"))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	form := url.Values{
+		"grant_type": {"password"},
+		"client_id":  {"mobile_app"},
+		"username":   {"mobile@example.com"},
+		"password":   {"mobilepass"},
+	}
+	resp, body := requestToken(t, baseURL, form)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 for public client, got %d: %v", resp.StatusCode, body)
+	}
+
+	// Public clients cannot use the client credentials flow
+	resp, body = requestToken(t, baseURL, url.Values{
+		"grant_type": {"client_credentials"},
+		"client_id":  {"mobile_app"},
+	})
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("Expected 400 invalid_grant, got %d %v", resp.StatusCode, body["error"])
+	}
+}
+
+// TestAuthorizationCodePKCE tests the authorization code flow with PKCE
+func TestAuthorizationCodePKCE(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	clientID, _, _, _ := emulator.GetDefaultCredentials()
+	redirectURI := "http://localhost/callback"
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func() string {
+		params := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {clientID},
+			"redirect_uri":          {redirectURI},
+			"code_challenge":        {challenge},
+			"code_challenge_method": {"S256"},
+			"state":                 {"xyz"},
+		}
+		noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}}
+		resp, err := noRedirect.Get(baseURL + "/services/oauth2/authorize?" + params.Encode())
+		if err != nil {
+			t.Fatalf("Authorize request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("Expected 302, got %d", resp.StatusCode)
+		}
+		location, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil {
+			t.Fatalf("Invalid redirect location: %v", err)
+		}
+		if location.Query().Get("state") != "xyz" {
+			t.Errorf("Expected state to be echoed, got %q", location.Query().Get("state"))
+		}
+		return location.Query().Get("code")
+	}
+
+	exchange := func(code, codeVerifier string) (*http.Response, map[string]interface{}) {
+		return requestToken(t, baseURL, url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {clientID},
+			"redirect_uri":  {redirectURI},
+			"code":          {code},
+			"code_verifier": {codeVerifier},
+		})
+	}
+
+	// A mismatched verifier is rejected
+	resp, body := exchange(authorize(), "wrong-verifier")
+	if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("Expected 400 invalid_grant, got %d %v", resp.StatusCode, body["error"])
+	}
+
+	code := authorize()
+	resp, body = exchange(code, verifier)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, body)
+	}
+	if body["access_token"] == "" {
+		t.Error("Expected an access token")
+	}
+
+	// Codes are single use
+	resp, _ = exchange(code, verifier)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected reused code to be rejected, got %d", resp.StatusCode)
+	}
+}
+
+// TestScopeEnforcement tests rejecting API requests from sessions without the api scope
+func TestScopeEnforcement(t *testing.T) {
+	emu := emulator.New(
+		emulator.WithScopeEnforcement(),
+		emulator.WithCredentials(auth.Credential{
+			ClientID:     "refresh_only",
+			ClientSecret: "secret",
+			Username:     "refresh@example.com",
+			Password:     "password",
+			Scopes:       []string{"refresh_token"},
+		}),
+		emulator.WithCredential("api_client", "secret", "api@example.com", "password"),
+		emulator.WithCredentials(auth.Credential{
+			ClientID:     "web_only",
+			ClientSecret: "secret",
+			Username:     "web@example.com",
+			Password:     "password",
+			Scopes:       []string{"web"},
+		}),
+	)
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	login := func(clientID, username, scope string) string {
+		form := url.Values{
+			"grant_type":    {"password"},
+			"client_id":     {clientID},
+			"client_secret": {"secret"},
+			"username":      {username},
+			"password":      {"password"},
+		}
+		if scope != "" {
+			form.Set("scope", scope)
+		}
+		resp, body := requestToken(t, baseURL, form)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, body)
+		}
+		return body["access_token"].(string)
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		expected int
+	}{
+		{"without api scope", login("refresh_only", "refresh@example.com", ""), http.StatusUnauthorized},
+		{"default scope", login("api_client", "api@example.com", ""), http.StatusOK},
+		{"narrowed scope", login("api_client", "api@example.com", "refresh_token"), http.StatusUnauthorized},
+		{"web scope only", login("web_only", "web@example.com", ""), http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		client := &sfclient.Client{AccessToken: tc.token, InstanceURL: baseURL}
+		resp, body := doRequest(t, client, "GET", "/services/data/v58.0/sobjects", nil, nil)
+		if resp.StatusCode != tc.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.expected, resp.StatusCode, body)
+		}
+	}
+
+	// Asking only for scopes the client was not granted gets no token at all
+	for _, scope := range []string{"api", "chatter_api", "api refresh_token"} {
+		resp, body := requestToken(t, baseURL, url.Values{
+			"grant_type":    {"password"},
+			"client_id":     {"web_only"},
+			"client_secret": {"secret"},
+			"username":      {"web@example.com"},
+			"password":      {"password"},
+			"scope":         {scope},
+		})
+		if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_scope" || body["access_token"] != nil {
+			t.Errorf("scope %q: expected 400 invalid_scope, got %d %v", scope, resp.StatusCode, body)
+		}
+	}
+
+	// The identity URL needs an identity scope rather than api
+	orgs, err := emu.Store().GetAllRecords("Organization")
+	if err != nil || len(orgs) != 1 {
+		t.Fatalf("Expected the organization, got %v (%v)", orgs, err)
+	}
+	orgID, userID := orgs[0]["Id"].(string), emu.Store().GetDefaultUserID()
+	for _, tc := range []struct {
+		scopes   []string
+		expected int
+	}{
+		{[]string{"api"}, http.StatusUnauthorized},
+		{[]string{"id"}, http.StatusOK},
+		{[]string{"openid"}, http.StatusOK},
+	} {
+		client := &sfclient.Client{AccessToken: emu.CreateTestSessionFor("", tc.scopes...), InstanceURL: baseURL}
+		resp, body := doRequest(t, client, http.MethodGet, "/id/"+orgID+"/"+userID, nil, nil)
+		if resp.StatusCode != tc.expected {
+			t.Errorf("identity with %v: expected %d, got %d: %s", tc.scopes, tc.expected, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestTokenIntrospection tests the token introspection endpoint
+func TestTokenIntrospection(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	clientID, clientSecret, username, _ := emulator.GetDefaultCredentials()
+	_, token := requestToken(t, baseURL, passwordForm())
+
+	introspect := func(accessToken string) map[string]interface{} {
+		resp, err := http.PostForm(baseURL+"/services/oauth2/introspect", url.Values{
+			"token":         {accessToken},
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+		})
+		if err != nil {
+			t.Fatalf("Introspect request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", resp.StatusCode)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode introspection response: %v", err)
+		}
+		return body
+	}
+
+	body := introspect(token["access_token"].(string))
+	if body["active"] != true {
+		t.Fatalf("Expected active token, got %v", body)
+	}
+	if body["client_id"] != clientID || body["username"] != username {
+		t.Errorf("Expected client_id and username of the session, got %v", body)
+	}
+	if body["scope"] != "api refresh_token" {
+		t.Errorf("Expected session scope, got %v", body["scope"])
+	}
+	if exp, _ := body["exp"].(float64); int64(exp) <= time.Now().Unix() {
+		t.Errorf("Expected exp in the future, got %v", body["exp"])
+	}
+
+	body = introspect("unknown_token")
+	if body["active"] != false || len(body) != 1 {
+		t.Errorf("Expected only active=false for unknown token, got %v", body)
+	}
+}
+
+// TestRefreshToken tests refreshing an expired access token
+func TestRefreshToken(t *testing.T) {
+	emu := emulator.New(emulator.WithTokenLifetime(500*time.Millisecond), emulator.WithPasswordRefreshTokens())
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	clientID, clientSecret, _, _ := emulator.GetDefaultCredentials()
+	_, token := requestToken(t, baseURL, passwordForm())
+	refreshToken, _ := token["refresh_token"].(string)
+	if refreshToken == "" {
+		t.Fatalf("Expected a refresh token, got %v", token)
+	}
+
+	callAPI := func(accessToken string) int {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/services/data/v58.0/limits", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	refresh := func(secret string) (*http.Response, map[string]interface{}) {
+		return requestToken(t, baseURL, url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {clientID},
+			"client_secret": {secret},
+			"refresh_token": {refreshToken},
+		})
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if status := callAPI(token["access_token"].(string)); status != http.StatusUnauthorized {
+		t.Fatalf("Expected the expired token to be rejected, got %d", status)
+	}
+
+	resp, refreshed := refresh(clientSecret)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, refreshed)
+	}
+	if _, ok := refreshed["refresh_token"]; ok {
+		t.Errorf("Expected no new refresh token, got %v", refreshed["refresh_token"])
+	}
+	if refreshed["scope"] != "api refresh_token" {
+		t.Errorf("Expected the original scope, got %v", refreshed["scope"])
+	}
+	if status := callAPI(refreshed["access_token"].(string)); status != http.StatusOK {
+		t.Errorf("Expected the refreshed token to work, got %d", status)
+	}
+
+	// The refresh token outlives every access token issued from it
+	time.Sleep(600 * time.Millisecond)
+	if resp, body := refresh(clientSecret); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the refresh token to stay valid, got %d: %v", resp.StatusCode, body)
+	}
+
+	if resp, body := refresh("wrong"); resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_client_id" {
+		t.Errorf("Expected 400 invalid_client_id, got %d %v", resp.StatusCode, body)
+	}
+	refreshToken = "unknown"
+	if resp, body := refresh(clientSecret); resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" {
+		t.Errorf("Expected 400 invalid_grant, got %d %v", resp.StatusCode, body)
+	}
+
+	// Client credentials grants never come with a refresh token
+	_, token = requestToken(t, baseURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+	if _, ok := token["refresh_token"]; ok {
+		t.Errorf("Expected no refresh token for client_credentials, got %v", token)
+	}
+
+	// Nor do password grants unless the emulator opts in
+	plain := emulator.New()
+	plainURL := plain.Start()
+	defer plain.Stop()
+	_, token = requestToken(t, plainURL, passwordForm())
+	if _, ok := token["refresh_token"]; ok || token["access_token"] == nil {
+		t.Errorf("Expected an access token without a refresh token, got %v", token)
+	}
+}
+
+// TestExpireAllSessions tests forcing sessions to expire on demand
+func TestExpireAllSessions(t *testing.T) {
+	emu := emulator.New(emulator.WithPasswordRefreshTokens())
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	clientID, clientSecret, _, _ := emulator.GetDefaultCredentials()
+	_, token := requestToken(t, baseURL, passwordForm())
+	client := &sfclient.Client{AccessToken: token["access_token"].(string), InstanceURL: baseURL}
+
+	path := "/services/data/v58.0/limits"
+	if resp, body := doRequest(t, client, http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	emu.ExpireAllSessions()
+	resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "INVALID_SESSION_ID") {
+		t.Fatalf("Expected 401 INVALID_SESSION_ID after expiry, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, refreshed := requestToken(t, baseURL, url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"refresh_token": {token["refresh_token"].(string)},
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the refresh token to survive expiry, got %d: %v", resp.StatusCode, refreshed)
+	}
+	client.AccessToken = refreshed["access_token"].(string)
+	if resp, body := doRequest(t, client, http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the refreshed token to work, got %d: %s", resp.StatusCode, body)
+	}
+
+	// A negative lifetime issues tokens that are expired from the start
+	expired := emulator.New(emulator.WithTokenLifetime(-time.Minute), emulator.WithExpiresIn())
+	expiredURL := expired.Start()
+	defer expired.Stop()
+
+	_, token = requestToken(t, expiredURL, passwordForm())
+	if expiresIn, _ := token["expires_in"].(float64); expiresIn < 0 {
+		t.Errorf("Expected no negative expires_in, got %v", expiresIn)
+	}
+	client = &sfclient.Client{AccessToken: token["access_token"].(string), InstanceURL: expiredURL}
+	if resp, body := doRequest(t, client, http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an already expired token, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+// TestJWTBearerFlow tests exchanging signed JWT assertions for sessions
+func TestJWTBearerFlow(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	emu := emulator.New(emulator.WithJWTKey(&key.PublicKey))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	clientID, _, username, _ := emulator.GetDefaultCredentials()
+	sign := func(signer *rsa.PrivateKey, claims map[string]interface{}) string {
+		encode := func(v interface{}) string {
+			data, _ := json.Marshal(v)
+			return base64.RawURLEncoding.EncodeToString(data)
+		}
+		unsigned := encode(map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encode(claims)
+		digest := sha256.Sum256([]byte(unsigned))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, signer, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign assertion: %v", err)
+		}
+		return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+	claims := func(iss string, exp time.Time) map[string]interface{} {
+		return map[string]interface{}{"iss": iss, "sub": username, "aud": "https://login.salesforce.com", "exp": exp.Unix()}
+	}
+	exchange := func(assertion string) (*http.Response, map[string]interface{}) {
+		return requestToken(t, baseURL, url.Values{
+			"grant_type": {auth.JWTBearerGrantType},
+			"assertion":  {assertion},
+		})
+	}
+
+	resp, token := exchange(sign(key, claims(clientID, time.Now().Add(3*time.Minute))))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, token)
+	}
+	client := &sfclient.Client{AccessToken: token["access_token"].(string), InstanceURL: token["instance_url"].(string)}
+	if _, err := client.Query("SELECT Id FROM Account"); err != nil {
+		t.Errorf("Expected the issued token to work: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		assertion string
+		error     string
+	}{
+		{"expired", sign(key, claims(clientID, time.Now().Add(-time.Minute))), "invalid_grant"},
+		{"unknown issuer", sign(key, claims("unknown_client", time.Now().Add(3*time.Minute))), "invalid_client_id"},
+		{"wrong key", sign(otherKey, claims(clientID, time.Now().Add(3*time.Minute))), "invalid_grant"},
+		{"wrong audience", sign(key, map[string]interface{}{"iss": clientID, "sub": username, "aud": "https://example.com", "exp": time.Now().Add(3 * time.Minute).Unix()}), "invalid_grant"},
+		{"not a JWT", "not-a-jwt", "invalid_grant"},
+	}
+	for _, tt := range tests {
+		resp, body := exchange(tt.assertion)
+		if resp.StatusCode != http.StatusBadRequest || body["error"] != tt.error {
+			t.Errorf("%s: expected 400 %s, got %d %v", tt.name, tt.error, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestUserInfo tests the OpenID Connect userinfo endpoint
+func TestUserInfo(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_, _, username, _ := emulator.GetDefaultCredentials()
+	_, token := requestToken(t, baseURL, passwordForm())
+
+	userInfo := func(accessToken string) (*http.Response, map[string]interface{}) {
+		req, _ := http.NewRequest(http.MethodGet, baseURL+"/services/oauth2/userinfo", nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Userinfo request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var body map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp, body
+	}
+
+	resp, body := userInfo(token["access_token"].(string))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, body)
+	}
+	if body["preferred_username"] != username {
+		t.Errorf("Expected preferred_username %s, got %v", username, body["preferred_username"])
+	}
+	if body["user_id"] != emu.Store().GetDefaultUserID() || body["organization_id"] == "" {
+		t.Errorf("Expected the session's user and org, got %v", body)
+	}
+	if body["sub"] != token["id"] {
+		t.Errorf("Expected sub to be the identity URL %v, got %v", token["id"], body["sub"])
+	}
+	if body["email"] != "admin@example.com" || body["name"] != "System Administrator" {
+		t.Errorf("Expected the User record's email and name, got %v", body)
+	}
+	urls, _ := body["urls"].(map[string]interface{})
+	if urls["rest"] != baseURL+"/services/data/v58.0/" {
+		t.Errorf("Expected the REST URL, got %v", urls)
+	}
+
+	if resp, _ := userInfo("invalid_token"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid session, got %d", resp.StatusCode)
+	}
+}
+
+// TestIdentityURL tests following the id of a token response
+func TestIdentityURL(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_, _, username, _ := emulator.GetDefaultCredentials()
+	_, token := requestToken(t, baseURL, passwordForm())
+
+	getIdentity := func(identityURL, accessToken string) (*http.Response, []byte) {
+		req, _ := http.NewRequest(http.MethodGet, identityURL, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Identity request failed: %v", err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	identityURL := token["id"].(string)
+	resp, body := getIdentity(identityURL, token["access_token"].(string))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var identity struct {
+		ID             string            `json:"id"`
+		AssertedUser   bool              `json:"asserted_user"`
+		UserID         string            `json:"user_id"`
+		OrganizationID string            `json:"organization_id"`
+		Username       string            `json:"username"`
+		DisplayName    string            `json:"display_name"`
+		Email          string            `json:"email"`
+		Photos         map[string]string `json:"photos"`
+		URLs           map[string]string `json:"urls"`
+	}
+	if err := json.Unmarshal(body, &identity); err != nil {
+		t.Fatalf("Failed to decode identity: %v %s", err, body)
+	}
+	if identity.ID != identityURL || !identity.AssertedUser || identity.UserID != emu.Store().GetDefaultUserID() {
+		t.Errorf("Expected the session's own identity, got %+v", identity)
+	}
+	if identity.Username != username || identity.DisplayName != "System Administrator" || identity.Email != "admin@example.com" {
+		t.Errorf("Expected the user's details, got %+v", identity)
+	}
+	if identity.Photos["picture"] == "" || identity.URLs["sobjects"] != baseURL+"/services/data/v58.0/sobjects/" {
+		t.Errorf("Expected photos and urls, got %+v", identity)
+	}
+
+	if resp, _ := getIdentity(identityURL, "invalid_token"); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an invalid session, got %d", resp.StatusCode)
+	}
+	if resp, _ := getIdentity(baseURL+"/id/"+identity.OrganizationID+"/005000000000000AAA", token["access_token"].(string)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown user, got %d", resp.StatusCode)
+	}
+}
+
+// TestMultipleUsers tests credentials logging in as different users
+func TestMultipleUsers(t *testing.T) {
+	emu := emulator.New(emulator.WithUser(auth.Credential{
+		ClientID:     "sales_client",
+		ClientSecret: "sales_secret",
+		Username:     "sales@example.com",
+		Password:     "salespassword",
+	}, map[string]interface{}{"FirstName": "Sally", "LastName": "Sales"}))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	login := func(form url.Values) *sfclient.Client {
+		resp, token := requestToken(t, baseURL, form)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, token)
+		}
+		return &sfclient.Client{AccessToken: token["access_token"].(string), InstanceURL: token["instance_url"].(string)}
+	}
+	admin := login(passwordForm())
+	sales := login(url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {"sales_client"},
+		"client_secret": {"sales_secret"},
+		"username":      {"sales@example.com"},
+		"password":      {"salespassword"},
+	})
+
+	users, err := admin.Query("SELECT Id, Name FROM User WHERE Username = 'sales@example.com'")
+	if err != nil || users.TotalSize != 1 {
+		t.Fatalf("Expected the seeded user, got %v (%v)", users, err)
+	}
+	salesUserID := users.Records[0]["Id"].(string)
+	if users.Records[0]["Name"] != "Sally Sales" {
+		t.Errorf("Expected the seeded user's name, got %v", users.Records[0]["Name"])
+	}
+
+	createdBy := func(client *sfclient.Client, name string) interface{} {
+		created, err := client.CreateRecord("Account", map[string]interface{}{"Name": name})
+		if err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+		record, err := client.GetRecord("Account", created.ID)
+		if err != nil {
+			t.Fatalf("GetRecord failed: %v", err)
+		}
+		if record["LastModifiedById"] != record["CreatedById"] {
+			t.Errorf("Expected LastModifiedById to match CreatedById, got %v", record)
+		}
+		return record["CreatedById"]
+	}
+	if got := createdBy(admin, "Admin Account"); got != emu.Store().GetDefaultUserID() {
+		t.Errorf("Expected the admin's record to be created by the default user, got %v", got)
+	}
+	if got := createdBy(sales, "Sales Account"); got != salesUserID {
+		t.Errorf("Expected the sales record to be created by %s, got %v", salesUserID, got)
+	}
+}
+
+// TestAuditFieldsFollowSession tests that writes are attributed to the
+// session's user
+func TestAuditFieldsFollowSession(t *testing.T) {
+	emu := emulator.New(emulator.WithUser(auth.Credential{
+		ClientID:     "sales_client",
+		ClientSecret: "sales_secret",
+		Username:     "sales@example.com",
+		Password:     "salespassword",
+	}, nil))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	login := func(form url.Values) *sfclient.Client {
+		resp, token := requestToken(t, baseURL, form)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %v", resp.StatusCode, token)
+		}
+		return &sfclient.Client{AccessToken: token["access_token"].(string), InstanceURL: token["instance_url"].(string)}
+	}
+	admin := login(passwordForm())
+	sales := login(url.Values{
+		"grant_type":    {"password"},
+		"client_id":     {"sales_client"},
+		"client_secret": {"sales_secret"},
+		"username":      {"sales@example.com"},
+		"password":      {"salespassword"},
+	})
+	adminID := emu.Store().GetDefaultUserID()
+	users, err := admin.Query("SELECT Id FROM User WHERE Username = 'sales@example.com'")
+	if err != nil || users.TotalSize != 1 {
+		t.Fatalf("Expected the seeded user, got %v (%v)", users, err)
+	}
+	salesID := users.Records[0]["Id"].(string)
+
+	created, err := admin.CreateRecord("Account", map[string]interface{}{"Name": "Shared Account"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if err := sales.UpdateRecord("Account", created.ID, map[string]interface{}{"Name": "Renamed"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	record, err := admin.GetRecord("Account", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if record["CreatedById"] != adminID {
+		t.Errorf("Expected CreatedById %s, got %v", adminID, record["CreatedById"])
+	}
+	if record["LastModifiedById"] != salesID {
+		t.Errorf("Expected LastModifiedById %s after the edit, got %v", salesID, record["LastModifiedById"])
+	}
+
+	// Bulk rows are written as the user who created the job
+	runIngestJob(t, sales, map[string]interface{}{"object": "Account", "operation": "insert"}, "Name\nBulk Account\n")
+	bulk, err := admin.Query("SELECT CreatedById, LastModifiedById FROM Account WHERE Name = 'Bulk Account'")
+	if err != nil || bulk.TotalSize != 1 {
+		t.Fatalf("Expected the bulk record, got %v (%v)", bulk, err)
+	}
+	if bulk.Records[0]["CreatedById"] != salesID || bulk.Records[0]["LastModifiedById"] != salesID {
+		t.Errorf("Expected the bulk record to be written by %s, got %v", salesID, bulk.Records[0])
+	}
+}
+
+// TestCreateTestSessionFor tests minting sessions for a chosen user and scopes
+func TestCreateTestSessionFor(t *testing.T) {
+	emu := emulator.New(emulator.WithScopeEnforcement())
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	profiles, err := emu.Store().GetAllRecords("Profile")
+	if err != nil || len(profiles) == 0 {
+		t.Fatalf("Expected a profile, got %v (%v)", profiles, err)
+	}
+	userID, err := emu.Store().CreateRecord("User", map[string]interface{}{
+		"Username":  "second@example.com",
+		"LastName":  "Second",
+		"Email":     "second@example.com",
+		"Alias":     "second",
+		"ProfileId": profiles[0]["Id"],
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	if token := emu.CreateTestSessionFor("005000000000000AAA"); token != "" {
+		t.Errorf("Expected no session for an unknown user, got %s", token)
+	}
+
+	cases := []struct {
+		name     string
+		token    string
+		expected int
+	}{
+		{"default user, every scope", emu.CreateTestSessionFor(""), http.StatusOK},
+		{"api scope", emu.CreateTestSessionFor(userID, "api", "refresh_token"), http.StatusOK},
+		{"without api scope", emu.CreateTestSessionFor(userID, "refresh_token"), http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		client := &sfclient.Client{AccessToken: tc.token, InstanceURL: baseURL}
+		resp, body := doRequest(t, client, "GET", "/services/data/v58.0/sobjects", nil, nil)
+		if resp.StatusCode != tc.expected {
+			t.Errorf("%s: expected %d, got %d: %s", tc.name, tc.expected, resp.StatusCode, body)
+		}
+	}
+
+	// The session belongs to the chosen user
+	clientID, clientSecret, _, _ := emulator.GetDefaultCredentials()
+	resp, err := http.PostForm(baseURL+"/services/oauth2/introspect", url.Values{
+		"token":         {cases[1].token},
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+	})
+	if err != nil {
+		t.Fatalf("Introspect request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode introspection response: %v", err)
+	}
+	sub, _ := body["sub"].(string)
+	if body["username"] != "second@example.com" || body["scope"] != "api refresh_token" || !strings.HasSuffix(sub, "/"+userID) {
+		t.Errorf("Unexpected introspection response: %v", body)
+	}
+}
+
+// TestAuthLogger tests failed logins logging the mismatched field without
+// changing the response or leaking secrets
+func TestAuthLogger(t *testing.T) {
+	var buf bytes.Buffer
+	emu := emulator.New(emulator.WithAuthLogger(log.New(&buf, "", 0)))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	form := func(clientID, secret, username, password string) url.Values {
+		return url.Values{
+			"grant_type":    {"password"},
+			"client_id":     {clientID},
+			"client_secret": {secret},
+			"username":      {username},
+			"password":      {password},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		form     url.Values
+		expected string
+	}{
+		{"unknown client", form("nope", "test_client_secret", "test@example.com", "testpassword"), `client_id "nope" unknown`},
+		{"wrong secret", form("test_client_id", "hunter2", "test@example.com", "testpassword"), "client_secret mismatch\n"},
+		{"username case", form("test_client_id", "test_client_secret", " Test@Example.com", "testpassword"), "username mismatch (differs only in case or surrounding whitespace)"},
+		{"wrong password", form("test_client_id", "test_client_secret", "test@example.com", "hunter2"), "password mismatch\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf.Reset()
+			resp, body := requestToken(t, baseURL, tt.form)
+			if resp.StatusCode != http.StatusBadRequest || body["error"] != "invalid_grant" || body["error_description"] != "authentication failure" {
+				t.Errorf("Expected a generic invalid_grant, got %d %v", resp.StatusCode, body)
+			}
+			logged := buf.String()
+			if !strings.Contains(logged, tt.expected) {
+				t.Errorf("Expected log to contain %q, got %q", tt.expected, logged)
+			}
+			if strings.Contains(logged, "hunter2") {
+				t.Errorf("Expected secrets to stay out of the log, got %q", logged)
+			}
+		})
+	}
+
+	buf.Reset()
+	if resp, _ := requestToken(t, baseURL, form("test_client_id", "test_client_secret", "test@example.com", "testpassword")); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected a successful login, got %d", resp.StatusCode)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing logged for a successful login, got %q", buf.String())
+	}
+}
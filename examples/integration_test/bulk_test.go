@@ -0,0 +1,328 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sfclient "github.com/MASA-JAPAN/go-salesforce-api-client"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/testutil"
+)
+
+// TestBulkQueryJobFormatOptions tests lineEnding and columnDelimiter round-tripping
+func TestBulkQueryJobFormatOptions(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	if _, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(2); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/jobs/query", map[string]interface{}{
+		"operation":       "query",
+		"query":           "SELECT Id, Name FROM Account",
+		"columnDelimiter": "PIPE",
+	}, map[string]string{
+		"Sforce-Line-Ending":         "CRLF",
+		"Sforce-Disable-Batch-Retry": "true",
+	})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var job map[string]interface{}
+	if err := json.Unmarshal(body, &job); err != nil {
+		t.Fatalf("Failed to decode job: %v", err)
+	}
+	if job["lineEnding"] != "CRLF" || job["columnDelimiter"] != "PIPE" {
+		t.Errorf("Expected lineEnding=CRLF and columnDelimiter=PIPE, got %v and %v", job["lineEnding"], job["columnDelimiter"])
+	}
+
+	time.Sleep(500 * time.Millisecond)
+
+	jobID := job["id"].(string)
+	_, body = doRequest(t, client, http.MethodGet, "/services/data/v58.0/jobs/query/"+jobID, nil, nil)
+	if err := json.Unmarshal(body, &job); err != nil || job["lineEnding"] != "CRLF" || job["columnDelimiter"] != "PIPE" {
+		t.Errorf("Expected job info to keep the format options, got %s", body)
+	}
+
+	_, results := doRequest(t, client, http.MethodGet, "/services/data/v58.0/jobs/query/"+jobID+"/results", nil, nil)
+	lines := strings.Split(strings.TrimSuffix(string(results), "\r\n"), "\r\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "|") {
+		t.Errorf("Expected 3 pipe-delimited CRLF rows, got %q", results)
+	}
+
+	resp, _ = doRequest(t, client, http.MethodPost, "/services/data/v58.0/jobs/query", map[string]interface{}{
+		"operation":       "query",
+		"query":           "SELECT Name FROM Account",
+		"columnDelimiter": "COLON",
+	}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown columnDelimiter, got %d", resp.StatusCode)
+	}
+}
+
+// TestBulkProcessingDelay tests jobs staying InProgress for the configured delay
+func TestBulkProcessingDelay(t *testing.T) {
+	emu := emulator.New(emulator.WithBulkProcessingDelay(400 * time.Millisecond))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	if _, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(2); err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	job, err := client.CreateJobQuery("SELECT Id, Name FROM Account")
+	if err != nil {
+		t.Fatalf("CreateJobQuery failed: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	status, err := client.GetJobQuery(job.ID)
+	if err != nil {
+		t.Fatalf("GetJobQuery failed: %v", err)
+	}
+	if status.State != "InProgress" {
+		t.Errorf("Expected state=InProgress during the delay, got %s", status.State)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for status.State != "JobComplete" && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		if status, err = client.GetJobQuery(job.ID); err != nil {
+			t.Fatalf("GetJobQuery failed: %v", err)
+		}
+	}
+	if status.State != "JobComplete" {
+		t.Errorf("Expected state=JobComplete after the delay, got %s", status.State)
+	}
+
+	// A job aborted while InProgress stays aborted
+	job, err = client.CreateJobQuery("SELECT Id FROM Account")
+	if err != nil {
+		t.Fatalf("CreateJobQuery failed: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if resp, body := doRequest(t, client, http.MethodPatch, "/services/data/v58.0/jobs/query/"+job.ID, map[string]interface{}{"state": "Aborted"}, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Abort failed: %d %s", resp.StatusCode, body)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if status, err = client.GetJobQuery(job.ID); err != nil || status.State != "Aborted" {
+		t.Errorf("Expected state=Aborted, got %v (%v)", status, err)
+	}
+}
+
+// TestBulkIngestInsert tests a CSV insert through an ingest job, from upload
+// to per-row results
+func TestBulkIngestInsert(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/jobs/ingest", map[string]interface{}{
+		"object":    "Account",
+		"operation": "insert",
+	}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var job map[string]interface{}
+	if err := json.Unmarshal(body, &job); err != nil {
+		t.Fatalf("Failed to decode job: %v", err)
+	}
+	if job["state"] != "Open" || job["jobType"] != "V2Ingest" {
+		t.Fatalf("Expected an Open V2Ingest job, got %s", body)
+	}
+	jobPath := "/services/data/v58.0/jobs/ingest/" + job["id"].(string)
+
+	csvData := "Name,NumberOfEmployees,AnnualRevenue\n"
+	for i := 0; i < 50; i++ {
+		csvData += fmt.Sprintf("Ingest %d,%d,\n", i, i)
+	}
+	csvData += "Too big,7,100000000000000000\n" // Out of AnnualRevenue's range
+
+	req, _ := http.NewRequest(http.MethodPut, baseURL+jobPath+"/batches", strings.NewReader(csvData))
+	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Content-Type", "text/csv")
+	uploadResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	_ = uploadResp.Body.Close()
+	if uploadResp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 for the upload, got %d", uploadResp.StatusCode)
+	}
+
+	resp, body = doRequest(t, client, http.MethodPatch, jobPath, map[string]interface{}{"state": "UploadComplete"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 closing the job, got %d: %s", resp.StatusCode, body)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job["state"] != "JobComplete" && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		_, body = doRequest(t, client, http.MethodGet, jobPath, nil, nil)
+		if err := json.Unmarshal(body, &job); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+	}
+	if job["state"] != "JobComplete" {
+		t.Fatalf("Expected JobComplete, got %s", body)
+	}
+	if job["numberRecordsProcessed"] != float64(51) || job["numberRecordsFailed"] != float64(1) {
+		t.Errorf("Expected 51 processed and 1 failed, got %v and %v", job["numberRecordsProcessed"], job["numberRecordsFailed"])
+	}
+
+	_, results := doRequest(t, client, http.MethodGet, jobPath+"/successfulResults", nil, nil)
+	lines := strings.Split(strings.TrimSpace(string(results)), "\n")
+	if len(lines) != 51 || lines[0] != "sf__Id,sf__Created,Name,NumberOfEmployees,AnnualRevenue" {
+		t.Errorf("Expected a header and 50 successful rows, got %d lines: %q", len(lines), lines[0])
+	}
+
+	_, failed := doRequest(t, client, http.MethodGet, jobPath+"/failedResults", nil, nil)
+	lines = strings.Split(strings.TrimSpace(string(failed)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "FIELD_INTEGRITY_EXCEPTION") {
+		t.Errorf("Expected one failed row, got %q", failed)
+	}
+
+	_, unprocessed := doRequest(t, client, http.MethodGet, jobPath+"/unprocessedrecords", nil, nil)
+	if strings.TrimSpace(string(unprocessed)) != "Name,NumberOfEmployees,AnnualRevenue" {
+		t.Errorf("Expected no unprocessed records, got %q", unprocessed)
+	}
+
+	result, err := client.Query("SELECT Id FROM Account WHERE NumberOfEmployees >= 10")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 40 {
+		t.Errorf("Expected 40 inserted accounts with 10 or more employees, got %d", result.TotalSize)
+	}
+}
+
+// TestBulkIngestResults tests splitting an update job's rows into
+// successfulResults and failedResults
+func TestBulkIngestResults(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	ids, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(2)
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	jobPath := runIngestJob(t, client, map[string]interface{}{"object": "Account", "operation": "update"},
+		"Id,Name\n"+ids[0]+",Renamed 0\n001000000000000AAA,Missing\n,No Id\n"+ids[1]+",Renamed 1\n")
+
+	_, results := doRequest(t, client, http.MethodGet, jobPath+"/successfulResults/", nil, nil)
+	lines := strings.Split(strings.TrimSpace(string(results)), "\n")
+	if len(lines) != 3 || lines[1] != ids[0]+",false,"+ids[0]+",Renamed 0" {
+		t.Errorf("Expected 2 successful updates, got %q", results)
+	}
+
+	_, failed := doRequest(t, client, http.MethodGet, jobPath+"/failedResults/", nil, nil)
+	lines = strings.Split(strings.TrimSpace(string(failed)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 2 failed rows, got %q", failed)
+	}
+	if !strings.HasPrefix(lines[1], "001000000000000AAA,INVALID_CROSS_REFERENCE_KEY:") {
+		t.Errorf("Expected the unknown Id to fail, got %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], ",MISSING_ARGUMENT:") {
+		t.Errorf("Expected the row without an Id to fail, got %q", lines[2])
+	}
+
+	record, err := client.GetRecord("Account", ids[1])
+	if err != nil || record["Name"] != "Renamed 1" {
+		t.Errorf("Expected the account to be renamed, got %v (%v)", record, err)
+	}
+}
+
+// TestBulkIngestResultColumns tests the Data Loader columns of the result
+// CSVs: sf__Id for updates, sf__Error as STATUS_CODE:message:fields -- and
+// the uploaded values quoted as they were
+func TestBulkIngestResultColumns(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	ids, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(2)
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	jobPath := runIngestJob(t, client, map[string]interface{}{"object": "Account", "operation": "update"},
+		"Id,Name,AnnualRevenue\n"+ids[0]+",Renamed 0,\n"+ids[1]+",\"Too big, really\",100000000000000000\n")
+
+	_, results := doRequest(t, client, http.MethodGet, jobPath+"/successfulResults/", nil, nil)
+	expected := "sf__Id,sf__Created,Id,Name,AnnualRevenue\n" + ids[0] + ",false," + ids[0] + ",Renamed 0,\n"
+	if string(results) != expected {
+		t.Errorf("Expected successfulResults %q, got %q", expected, results)
+	}
+
+	_, failed := doRequest(t, client, http.MethodGet, jobPath+"/failedResults/", nil, nil)
+	expected = "sf__Id,sf__Error,Id,Name,AnnualRevenue\n" +
+		ids[1] + ",FIELD_INTEGRITY_EXCEPTION:AnnualRevenue: value outside of valid range on numeric field: 1e+17:AnnualRevenue --," +
+		ids[1] + ",\"Too big, really\",100000000000000000\n"
+	if string(failed) != expected {
+		t.Errorf("Expected failedResults %q, got %q", expected, failed)
+	}
+}
+
+// runIngestJob creates an ingest job, uploads data, closes the job and waits
+// for it to complete, returning the job's path
+func runIngestJob(t *testing.T, client *sfclient.Client, config map[string]interface{}, data string) string {
+	t.Helper()
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/jobs/ingest", config, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 creating the job, got %d: %s", resp.StatusCode, body)
+	}
+	var job map[string]interface{}
+	if err := json.Unmarshal(body, &job); err != nil {
+		t.Fatalf("Failed to decode job: %v", err)
+	}
+	jobPath := "/services/data/v58.0/jobs/ingest/" + job["id"].(string)
+
+	req, _ := http.NewRequest(http.MethodPut, client.InstanceURL+jobPath+"/batches", strings.NewReader(data))
+	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Content-Type", "text/csv")
+	uploadResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	_ = uploadResp.Body.Close()
+	if uploadResp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 for the upload, got %d", uploadResp.StatusCode)
+	}
+
+	doRequest(t, client, http.MethodPatch, jobPath, map[string]interface{}{"state": "UploadComplete"}, nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job["state"] != "JobComplete" && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		_, body = doRequest(t, client, http.MethodGet, jobPath, nil, nil)
+		if err := json.Unmarshal(body, &job); err != nil {
+			t.Fatalf("Failed to decode job: %v", err)
+		}
+	}
+	if job["state"] != "JobComplete" {
+		t.Fatalf("Expected JobComplete, got %s", body)
+	}
+	return jobPath
+}
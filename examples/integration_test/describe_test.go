@@ -0,0 +1,465 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// TestDescribeFieldDefaults tests describe reporting defaults that create applies
+func TestDescribeFieldDefaults(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Invoice__c",
+		Label:      "Invoice",
+		KeyPrefix:  "a01",
+		Custom:     true,
+		Createable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			{Name: "Status__c", Type: storage.FieldTypeString, Createable: true, DefaultValue: "Draft"},
+			{Name: "Issued__c", Type: storage.FieldTypeDate, Createable: true, DefaultValueFormula: "TODAY()"},
+			{Name: "Total__c", Type: storage.FieldTypeCurrency, Calculated: true, CalculatedFormula: "Amount__c * 1.1"},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	result, err := client.DescribeSObject("Invoice__c")
+	if err != nil {
+		t.Fatalf("DescribeSObject failed: %v", err)
+	}
+
+	fields := map[string]map[string]interface{}{}
+	for _, f := range result["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		fields[field["name"].(string)] = field
+	}
+
+	if fields["Status__c"]["defaultValue"] != "Draft" || fields["Status__c"]["defaultedOnCreate"] != true {
+		t.Errorf("Expected Status__c default 'Draft' defaulted on create, got %v", fields["Status__c"])
+	}
+	if fields["Issued__c"]["defaultValueFormula"] != "TODAY()" || fields["Issued__c"]["defaultedOnCreate"] != true {
+		t.Errorf("Expected Issued__c formula default, got %v", fields["Issued__c"])
+	}
+	if fields["Total__c"]["calculated"] != true || fields["Total__c"]["calculatedFormula"] != "Amount__c * 1.1" {
+		t.Errorf("Expected Total__c to be calculated, got %v", fields["Total__c"])
+	}
+	if v, ok := fields["Name"]["defaultValue"]; !ok || v != nil {
+		t.Errorf("Expected Name defaultValue to be null, got %v", fields["Name"])
+	}
+	if v, ok := fields["Name"]["defaultValueFormula"]; !ok || v != nil {
+		t.Errorf("Expected Name defaultValueFormula to be null, got %v", fields["Name"])
+	}
+
+	created, err := client.CreateRecord("Invoice__c", map[string]interface{}{"Name": "INV-1"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	record, err := client.GetRecord("Invoice__c", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if record["Status__c"] != "Draft" {
+		t.Errorf("Expected Status__c='Draft', got %v", record["Status__c"])
+	}
+	if record["Issued__c"] != time.Now().UTC().Format("2006-01-02") {
+		t.Errorf("Expected Issued__c to be today, got %v", record["Issued__c"])
+	}
+}
+
+// TestDescribeErrors tests the status and error shape for unknown objects and fields
+func TestDescribeErrors(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		status  int
+		code    string
+		message string
+	}{
+		{"describe unknown object", "/services/data/v58.0/sobjects/Foo__c/describe", http.StatusNotFound, "NOT_FOUND", "The requested resource does not exist"},
+		{"basic info unknown object", "/services/data/v58.0/sobjects/Foo__c", http.StatusNotFound, "NOT_FOUND", "The requested resource does not exist"},
+		{"unknown field", "/services/data/v58.0/sobjects/Account/" + created.ID + "?fields=Name,Bogus__c", http.StatusBadRequest, "INVALID_FIELD", "No such column 'Bogus__c' on sobject of type Account"},
+		{"describe known object", "/services/data/v58.0/sobjects/Account/describe", http.StatusOK, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, client, http.MethodGet, tt.path, nil, nil)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("Expected status %d, got %d: %s", tt.status, resp.StatusCode, body)
+			}
+			if tt.code == "" {
+				return
+			}
+
+			var errs []map[string]interface{}
+			if err := json.Unmarshal(body, &errs); err != nil || len(errs) != 1 {
+				t.Fatalf("Expected a single error, got %s", body)
+			}
+			if errs[0]["errorCode"] != tt.code || errs[0]["message"] != tt.message {
+				t.Errorf("Expected %s %q, got %v", tt.code, tt.message, errs[0])
+			}
+		})
+	}
+}
+
+// TestDescribeCompoundFieldName tests address components naming their compound field
+func TestDescribeCompoundFieldName(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	result, err := client.DescribeSObject("Account")
+	if err != nil {
+		t.Fatalf("DescribeSObject failed: %v", err)
+	}
+
+	fields := map[string]map[string]interface{}{}
+	for _, f := range result["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		fields[field["name"].(string)] = field
+	}
+
+	for _, name := range []string{"BillingStreet", "BillingCity", "BillingState", "BillingPostalCode", "BillingCountry"} {
+		if fields[name]["compoundFieldName"] != "BillingAddress" {
+			t.Errorf("Expected %s compoundFieldName=BillingAddress, got %v", name, fields[name]["compoundFieldName"])
+		}
+	}
+	if fields["ShippingCity"]["compoundFieldName"] != "ShippingAddress" {
+		t.Errorf("Expected ShippingCity compoundFieldName=ShippingAddress, got %v", fields["ShippingCity"]["compoundFieldName"])
+	}
+	if fields["BillingAddress"]["type"] != "address" {
+		t.Errorf("Expected BillingAddress of type address, got %v", fields["BillingAddress"])
+	}
+	if v, ok := fields["Name"]["compoundFieldName"]; !ok || v != nil {
+		t.Errorf("Expected Name compoundFieldName to be null, got %v", fields["Name"])
+	}
+}
+
+// TestDescribeApprovalLayouts tests approval layouts derived from registered approval processes
+func TestDescribeApprovalLayouts(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	// No approval process yet: an empty but valid response
+	resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/sobjects/Opportunity/describe/approvalLayouts", nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		ApprovalLayouts []struct {
+			ID          string `json:"id"`
+			Name        string `json:"name"`
+			Label       string `json:"label"`
+			LayoutItems []struct {
+				Label            string `json:"label"`
+				LayoutComponents []struct {
+					Type  string `json:"type"`
+					Value string `json:"value"`
+				} `json:"layoutComponents"`
+			} `json:"layoutItems"`
+		} `json:"approvalLayouts"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || result.ApprovalLayouts == nil || len(result.ApprovalLayouts) != 0 {
+		t.Fatalf("Expected an empty approvalLayouts list, got %s", body)
+	}
+
+	err := emu.Store().RegisterApprovalProcess("Opportunity", storage.ApprovalProcess{
+		Name:   "Discount_Approval",
+		Label:  "Discount Approval",
+		Fields: []string{"Name", "Amount"},
+	})
+	if err != nil {
+		t.Fatalf("RegisterApprovalProcess failed: %v", err)
+	}
+
+	_, body = doRequest(t, client, http.MethodGet, "/services/data/v58.0/sobjects/Opportunity/describe/approvalLayouts/Discount_Approval", nil, nil)
+	if err := json.Unmarshal(body, &result); err != nil || len(result.ApprovalLayouts) != 1 {
+		t.Fatalf("Expected one approval layout, got %s", body)
+	}
+	layout := result.ApprovalLayouts[0]
+	if layout.Name != "Discount_Approval" || layout.Label != "Discount Approval" || layout.ID == "" {
+		t.Errorf("Unexpected approval layout: %+v", layout)
+	}
+	if len(layout.LayoutItems) != 2 || layout.LayoutItems[1].LayoutComponents[0].Value != "Amount" {
+		t.Errorf("Expected Name and Amount layout items, got %+v", layout.LayoutItems)
+	}
+
+	resp, _ = doRequest(t, client, http.MethodGet, "/services/data/v58.0/sobjects/Opportunity/describe/approvalLayouts/Missing", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown approval process, got %d", resp.StatusCode)
+	}
+}
+
+// TestPicklistDependency tests describing and enforcing a dependent picklist
+func TestPicklistDependency(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	err := emu.Store().RegisterPicklistDependency("Account", storage.PicklistDependency{
+		ControllingField: "Industry",
+		DependentField:   "Type",
+		ValidFor: map[string][]string{
+			"Banking":    {"Customer - Direct", "Other"},
+			"Technology": {"Technology Partner", "Other"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("RegisterPicklistDependency failed: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	describe, err := client.DescribeSObject("Account")
+	if err != nil {
+		t.Fatalf("DescribeSObject failed: %v", err)
+	}
+	for _, f := range describe["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		switch field["name"] {
+		case "Type":
+			if field["dependentPicklist"] != true || field["controllerName"] != "Industry" {
+				t.Errorf("Expected Type to depend on Industry, got %v/%v", field["dependentPicklist"], field["controllerName"])
+			}
+			for _, v := range field["picklistValues"].([]interface{}) {
+				value := v.(map[string]interface{})
+				// Banking and Technology are the 2nd and 7th Industry values
+				if value["value"] == "Other" && value["validFor"] != "Qg==" {
+					t.Errorf("Expected validFor Qg== for Other, got %v", value["validFor"])
+				}
+			}
+		case "Industry":
+			if field["dependentPicklist"] != false || field["controllerName"] != nil {
+				t.Errorf("Expected Industry not to be dependent, got %v/%v", field["dependentPicklist"], field["controllerName"])
+			}
+		}
+	}
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Bank", "Industry": "Banking", "Type": "Customer - Direct"})
+	if err != nil {
+		t.Fatalf("CreateRecord with an allowed value failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		record map[string]interface{}
+	}{
+		{"not allowed", map[string]interface{}{"Name": "Bank", "Industry": "Banking", "Type": "Technology Partner"}},
+		{"no controlling value", map[string]interface{}{"Name": "Bank", "Type": "Other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.CreateRecord("Account", tt.record)
+			if err == nil || !strings.Contains(err.Error(), "FIELD_INTEGRITY_EXCEPTION") {
+				t.Errorf("Expected FIELD_INTEGRITY_EXCEPTION, got %v", err)
+			}
+		})
+	}
+
+	// Changing the controlling field alone is checked against the stored value
+	if err := client.UpdateRecord("Account", created.ID, map[string]interface{}{"Industry": "Technology"}); err == nil {
+		t.Error("Expected changing Industry to invalidate Type")
+	}
+	if err := client.UpdateRecord("Account", created.ID, map[string]interface{}{"Industry": "Technology", "Type": "Technology Partner"}); err != nil {
+		t.Errorf("UpdateRecord with an allowed value failed: %v", err)
+	}
+}
+
+// TestDescribeChildRelationships tests child relationship names derived from lookups
+func TestDescribeChildRelationships(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:        "Invoice__c",
+		Label:       "Invoice",
+		LabelPlural: "Invoices",
+		KeyPrefix:   "a01",
+		Custom:      true,
+		Createable:  true,
+		Queryable:   true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			{Name: "Account__c", Type: storage.FieldTypeReference, Createable: true, ReferenceTo: []string{"Account"}, RelationshipName: "Account__r"},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	relationships := func(objectType string) map[string]string {
+		result, err := client.DescribeSObject(objectType)
+		if err != nil {
+			t.Fatalf("DescribeSObject failed: %v", err)
+		}
+		names := map[string]string{}
+		for _, r := range result["childRelationships"].([]interface{}) {
+			rel := r.(map[string]interface{})
+			names[rel["childSObject"].(string)+"."+rel["field"].(string)] = rel["relationshipName"].(string)
+		}
+		return names
+	}
+
+	account := relationships("Account")
+	for key, want := range map[string]string{
+		"Contact.AccountId":     "Contacts",
+		"Account.ParentId":      "ChildAccounts",
+		"Task.WhatId":           "Tasks",
+		"Invoice__c.Account__c": "Invoices__r",
+	} {
+		if account[key] != want {
+			t.Errorf("Expected Account child relationship %s=%s, got %q", key, want, account[key])
+		}
+	}
+	if _, ok := account["Account.OwnerId"]; ok {
+		t.Error("Expected no child relationship for OwnerId")
+	}
+
+	contact := relationships("Contact")
+	if contact["Case.ContactId"] != "Cases" || contact["Task.WhoId"] != "Tasks" {
+		t.Errorf("Expected Contact Cases and Tasks relationships, got %v", contact)
+	}
+
+	// Subqueries resolve derived relationship names case-insensitively
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if _, err := client.CreateRecord("Invoice__c", map[string]interface{}{"Name": "INV-1", "Account__c": created.ID}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	result, err := client.Query("SELECT Name, (SELECT Name FROM invoices__r) FROM Account")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	invoices, ok := result.Records[0]["Invoices__r"].(map[string]interface{})
+	if !ok || invoices["totalSize"] != float64(1) {
+		t.Errorf("Expected 1 invoice under Invoices__r, got %v", result.Records[0])
+	}
+}
+
+// TestDescribeEmptyStructures tests describe always carrying its layout and scope keys
+func TestDescribeEmptyStructures(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/sobjects/Account/describe", nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	var describe map[string]json.RawMessage
+	if err := json.Unmarshal(body, &describe); err != nil {
+		t.Fatalf("Failed to decode describe: %v", err)
+	}
+
+	expected := map[string]string{
+		"namedLayoutInfos":      "[]",
+		"actionOverrides":       "[]",
+		"networkScopeFieldName": "null",
+		"supportedScopes":       "[]",
+	}
+	for key, value := range expected {
+		if got, ok := describe[key]; !ok || string(got) != value {
+			t.Errorf("Expected %s to be %s, got %s", key, value, got)
+		}
+	}
+}
+
+// TestCustomObjectKeyPrefixes tests unique and explicit key prefixes resolving IDs back to their object
+func TestCustomObjectKeyPrefixes(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	store := emu.Store()
+	for _, name := range []string{"Widget__c", "Wheel__c"} {
+		err := store.RegisterSObject(storage.SObjectDefinition{
+			Name:       name,
+			Label:      name,
+			Custom:     true,
+			Createable: true,
+			Queryable:  true,
+			Fields: []storage.FieldDefinition{
+				{Name: "Id", Type: storage.FieldTypeID},
+				{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			},
+		})
+		if err != nil {
+			t.Fatalf("RegisterSObject %s failed: %v", name, err)
+		}
+	}
+	if err := store.RegisterSObject(storage.SObjectDefinition{Name: "Gadget__c", KeyPrefix: "001", Custom: true}); err == nil {
+		t.Error("Expected registering a prefix owned by Account to fail")
+	}
+	account, _ := store.DescribeSObject("Account")
+	account.SObjectDefinition.KeyPrefix = "0X1"
+	if err := store.RegisterSObject(account.SObjectDefinition); err != nil {
+		t.Fatalf("Overriding the Account prefix failed: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	widget, _ := client.DescribeSObject("Widget__c")
+	wheel, _ := client.DescribeSObject("Wheel__c")
+	wheelPrefix, _ := wheel["keyPrefix"].(string)
+	if widget["keyPrefix"] != "a0W" || wheelPrefix == "" || wheelPrefix == widget["keyPrefix"] {
+		t.Fatalf("Expected distinct prefixes, got %v and %v", widget["keyPrefix"], wheel["keyPrefix"])
+	}
+
+	ids := map[string]string{}
+	for _, name := range []string{"Widget__c", "Wheel__c", "Account"} {
+		created, err := client.CreateRecord(name, map[string]interface{}{"Name": "One"})
+		if err != nil {
+			t.Fatalf("CreateRecord %s failed: %v", name, err)
+		}
+		ids[name] = created.ID
+	}
+	if ids["Account"][:3] != "0X1" || ids["Wheel__c"][:3] != wheelPrefix {
+		t.Errorf("Unexpected IDs: %v", ids)
+	}
+
+	// Composite delete finds each object type from the ID prefix alone
+	path := "/services/data/v58.0/composite/sobjects?ids=" + ids["Widget__c"] + "," + ids["Wheel__c"] + "," + ids["Account"]
+	if resp, body := doRequest(t, client, http.MethodDelete, path, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Composite delete failed: %d %s", resp.StatusCode, body)
+	}
+	for name, id := range ids {
+		if _, err := store.GetRecord(name, id); err == nil {
+			t.Errorf("Expected %s %s to be deleted", name, id)
+		}
+	}
+}
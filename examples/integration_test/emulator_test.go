@@ -0,0 +1,618 @@
+package integration_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage/sqlite"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/testutil"
+)
+
+// TestLastErrors tests capturing error responses for assertions
+func TestLastErrors(t *testing.T) {
+	emu := emulator.New(emulator.WithErrorCapture(2))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	if _, err := client.GetRecord("Account", "001000000000000AAA"); err == nil {
+		t.Fatal("Expected error when getting a missing record")
+	}
+
+	errs := emu.LastErrors()
+	if len(errs) != 1 {
+		t.Fatalf("Expected 1 captured error, got %d", len(errs))
+	}
+	if errs[0].Status != 404 || errs[0].ErrorCode != "NOT_FOUND" {
+		t.Errorf("Expected 404 NOT_FOUND, got %d %s", errs[0].Status, errs[0].ErrorCode)
+	}
+
+	// Only the last two errors are retained
+	for i := 0; i < 3; i++ {
+		_, _ = client.Query("SELECT Id FROM Nope")
+	}
+	errs = emu.LastErrors()
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 captured errors, got %d", len(errs))
+	}
+	if errs[1].ErrorCode != "MALFORMED_QUERY" {
+		t.Errorf("Expected MALFORMED_QUERY, got %s", errs[1].ErrorCode)
+	}
+
+	emu.ResetErrors()
+	if len(emu.LastErrors()) != 0 {
+		t.Error("Expected no captured errors after ResetErrors")
+	}
+}
+
+// TestResponseHeaders tests adding configured headers to every response
+func TestResponseHeaders(t *testing.T) {
+	emu := emulator.New(
+		emulator.WithResponseHeader("Sforce-Limit-Info", "api-usage=1/15000"),
+		emulator.WithResponseHeader("X-Trace-Id", "trace-123"),
+	)
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	for _, path := range []string{"/services/data/v58.0/sobjects", "/services/data/v58.0/sobjects/Account/001000000000000AAA"} {
+		resp, _ := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if got := resp.Header.Get("Sforce-Limit-Info"); got != "api-usage=1/15000" {
+			t.Errorf("%s: expected Sforce-Limit-Info header, got %q", path, got)
+		}
+		if got := resp.Header.Get("X-Trace-Id"); got != "trace-123" {
+			t.Errorf("%s: expected X-Trace-Id header, got %q", path, got)
+		}
+	}
+}
+
+// TestSforceLimitInfo tests reporting API usage on every API response
+func TestSforceLimitInfo(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	paths := []string{
+		"/services/data/v58.0/sobjects",
+		"/services/data/v58.0/sobjects/Account/001000000000000AAA",
+		"/services/data/v58.0/jobs/query",
+	}
+	for i, path := range paths {
+		resp, _ := doRequest(t, client, http.MethodGet, path, nil, nil)
+		want := fmt.Sprintf("api-usage=%d/%d", i+1, storage.DefaultDailyAPIRequestLimit)
+		if got := resp.Header.Get("Sforce-Limit-Info"); got != want {
+			t.Errorf("%s: expected Sforce-Limit-Info %q, got %q", path, want, got)
+		}
+	}
+
+	limits, err := client.GetLimits()
+	if err != nil {
+		t.Fatalf("GetLimits failed: %v", err)
+	}
+	daily, _ := limits["DailyApiRequests"].(map[string]interface{})
+	if want := float64(storage.DefaultDailyAPIRequestLimit - 4); daily["Remaining"] != want {
+		t.Errorf("Expected %v requests remaining, got %v", want, daily)
+	}
+}
+
+// TestCallOptionsClient tests logging and per-client errors keyed by the
+// client named in Sforce-Call-Options
+func TestCallOptionsClient(t *testing.T) {
+	var buf bytes.Buffer
+	emu := emulator.New(emulator.WithRequestLogger(log.New(&buf, "", 0)), emulator.WithErrorCapture(5))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	emu.SetClientError("Billing/2.0", http.StatusServiceUnavailable, sferrors.SalesforceError{
+		Message:   "Server unavailable",
+		ErrorCode: "SERVER_UNAVAILABLE",
+	})
+
+	path := "/services/data/v58.0/sobjects"
+	billing := map[string]string{"Sforce-Call-Options": "client=Billing/2.0, defaultNamespace=acme"}
+	resp, body := doRequest(t, client, http.MethodGet, path, nil, billing)
+	if resp.StatusCode != http.StatusServiceUnavailable || !bytes.Contains(body, []byte("SERVER_UNAVAILABLE")) {
+		t.Errorf("Expected the injected error for Billing, got %d %s", resp.StatusCode, body)
+	}
+	if errs := emu.LastErrors(); len(errs) != 1 || errs[0].ErrorCode != "SERVER_UNAVAILABLE" {
+		t.Errorf("Expected the injected error to be captured, got %v", errs)
+	}
+
+	for _, headers := range []map[string]string{nil, {"Sforce-Call-Options": "client=Sales"}} {
+		if resp, body := doRequest(t, client, http.MethodGet, path, nil, headers); resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected other clients to succeed, got %d %s", resp.StatusCode, body)
+		}
+	}
+
+	if logged := buf.String(); !strings.Contains(logged, `GET /services/data/v58.0/sobjects client="Billing/2.0"`) ||
+		!strings.Contains(logged, `client="Sales"`) {
+		t.Errorf("Expected requests logged with their client, got %q", logged)
+	}
+
+	emu.ClearClientErrors()
+	if resp, _ := doRequest(t, client, http.MethodGet, path, nil, billing); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected Billing to succeed after ClearClientErrors, got %d", resp.StatusCode)
+	}
+}
+
+// TestFailNextRequests tests failing a number of API requests on demand
+func TestFailNextRequests(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	path := "/services/data/v58.0/sobjects"
+
+	emu.FailNextRequests(2, sferrors.ErrorCodeRequestLimitExceeded)
+	emu.FailNextRequests(1, sferrors.ErrorCodeInvalidSessionID)
+	for i, want := range []struct {
+		status int
+		code   string
+	}{
+		{http.StatusForbidden, "REQUEST_LIMIT_EXCEEDED"},
+		{http.StatusForbidden, "REQUEST_LIMIT_EXCEEDED"},
+		{http.StatusUnauthorized, "INVALID_SESSION_ID"},
+	} {
+		resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if resp.StatusCode != want.status || !bytes.Contains(body, []byte(want.code)) {
+			t.Errorf("Request %d: expected %d %s, got %d %s", i, want.status, want.code, resp.StatusCode, body)
+		}
+	}
+
+	if resp, body := doRequest(t, client, http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected requests to succeed once the failures are used up, got %d %s", resp.StatusCode, body)
+	}
+}
+
+// TestOperationLog tests recording writes for assertions through Go and SOQL
+func TestOperationLog(t *testing.T) {
+	emu := emulator.New(emulator.WithOperationLogObject())
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Logged"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if _, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": "Logged"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if err := client.UpdateRecord("Account", account.ID, map[string]interface{}{"Name": "Renamed"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	if err := client.DeleteRecord("Account", account.ID); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+
+	ops := emu.OperationLog()
+	var kinds []string
+	for _, op := range ops {
+		kinds = append(kinds, op.Type+" "+op.ObjectType)
+	}
+	if strings.Join(kinds, ", ") != "create Account, create Contact, update Account, delete Account" {
+		t.Fatalf("Unexpected operation log: %v", kinds)
+	}
+	if ops[0].RecordID != account.ID || ops[0].UserID == "" || ops[0].Timestamp.IsZero() {
+		t.Errorf("Expected the create to record the Account ID, user and time, got %+v", ops[0])
+	}
+
+	result, err := client.Query("SELECT Id, RecordId FROM OperationLog WHERE Operation = 'create' AND SObjectType = 'Account'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0]["RecordId"] != account.ID {
+		t.Errorf("Expected exactly one Account create, got %v", result.Records)
+	}
+
+	emu.ResetOperationLog()
+	if ops := emu.OperationLog(); len(ops) != 0 {
+		t.Errorf("Expected an empty log after reset, got %d operations", len(ops))
+	}
+}
+
+// TestOperationLogLimit tests that the operation log keeps only the most recent operations
+func TestOperationLogLimit(t *testing.T) {
+	emu := emulator.New(emulator.WithOperationLogLimit(2))
+	emu.Start()
+	defer emu.Stop()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, _ := emu.Store().CreateRecord("Account", map[string]interface{}{"Name": "Bounded"})
+		ids = append(ids, id)
+	}
+
+	ops := emu.OperationLog()
+	if len(ops) != 2 || ops[0].RecordID != ids[1] || ops[1].RecordID != ids[2] {
+		t.Errorf("Expected the last 2 creates, got %+v", ops)
+	}
+}
+
+// TestSaveAndLoad tests snapshotting the store to a file and restoring it
+func TestSaveAndLoad(t *testing.T) {
+	emu := emulator.New()
+	emu.Start()
+	defer emu.Stop()
+
+	store := emu.Store()
+	if err := store.RegisterSObject(storage.SObjectDefinition{
+		Name:       "Invoice__c",
+		Label:      "Invoice",
+		Custom:     true,
+		Createable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			{Name: "Account__c", Type: storage.FieldTypeReference, Createable: true, ReferenceTo: []string{"Account"},
+				RelationshipName: "Account__r", ChildRelationshipName: "Invoices__r"},
+		},
+	}); err != nil {
+		t.Fatalf("RegisterSObject failed: %v", err)
+	}
+	accountID, err := store.CreateRecord("Account", storage.Record{"Name": "Saved Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if _, err := store.CreateRecord("Invoice__c", storage.Record{"Name": "INV-1", "Account__c": accountID}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	path := t.TempDir() + "/state.json"
+	if err := emu.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	emu.Reset()
+	if result, err := emu.Query("SELECT Id FROM Account"); err != nil || result.TotalSize != 0 {
+		t.Fatalf("Expected no accounts after reset, got %v (%v)", result, err)
+	}
+
+	// Load into the reset emulator and into a fresh one without the schema
+	fresh := emulator.New()
+	for _, target := range []*emulator.Emulator{emu, fresh} {
+		if err := target.Load(path); err != nil {
+			t.Fatalf("Load failed: %v", err)
+		}
+		result, err := target.Query("SELECT Name, (SELECT Name FROM Invoices__r) FROM Account WHERE Id = '" + accountID + "'")
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		records := result.Records
+		if len(records) != 1 || records[0]["Name"] != "Saved Co" {
+			t.Fatalf("Expected the saved account, got %v", records)
+		}
+		invoices, _ := records[0]["Invoices__r"].(*soql.SubqueryResult)
+		if invoices == nil || invoices.TotalSize != 1 {
+			t.Errorf("Expected the saved invoice in the subquery, got %v", records[0]["Invoices__r"])
+		}
+
+		id, err := target.Store().CreateRecord("Account", storage.Record{"Name": "New Co"})
+		if err != nil || id == accountID {
+			t.Errorf("Expected a new, distinct account ID, got %q (%v)", id, err)
+		}
+	}
+}
+
+// TestSnapshotRoundTrip tests that restoring a snapshot keeps value types and
+// the settings and recycle bin state stored alongside the records
+func TestSnapshotRoundTrip(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.EnableFieldHistory("Account", "Industry"); err != nil {
+		t.Fatalf("EnableFieldHistory failed: %v", err)
+	}
+	store.EnableChangeDataCapture("Account")
+	if err := store.RegisterApprovalProcess("Account", storage.ApprovalProcess{Name: "Discount", Label: "Discount", Fields: []string{"Name"}}); err != nil {
+		t.Fatalf("RegisterApprovalProcess failed: %v", err)
+	}
+
+	accountID, err := store.CreateRecord("Account", storage.Record{"Name": "Snapshot Co", "NumberOfEmployees": 42, "AnnualRevenue": 1.5})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	contactID, err := store.CreateRecord("Contact", storage.Record{"LastName": "Cascaded", "AccountId": accountID})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	deletedID, err := store.CreateRecord("Account", storage.Record{"Name": "Deleted Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	beforeDelete, _ := store.GetRecord("Account", deletedID)
+	cascadedID, err := store.CreateRecord("Contact", storage.Record{"LastName": "Deleted With Account", "AccountId": deletedID})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	cascaded, _ := store.GetRecord("Contact", cascadedID)
+	if err := store.DeleteRecordAs("005000000000002AAA", "Account", deletedID); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+
+	data, err := store.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	restored := storage.NewMemoryStore()
+	if err := restored.Restore(data); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	account, err := restored.GetRecord("Account", accountID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if n, ok := account["NumberOfEmployees"].(int); !ok || n != 42 {
+		t.Errorf("Expected NumberOfEmployees to stay the int 42, got %T %v", account["NumberOfEmployees"], account["NumberOfEmployees"])
+	}
+	if n, ok := account["AnnualRevenue"].(float64); !ok || n != 1.5 {
+		t.Errorf("Expected AnnualRevenue to stay the float64 1.5, got %T %v", account["AnnualRevenue"], account["AnnualRevenue"])
+	}
+
+	if layouts, err := restored.ApprovalLayouts("Account", "Discount"); err != nil || len(layouts) != 1 {
+		t.Errorf("Expected the approval process to be restored, got %v (%v)", layouts, err)
+	}
+
+	if err := restored.UpdateRecord("Account", accountID, storage.Record{"Industry": "Energy"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	history, _ := restored.GetAllRecords("AccountHistory")
+	if len(history) != 1 || history[0]["NewValue"] != "Energy" {
+		t.Errorf("Expected field history tracking to be restored, got %v", history)
+	}
+	events := restored.ChangeEvents()
+	if len(events) != 1 {
+		t.Errorf("Expected Change Data Capture to be restored, got %d events", len(events))
+	}
+
+	// Rolling back the restored deletion brings back the contact it cascaded to
+	if err := restored.RestoreRecord("Account", deletedID, beforeDelete); err != nil {
+		t.Fatalf("RestoreRecord failed: %v", err)
+	}
+	contact, err := restored.GetRecord("Contact", cascadedID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if contact["IsDeleted"] != false || contact["LastModifiedById"] != cascaded["LastModifiedById"] {
+		t.Errorf("Expected the contact as it was before the deletion, got %v", contact)
+	}
+	if _, err := restored.GetRecord("Contact", contactID); err != nil {
+		t.Errorf("GetRecord failed: %v", err)
+	}
+}
+
+// TestSQLiteStore tests that a SQLite-backed emulator keeps its records
+// after the store is closed and reopened
+func TestSQLiteStore(t *testing.T) {
+	path := t.TempDir() + "/emulator.db"
+
+	store, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	emu := emulator.New(emulator.WithStore(store))
+	baseURL := emu.Start()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Persistent Co", "NumberOfEmployees": 42})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if err := store.AddField("Account", storage.FieldDefinition{
+		Name: "Tier__c", Label: "Tier", Type: storage.FieldTypeString, Length: 20,
+		Nillable: true, Createable: true, Updateable: true,
+	}); err != nil {
+		t.Fatalf("AddField failed: %v", err)
+	}
+	if err := store.UpdateRecord("Account", created.ID, storage.Record{"Tier__c": "Gold"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	if _, err := store.CreateRecord("Contact", storage.Record{"LastName": "Removed"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if err := store.Truncate("Contact"); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	job, err := client.CreateJobQuery("SELECT Id FROM Account")
+	if err != nil {
+		t.Fatalf("CreateJobQuery failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	emu.Stop()
+	if _, err := testutil.NewFixtures(store).LoadSampleApexClasses(1); err != nil {
+		t.Fatalf("LoadSampleApexClasses failed: %v", err)
+	}
+
+	// Each write is saved as it happens, so a second connection sees it
+	// before the first store is closed
+	reopened, err := sqlite.Open(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer reopened.Close()
+	if got, want := reopened.GetLimits().DailyApiRequests, store.GetLimits().DailyApiRequests; got != want || got.Remaining == got.Max {
+		t.Errorf("Expected the API request count to be saved, got %+v, want %+v", got, want)
+	}
+	if saved, err := reopened.GetBulkJob(job.ID); err != nil || saved.State != storage.JobStateJobComplete {
+		t.Errorf("Expected the completed bulk job to be saved, got %+v (%v)", saved, err)
+	}
+	if results, _, err := reopened.GetBulkJobResults(job.ID, "", 10); err != nil || len(results.Records) != 1 {
+		t.Errorf("Expected the bulk job's results to be saved, got %+v (%v)", results, err)
+	}
+	if classes, err := reopened.Tooling().GetAllRecords("ApexClass"); err != nil || len(classes) != 1 {
+		t.Errorf("Expected the Tooling API record to be saved, got %d (%v)", len(classes), err)
+	}
+	if contacts, err := reopened.GetAllRecords("Contact"); err != nil || len(contacts) != 0 {
+		t.Errorf("Expected the truncated contact to stay removed, got %d (%v)", len(contacts), err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	emu = emulator.New(emulator.WithStore(reopened))
+	baseURL = emu.Start()
+	defer emu.Stop()
+
+	client = createAuthenticatedClient(t, emu, baseURL)
+	result, err := client.Query("SELECT Id, Name, NumberOfEmployees, Tier__c FROM Account")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 {
+		t.Fatalf("Expected the saved account, got %d records", len(result.Records))
+	}
+	account := result.Records[0]
+	if account["Id"] != created.ID || account["Name"] != "Persistent Co" || account["Tier__c"] != "Gold" {
+		t.Errorf("Unexpected account after reopening: %v", account)
+	}
+	if account["NumberOfEmployees"] != float64(42) {
+		t.Errorf("Expected NumberOfEmployees=42, got %v", account["NumberOfEmployees"])
+	}
+}
+
+// TestTrackChanges tests that a MemoryStore tracking changes reports only
+// the records each write touched
+func TestTrackChanges(t *testing.T) {
+	store := storage.NewMemoryStore()
+	store.TrackChanges()
+	initial, err := store.TakeChanges()
+	if err != nil {
+		t.Fatalf("TakeChanges failed: %v", err)
+	}
+	if !initial.Replaced || len(initial.Records) == 0 {
+		t.Fatalf("Expected the first changes to hold every record, got %d (replaced=%v)", len(initial.Records), initial.Replaced)
+	}
+
+	changed := func() []string {
+		t.Helper()
+		changes, err := store.TakeChanges()
+		if err != nil {
+			t.Fatalf("TakeChanges failed: %v", err)
+		}
+		if changes.Replaced || len(changes.State) == 0 {
+			t.Errorf("Expected incremental changes with the store's state, got replaced=%v", changes.Replaced)
+		}
+		var ids []string
+		for _, change := range changes.Records {
+			if change.Data == nil {
+				ids = append(ids, "-"+change.ID)
+			} else {
+				ids = append(ids, change.ID)
+			}
+		}
+		return ids
+	}
+
+	accountID, err := store.CreateRecord("Account", storage.Record{"Name": "Tracked Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if ids := changed(); len(ids) != 1 || ids[0] != accountID {
+		t.Errorf("Expected only the new account, got %v", ids)
+	}
+	if ids := changed(); len(ids) != 0 {
+		t.Errorf("Expected no changes without writes, got %v", ids)
+	}
+
+	contactID, err := store.CreateRecord("Contact", storage.Record{"LastName": "Tracked", "AccountId": accountID})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	changed()
+	if err := store.DeleteRecord("Account", accountID); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+	if ids := changed(); len(ids) != 2 || ids[0] != accountID || ids[1] != contactID {
+		t.Errorf("Expected the account and its cascade-deleted contact, got %v", ids)
+	}
+
+	if err := store.Truncate("Contact"); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if ids := changed(); len(ids) != 1 || ids[0] != "-"+contactID {
+		t.Errorf("Expected the contact to be removed, got %v", ids)
+	}
+
+	store.Reset()
+	if changes, _ := store.TakeChanges(); !changes.Replaced {
+		t.Error("Expected Reset to replace every record")
+	}
+}
+
+// countingStore is a minimal fake store: it delegates to a MemoryStore it
+// hides from the emulator and counts the records created through it
+type countingStore struct {
+	storage.Store
+	creates int
+}
+
+func (s *countingStore) CreateRecordAs(userID, objectType string, record storage.Record) (string, error) {
+	s.creates++
+	return s.Store.CreateRecordAs(userID, objectType, record)
+}
+
+// TestWithStore tests serving the emulator from a store that is not a MemoryStore
+func TestWithStore(t *testing.T) {
+	store := &countingStore{Store: storage.NewMemoryStore()}
+	emu := emulator.New(emulator.WithStore(store))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	if emu.Store() != store {
+		t.Fatalf("Expected Store to return the supplied store, got %T", emu.Store())
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	if _, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Faked"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if store.creates != 1 {
+		t.Errorf("Expected the create to reach the supplied store, got %d creates", store.creates)
+	}
+
+	ids, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(2)
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("LoadSampleAccounts failed: %v", err)
+	}
+	result, err := client.Query("SELECT Id FROM Account")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 3 {
+		t.Errorf("Expected 3 accounts, got %d", result.TotalSize)
+	}
+
+	// Features that need a MemoryStore are disabled rather than failing
+	if ops := emu.OperationLog(); ops != nil {
+		t.Errorf("Expected no operation log, got %v", ops)
+	}
+	if err := emu.Save(t.TempDir() + "/state.json"); err == nil {
+		t.Error("Expected Save to fail for a store without snapshots")
+	}
+
+	// Options that configure a MemoryStore are a setup mistake without one
+	func() {
+		defer func() {
+			if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "WithRateLimit") {
+				t.Errorf("Expected New to panic naming WithRateLimit, got %v", r)
+			}
+		}()
+		emulator.New(emulator.WithStore(store), emulator.WithRateLimit(10))
+	}()
+}
@@ -1,12 +1,19 @@
 package integration_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	sfclient "github.com/MASA-JAPAN/go-salesforce-api-client"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/testutil"
 )
 
@@ -355,6 +362,52 @@ func TestGetLimits(t *testing.T) {
 	}
 }
 
+// TestRateLimit tests counting API requests against a daily limit
+func TestRateLimit(t *testing.T) {
+	emu := emulator.New(emulator.WithRateLimit(4))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	path := "/services/data/v58.0/sobjects"
+
+	// Unauthenticated requests are rejected without using the allowance
+	anonymous := &sfclient.Client{InstanceURL: baseURL}
+	if resp, _ := doRequest(t, anonymous, http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a session, got %d", resp.StatusCode)
+	}
+
+	for i := 1; i <= 2; i++ {
+		resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Request %d: expected 200, got %d %s", i, resp.StatusCode, body)
+		}
+		if got, want := resp.Header.Get("Sforce-Limit-Info"), fmt.Sprintf("api-usage=%d/4", i); got != want {
+			t.Errorf("Request %d: expected Sforce-Limit-Info %q, got %q", i, want, got)
+		}
+	}
+
+	limits, err := client.GetLimits()
+	if err != nil {
+		t.Fatalf("GetLimits failed: %v", err)
+	}
+	daily, _ := limits["DailyApiRequests"].(map[string]interface{})
+	if daily["Max"] != float64(4) || daily["Remaining"] != float64(1) {
+		t.Errorf("Expected 1 of 4 requests remaining, got %v", daily)
+	}
+
+	if resp, body := doRequest(t, client, http.MethodGet, path, nil, nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the last allowed request to succeed, got %d %s", resp.StatusCode, body)
+	}
+	resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "REQUEST_LIMIT_EXCEEDED") {
+		t.Errorf("Expected 403 REQUEST_LIMIT_EXCEEDED past the limit, got %d %s", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Sforce-Limit-Info"); got != "api-usage=4/4" {
+		t.Errorf("Expected Sforce-Limit-Info api-usage=4/4, got %q", got)
+	}
+}
+
 // TestGetRecordCounts tests the record count API
 func TestGetRecordCounts(t *testing.T) {
 	emu := emulator.New()
@@ -487,6 +540,598 @@ func TestCompositeDelete(t *testing.T) {
 	}
 }
 
+// TestCompositeSubrequestLimit tests rejecting composite requests with too many subrequests
+func TestCompositeSubrequestLimit(t *testing.T) {
+	composite := func(n int) map[string]interface{} {
+		subrequests := make([]map[string]interface{}, n)
+		for i := range subrequests {
+			subrequests[i] = map[string]interface{}{
+				"method":      "GET",
+				"url":         "/services/data/v58.0/limits",
+				"referenceId": fmt.Sprintf("ref%d", i),
+			}
+		}
+		return map[string]interface{}{"compositeRequest": subrequests}
+	}
+
+	tests := []struct {
+		name     string
+		options  []emulator.Option
+		count    int
+		expected int
+	}{
+		{"default limit", nil, 25, http.StatusOK},
+		{"over default limit", nil, 26, http.StatusBadRequest},
+		{"configured limit", []emulator.Option{emulator.WithCompositeLimit(2)}, 2, http.StatusOK},
+		{"over configured limit", []emulator.Option{emulator.WithCompositeLimit(2)}, 3, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := emulator.New(tt.options...)
+			baseURL := emu.Start()
+			defer emu.Stop()
+
+			client := createAuthenticatedClient(t, emu, baseURL)
+			resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite", composite(tt.count), nil)
+			if resp.StatusCode != tt.expected {
+				t.Fatalf("Expected %d, got %d: %s", tt.expected, resp.StatusCode, body)
+			}
+			if tt.expected == http.StatusBadRequest && !bytes.Contains(body, []byte("LIMIT_EXCEEDED")) {
+				t.Errorf("Expected LIMIT_EXCEEDED, got %s", body)
+			}
+		})
+	}
+}
+
+// TestCompositeTree tests creating record trees and validating their child relationships
+func TestCompositeTree(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tree := func(childKey, childType, childRef string) map[string]interface{} {
+		return map[string]interface{}{
+			"records": []map[string]interface{}{{
+				"attributes": map[string]interface{}{"type": "Account", "referenceId": "acc1"},
+				"Name":       "Tree Account",
+				childKey: map[string]interface{}{
+					"records": []map[string]interface{}{
+						{"attributes": map[string]interface{}{"type": childType, "referenceId": childRef}, "LastName": "One"},
+						{"attributes": map[string]interface{}{"type": childType, "referenceId": "con2"}, "LastName": "Two"},
+					},
+				},
+			}},
+		}
+	}
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/tree/Account", tree("Contacts", "Contact", "con1"), nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	var created struct {
+		HasErrors bool `json:"hasErrors"`
+		Results   []struct {
+			ReferenceID string `json:"referenceId"`
+			ID          string `json:"id"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	ids := map[string]string{}
+	for _, result := range created.Results {
+		ids[result.ReferenceID] = result.ID
+	}
+	if created.HasErrors || len(ids) != 3 || ids["acc1"] == "" || ids["con1"] == "" || ids["con2"] == "" {
+		t.Fatalf("Expected an id for every referenceId, got %s", body)
+	}
+	contact, err := client.GetRecord("Contact", ids["con1"])
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if contact["AccountId"] != ids["acc1"] {
+		t.Errorf("Expected AccountId=%s, got %v", ids["acc1"], contact["AccountId"])
+	}
+
+	tests := []struct {
+		name    string
+		request map[string]interface{}
+		message string
+	}{
+		{"invalid relationship", tree("Contactz", "Contact", "con1"), "Contactz"},
+		{"type mismatch", tree("Contacts", "Lead", "con1"), "INVALID_TYPE"},
+		{"duplicate referenceId", tree("Contacts", "Contact", "con2"), "Duplicate ReferenceId"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/tree/Account", tt.request, nil)
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %d: %s", resp.StatusCode, body)
+			}
+			if !bytes.Contains(body, []byte(`"hasErrors":true`)) || !bytes.Contains(body, []byte(tt.message)) {
+				t.Errorf("Expected an error mentioning %s, got %s", tt.message, body)
+			}
+		})
+	}
+
+	// A child failing validation rolls back the records created before it
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/tree/Account", map[string]interface{}{
+		"records": []map[string]interface{}{{
+			"attributes": map[string]interface{}{"type": "Account", "referenceId": "acc1"},
+			"Name":       "Rolled Back Tree",
+			"Contacts": map[string]interface{}{
+				"records": []map[string]interface{}{
+					{"attributes": map[string]interface{}{"type": "Contact", "referenceId": "con1"}, "LastName": "Created"},
+					{"attributes": map[string]interface{}{"type": "Contact", "referenceId": "con2"}, "FirstName": "No LastName"},
+				},
+			},
+		}},
+	}, nil)
+	if resp.StatusCode != http.StatusBadRequest || !bytes.Contains(body, []byte("REQUIRED_FIELD_MISSING")) {
+		t.Fatalf("Expected 400 with REQUIRED_FIELD_MISSING, got %d: %s", resp.StatusCode, body)
+	}
+	for _, query := range []string{
+		"SELECT Id FROM Account WHERE Name = 'Rolled Back Tree'",
+		"SELECT Id FROM Contact WHERE LastName = 'Created'",
+	} {
+		result, err := client.Query(query)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if result.TotalSize != 0 {
+			t.Errorf("Expected the tree to be rolled back, %q found %d records", query, result.TotalSize)
+		}
+	}
+}
+
+// TestCompositeGraph tests graphs succeeding and rolling back independently
+func TestCompositeGraph(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	kept, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Kept"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	binned, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Not Binned"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/graph", map[string]interface{}{
+		"graphs": []map[string]interface{}{
+			{
+				"graphId": "good",
+				"compositeRequest": []map[string]interface{}{
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Account", "referenceId": "acct", "body": map[string]interface{}{"Name": "Graph Account"}},
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Contact", "referenceId": "con", "body": map[string]interface{}{"LastName": "Graph", "AccountId": "@{acct.id}"}},
+				},
+			},
+			{
+				"graphId": "bad",
+				"compositeRequest": []map[string]interface{}{
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Account", "referenceId": "acct", "body": map[string]interface{}{"Name": "Rolled Back"}},
+					{"method": "PATCH", "url": "/services/data/v58.0/sobjects/Account/" + kept.ID, "referenceId": "rename", "body": map[string]interface{}{"Name": "Renamed"}},
+					{"method": "DELETE", "url": "/services/data/v58.0/sobjects/Account/" + binned.ID, "referenceId": "remove"},
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Contact", "referenceId": "con", "body": map[string]interface{}{"FirstName": "No LastName"}},
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Account", "referenceId": "after", "body": map[string]interface{}{"Name": "Never Created"}},
+				},
+			},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		Graphs []struct {
+			GraphID       string `json:"graphId"`
+			IsSuccessful  bool   `json:"isSuccessful"`
+			GraphResponse struct {
+				CompositeResponse []struct {
+					Body           json.RawMessage `json:"body"`
+					HTTPStatusCode int             `json:"httpStatusCode"`
+					ReferenceID    string          `json:"referenceId"`
+				} `json:"compositeResponse"`
+			} `json:"graphResponse"`
+		} `json:"graphs"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Graphs) != 2 {
+		t.Fatalf("Failed to parse response: %v %s", err, body)
+	}
+
+	good, bad := result.Graphs[0], result.Graphs[1]
+	if good.GraphID != "good" || !good.IsSuccessful {
+		t.Errorf("Expected the good graph to succeed, got %+v", good)
+	}
+	for _, sub := range good.GraphResponse.CompositeResponse {
+		if sub.HTTPStatusCode != http.StatusCreated {
+			t.Errorf("Expected 201 for %s, got %d: %s", sub.ReferenceID, sub.HTTPStatusCode, sub.Body)
+		}
+	}
+
+	if bad.GraphID != "bad" || bad.IsSuccessful || len(bad.GraphResponse.CompositeResponse) != 5 {
+		t.Fatalf("Expected the bad graph to fail with 5 responses, got %+v", bad)
+	}
+	for i, sub := range bad.GraphResponse.CompositeResponse {
+		want := "PROCESSING_HALTED"
+		if i == 3 {
+			want = "REQUIRED_FIELD_MISSING"
+		}
+		if sub.HTTPStatusCode != http.StatusBadRequest || !strings.Contains(string(sub.Body), want) {
+			t.Errorf("Expected 400 %s for %s, got %d: %s", want, sub.ReferenceID, sub.HTTPStatusCode, sub.Body)
+		}
+	}
+
+	// Only the good graph's writes remain
+	accounts, err := client.Query("SELECT Name FROM Account ORDER BY Name")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	var names []string
+	for _, record := range accounts.Records {
+		names = append(names, record["Name"].(string))
+	}
+	if strings.Join(names, ",") != "Graph Account,Kept,Not Binned" {
+		t.Errorf("Expected the bad graph's writes to be rolled back, got %v", names)
+	}
+	all, _ := emu.Store().GetAllRecordsWithDeleted("Account")
+	if len(all) != 3 {
+		t.Errorf("Expected nothing left in the recycle bin, got %d accounts", len(all))
+	}
+	if contacts, err := client.Query("SELECT AccountId FROM Contact"); err != nil || contacts.TotalSize != 1 {
+		t.Errorf("Expected only the good graph's contact, got %v (%v)", contacts, err)
+	}
+}
+
+// TestCompositeGraphUpsertRollback tests rolling back upserts by external ID
+func TestCompositeGraphUpsertRollback(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Supplier__c",
+		Label:      "Supplier",
+		Custom:     true,
+		Createable: true,
+		Updateable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true, Updateable: true},
+			{Name: "External_Id__c", Type: storage.FieldTypeString, Createable: true, Updateable: true, ExternalId: true, Nillable: true},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	existing, err := client.CreateRecord("Supplier__c", map[string]interface{}{"Name": "Acme", "External_Id__c": "ABC123"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	path := "/services/data/v58.0/sobjects/Supplier__c/External_Id__c/"
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/graph", map[string]interface{}{
+		"graphs": []map[string]interface{}{
+			{
+				"graphId": "upserts",
+				"compositeRequest": []map[string]interface{}{
+					{"method": "PATCH", "url": path + "abc123", "referenceId": "update", "body": map[string]interface{}{"Name": "Renamed"}},
+					{"method": "PATCH", "url": path + "NEW1", "referenceId": "insert", "body": map[string]interface{}{"Name": "Inserted"}},
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Contact", "referenceId": "con", "body": map[string]interface{}{"FirstName": "No LastName"}},
+				},
+			},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"isSuccessful":false`) {
+		t.Fatalf("Expected the graph to fail, got %d: %s", resp.StatusCode, body)
+	}
+
+	record, err := client.GetRecord("Supplier__c", existing.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if record["Name"] != "Acme" {
+		t.Errorf("Expected the upsert update to be rolled back, got %v", record["Name"])
+	}
+	suppliers, err := client.Query("SELECT Id FROM Supplier__c")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if suppliers.TotalSize != 1 {
+		t.Errorf("Expected the upsert insert to be rolled back, got %d suppliers", suppliers.TotalSize)
+	}
+}
+
+// TestCompositeBatch tests independent batch subrequests and haltOnError
+func TestCompositeBatch(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	type batchResponse struct {
+		HasErrors bool `json:"hasErrors"`
+		Results   []struct {
+			StatusCode int             `json:"statusCode"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"results"`
+	}
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/batch", map[string]interface{}{
+		"batchRequests": []map[string]interface{}{
+			{"method": "POST", "url": "v58.0/sobjects/Account", "richInput": map[string]interface{}{"Name": "Batch Account"}},
+			{"method": "POST", "url": "v58.0/sobjects/Contact", "richInput": map[string]interface{}{"FirstName": "No LastName"}},
+			{"method": "GET", "url": "v58.0/query?q=SELECT+Name+FROM+Account"},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result batchResponse
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Results) != 3 {
+		t.Fatalf("Failed to parse response: %v %s", err, body)
+	}
+	if !result.HasErrors {
+		t.Error("Expected hasErrors to be true")
+	}
+	if result.Results[0].StatusCode != http.StatusCreated {
+		t.Errorf("Expected 201 for the create, got %d: %s", result.Results[0].StatusCode, result.Results[0].Result)
+	}
+	if result.Results[1].StatusCode != http.StatusBadRequest || !strings.Contains(string(result.Results[1].Result), "REQUIRED_FIELD_MISSING") {
+		t.Errorf("Expected 400 REQUIRED_FIELD_MISSING, got %d: %s", result.Results[1].StatusCode, result.Results[1].Result)
+	}
+	// The failed create doesn't stop the query, which sees the first create
+	if result.Results[2].StatusCode != http.StatusOK || !strings.Contains(string(result.Results[2].Result), "Batch Account") {
+		t.Errorf("Expected the query to return the created account, got %d: %s", result.Results[2].StatusCode, result.Results[2].Result)
+	}
+
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/batch", map[string]interface{}{
+		"haltOnError": true,
+		"batchRequests": []map[string]interface{}{
+			{"method": "POST", "url": "v58.0/sobjects/Contact", "richInput": map[string]interface{}{"FirstName": "No LastName"}},
+			{"method": "POST", "url": "v58.0/sobjects/Account", "richInput": map[string]interface{}{"Name": "Never Created"}},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	result = batchResponse{}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.Results) != 2 {
+		t.Fatalf("Failed to parse response: %v %s", err, body)
+	}
+	if result.Results[1].StatusCode != http.StatusPreconditionFailed || !strings.Contains(string(result.Results[1].Result), "BATCH_PROCESSING_HALTED") {
+		t.Errorf("Expected 412 BATCH_PROCESSING_HALTED, got %d: %s", result.Results[1].StatusCode, result.Results[1].Result)
+	}
+	if accounts, err := client.Query("SELECT Id FROM Account"); err != nil || accounts.TotalSize != 1 {
+		t.Errorf("Expected the halted create to be skipped, got %v (%v)", accounts, err)
+	}
+}
+
+// TestCompositeSObjectsAllOrNone tests that a failed all-or-none collection
+// request leaves the store unchanged
+func TestCompositeSObjectsAllOrNone(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	first, err := client.CreateRecord("Account", map[string]interface{}{"Name": "First"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	second, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Second"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	missing := first.ID[:3] + strings.Repeat("0", 15)
+
+	type collectionResult struct {
+		ID      string            `json:"id"`
+		Success bool              `json:"success"`
+		Errors  []json.RawMessage `json:"errors"`
+	}
+	expectRolledBack := func(body []byte, failed int, code string) {
+		t.Helper()
+		var results []collectionResult
+		if err := json.Unmarshal(body, &results); err != nil {
+			t.Fatalf("Failed to parse response: %v %s", err, body)
+		}
+		for i, result := range results {
+			want := "PROCESSING_HALTED"
+			if i == failed {
+				want = code
+			}
+			if result.Success || len(result.Errors) != 1 || !strings.Contains(string(result.Errors[0]), want) {
+				t.Errorf("Expected row %d to fail with %s, got %+v", i, want, result)
+			}
+		}
+	}
+	expectAccounts := func(want string) {
+		t.Helper()
+		all, _ := emu.Store().GetAllRecordsWithDeleted("Account")
+		var names []string
+		for _, record := range all {
+			names = append(names, record["Name"].(string))
+		}
+		if len(all) != 2 || strings.Join(names, ",") != want {
+			t.Errorf("Expected accounts %s, got %v", want, names)
+		}
+	}
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/sobjects", map[string]interface{}{
+		"allOrNone": true,
+		"records": []map[string]interface{}{
+			{"attributes": map[string]interface{}{"type": "Account"}, "Name": "Third"},
+			{"attributes": map[string]interface{}{"type": "Account"}, "Name": "Fourth"},
+			{"attributes": map[string]interface{}{"type": "Contact"}, "FirstName": "No LastName"},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d: %s", resp.StatusCode, body)
+	}
+	expectRolledBack(body, 2, "REQUIRED_FIELD_MISSING")
+	expectAccounts("First,Second")
+
+	resp, body = doRequest(t, client, http.MethodPatch, "/services/data/v58.0/composite/sobjects", map[string]interface{}{
+		"allOrNone": true,
+		"records": []map[string]interface{}{
+			{"attributes": map[string]interface{}{"type": "Account"}, "Id": first.ID, "Name": "Renamed"},
+			{"attributes": map[string]interface{}{"type": "Account"}, "Id": second.ID, "Name": strings.Repeat("x", 300)},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d: %s", resp.StatusCode, body)
+	}
+	expectRolledBack(body, 1, "STRING_TOO_LONG")
+	expectAccounts("First,Second")
+
+	resp, body = doRequest(t, client, http.MethodDelete, "/services/data/v58.0/composite/sobjects?allOrNone=true&ids="+first.ID+","+missing, nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d: %s", resp.StatusCode, body)
+	}
+	expectRolledBack(body, 1, "INVALID_FIELD")
+	expectAccounts("First,Second")
+	if result, err := client.Query("SELECT Id FROM Account"); err != nil || result.TotalSize != 2 {
+		t.Errorf("Expected both accounts to stay out of the recycle bin, got %v (%v)", result, err)
+	}
+}
+
+// TestCompositeRoutesSubrequests tests that composite subrequests reach
+// the same endpoints as top-level requests
+func TestCompositeRoutesSubrequests(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite", map[string]interface{}{
+		"compositeRequest": []map[string]interface{}{
+			{"method": "GET", "url": "/services/data/v58.0/sobjects/Account/describe", "referenceId": "describe"},
+			{"method": "GET", "url": "/services/data/v58.0/limits", "referenceId": "limits"},
+			{"method": "GET", "url": "/services/data/v58.0/nowhere", "referenceId": "missing"},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		CompositeResponse []struct {
+			Body           json.RawMessage `json:"body"`
+			HTTPStatusCode int             `json:"httpStatusCode"`
+		} `json:"compositeResponse"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.CompositeResponse) != 3 {
+		t.Fatalf("Failed to parse response: %v %s", err, body)
+	}
+
+	describe, limits, missing := result.CompositeResponse[0], result.CompositeResponse[1], result.CompositeResponse[2]
+	var description, orgLimits map[string]interface{}
+	if err := json.Unmarshal(describe.Body, &description); err != nil || describe.HTTPStatusCode != http.StatusOK || description["name"] != "Account" {
+		t.Errorf("Expected the Account describe, got %d: %s", describe.HTTPStatusCode, describe.Body)
+	}
+	if err := json.Unmarshal(limits.Body, &orgLimits); err != nil || limits.HTTPStatusCode != http.StatusOK || orgLimits["DailyApiRequests"] == nil {
+		t.Errorf("Expected the org limits, got %d: %s", limits.HTTPStatusCode, limits.Body)
+	}
+	if missing.HTTPStatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown resource, got %d", missing.HTTPStatusCode)
+	}
+}
+
+// TestCompositeForwardsHeaders tests that subrequests see the parent's
+// headers unless they set their own
+func TestCompositeForwardsHeaders(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account", map[string]interface{}{"Name": "Acme"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	recordURL := "/services/data/v58.0/sobjects/Account/" + created.ID
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite", map[string]interface{}{
+		"compositeRequest": []map[string]interface{}{
+			{"method": "PATCH", "url": recordURL, "referenceId": "inherited", "body": map[string]interface{}{"Name": "Acme 2"}},
+			{"method": "PATCH", "url": recordURL, "referenceId": "overridden", "body": map[string]interface{}{"Name": "Acme 3"},
+				"httpHeaders": map[string]string{"Prefer": "return=minimal"}},
+		},
+	}, map[string]string{"Prefer": "return=representation"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+
+	var result struct {
+		CompositeResponse []struct {
+			Body           map[string]interface{} `json:"body"`
+			HTTPStatusCode int                    `json:"httpStatusCode"`
+		} `json:"compositeResponse"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil || len(result.CompositeResponse) != 2 {
+		t.Fatalf("Failed to parse response: %v %s", err, body)
+	}
+	inherited, overridden := result.CompositeResponse[0], result.CompositeResponse[1]
+	if inherited.HTTPStatusCode != http.StatusOK || inherited.Body["Name"] != "Acme 2" {
+		t.Errorf("Expected the parent's Prefer header to return the record, got %d: %v", inherited.HTTPStatusCode, inherited.Body)
+	}
+	if overridden.HTTPStatusCode != http.StatusNoContent {
+		t.Errorf("Expected the subrequest's Prefer header to win, got %d: %v", overridden.HTTPStatusCode, overridden.Body)
+	}
+}
+
+// TestPrettyPrintedJSON tests indented responses on request
+func TestPrettyPrintedJSON(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tests := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		pretty  bool
+	}{
+		{"default", "/services/data/v58.0/sobjects/Account/describe", nil, false},
+		{"pretty", "/services/data/v58.0/sobjects/Account/describe?pretty=true", nil, true},
+		{"prettyPrint", "/services/data/v58.0/limits?prettyPrint=true", nil, true},
+		{"header", "/services/data/v58.0/query?q=SELECT+Id+FROM+Account", map[string]string{"X-PrettyPrint": "1"}, true},
+		{"error", "/services/data/v58.0/sobjects/Nope__c/describe?pretty=true", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, body := doRequest(t, client, http.MethodGet, tt.path, nil, tt.headers)
+			if !json.Valid(body) {
+				t.Fatalf("Expected valid JSON, got %s", body)
+			}
+			if indented := bytes.Contains(body, []byte("\n  ")); indented != tt.pretty {
+				t.Errorf("Expected indented=%v, got %s", tt.pretty, body)
+			}
+		})
+	}
+}
+
 // Helper function to create an authenticated client
 func createAuthenticatedClient(t *testing.T, emu *emulator.Emulator, baseURL string) *sfclient.Client {
 	clientID, clientSecret, username, password := emulator.GetDefaultCredentials()
@@ -506,3 +1151,38 @@ func createAuthenticatedClient(t *testing.T, emu *emulator.Emulator, baseURL str
 
 	return client
 }
+
+// Helper function to send a raw authenticated request to the emulator
+func doRequest(t *testing.T, client *sfclient.Client, method, path string, body interface{}, headers map[string]string) (*http.Response, []byte) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("Failed to marshal body: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, client.InstanceURL+path, reader)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+
+	return resp, respBody
+}
@@ -0,0 +1,355 @@
+package integration_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sfclient "github.com/MASA-JAPAN/go-salesforce-api-client"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+)
+
+// metadataResult is the result element of a Metadata API response
+type metadataResult struct {
+	ID           string `xml:"id"`
+	Done         bool   `xml:"done"`
+	Status       string `xml:"status"`
+	Success      bool   `xml:"success"`
+	ZipFile      string `xml:"zipFile"`
+	ErrorMessage string `xml:"errorMessage"`
+	FullName     string `xml:"fullName"`
+	FileName     string `xml:"fileName"`
+	Type         string `xml:"type"`
+	Errors       []struct {
+		StatusCode string `xml:"statusCode"`
+	} `xml:"errors"`
+	Records []struct {
+		FullName string `xml:"fullName"`
+		Label    string `xml:"label"`
+		Length   int    `xml:"length"`
+	} `xml:"records"`
+	MetadataObjects []struct {
+		Name          string `xml:"xmlName"`
+		DirectoryName string `xml:"directoryName"`
+		Suffix        string `xml:"suffix"`
+	} `xml:"metadataObjects"`
+	Details struct {
+		ComponentFailures []struct {
+			FullName string `xml:"fullName"`
+			Problem  string `xml:"problem"`
+		} `xml:"componentFailures"`
+	} `xml:"details"`
+}
+
+// metadataCall posts a Metadata API SOAP request with the client's session
+// and returns the raw response
+func metadataCall(t *testing.T, client *sfclient.Client, body string) []byte {
+	t.Helper()
+
+	envelope := `<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="http://soap.sforce.com/2006/04/metadata" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <soapenv:Header><SessionHeader><sessionId>` + client.AccessToken + `</sessionId></SessionHeader></soapenv:Header>
+  <soapenv:Body>` + body + `</soapenv:Body>
+</soapenv:Envelope>`
+	resp, err := http.Post(client.InstanceURL+"/services/Soap/m/58.0", "text/xml", strings.NewReader(envelope))
+	if err != nil {
+		t.Fatalf("Metadata API request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from the Metadata API, got %d: %s", resp.StatusCode, data)
+	}
+	return data
+}
+
+// metadataResults decodes the result elements of a Metadata API response
+func metadataResults(t *testing.T, data []byte) []metadataResult {
+	t.Helper()
+
+	var envelope struct {
+		Body struct {
+			Response struct {
+				Results []metadataResult `xml:"result"`
+			} `xml:",any"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		t.Fatalf("Failed to decode Metadata API response: %v", err)
+	}
+	return envelope.Body.Response.Results
+}
+
+// deployFiles deploys a ZIP of files and waits for the deployment to finish
+func deployFiles(t *testing.T, client *sfclient.Client, files map[string]string) metadataResult {
+	t.Helper()
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, _ := archive.Create(name)
+		_, _ = w.Write([]byte(content))
+	}
+	_ = archive.Close()
+
+	deployed := metadataResults(t, metadataCall(t, client, `<deploy><ZipFile>`+
+		base64.StdEncoding.EncodeToString(buf.Bytes())+`</ZipFile><DeployOptions><rollbackOnError>true</rollbackOnError></DeployOptions></deploy>`))
+	if len(deployed) != 1 || deployed[0].ID == "" {
+		t.Fatalf("Expected a deploy ID, got %v", deployed)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		results := metadataResults(t, metadataCall(t, client, `<checkDeployStatus><asyncProcessId>`+
+			deployed[0].ID+`</asyncProcessId><includeDetails>true</includeDetails></checkDeployStatus>`))
+		if len(results) == 1 && results[0].Done {
+			return results[0]
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("Deployment %s did not finish", deployed[0].ID)
+	return metadataResult{}
+}
+
+const myObjectXML = `<?xml version="1.0" encoding="UTF-8"?>
+<CustomObject xmlns="http://soap.sforce.com/2006/04/metadata">
+    <label>My Object</label>
+    <pluralLabel>My Objects</pluralLabel>
+    <nameField><label>My Object Name</label><type>Text</type></nameField>
+    <deploymentStatus>Deployed</deploymentStatus>
+    <sharingModel>ReadWrite</sharingModel>
+    <fields>
+        <fullName>Amount__c</fullName>
+        <label>Amount</label>
+        <type>Number</type>
+        <precision>18</precision>
+        <scale>2</scale>
+    </fields>
+    <fields>
+        <fullName>Status__c</fullName>
+        <label>Status</label>
+        <type>Text</type>
+        <length>40</length>
+    </fields>
+</CustomObject>`
+
+// TestDeployCustomObject tests that deploying a CustomObject registers it
+// and that malformed metadata fails the deployment
+func TestDeployCustomObject(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	result := deployFiles(t, client, map[string]string{
+		"package.xml":                `<Package xmlns="http://soap.sforce.com/2006/04/metadata"><version>58.0</version></Package>`,
+		"objects/MyObject__c.object": myObjectXML,
+	})
+	if !result.Success || result.Status != "Succeeded" {
+		t.Fatalf("Expected the deployment to succeed, got %+v", result)
+	}
+
+	created, err := client.CreateRecord("MyObject__c", map[string]interface{}{
+		"Name": "First", "Amount__c": 12.5, "Status__c": "Open",
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	query, err := client.Query("SELECT Id, Name, Amount__c, Status__c FROM MyObject__c")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(query.Records) != 1 || query.Records[0]["Id"] != created.ID ||
+		query.Records[0]["Amount__c"] != 12.5 || query.Records[0]["Status__c"] != "Open" {
+		t.Errorf("Expected the created record, got %v", query.Records)
+	}
+
+	result = deployFiles(t, client, map[string]string{
+		"objects/Broken__c.object": `<CustomObject><fields><fullName>Oops__c</fullName>`,
+	})
+	if result.Success || result.Status != "Failed" || len(result.Details.ComponentFailures) != 1 ||
+		result.Details.ComponentFailures[0].FullName != "Broken__c" {
+		t.Errorf("Expected a component failure for Broken__c, got %+v", result)
+	}
+	if emu.Store().HasSObject("Broken__c") {
+		t.Error("Expected the failed deployment not to register Broken__c")
+	}
+}
+
+// TestRetrieveCustomObject tests that a retrieve returns a ZIP with the
+// manifest and the .object file of each requested object
+func TestRetrieveCustomObject(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	retrieved := metadataResults(t, metadataCall(t, client, `<retrieve><retrieveRequest>
+  <apiVersion>58.0</apiVersion><singlePackage>true</singlePackage>
+  <unpackaged><types><members>Account</members><name>CustomObject</name></types><version>58.0</version></unpackaged>
+</retrieveRequest></retrieve>`))
+	if len(retrieved) != 1 || retrieved[0].ID == "" {
+		t.Fatalf("Expected a retrieve ID, got %v", retrieved)
+	}
+
+	var result metadataResult
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline) && !result.Done; {
+		time.Sleep(50 * time.Millisecond)
+		results := metadataResults(t, metadataCall(t, client, `<checkRetrieveStatus><asyncProcessId>`+
+			retrieved[0].ID+`</asyncProcessId><includeZip>true</includeZip></checkRetrieveStatus>`))
+		if len(results) == 1 {
+			result = results[0]
+		}
+	}
+	if !result.Success || result.ZipFile == "" {
+		t.Fatalf("Expected a successful retrieve with a ZIP, got %+v", result)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(result.ZipFile)
+	if err != nil {
+		t.Fatalf("Failed to decode the ZIP: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Failed to open the ZIP: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		rc, _ := file.Open()
+		files[file.Name], _ = io.ReadAll(rc)
+		rc.Close()
+	}
+	if !strings.Contains(string(files["package.xml"]), "<members>Account</members>") {
+		t.Errorf("Expected package.xml to list Account, got %s", files["package.xml"])
+	}
+
+	var object struct {
+		Fields []struct {
+			FullName string `xml:"fullName"`
+			Type     string `xml:"type"`
+		} `xml:"fields"`
+	}
+	if err := xml.Unmarshal(files["objects/Account.object"], &object); err != nil {
+		t.Fatalf("Failed to parse objects/Account.object: %v (files: %d)", err, len(files))
+	}
+	types := map[string]string{}
+	for _, field := range object.Fields {
+		types[field.FullName] = field.Type
+	}
+	if types["Industry"] != "Picklist" || types["AnnualRevenue"] != "Currency" || types["Name"] != "Text" {
+		t.Errorf("Expected Account's fields in the .object file, got %v", types)
+	}
+}
+
+// describeField returns a field from the describe of objectType, or nil
+func describeField(t *testing.T, client *sfclient.Client, objectType, name string) map[string]interface{} {
+	t.Helper()
+
+	description, err := client.DescribeSObject(objectType)
+	if err != nil {
+		t.Fatalf("DescribeSObject failed: %v", err)
+	}
+	for _, f := range description["fields"].([]interface{}) {
+		if field := f.(map[string]interface{}); field["name"] == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// TestMetadataCRUD tests creating, reading, updating and deleting a
+// CustomField through the CRUD Metadata API calls
+func TestMetadataCRUD(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	field := `<metadata xsi:type="CustomField"><fullName>Account.Region__c</fullName>
+  <label>Region</label><type>Text</type><length>20</length></metadata>`
+
+	results := metadataResults(t, metadataCall(t, client, `<createMetadata>`+field+`</createMetadata>`))
+	if len(results) != 1 || !results[0].Success || results[0].FullName != "Account.Region__c" {
+		t.Fatalf("Expected the field to be created, got %+v", results)
+	}
+	if described := describeField(t, client, "Account", "Region__c"); described == nil || described["length"] != float64(20) {
+		t.Errorf("Expected Region__c in the Account describe, got %v", described)
+	}
+
+	results = metadataResults(t, metadataCall(t, client, `<createMetadata>`+field+`</createMetadata>`))
+	if len(results) != 1 || results[0].Success || len(results[0].Errors) != 1 ||
+		results[0].Errors[0].StatusCode != "DUPLICATE_DEVELOPER_NAME" {
+		t.Errorf("Expected creating the field twice to fail, got %+v", results)
+	}
+
+	results = metadataResults(t, metadataCall(t, client, `<updateMetadata>`+
+		strings.Replace(field, "<label>Region</label>", "<label>Sales Region</label>", 1)+`</updateMetadata>`))
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("Expected the field to be updated, got %+v", results)
+	}
+
+	results = metadataResults(t, metadataCall(t, client,
+		`<readMetadata><type>CustomField</type><fullNames>Account.Region__c</fullNames></readMetadata>`))
+	if len(results) != 1 || len(results[0].Records) != 1 || results[0].Records[0].Label != "Sales Region" ||
+		results[0].Records[0].Length != 20 {
+		t.Errorf("Expected to read the updated field, got %+v", results)
+	}
+
+	results = metadataResults(t, metadataCall(t, client,
+		`<deleteMetadata><type>CustomField</type><fullNames>Account.Region__c</fullNames></deleteMetadata>`))
+	if len(results) != 1 || !results[0].Success {
+		t.Fatalf("Expected the field to be deleted, got %+v", results)
+	}
+	if described := describeField(t, client, "Account", "Region__c"); described != nil {
+		t.Errorf("Expected Region__c to be gone from the describe, got %v", described)
+	}
+}
+
+// TestListMetadata tests that listMetadata lists deployed objects and that
+// describeMetadata reports the supported types
+func TestListMetadata(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	if result := deployFiles(t, client, map[string]string{"objects/MyObject__c.object": myObjectXML}); !result.Success {
+		t.Fatalf("Expected the deployment to succeed, got %+v", result)
+	}
+
+	results := metadataResults(t, metadataCall(t, client,
+		`<listMetadata><queries><type>CustomObject</type></queries><asOfVersion>58.0</asOfVersion></listMetadata>`))
+	var listed bool
+	for _, file := range results {
+		if file.FullName == "MyObject__c" {
+			listed = file.Type == "CustomObject" && file.FileName == "objects/MyObject__c.object" && file.ID != ""
+		}
+	}
+	if !listed {
+		t.Errorf("Expected MyObject__c among the listed CustomObjects, got %+v", results)
+	}
+
+	results = metadataResults(t, metadataCall(t, client,
+		`<listMetadata><queries><type>CustomField</type></queries></listMetadata>`))
+	fields := map[string]bool{}
+	for _, file := range results {
+		fields[file.FullName] = true
+	}
+	if !fields["MyObject__c.Amount__c"] || !fields["MyObject__c.Status__c"] || fields["Account.Name"] {
+		t.Errorf("Expected the deployed custom fields only, got %v", fields)
+	}
+
+	results = metadataResults(t, metadataCall(t, client, `<describeMetadata><asOfVersion>58.0</asOfVersion></describeMetadata>`))
+	if len(results) != 1 || len(results[0].MetadataObjects) == 0 || results[0].MetadataObjects[0].Name != "CustomObject" ||
+		results[0].MetadataObjects[0].DirectoryName != "objects" || results[0].MetadataObjects[0].Suffix != "object" {
+		t.Errorf("Expected CustomObject among the described types, got %+v", results)
+	}
+}
@@ -0,0 +1,1429 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/testutil"
+)
+
+// TestQueryPolymorphicRelationships tests Who/What traversal on activities
+func TestQueryPolymorphicRelationships(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	contact, err := client.CreateRecord("Contact", map[string]interface{}{
+		"FirstName": "Jane",
+		"LastName":  "Smith",
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	opportunity, err := client.CreateRecord("Opportunity", map[string]interface{}{
+		"Name":      "Big Deal",
+		"StageName": "Prospecting",
+		"CloseDate": "2025-12-31",
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	_, err = client.CreateRecord("Task", map[string]interface{}{
+		"Subject": "Follow up",
+		"WhoId":   contact.ID,
+		"WhatId":  opportunity.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	result, err := client.Query("SELECT Id, Who.Name, What.Name FROM Task")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(result.Records))
+	}
+
+	who, ok := result.Records[0]["Who"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected Who to be an object, got %v", result.Records[0]["Who"])
+	}
+	if who["Name"] != "Jane Smith" {
+		t.Errorf("Expected Who.Name='Jane Smith', got %v", who["Name"])
+	}
+	if attrs, _ := who["attributes"].(map[string]interface{}); attrs["type"] != "Contact" {
+		t.Errorf("Expected Who type Contact, got %v", attrs["type"])
+	}
+
+	what, ok := result.Records[0]["What"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected What to be an object, got %v", result.Records[0]["What"])
+	}
+	if what["Name"] != "Big Deal" {
+		t.Errorf("Expected What.Name='Big Deal', got %v", what["Name"])
+	}
+	if attrs, _ := what["attributes"].(map[string]interface{}); attrs["type"] != "Opportunity" {
+		t.Errorf("Expected What type Opportunity, got %v", attrs["type"])
+	}
+}
+
+// TestQueryTypeOf tests TYPEOF projection on polymorphic relationships
+func TestQueryTypeOf(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{
+		"Name":  "Acme",
+		"Phone": "555-0100",
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	caseResp, err := client.CreateRecord("Case", map[string]interface{}{
+		"Subject": "Broken widget",
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	for _, whatID := range []string{account.ID, caseResp.ID} {
+		if _, err := client.CreateRecord("Task", map[string]interface{}{"Subject": "Call", "WhatId": whatID}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT Id, TYPEOF What WHEN Account THEN Name, Phone WHEN Opportunity THEN Amount ELSE Id END FROM Task")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(result.Records))
+	}
+
+	for _, record := range result.Records {
+		what, ok := record["What"].(map[string]interface{})
+		if !ok {
+			t.Fatalf("Expected What to be an object, got %v", record["What"])
+		}
+		attrs, _ := what["attributes"].(map[string]interface{})
+		switch attrs["type"] {
+		case "Account":
+			if what["Name"] != "Acme" || what["Phone"] != "555-0100" {
+				t.Errorf("Expected Account Name and Phone, got %v", what)
+			}
+		case "Case":
+			if what["Id"] != caseResp.ID {
+				t.Errorf("Expected ELSE branch to project Id, got %v", what)
+			}
+			if _, ok := what["Name"]; ok {
+				t.Errorf("Expected Case to not project Name, got %v", what)
+			}
+		default:
+			t.Errorf("Unexpected What type: %v", attrs["type"])
+		}
+	}
+}
+
+// TestQueryPost tests the opt-in POST variant of the query endpoint
+func TestQueryPost(t *testing.T) {
+	for _, allow := range []bool{false, true} {
+		opts := []emulator.Option{}
+		if allow {
+			opts = append(opts, emulator.WithQueryPost())
+		}
+		emu := emulator.New(opts...)
+		baseURL := emu.Start()
+
+		client := createAuthenticatedClient(t, emu, baseURL)
+		if _, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme"}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+
+		resp, body := doRequest(t, client, "POST", "/services/data/v58.0/query",
+			map[string]interface{}{"query": "SELECT Id, Name FROM Account WHERE Name = 'Acme'"}, nil)
+		emu.Stop()
+
+		if !allow {
+			if resp.StatusCode != http.StatusMethodNotAllowed {
+				t.Errorf("Expected 405 when disabled, got %d", resp.StatusCode)
+			}
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+		}
+		var result map[string]interface{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if result["totalSize"] != float64(1) {
+			t.Errorf("Expected totalSize=1, got %v", result["totalSize"])
+		}
+	}
+}
+
+// TestQueryGroupByDateFunctions tests grouping by CALENDAR_MONTH, CALENDAR_YEAR and DAY_ONLY
+func TestQueryGroupByDateFunctions(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	for _, opp := range []struct {
+		closeDate string
+		amount    float64
+	}{
+		{"2024-01-15", 100},
+		{"2024-01-31", 50},
+		{"2024-03-01", 25},
+		{"2025-01-10", 10},
+	} {
+		if _, err := client.CreateRecord("Opportunity", map[string]interface{}{
+			"Name":      "Deal " + opp.closeDate,
+			"StageName": "Prospecting",
+			"CloseDate": opp.closeDate,
+			"Amount":    opp.amount,
+		}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT CALENDAR_MONTH(CloseDate), SUM(Amount) FROM Opportunity GROUP BY CALENDAR_MONTH(CloseDate)")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 groups, got %d: %v", len(result.Records), result.Records)
+	}
+	if result.Records[0]["expr0"] != float64(1) || result.Records[0]["expr1"] != float64(160) {
+		t.Errorf("Expected January total 160, got %v", result.Records[0])
+	}
+	if result.Records[1]["expr0"] != float64(3) || result.Records[1]["expr1"] != float64(25) {
+		t.Errorf("Expected March total 25, got %v", result.Records[1])
+	}
+
+	result, err = client.Query("SELECT CALENDAR_YEAR(CloseDate) year, COUNT(Id) total FROM Opportunity WHERE Amount > 20 GROUP BY CALENDAR_YEAR(CloseDate)")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0]["year"] != float64(2024) || result.Records[0]["total"] != float64(3) {
+		t.Errorf("Expected one 2024 group of 3, got %v", result.Records)
+	}
+
+	result, err = client.Query("SELECT DAY_ONLY(CreatedDate), COUNT(Id) FROM Opportunity GROUP BY DAY_ONLY(CreatedDate)")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0]["expr1"] != float64(4) {
+		t.Errorf("Expected all records created on one day, got %v", result.Records)
+	}
+	if day, _ := result.Records[0]["expr0"].(string); len(day) != len("2006-01-02") {
+		t.Errorf("Expected DAY_ONLY to return a date, got %v", result.Records[0]["expr0"])
+	}
+}
+
+// TestQueryGroupByAggregates tests aggregate functions per group, with aliases,
+// exprN names and multiple grouping fields
+func TestQueryGroupByAggregates(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	ids, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(12)
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	for i, id := range ids {
+		rating := "Hot"
+		if i >= 6 {
+			rating = "Cold"
+		}
+		if err := emu.Store().UpdateRecord("Account", id, storage.Record{"Rating": rating}); err != nil {
+			t.Fatalf("UpdateRecord failed: %v", err)
+		}
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	result, err := client.Query("SELECT Industry, COUNT(Id) total, SUM(AnnualRevenue), AVG(NumberOfEmployees), MIN(Name), MAX(Name) FROM Account GROUP BY Industry")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 6 {
+		t.Fatalf("Expected 6 industries, got %d: %v", len(result.Records), result.Records)
+	}
+	tech := result.Records[5]
+	if tech["Industry"] != "Technology" || tech["total"] != float64(2) {
+		t.Errorf("Expected 2 Technology accounts last, got %v", tech)
+	}
+	if tech["expr0"] != float64(800000) || tech["expr1"] != float64(40) {
+		t.Errorf("Expected SUM 800000 and AVG 40, got %v", tech)
+	}
+	if tech["expr2"] != "Test Account 1" || tech["expr3"] != "Test Account 7" {
+		t.Errorf("Expected MIN and MAX of Name, got %v", tech)
+	}
+
+	result, err = client.Query("SELECT Industry, Rating, COUNT(Id) FROM Account WHERE Industry = 'Technology' GROUP BY Industry, Rating")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 groups, got %v", result.Records)
+	}
+	for i, rating := range []string{"Cold", "Hot"} {
+		row := result.Records[i]
+		if row["Industry"] != "Technology" || row["Rating"] != rating || row["expr0"] != float64(1) {
+			t.Errorf("Expected one Technology account rated %s, got %v", rating, row)
+		}
+	}
+
+	// HAVING filters the groups
+	havingTests := []struct {
+		having     string
+		industries []string
+	}{
+		{"COUNT(Id) = 2 AND Industry = 'Technology'", []string{"Technology"}},
+		{"COUNT(Id) > 2", nil},
+		{"MIN(Name) = 'Test Account 1' OR Industry = 'Finance'", []string{"Finance", "Technology"}},
+		{"NOT count(Id) < 2 AND Industry IN ('Finance', 'Education')", []string{"Education", "Finance"}},
+	}
+	for _, tt := range havingTests {
+		query := "SELECT Industry, COUNT(Id) FROM Account GROUP BY Industry HAVING " + tt.having
+		result, err := client.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var industries []string
+		for _, row := range result.Records {
+			industries = append(industries, row["Industry"].(string))
+		}
+		if strings.Join(industries, ",") != strings.Join(tt.industries, ",") {
+			t.Errorf("%s: expected %v, got %v", query, tt.industries, industries)
+		}
+	}
+	for _, having := range []string{"Rating = 'Hot'", "BOGUS(Id) > 1", "COUNT(Id) >"} {
+		path := "/services/data/v58.0/query?q=" + url.QueryEscape("SELECT Industry, COUNT(Id) FROM Account GROUP BY Industry HAVING "+having)
+		resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "MALFORMED_QUERY") {
+			t.Errorf("HAVING %s: expected 400 MALFORMED_QUERY, got %d: %s", having, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestQueryDateLiterals tests date literals against date and datetime fields
+func TestQueryDateLiterals(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	store := emu.Store()
+	_ = store.RegisterSObject(storage.SObjectDefinition{
+		Name:       "Visit__c",
+		Label:      "Visit",
+		Custom:     true,
+		Createable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			{Name: "VisitDate__c", Type: storage.FieldTypeDate, Createable: true},
+			{Name: "VisitedAt__c", Type: storage.FieldTypeDatetime, Createable: true},
+		},
+	})
+
+	now := time.Now().UTC()
+	for _, visit := range []struct {
+		name string
+		days int
+	}{
+		{"today", 0},
+		{"yesterday", -1},
+		{"last week", -7},
+		{"long ago", -400},
+		{"tomorrow", 1},
+	} {
+		at := now.AddDate(0, 0, visit.days)
+		if _, err := store.CreateRecord("Visit__c", storage.Record{
+			"Name":         visit.name,
+			"VisitDate__c": at.Format("2006-01-02"),
+			"VisitedAt__c": at.Format(time.RFC3339),
+		}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tests := []struct {
+		where string
+		names []string
+	}{
+		{"CreatedDate = TODAY", []string{"last week", "long ago", "today", "tomorrow", "yesterday"}},
+		{"CreatedDate < TODAY", nil},
+		{"%s = TODAY", []string{"today"}},
+		{"%s = YESTERDAY", []string{"yesterday"}},
+		{"%s = TOMORROW", []string{"tomorrow"}},
+		{"%s >= LAST_N_DAYS:7", []string{"last week", "today", "tomorrow", "yesterday"}},
+		{"%s = LAST_N_DAYS:7", []string{"last week", "today", "yesterday"}},
+		{"%s < LAST_N_DAYS:7", []string{"long ago"}},
+		{"%s = NEXT_N_DAYS:3", []string{"tomorrow"}},
+		{"%s > TODAY", []string{"tomorrow"}},
+		{"%s != LAST_N_DAYS:30", []string{"long ago", "tomorrow"}},
+	}
+	for _, field := range []string{"VisitDate__c", "VisitedAt__c"} {
+		for _, tt := range tests {
+			query := "SELECT Name FROM Visit__c WHERE " + strings.ReplaceAll(tt.where, "%s", field) + " ORDER BY Name"
+			result, err := client.Query(query)
+			if err != nil {
+				t.Fatalf("%s: %v", query, err)
+			}
+			var names []string
+			for _, record := range result.Records {
+				names = append(names, record["Name"].(string))
+			}
+			if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+				t.Errorf("%s: expected %v, got %v", query, tt.names, names)
+			}
+		}
+	}
+
+	// THIS_MONTH always holds today
+	result, err := client.Query("SELECT Name FROM Visit__c WHERE VisitDate__c = THIS_MONTH AND Name = 'today'")
+	if err != nil || len(result.Records) != 1 {
+		t.Errorf("Expected today in THIS_MONTH, got %v (%v)", result, err)
+	}
+}
+
+// TestQueryOrderByMultipleFields tests multi-key ORDER BY, null placement and
+// stable tie-breaking
+func TestQueryOrderByMultipleFields(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	for _, record := range []storage.Record{
+		{"Name": "A", "Industry": "Tech", "AnnualRevenue": 100},
+		{"Name": "B", "Industry": "Bank", "AnnualRevenue": 300},
+		{"Name": "C", "Industry": "Tech"},
+		{"Name": "D", "Industry": "Tech", "AnnualRevenue": 500},
+		{"Name": "E", "AnnualRevenue": 200},
+		{"Name": "F", "Industry": "Bank", "AnnualRevenue": 300},
+	} {
+		if _, err := emu.Store().CreateRecord("Account", record); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tests := []struct {
+		orderBy string
+		names   string
+	}{
+		{"Industry ASC, AnnualRevenue DESC NULLS LAST", "E,B,F,D,A,C"},
+		{"Industry ASC NULLS LAST, AnnualRevenue DESC NULLS FIRST", "B,F,C,D,A,E"},
+		{"AnnualRevenue", "C,A,E,B,F,D"},
+		{"AnnualRevenue DESC", "D,B,F,E,A,C"},
+		{"Industry DESC, Name DESC", "D,C,A,F,B,E"},
+		// B and F tie on both keys and keep their insertion order
+		{"AnnualRevenue DESC, Industry", "D,B,F,E,A,C"},
+	}
+	for _, tt := range tests {
+		query := "SELECT Name FROM Account ORDER BY " + tt.orderBy
+		result, err := client.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var names []string
+		for _, record := range result.Records {
+			names = append(names, record["Name"].(string))
+		}
+		if got := strings.Join(names, ","); got != tt.names {
+			t.Errorf("%s: expected %s, got %s", query, tt.names, got)
+		}
+	}
+
+	if _, err := client.Query("SELECT Name FROM Account ORDER BY Name SIDEWAYS"); err == nil {
+		t.Error("Expected an error for an invalid ORDER BY clause")
+	}
+}
+
+// TestQueryWhereRelationshipField tests filtering on parent fields such as Account.Industry
+func TestQueryWhereRelationshipField(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tech, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Tech Co", "Industry": "Technology"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	bank, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Bank Co", "Industry": "Banking"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	for _, contact := range []map[string]interface{}{
+		{"LastName": "Techie", "AccountId": tech.ID},
+		{"LastName": "Banker", "AccountId": bank.ID},
+		{"LastName": "Orphan"},
+	} {
+		if _, err := client.CreateRecord("Contact", contact); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT Id, LastName FROM Contact WHERE Account.Industry = 'Technology'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0]["LastName"] != "Techie" {
+		t.Errorf("Expected only Techie, got %v", result.Records)
+	}
+
+	// Contacts without an account never match a parent field condition
+	result, err = client.Query("SELECT Id, LastName FROM Contact WHERE Account.Industry != 'Technology'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0]["LastName"] != "Banker" {
+		t.Errorf("Expected only Banker, got %v", result.Records)
+	}
+}
+
+// TestQueryParentRelationshipFields tests parent fields such as Account.Name
+// projected as nested objects, including multi-level paths and empty lookups
+func TestQueryParentRelationshipFields(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	users, err := client.Query("SELECT Id FROM User LIMIT 1")
+	if err != nil || len(users.Records) != 1 {
+		t.Fatalf("Query User failed: %v", err)
+	}
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme", "OwnerId": users.Records[0]["Id"]})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	for _, contact := range []map[string]interface{}{
+		{"LastName": "Linked", "AccountId": account.ID},
+		{"LastName": "Orphan"},
+	} {
+		if _, err := client.CreateRecord("Contact", contact); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT Id, LastName, Account.Name, Account.Owner.Name FROM Contact ORDER BY LastName")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 contacts, got %d", len(result.Records))
+	}
+
+	linked := result.Records[0]
+	if _, ok := linked["Account.Name"]; ok {
+		t.Errorf("Expected no flat Account.Name column, got %v", linked)
+	}
+	parent, ok := linked["Account"].(map[string]interface{})
+	if !ok || parent["Name"] != "Acme" {
+		t.Fatalf("Expected a nested Account with Name Acme, got %v", linked["Account"])
+	}
+	if attrs, _ := parent["attributes"].(map[string]interface{}); attrs["type"] != "Account" {
+		t.Errorf("Expected Account attributes, got %v", parent["attributes"])
+	}
+	owner, ok := parent["Owner"].(map[string]interface{})
+	if !ok || owner["Name"] != "System Administrator" {
+		t.Errorf("Expected a nested Owner with a Name, got %v", parent["Owner"])
+	}
+
+	orphan := result.Records[1]
+	if value, ok := orphan["Account"]; !ok || value != nil {
+		t.Errorf("Expected Account to be null for a contact without one, got %v", orphan)
+	}
+}
+
+// TestQuerySubqueryLimitOffset tests child subqueries with their own ORDER BY, LIMIT and OFFSET
+func TestQuerySubqueryLimitOffset(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if _, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Zenith"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	for _, lastName := range []string{"Delta", "Alpha", "Charlie", "Bravo"} {
+		if _, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": lastName, "AccountId": account.ID}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT Name, (SELECT LastName FROM Contacts ORDER BY LastName LIMIT 2 OFFSET 1) FROM Account ORDER BY Name LIMIT 10")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 2 || result.TotalSize != 2 {
+		t.Fatalf("Expected totalSize to count only the 2 accounts, got %d and %d records", result.TotalSize, len(result.Records))
+	}
+
+	contacts, ok := result.Records[0]["Contacts"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected Contacts to be a query result, got %v", result.Records[0]["Contacts"])
+	}
+	records := contacts["records"].([]interface{})
+	if len(records) != 2 || contacts["totalSize"] != float64(2) {
+		t.Fatalf("Expected 2 contacts, got %v", contacts)
+	}
+	if records[0].(map[string]interface{})["LastName"] != "Bravo" || records[1].(map[string]interface{})["LastName"] != "Charlie" {
+		t.Errorf("Expected Bravo and Charlie, got %v", records)
+	}
+	if contacts["done"] != false {
+		t.Errorf("Expected done=false with more contacts beyond the limit, got %v", contacts["done"])
+	}
+
+	if result.Records[1]["Contacts"] != nil {
+		t.Errorf("Expected null Contacts for an account without contacts, got %v", result.Records[1]["Contacts"])
+	}
+}
+
+// TestQueryWithoutHTTP tests running SOQL directly against the store
+func TestQueryWithoutHTTP(t *testing.T) {
+	emu := emulator.New()
+
+	if err := testutil.NewFixtures(emu.Store()).LoadBasicCRMData(); err != nil {
+		t.Fatalf("LoadBasicCRMData failed: %v", err)
+	}
+
+	result, err := emu.Query("SELECT Id, Name FROM Account WHERE Name = 'Test Account 1'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 1 || len(result.Records) != 1 || result.Records[0]["Name"] != "Test Account 1" {
+		t.Errorf("Expected Test Account 1, got %v", result.Records)
+	}
+
+	engine := soql.NewEngine(emu.Store(), "58.0")
+	records, err := engine.Query("SELECT Name, (SELECT LastName FROM Contacts) FROM Account WHERE Name = 'Test Account 1'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 account, got %d", len(records))
+	}
+	if contacts, ok := records[0]["Contacts"].(*soql.SubqueryResult); !ok || contacts.TotalSize != 5 {
+		t.Errorf("Expected 5 contacts, got %v", records[0]["Contacts"])
+	}
+
+	if _, err := engine.Query("SELECT Id FROM NoSuchObject"); err == nil {
+		t.Error("Expected an error for an unknown object")
+	}
+}
+
+// TestCountQueryAcrossPaths tests COUNT() giving the same count via REST,
+// composite, bulk and direct queries
+func TestCountQueryAcrossPaths(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	if err := testutil.NewFixtures(emu.Store()).LoadBasicCRMData(); err != nil {
+		t.Fatalf("LoadBasicCRMData failed: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	query := "SELECT COUNT() FROM Contact WHERE LastName != null"
+
+	// REST query
+	resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/query?q="+url.QueryEscape(query), nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		TotalSize int                      `json:"totalSize"`
+		Records   []map[string]interface{} `json:"records"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if result.TotalSize != 50 || len(result.Records) != 0 {
+		t.Errorf("Expected totalSize=50 with no records, got %d and %d records", result.TotalSize, len(result.Records))
+	}
+
+	// Composite subrequest
+	composite := map[string]interface{}{
+		"compositeRequest": []map[string]interface{}{
+			{"method": "GET", "url": "/services/data/v58.0/query?q=" + url.QueryEscape(query), "referenceId": "count"},
+		},
+	}
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite", composite, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var compositeResult struct {
+		CompositeResponse []struct {
+			Body struct {
+				TotalSize int                      `json:"totalSize"`
+				Records   []map[string]interface{} `json:"records"`
+			} `json:"body"`
+		} `json:"compositeResponse"`
+	}
+	if err := json.Unmarshal(body, &compositeResult); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(compositeResult.CompositeResponse) != 1 || compositeResult.CompositeResponse[0].Body.TotalSize != 50 {
+		t.Errorf("Expected composite totalSize=50, got %s", body)
+	}
+
+	// Bulk query job
+	job, err := client.CreateJobQuery(query)
+	if err != nil {
+		t.Fatalf("CreateJobQuery failed: %v", err)
+	}
+	time.Sleep(500 * time.Millisecond)
+
+	rows, _, err := client.GetJobQueryResultsParsed(job.ID, "", 100)
+	if err != nil {
+		t.Fatalf("GetJobQueryResultsParsed failed: %v", err)
+	}
+	if len(rows) != 1 || rows[0]["expr0"] != "50" {
+		t.Errorf("Expected a single expr0=50 row, got %v", rows)
+	}
+
+	// Emulator.Query
+	direct, err := emu.Query(query)
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if direct.TotalSize != 50 || len(direct.Records) != 0 {
+		t.Errorf("Expected totalSize=50 with no records, got %d and %d records", direct.TotalSize, len(direct.Records))
+	}
+}
+
+// TestCountQuery tests bare COUNT() answering with totalSize and no records
+func TestCountQuery(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	for _, industry := range []string{"Technology", "Technology", "Banking"} {
+		if _, err := emu.Store().CreateRecord("Account", storage.Record{"Name": industry, "Industry": industry}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"SELECT COUNT() FROM Account", 3},
+		{"SELECT COUNT() FROM Account WHERE Industry = 'Technology'", 2},
+		{"SELECT COUNT() FROM Account WHERE Industry = 'Retail'", 0},
+	}
+	for _, tt := range tests {
+		resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/query?q="+url.QueryEscape(tt.query), nil, nil)
+		var result map[string]interface{}
+		if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &result) != nil {
+			t.Fatalf("%s: %d %s", tt.query, resp.StatusCode, body)
+		}
+		if result["totalSize"] != float64(tt.expected) || result["done"] != true {
+			t.Errorf("%s: expected totalSize=%d and done, got %s", tt.query, tt.expected, body)
+		}
+		if records, ok := result["records"].([]interface{}); !ok || len(records) != 0 {
+			t.Errorf("%s: expected an empty records array, got %s", tt.query, body)
+		}
+	}
+}
+
+// TestQueryBooleanStoredAsString tests boolean filters matching bools and "true" strings
+func TestQueryBooleanStoredAsString(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Feature__c",
+		Label:      "Feature",
+		KeyPrefix:  "a02",
+		Custom:     true,
+		Createable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			{Name: "IsActive__c", Type: storage.FieldTypeBoolean, Createable: true, Updateable: true},
+			{Name: "Legacy__c", Type: storage.FieldTypeString, Createable: true, Updateable: true, Nillable: true},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	// Legacy__c is a text field, so its string value is stored as sent
+	for _, record := range []map[string]interface{}{
+		{"Name": "bool", "IsActive__c": true, "Legacy__c": true},
+		{"Name": "string", "IsActive__c": "true", "Legacy__c": "True"},
+		{"Name": "off", "IsActive__c": "false", "Legacy__c": "false"},
+	} {
+		if _, err := client.CreateRecord("Feature__c", record); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT Name, IsActive__c FROM Feature__c WHERE IsActive__c = true")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 2 {
+		t.Errorf("Expected 2 active features, got %d", result.TotalSize)
+	}
+	for _, record := range result.Records {
+		if record["IsActive__c"] != true {
+			t.Errorf("Expected IsActive__c stored as bool, got %#v", record["IsActive__c"])
+		}
+	}
+
+	result, err = client.Query("SELECT Name FROM Feature__c WHERE Legacy__c = true")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 2 {
+		t.Errorf("Expected 2 records with Legacy__c true, got %d", result.TotalSize)
+	}
+
+	result, err = client.Query("SELECT Name FROM Feature__c WHERE IsActive__c != true")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 1 || result.Records[0]["Name"] != "off" {
+		t.Errorf("Expected only the inactive feature, got %v", result.Records)
+	}
+}
+
+// TestQueryEmptyStringVersusNull tests empty-string and null filters on text and number fields
+func TestQueryEmptyStringVersusNull(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	for _, record := range []map[string]interface{}{
+		{"Name": "empty", "Website": "", "AnnualRevenue": ""},
+		{"Name": "null", "Website": nil, "AnnualRevenue": nil},
+		{"Name": "value", "Website": "Text", "AnnualRevenue": 1000},
+	} {
+		if _, err := client.CreateRecord("Account", record); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		where string
+		names []string
+	}{
+		{"Website = ''", []string{"empty"}},
+		{"Website = null", []string{"null"}},
+		{"Website != null", []string{"empty", "value"}},
+		{"AnnualRevenue = null", []string{"empty", "null"}},
+		{"AnnualRevenue != null", []string{"value"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			result, err := client.Query("SELECT Name FROM Account WHERE " + tt.where + " ORDER BY Name")
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			var names []string
+			for _, record := range result.Records {
+				names = append(names, record["Name"].(string))
+			}
+			if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+				t.Errorf("Expected %v, got %v", tt.names, names)
+			}
+		})
+	}
+}
+
+// TestQueryInsertionOrder tests unordered queries returning records in insertion order
+func TestQueryInsertionOrder(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	var ids []string
+	for i := 0; i < 20; i++ {
+		created, err := client.CreateRecord("Account", map[string]interface{}{"Name": fmt.Sprintf("Account %02d", i)})
+		if err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	for run := 0; run < 3; run++ {
+		result, err := client.Query("SELECT Id FROM Account")
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		if len(result.Records) != len(ids) {
+			t.Fatalf("Expected %d records, got %d", len(ids), len(result.Records))
+		}
+		for i, record := range result.Records {
+			if record["Id"] != ids[i] {
+				t.Fatalf("Run %d: expected record %d to be %s, got %v", run, i, ids[i], record["Id"])
+			}
+		}
+	}
+}
+
+// TestQueryPaginationPerEmulator tests that concurrent emulators keep their query locators apart
+func TestQueryPaginationPerEmulator(t *testing.T) {
+	paginate := func(t *testing.T, prefix string) {
+		emu := emulator.New()
+		baseURL := emu.Start()
+		defer emu.Stop()
+
+		for i := 0; i < 10; i++ {
+			_, _ = emu.Store().CreateRecord("Account", map[string]interface{}{"Name": fmt.Sprintf("%s %02d", prefix, i)})
+		}
+		client := createAuthenticatedClient(t, emu, baseURL)
+
+		// Paginate the same query several times to reuse locator numbers
+		for run := 0; run < 5; run++ {
+			var names []string
+			path := "/services/data/v58.0/query?q=" + url.QueryEscape("SELECT Name FROM Account")
+			for path != "" {
+				resp, body := doRequest(t, client, http.MethodGet, path, nil, map[string]string{"Sforce-Query-Options": "batchSize=3"})
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("Expected 200 for %s, got %d: %s", path, resp.StatusCode, body)
+				}
+				var page struct {
+					NextRecordsURL string                   `json:"nextRecordsUrl"`
+					Records        []map[string]interface{} `json:"records"`
+				}
+				if err := json.Unmarshal(body, &page); err != nil {
+					t.Fatalf("Failed to parse response: %v", err)
+				}
+				for _, record := range page.Records {
+					names = append(names, record["Name"].(string))
+				}
+				path = page.NextRecordsURL
+			}
+
+			if len(names) != 10 {
+				t.Fatalf("Run %d: expected 10 records, got %d: %v", run, len(names), names)
+			}
+			for i, name := range names {
+				if name != fmt.Sprintf("%s %02d", prefix, i) {
+					t.Fatalf("Run %d: expected %s %02d, got %s", run, prefix, i, name)
+				}
+			}
+		}
+	}
+
+	t.Run("locator of another emulator", func(t *testing.T) {
+		first, second := emulator.New(), emulator.New()
+		firstURL, secondURL := first.Start(), second.Start()
+		defer first.Stop()
+		defer second.Stop()
+
+		for i := 0; i < 5; i++ {
+			_, _ = first.Store().CreateRecord("Account", map[string]interface{}{"Name": fmt.Sprintf("First %02d", i)})
+		}
+		firstClient := createAuthenticatedClient(t, first, firstURL)
+		secondClient := createAuthenticatedClient(t, second, secondURL)
+
+		path := "/services/data/v58.0/query?q=" + url.QueryEscape("SELECT Name FROM Account")
+		_, body := doRequest(t, firstClient, http.MethodGet, path, nil, map[string]string{"Sforce-Query-Options": "batchSize=2"})
+		var page struct {
+			NextRecordsURL string `json:"nextRecordsUrl"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil || page.NextRecordsURL == "" {
+			t.Fatalf("Expected a nextRecordsUrl, got %s", body)
+		}
+
+		resp, body := doRequest(t, secondClient, http.MethodGet, page.NextRecordsURL, nil, nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected 404 for another emulator's locator, got %d: %s", resp.StatusCode, body)
+		}
+	})
+
+	for _, prefix := range []string{"First", "Second"} {
+		prefix := prefix
+		t.Run(prefix, func(t *testing.T) {
+			t.Parallel()
+			paginate(t, prefix)
+		})
+	}
+}
+
+// TestSearch tests SOSL partial matches, field scopes and RETURNING
+func TestSearch(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	_, _ = client.CreateRecord("Account", map[string]interface{}{"Name": "Acme Corp"})
+	_, _ = client.CreateRecord("Account", map[string]interface{}{"Name": "Globex"})
+	_, _ = client.CreateRecord("Contact", map[string]interface{}{"LastName": "Acmeson"})
+	_, _ = client.CreateRecord("Contact", map[string]interface{}{"LastName": "Smith", "Email": "smith@acme.example.com"})
+
+	search := func(t *testing.T, sosl string) []map[string]interface{} {
+		resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/search?q="+url.QueryEscape(sosl), nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+		}
+		var result struct {
+			SearchRecords []map[string]interface{} `json:"searchRecords"`
+		}
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("Failed to parse response: %v", err)
+		}
+		return result.SearchRecords
+	}
+	names := func(records []map[string]interface{}) string {
+		var names []string
+		for _, record := range records {
+			attrs := record["attributes"].(map[string]interface{})
+			names = append(names, fmt.Sprintf("%s:%v", attrs["type"], record["Name"]))
+		}
+		return strings.Join(names, ", ")
+	}
+
+	tests := []struct {
+		name     string
+		sosl     string
+		expected string
+	}{
+		{"all fields", "FIND {acme} IN ALL FIELDS RETURNING Account(Id, Name), Contact(Id, Name)", "Account:Acme Corp, Contact:Acmeson, Contact:Smith"},
+		{"partial match", "FIND {CME} RETURNING Account(Name)", "Account:Acme Corp"},
+		{"name fields", "FIND {acme} IN NAME FIELDS RETURNING Account(Id, Name), Contact(Id, Name)", "Account:Acme Corp, Contact:Acmeson"},
+		{"returning order", "FIND {acme} IN NAME FIELDS RETURNING Contact(Name), Account(Name)", "Contact:Acmeson, Account:Acme Corp"},
+		{"limit", "FIND {acme} RETURNING Account(Name), Contact(Name) LIMIT 2", "Account:Acme Corp, Contact:Acmeson"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := names(search(t, tt.sosl)); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+
+	t.Run("all objects", func(t *testing.T) {
+		records := search(t, "FIND {acme}")
+		types := map[string]int{}
+		for _, record := range records {
+			types[record["attributes"].(map[string]interface{})["type"].(string)]++
+			if _, ok := record["Name"]; ok || record["Id"] == nil {
+				t.Errorf("Expected only Ids without RETURNING, got %v", record)
+			}
+		}
+		if types["Account"] != 1 || types["Contact"] != 2 {
+			t.Errorf("Expected 1 Account and 2 Contacts, got %v", types)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/search?q="+url.QueryEscape("SELECT Id FROM Account"), nil, nil)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "MALFORMED_SEARCH") {
+			t.Errorf("Expected 400 MALFORMED_SEARCH, got %d: %s", resp.StatusCode, body)
+		}
+	})
+}
+
+// TestQueryFieldCapabilities tests describe capability flags and their enforcement in SOQL
+func TestQueryFieldCapabilities(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	notFilterable := false
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:      "Secret__c",
+		Label:     "Secret",
+		Custom:    true,
+		Queryable: true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString},
+			{Name: "Token__c", Type: storage.FieldTypeString, Filterable: &notFilterable},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	describe, err := client.DescribeSObject("Account")
+	if err != nil {
+		t.Fatalf("DescribeSObject failed: %v", err)
+	}
+	flags := map[string]map[string]interface{}{}
+	for _, f := range describe["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		flags[field["name"].(string)] = field
+	}
+	if d := flags["Description"]; d["filterable"] != false || d["sortable"] != false || d["groupable"] != false {
+		t.Errorf("Expected Description to be neither filterable, sortable nor groupable, got %v", d)
+	}
+	if n := flags["Name"]; n["filterable"] != true || n["sortable"] != true || n["groupable"] != true || n["aggregatable"] != true {
+		t.Errorf("Expected Name to support every clause, got %v", n)
+	}
+	if r := flags["AnnualRevenue"]; r["groupable"] != false || r["aggregatable"] != true {
+		t.Errorf("Expected AnnualRevenue to be aggregatable but not groupable, got %v", r)
+	}
+
+	tests := []struct {
+		query string
+		ok    bool
+	}{
+		{"SELECT Id FROM Account WHERE Name = 'Acme'", true},
+		{"SELECT Id FROM Account WHERE Description = 'Acme'", false},
+		{"SELECT Id FROM Account ORDER BY Description", false},
+		{"SELECT Industry, COUNT(Id) FROM Account GROUP BY Industry", true},
+		{"SELECT AnnualRevenue, COUNT(Id) FROM Account GROUP BY AnnualRevenue", false},
+		{"SELECT MAX(AnnualRevenue) FROM Account", true},
+		{"SELECT MAX(Description) FROM Account", false},
+		{"SELECT Id FROM Secret__c WHERE Token__c = 'x'", false},
+		{"SELECT Id FROM Secret__c ORDER BY Token__c", true},
+	}
+	for _, tt := range tests {
+		_, err := client.Query(tt.query)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.query, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: expected an error", tt.query)
+		}
+	}
+}
+
+// TestQueryNullFilters tests that = null matches every representation of a missing value
+func TestQueryNullFilters(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	store := emu.Store()
+	var noIndustry *string
+	for _, record := range []storage.Record{
+		{"Name": "never set"},
+		{"Name": "explicit nil", "Industry": nil, "AnnualRevenue": nil},
+		{"Name": "typed nil", "Industry": noIndustry},
+		{"Name": "value", "Industry": "Banking", "AnnualRevenue": 500},
+	} {
+		if _, err := store.CreateRecord("Account", record); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+	accountID, _ := store.CreateRecord("Account", storage.Record{"Name": "Parent", "Industry": "Energy"})
+	_, _ = store.CreateRecord("Contact", storage.Record{"LastName": "Orphan"})
+	_, _ = store.CreateRecord("Contact", storage.Record{"LastName": "Child", "AccountId": accountID})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tests := []struct {
+		query string
+		names []string
+	}{
+		{"SELECT Name FROM Account WHERE Industry = null ORDER BY Name", []string{"explicit nil", "never set", "typed nil"}},
+		{"SELECT Name FROM Account WHERE Industry != null ORDER BY Name", []string{"Parent", "value"}},
+		{"SELECT Name FROM Account WHERE AnnualRevenue < 1000", []string{"value"}},
+		{"SELECT LastName FROM Contact WHERE Account.Industry = null", []string{"Orphan"}},
+		{"SELECT LastName FROM Contact WHERE Account.Industry != null", []string{"Child"}},
+	}
+	for _, tt := range tests {
+		result, err := client.Query(tt.query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		var names []string
+		for _, record := range result.Records {
+			name, _ := record["Name"].(string)
+			if name == "" {
+				name, _ = record["LastName"].(string)
+			}
+			names = append(names, name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.names, names)
+		}
+	}
+}
+
+// TestQueryWhereBooleanLogic tests OR, AND and parentheses in WHERE clauses
+func TestQueryWhereBooleanLogic(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	store := emu.Store()
+	for _, record := range []storage.Record{
+		{"Name": "A", "Industry": "Banking", "Rating": "Hot", "NumberOfEmployees": 10},
+		{"Name": "B", "Industry": "Energy", "Rating": "Hot", "NumberOfEmployees": 500},
+		{"Name": "C", "Industry": "Banking", "Rating": "Cold", "NumberOfEmployees": 50},
+		{"Name": "D (or not)", "Industry": "Retail", "Rating": "Warm", "NumberOfEmployees": 5},
+	} {
+		if _, err := store.CreateRecord("Account", record); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	tests := []struct {
+		where string
+		names []string
+	}{
+		{"Industry = 'Banking' OR Industry = 'Energy'", []string{"A", "B", "C"}},
+		{"(Industry = 'Banking' OR Industry = 'Energy') AND Rating = 'Hot'", []string{"A", "B"}},
+		{"Industry = 'Banking' OR Industry = 'Energy' AND Rating = 'Cold'", []string{"A", "C"}},
+		{"Rating = 'Hot' AND (Industry = 'Energy' OR (Industry = 'Banking' AND NumberOfEmployees < 20))", []string{"A", "B"}},
+		{"((Name = 'D (or not)'))", []string{"D (or not)"}},
+		{"Industry IN ('Retail', 'Energy') or Rating = 'Cold'", []string{"B", "C", "D (or not)"}},
+		{"NOT Industry = 'Banking'", []string{"B", "D (or not)"}},
+		{"NOT (Industry = 'Banking' OR Rating = 'Hot') OR Name = 'A'", []string{"A", "D (or not)"}},
+		{"Industry NOT IN ('Banking', 'Retail')", []string{"B"}},
+	}
+	for _, tt := range tests {
+		query := "SELECT Name FROM Account WHERE " + tt.where + " ORDER BY Name"
+		result, err := client.Query(query)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var names []string
+		for _, record := range result.Records {
+			names = append(names, record["Name"].(string))
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("%s: expected %v, got %v", query, tt.names, names)
+		}
+	}
+
+	if _, err := client.Query("SELECT Name FROM Account WHERE (Industry = 'Banking'"); err == nil {
+		t.Error("Expected an error for unbalanced parentheses")
+	}
+
+	// A comparison the engine cannot parse fails rather than matching everything
+	for _, where := range []string{
+		"Industry = 'Banking' OR Name INCLUDES ('A')",
+		"Industry = 'Banking' AND",
+		"CreatedDate > 2024-01-01T00:00:00Z",
+	} {
+		path := "/services/data/v58.0/query?q=" + url.QueryEscape("SELECT Name FROM Account WHERE "+where)
+		resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "MALFORMED_QUERY") {
+			t.Errorf("%s: expected 400 MALFORMED_QUERY, got %d: %s", where, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestQuerySystemObjects tests the seeded Organization and Profile records and UserRole
+func TestQuerySystemObjects(t *testing.T) {
+	emu := emulator.New(emulator.WithOrganization("00D5g000001AbCdEAF", "Acme Corp"))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	result, err := client.Query("SELECT Id, Name, InstanceName FROM Organization LIMIT 1")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 1 {
+		t.Fatalf("Expected one Organization, got %d", result.TotalSize)
+	}
+	org := result.Records[0]
+	if org["Id"] != "00D5g000001AbCdEAF" || org["Name"] != "Acme Corp" || !strings.Contains(baseURL, org["InstanceName"].(string)) {
+		t.Errorf("Unexpected Organization: %v", org)
+	}
+	if _, err := client.CreateRecord("Organization", map[string]interface{}{"Name": "Second"}); err == nil {
+		t.Error("Expected creating a second Organization to fail")
+	}
+
+	// The default user has the System Administrator profile
+	result, err = client.Query("SELECT Profile.Name FROM User WHERE Id = '" + emu.Store().GetDefaultUserID() + "'")
+	if err != nil || result.TotalSize != 1 {
+		t.Fatalf("Query failed: %v (%v)", err, result)
+	}
+	if profile, _ := result.Records[0]["Profile"].(map[string]interface{}); profile["Name"] != "System Administrator" {
+		t.Errorf("Expected the System Administrator profile, got %v", result.Records[0])
+	}
+
+	if _, err := client.CreateRecord("UserRole", map[string]interface{}{"Name": "CEO"}); err != nil {
+		t.Fatalf("CreateRecord UserRole failed: %v", err)
+	}
+	result, err = client.Query("SELECT Name FROM UserRole")
+	if err != nil || result.TotalSize != 1 || result.Records[0]["Name"] != "CEO" {
+		t.Errorf("Expected the CEO role, got %v (%v)", result, err)
+	}
+}
+
+// TestQueryVersusQueryAll tests queryAll returning the deleted and archived
+// records query leaves out
+func TestQueryVersusQueryAll(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	ids, err := testutil.NewFixtures(emu.Store()).LoadSampleAccounts(3)
+	if err != nil {
+		t.Fatalf("Failed to load fixtures: %v", err)
+	}
+	if err := client.DeleteRecord("Account", ids[0]); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+	for _, archived := range []bool{false, true} {
+		if _, err := emu.Store().CreateRecord("Task", storage.Record{"Subject": "Call", "IsArchived": archived}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		live     int
+		all      int
+		deleted  int
+		archived int
+	}{
+		{"SELECT Id, IsDeleted FROM Account", 2, 3, 1, 0},
+		{"SELECT Id, IsDeleted, IsArchived FROM Task", 1, 2, 0, 1},
+		{"SELECT COUNT() FROM Account", 2, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			for _, endpoint := range []string{"query", "queryAll"} {
+				resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/"+endpoint+"?q="+url.QueryEscape(tt.query), nil, nil)
+				var result struct {
+					TotalSize int                      `json:"totalSize"`
+					Records   []map[string]interface{} `json:"records"`
+				}
+				if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &result) != nil {
+					t.Fatalf("%s failed: %d %s", endpoint, resp.StatusCode, body)
+				}
+
+				want := tt.live
+				if endpoint == "queryAll" {
+					want = tt.all
+				}
+				if result.TotalSize != want {
+					t.Errorf("%s: expected totalSize %d, got %d", endpoint, want, result.TotalSize)
+				}
+
+				deleted, archived := 0, 0
+				for _, record := range result.Records {
+					if record["IsDeleted"] == true {
+						deleted++
+					}
+					if record["IsArchived"] == true {
+						archived++
+					}
+				}
+				if endpoint == "queryAll" && (deleted != tt.deleted || archived != tt.archived) {
+					t.Errorf("queryAll: expected %d deleted and %d archived, got %d and %d", tt.deleted, tt.archived, deleted, archived)
+				}
+				if endpoint == "query" && deleted+archived != 0 {
+					t.Errorf("query: expected no deleted or archived records, got %d and %d", deleted, archived)
+				}
+			}
+		})
+	}
+}
+
+// TestToolingQuery tests SOQL against the Tooling API objects
+func TestToolingQuery(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	if _, err := testutil.NewFixtures(emu.Store()).LoadSampleApexClasses(3); err != nil {
+		t.Fatalf("LoadSampleApexClasses failed: %v", err)
+	}
+	if err := emu.Store().AddField("Account", storage.FieldDefinition{
+		Name: "Region__c", Label: "Region", Type: storage.FieldTypeString, Length: 40,
+		Nillable: true, Createable: true, Updateable: true,
+	}); err != nil {
+		t.Fatalf("AddField failed: %v", err)
+	}
+
+	toolingQuery := func(q string) map[string]interface{} {
+		t.Helper()
+		resp, body := doRequest(t, client, "GET", "/services/data/v58.0/tooling/query?q="+url.QueryEscape(q), nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 for %q, got %d: %s", q, resp.StatusCode, body)
+		}
+		var result map[string]interface{}
+		if err := json.Unmarshal(body, &result); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return result
+	}
+
+	result := toolingQuery("SELECT Id, Name, Status FROM ApexClass WHERE Name LIKE 'SampleClass%' ORDER BY Name")
+	records, _ := result["records"].([]interface{})
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 ApexClass rows, got %v", result)
+	}
+	first := records[0].(map[string]interface{})
+	if first["Name"] != "SampleClass1" || first["Status"] != "Active" {
+		t.Errorf("Unexpected ApexClass row: %v", first)
+	}
+	if id, _ := first["Id"].(string); !strings.HasPrefix(id, "01p") {
+		t.Errorf("Expected an 01p ApexClass ID, got %v", first["Id"])
+	}
+
+	result = toolingQuery("SELECT QualifiedApiName, KeyPrefix FROM EntityDefinition WHERE QualifiedApiName = 'Account'")
+	records, _ = result["records"].([]interface{})
+	if len(records) != 1 || records[0].(map[string]interface{})["KeyPrefix"] != "001" {
+		t.Errorf("Expected the Account EntityDefinition, got %v", result)
+	}
+
+	result = toolingQuery("SELECT DeveloperName, TableEnumOrId FROM CustomField WHERE TableEnumOrId = 'Account'")
+	records, _ = result["records"].([]interface{})
+	if len(records) != 1 || records[0].(map[string]interface{})["DeveloperName"] != "Region" {
+		t.Errorf("Expected the Region__c CustomField, got %v", result)
+	}
+
+	// Tooling objects are not visible to the data API
+	resp, body := doRequest(t, client, "GET", "/services/data/v58.0/query?q="+url.QueryEscape("SELECT Id FROM ApexClass"), nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 querying ApexClass through /query, got %d: %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,1425 @@
+package integration_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/rest"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// TestUpdateRecordReturnRepresentation tests PATCH returning the updated record
+func TestUpdateRecordReturnRepresentation(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Original", "Industry": "Banking"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	path := "/services/data/v58.0/sobjects/Account/" + created.ID
+
+	// Default PATCH returns 204
+	resp, _ := doRequest(t, client, http.MethodPatch, path, map[string]interface{}{"Name": "First"}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+
+	// Prefer: return=representation returns the full record
+	resp, body := doRequest(t, client, http.MethodPatch, path, map[string]interface{}{"Name": "Second"},
+		map[string]string{"Prefer": "return=representation"})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(body, &record); err != nil {
+		t.Fatalf("Failed to decode record: %v", err)
+	}
+	if record["Name"] != "Second" || record["Industry"] != "Banking" {
+		t.Errorf("Expected merged record, got %v", record)
+	}
+
+	// POST with ?_HttpMethod=PATCH is treated as an update
+	resp, _ = doRequest(t, client, http.MethodPost, path+"?_HttpMethod=PATCH", map[string]interface{}{"Name": "Third"}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	result, err := client.GetRecord("Account", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if result["Name"] != "Third" {
+		t.Errorf("Expected Name='Third', got %v", result["Name"])
+	}
+
+	// Other methods cannot be tunneled
+	resp, body = doRequest(t, client, http.MethodPost, path+"?_HttpMethod=DELETE", nil, nil)
+	if resp.StatusCode != http.StatusMethodNotAllowed || !strings.Contains(string(body), "METHOD_NOT_ALLOWED") {
+		t.Errorf("Expected 405 METHOD_NOT_ALLOWED, got %d: %s", resp.StatusCode, body)
+	}
+	if _, err := client.GetRecord("Account", created.ID); err != nil {
+		t.Errorf("Expected the record to survive, got %v", err)
+	}
+}
+
+// TestGetRecordUpdateMru tests GET with updateMru feeding the RecentlyViewed object
+func TestGetRecordUpdateMru(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	ids := []string{}
+	for _, name := range []string{"First", "Second", "Unviewed"} {
+		created, err := client.CreateRecord("Account", map[string]interface{}{"Name": name})
+		if err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	for _, id := range ids[:2] {
+		resp, body := doRequest(t, client, "GET", "/services/data/v58.0/sobjects/Account/"+id+"?updateMru=true", nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", resp.StatusCode, body)
+		}
+	}
+	if _, err := client.GetRecord("Account", ids[2]); err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+
+	result, err := client.Query("SELECT Id, Name, Type FROM RecentlyViewed")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 2 {
+		t.Fatalf("Expected 2 recently viewed records, got %d", len(result.Records))
+	}
+	if result.Records[0]["Name"] != "Second" || result.Records[1]["Name"] != "First" {
+		t.Errorf("Expected most recently viewed first, got %v", result.Records)
+	}
+	if result.Records[0]["Type"] != "Account" {
+		t.Errorf("Expected Type='Account', got %v", result.Records[0]["Type"])
+	}
+
+	// A deleted record is not found, and viewing it leaves the list alone
+	if err := client.DeleteRecord("Account", ids[2]); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+	resp, body := doRequest(t, client, "GET", "/services/data/v58.0/sobjects/Account/"+ids[2]+"?updateMru=true", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("Expected 404 for a deleted record, got %d: %s", resp.StatusCode, body)
+	}
+	result, err = client.Query("SELECT Id FROM RecentlyViewed")
+	if err != nil || len(result.Records) != 2 {
+		t.Errorf("Expected the deleted record to stay out of RecentlyViewed, got %v (%v)", result, err)
+	}
+	deleted, _ := emu.Store().GetAllRecordsWithDeleted("Account")
+	for _, record := range deleted {
+		if record["Id"] == ids[2] && record["LastViewedDate"] != nil {
+			t.Errorf("Expected no LastViewedDate on the deleted record, got %v", record["LastViewedDate"])
+		}
+	}
+}
+
+// TestOpportunityStageProbability tests Probability defaulting from StageName
+func TestOpportunityStageProbability(t *testing.T) {
+	emu := emulator.New(emulator.WithStageProbabilities(map[string]float64{
+		"Prospecting": 15,
+		"Closed Won":  100,
+	}))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Opportunity", map[string]interface{}{
+		"Name":      "Deal",
+		"StageName": "Prospecting",
+		"CloseDate": "2025-12-31",
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	record, err := client.GetRecord("Opportunity", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if record["Probability"] != float64(15) {
+		t.Errorf("Expected Probability=15, got %v", record["Probability"])
+	}
+
+	if err := client.UpdateRecord("Opportunity", created.ID, map[string]interface{}{"StageName": "Closed Won"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	record, _ = client.GetRecord("Opportunity", created.ID)
+	if record["Probability"] != float64(100) {
+		t.Errorf("Expected Probability=100 after stage change, got %v", record["Probability"])
+	}
+
+	// An explicit Probability is kept
+	if err := client.UpdateRecord("Opportunity", created.ID, map[string]interface{}{"StageName": "Prospecting", "Probability": 42}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	record, _ = client.GetRecord("Opportunity", created.ID)
+	if record["Probability"] != float64(42) {
+		t.Errorf("Expected explicit Probability=42, got %v", record["Probability"])
+	}
+}
+
+// TestTruncate tests removing every record of one object type
+func TestTruncate(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	for _, name := range []string{"One", "Two"} {
+		if _, err := client.CreateRecord("Account", map[string]interface{}{"Name": name}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+	if _, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": "Kept"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	if err := emu.Store().Truncate("Account"); err != nil {
+		t.Fatalf("Truncate failed: %v", err)
+	}
+	if err := emu.Store().Truncate("Unknown__c"); err == nil {
+		t.Error("Expected error truncating unknown object type")
+	}
+
+	counts := emu.Store().GetRecordCounts([]string{"Account", "Contact"})
+	if counts["Account"] != 0 || counts["Contact"] != 1 {
+		t.Errorf("Expected 0 accounts and 1 contact, got %v", counts)
+	}
+
+	// The admin endpoint truncates over HTTP
+	resp, _ := doRequest(t, client, http.MethodDelete, "/_emulator/sobjects/Contact", nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if counts := emu.Store().GetRecordCounts([]string{"Contact"}); counts["Contact"] != 0 {
+		t.Errorf("Expected 0 contacts, got %v", counts)
+	}
+
+	resp, _ = doRequest(t, client, http.MethodDelete, "/_emulator/sobjects/Unknown__c", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", resp.StatusCode)
+	}
+}
+
+// TestFieldHistoryTracking tests tracked field changes being queryable as history
+func TestFieldHistoryTracking(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	if err := emu.Store().EnableFieldHistory("Account", "Industry", "Rating"); err != nil {
+		t.Fatalf("EnableFieldHistory failed: %v", err)
+	}
+	if err := emu.Store().EnableFieldHistory("Nope__c", "Name"); err == nil {
+		t.Error("Expected error enabling history on an unknown object")
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme", "Industry": "Banking"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	updates := []map[string]interface{}{
+		{"Industry": "Technology"},
+		{"Phone": "555-0100"},              // not tracked
+		{"Industry": "Technology"},         // unchanged
+		{"Rating": "Hot", "Name": "Acme2"}, // only Rating is tracked
+	}
+	for _, update := range updates {
+		if err := client.UpdateRecord("Account", created.ID, update); err != nil {
+			t.Fatalf("UpdateRecord failed: %v", err)
+		}
+	}
+
+	result, err := client.Query("SELECT Id, Field, OldValue, NewValue, CreatedDate FROM AccountHistory WHERE AccountId = '" + created.ID + "' ORDER BY Field")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 2 {
+		t.Fatalf("Expected 2 history entries, got %d: %v", result.TotalSize, result.Records)
+	}
+
+	industry := result.Records[0]
+	if industry["Field"] != "Industry" || industry["OldValue"] != "Banking" || industry["NewValue"] != "Technology" || industry["CreatedDate"] == nil {
+		t.Errorf("Unexpected Industry history: %v", industry)
+	}
+	rating := result.Records[1]
+	if rating["Field"] != "Rating" || rating["OldValue"] != nil || rating["NewValue"] != "Hot" {
+		t.Errorf("Unexpected Rating history: %v", rating)
+	}
+
+	// Each history object has a key prefix of its own
+	if err := emu.Store().EnableFieldHistory("Contact", "LastName"); err != nil {
+		t.Fatalf("EnableFieldHistory failed: %v", err)
+	}
+	contact, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": "Before"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if err := client.UpdateRecord("Contact", contact.ID, map[string]interface{}{"LastName": "After"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	contactHistory, err := client.Query("SELECT Id FROM ContactHistory")
+	if err != nil || contactHistory.TotalSize != 1 {
+		t.Fatalf("Expected 1 ContactHistory entry, got %v (%v)", contactHistory, err)
+	}
+	accountID, contactID := industry["Id"].(string), contactHistory.Records[0]["Id"].(string)
+	if accountID[:3] == contactID[:3] {
+		t.Errorf("Expected distinct key prefixes, got %s and %s", accountID, contactID)
+	}
+	if got := emu.Store().ObjectTypeForID(accountID); got != "AccountHistory" {
+		t.Errorf("Expected %s to be an AccountHistory ID, got %q", accountID, got)
+	}
+	if got := emu.Store().ObjectTypeForID(contactID); got != "ContactHistory" {
+		t.Errorf("Expected %s to be a ContactHistory ID, got %q", contactID, got)
+	}
+}
+
+// TestStoreReadsReturnCopies tests that mutating records returned by the store leaves it unchanged
+func TestStoreReadsReturnCopies(t *testing.T) {
+	emu := emulator.New()
+	store := emu.Store()
+	if err := store.AddField("Account", storage.FieldDefinition{Name: "Tags__c", Type: storage.FieldTypeMultiPicklist, Nillable: true, Createable: true, Updateable: true}); err != nil {
+		t.Fatalf("AddField failed: %v", err)
+	}
+
+	input := storage.Record{"Name": "Acme", "Tags__c": []interface{}{"a", "b"}}
+	id, err := store.CreateRecord("Account", input)
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	input["Name"] = "Changed after create"
+	input["Tags__c"].([]interface{})[0] = "changed"
+
+	record, err := store.GetRecord("Account", id)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	record["Name"] = "Mutated"
+	record["attributes"].(map[string]interface{})["type"] = "Mutated"
+	record["Tags__c"].([]interface{})[1] = "mutated"
+
+	records, err := store.GetAllRecords("Account")
+	if err != nil {
+		t.Fatalf("GetAllRecords failed: %v", err)
+	}
+	records[0]["Industry"] = "Mutated"
+
+	stored, _ := store.GetRecord("Account", id)
+	if stored["Name"] != "Acme" {
+		t.Errorf("Expected Name='Acme', got %v", stored["Name"])
+	}
+	if stored["attributes"].(map[string]interface{})["type"] != "Account" {
+		t.Errorf("Expected attributes type 'Account', got %v", stored["attributes"])
+	}
+	if tags := stored["Tags__c"].([]interface{}); tags[0] != "a" || tags[1] != "b" {
+		t.Errorf("Expected Tags__c [a b], got %v", tags)
+	}
+	if _, ok := stored["Industry"]; ok {
+		t.Errorf("Expected no Industry, got %v", stored["Industry"])
+	}
+}
+
+// TestRecycleBin tests a deleted record through getDeleted, queryAll and undelete
+func TestRecycleBin(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Binned"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	before := time.Now().UTC().Add(-time.Second)
+	if err := client.DeleteRecord("Account", created.ID); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+	if err := client.DeleteRecord("Account", created.ID); err == nil {
+		t.Error("Expected deleting an already deleted record to fail")
+	}
+
+	// getDeleted reports the record with its deletion time
+	path := "/services/data/v58.0/sobjects/Account/deleted/?start=" + url.QueryEscape(before.Format(time.RFC3339)) +
+		"&end=" + url.QueryEscape(time.Now().UTC().Add(time.Minute).Format(time.RFC3339))
+	resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from getDeleted, got %d: %s", resp.StatusCode, body)
+	}
+	var deleted struct {
+		DeletedRecords []struct {
+			ID          string `json:"id"`
+			DeletedDate string `json:"deletedDate"`
+		} `json:"deletedRecords"`
+	}
+	if err := json.Unmarshal(body, &deleted); err != nil {
+		t.Fatalf("Failed to decode getDeleted response: %v", err)
+	}
+	if len(deleted.DeletedRecords) != 1 || deleted.DeletedRecords[0].ID != created.ID {
+		t.Fatalf("Expected the deleted account, got %s", body)
+	}
+	deletedDate, err := time.Parse("2006-01-02T15:04:05.000-0700", deleted.DeletedRecords[0].DeletedDate)
+	if err != nil || deletedDate.Before(before) {
+		t.Errorf("Unexpected deletedDate %q", deleted.DeletedRecords[0].DeletedDate)
+	}
+
+	// query hides the record, queryAll and ALL ROWS show it as deleted
+	soql := "SELECT Id, IsDeleted FROM Account WHERE Id = '" + created.ID + "'"
+	if result, err := client.Query(soql); err != nil || result.TotalSize != 0 {
+		t.Errorf("Expected query to hide the deleted record, got %v (%v)", result, err)
+	}
+	resp, body = doRequest(t, client, http.MethodGet, "/services/data/v58.0/queryAll?q="+url.QueryEscape(soql), nil, nil)
+	var queryAll struct {
+		TotalSize int                      `json:"totalSize"`
+		Records   []map[string]interface{} `json:"records"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &queryAll) != nil {
+		t.Fatalf("queryAll failed: %d %s", resp.StatusCode, body)
+	}
+	if queryAll.TotalSize != 1 || queryAll.Records[0]["IsDeleted"] != true {
+		t.Errorf("Expected queryAll to return the deleted record, got %s", body)
+	}
+	if result, err := client.Query(soql + " ALL ROWS"); err != nil || result.TotalSize != 1 {
+		t.Errorf("Expected ALL ROWS to return the deleted record, got %v (%v)", result, err)
+	}
+
+	// undelete restores it everywhere
+	if err := emu.Store().UndeleteRecord("Account", created.ID); err != nil {
+		t.Fatalf("UndeleteRecord failed: %v", err)
+	}
+	if err := emu.Store().UndeleteRecord("Account", created.ID); err == nil {
+		t.Error("Expected undeleting a live record to fail")
+	}
+	record, err := emu.Store().GetRecord("Account", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord after undelete failed: %v", err)
+	}
+	if record["IsDeleted"] != false || record["SystemModstamp"] == nil {
+		t.Errorf("Unexpected undeleted record: %v", record)
+	}
+	if result, err := client.Query(soql); err != nil || result.TotalSize != 1 {
+		t.Errorf("Expected query to return the undeleted record, got %v (%v)", result, err)
+	}
+	_, body = doRequest(t, client, http.MethodGet, path, nil, nil)
+	if err := json.Unmarshal(body, &deleted); err != nil || len(deleted.DeletedRecords) != 0 {
+		t.Errorf("Expected no deleted records after undelete, got %s", body)
+	}
+}
+
+// TestGetUpdatedAndDeleted tests replication windows on either side of a time boundary
+func TestGetUpdatedAndDeleted(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	modified, _ := client.CreateRecord("Account", map[string]interface{}{"Name": "Modified"})
+	removed, _ := client.CreateRecord("Account", map[string]interface{}{"Name": "Removed"})
+	untouched, _ := client.CreateRecord("Account", map[string]interface{}{"Name": "Untouched"})
+
+	// SystemModstamp has second precision, so wait for the next second
+	boundary := time.Now().UTC().Truncate(time.Second).Add(time.Second)
+	time.Sleep(time.Until(boundary))
+
+	_ = client.UpdateRecord("Account", modified.ID, map[string]interface{}{"Name": "Modified again"})
+	created, _ := client.CreateRecord("Account", map[string]interface{}{"Name": "Created"})
+	_ = client.DeleteRecord("Account", removed.ID)
+
+	window := func(kind string, start, end time.Time) []byte {
+		path := "/services/data/v58.0/sobjects/Account/" + kind + "/?start=" + url.QueryEscape(start.Format(time.RFC3339)) +
+			"&end=" + url.QueryEscape(end.Format(time.RFC3339))
+		resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 from %s, got %d: %s", kind, resp.StatusCode, body)
+		}
+		return body
+	}
+	updatedIDs := func(start, end time.Time) []string {
+		var updated struct {
+			IDs               []string `json:"ids"`
+			LatestDateCovered string   `json:"latestDateCovered"`
+		}
+		body := window("updated", start, end)
+		if err := json.Unmarshal(body, &updated); err != nil || updated.IDs == nil || updated.LatestDateCovered == "" {
+			t.Fatalf("Unexpected getUpdated response: %s", body)
+		}
+		return updated.IDs
+	}
+	deletedIDs := func(start, end time.Time) []string {
+		var deleted struct {
+			DeletedRecords []struct {
+				ID string `json:"id"`
+			} `json:"deletedRecords"`
+		}
+		if err := json.Unmarshal(window("deleted", start, end), &deleted); err != nil {
+			t.Fatalf("Failed to decode getDeleted response: %v", err)
+		}
+		var ids []string
+		for _, record := range deleted.DeletedRecords {
+			ids = append(ids, record.ID)
+		}
+		return ids
+	}
+
+	later := boundary.Add(time.Minute)
+	if ids := updatedIDs(boundary, later); strings.Join(ids, ",") != modified.ID+","+created.ID {
+		t.Errorf("Expected the modified and created accounts after the boundary, got %v", ids)
+	}
+	if ids := updatedIDs(boundary.Add(-time.Hour), boundary.Add(-time.Second)); strings.Join(ids, ",") != untouched.ID {
+		t.Errorf("Expected only the untouched account before the boundary, got %v", ids)
+	}
+	if ids := deletedIDs(boundary, later); strings.Join(ids, ",") != removed.ID {
+		t.Errorf("Expected the removed account after the boundary, got %v", ids)
+	}
+	if ids := deletedIDs(boundary.Add(-time.Hour), boundary.Add(-time.Second)); len(ids) != 0 {
+		t.Errorf("Expected no deletions before the boundary, got %v", ids)
+	}
+}
+
+// TestCreateUpdateWarnings tests warnings attached to successful writes by the warning hook
+func TestCreateUpdateWarnings(t *testing.T) {
+	emu := emulator.New(emulator.WithWarnings(func(operation, objectType string, record storage.Record) []rest.Warning {
+		if _, ok := record["CreatedDate"]; ok {
+			return []rest.Warning{{Message: operation + " ignored CreatedDate on " + objectType, Fields: []string{"CreatedDate"}}}
+		}
+		return nil
+	}))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	var created struct {
+		ID       string         `json:"id"`
+		Warnings []rest.Warning `json:"warnings"`
+	}
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account",
+		map[string]interface{}{"Name": "Acme", "CreatedDate": "2020-01-01T00:00:00Z"}, nil)
+	if resp.StatusCode != http.StatusCreated || json.Unmarshal(body, &created) != nil {
+		t.Fatalf("Create failed: %d %s", resp.StatusCode, body)
+	}
+	if len(created.Warnings) != 1 || created.Warnings[0].Message != "create ignored CreatedDate on Account" {
+		t.Errorf("Expected a create warning, got %s", body)
+	}
+
+	// Without warnings the responses keep their usual shape
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account", map[string]interface{}{"Name": "Plain"}, nil)
+	var plain map[string]interface{}
+	if err := json.Unmarshal(body, &plain); err != nil || resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Create failed: %d %s", resp.StatusCode, body)
+	}
+	if _, ok := plain["warnings"]; ok {
+		t.Errorf("Expected no warnings field, got %s", body)
+	}
+	path := "/services/data/v58.0/sobjects/Account/" + created.ID
+	if resp, _ := doRequest(t, client, http.MethodPatch, path, map[string]interface{}{"Phone": "555"}, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 for an update without warnings, got %d", resp.StatusCode)
+	}
+
+	// An update with warnings returns them in a 200 body
+	resp, body = doRequest(t, client, http.MethodPatch, path, map[string]interface{}{"CreatedDate": "2020-01-01T00:00:00Z"}, nil)
+	var updated struct {
+		Success  bool           `json:"success"`
+		Warnings []rest.Warning `json:"warnings"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &updated) != nil || !updated.Success {
+		t.Fatalf("Expected 200 with warnings, got %d %s", resp.StatusCode, body)
+	}
+	if len(updated.Warnings) != 1 || updated.Warnings[0].Fields[0] != "CreatedDate" {
+		t.Errorf("Expected an update warning, got %s", body)
+	}
+}
+
+// TestGetRecordOmitsIsDeleted tests IsDeleted only appearing in GET responses that ask for it
+func TestGetRecordOmitsIsDeleted(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  []emulator.Option
+		query    string
+		expected bool
+	}{
+		{"default GET", nil, "", false},
+		{"requested field", nil, "?fields=Name,IsDeleted", true},
+		{"system fields enabled", []emulator.Option{emulator.WithSystemFields()}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emu := emulator.New(tt.options...)
+			baseURL := emu.Start()
+			defer emu.Stop()
+
+			client := createAuthenticatedClient(t, emu, baseURL)
+			created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme"})
+			if err != nil {
+				t.Fatalf("CreateRecord failed: %v", err)
+			}
+
+			resp, body := doRequest(t, client, http.MethodGet, "/services/data/v58.0/sobjects/Account/"+created.ID+tt.query, nil, nil)
+			var record map[string]interface{}
+			if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &record) != nil {
+				t.Fatalf("GET failed: %d %s", resp.StatusCode, body)
+			}
+			if _, ok := record["IsDeleted"]; ok != tt.expected {
+				t.Errorf("Expected IsDeleted present=%v, got %s", tt.expected, body)
+			}
+			if record["Name"] != "Acme" {
+				t.Errorf("Expected Name in the response, got %s", body)
+			}
+		})
+	}
+}
+
+// TestWriteAttributesType tests attributes being stripped on every write path
+// and rejected when their type does not match the target object
+func TestWriteAttributesType(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account", map[string]interface{}{
+		"attributes": map[string]interface{}{"type": "Account", "url": "/bogus"},
+		"Name":       "Acme",
+	}, nil)
+	if resp.StatusCode != http.StatusCreated || json.Unmarshal(body, &created) != nil {
+		t.Fatalf("Create failed: %d %s", resp.StatusCode, body)
+	}
+	record, _ := emu.Store().GetRecord("Account", created.ID)
+	if attrs, _ := record["attributes"].(map[string]interface{}); attrs["url"] == "/bogus" {
+		t.Errorf("Expected client attributes to be discarded, got %v", attrs)
+	}
+
+	path := "/services/data/v58.0/sobjects/Account/" + created.ID
+	mismatched := map[string]interface{}{
+		"attributes": map[string]interface{}{"type": "Contact"},
+		"Name":       "Wrong",
+	}
+	for _, method := range []string{http.MethodPost, http.MethodPatch} {
+		target := "/services/data/v58.0/sobjects/Account"
+		if method == http.MethodPatch {
+			target = path
+		}
+		resp, body = doRequest(t, client, method, target, mismatched, nil)
+		var errs []map[string]interface{}
+		if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0]["errorCode"] != "INVALID_TYPE" {
+			t.Errorf("%s: expected 400 INVALID_TYPE, got %d %s", method, resp.StatusCode, body)
+		}
+	}
+
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite", map[string]interface{}{
+		"compositeRequest": []map[string]interface{}{
+			{"method": "PATCH", "url": path, "referenceId": "bad", "body": mismatched},
+		},
+	}, nil)
+	var composite struct {
+		CompositeResponse []struct {
+			HTTPStatusCode int `json:"httpStatusCode"`
+		} `json:"compositeResponse"`
+	}
+	if err := json.Unmarshal(body, &composite); err != nil || len(composite.CompositeResponse) != 1 {
+		t.Fatalf("Composite failed: %d %s", resp.StatusCode, body)
+	}
+	if composite.CompositeResponse[0].HTTPStatusCode != http.StatusBadRequest {
+		t.Errorf("Expected a 400 subresponse, got %s", body)
+	}
+
+	record, _ = emu.Store().GetRecord("Account", created.ID)
+	if record["Name"] != "Acme" {
+		t.Errorf("Expected mismatched writes to be rejected, got Name %v", record["Name"])
+	}
+}
+
+// TestNumericScaleAndPrecision tests currency values being rounded to their
+// scale and rejected beyond their precision
+func TestNumericScaleAndPrecision(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme", "AnnualRevenue": 1234.567})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	record, _ := emu.Store().GetRecord("Account", created.ID)
+	if record["AnnualRevenue"] != 1234.57 {
+		t.Errorf("Expected AnnualRevenue rounded to 1234.57, got %v", record["AnnualRevenue"])
+	}
+
+	// Numbers sent as strings are rounded and range checked the same way
+	fromString, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme String", "AnnualRevenue": "98.765"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	record, _ = emu.Store().GetRecord("Account", fromString.ID)
+	if record["AnnualRevenue"] != 98.77 {
+		t.Errorf("Expected AnnualRevenue \"98.765\" rounded to 98.77, got %T %v", record["AnnualRevenue"], record["AnnualRevenue"])
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   map[string]interface{}
+	}{
+		{"create", http.MethodPost, "/services/data/v58.0/sobjects/Opportunity",
+			map[string]interface{}{"Name": "Huge", "StageName": "Prospecting", "CloseDate": "2025-01-01", "Amount": 1e14}},
+		{"update", http.MethodPatch, "/services/data/v58.0/sobjects/Account/" + created.ID,
+			map[string]interface{}{"Name": "Changed", "AnnualRevenue": -1e16}},
+		{"string", http.MethodPatch, "/services/data/v58.0/sobjects/Account/" + created.ID,
+			map[string]interface{}{"Name": "Changed", "AnnualRevenue": "10000000000000000"}},
+	}
+	for _, tt := range tests {
+		resp, body := doRequest(t, client, tt.method, tt.path, tt.body, nil)
+		var errs []map[string]interface{}
+		if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0]["errorCode"] != "FIELD_INTEGRITY_EXCEPTION" {
+			t.Errorf("%s: expected 400 FIELD_INTEGRITY_EXCEPTION, got %d %s", tt.name, resp.StatusCode, body)
+		}
+	}
+
+	// A rejected update leaves the record untouched
+	record, _ = emu.Store().GetRecord("Account", created.ID)
+	if record["Name"] != "Acme" || record["AnnualRevenue"] != 1234.57 {
+		t.Errorf("Expected the record to be unchanged, got %v", record)
+	}
+}
+
+// TestUpsertByExternalID tests the create, update and multiple match branches of upsert
+func TestUpsertByExternalID(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Supplier__c",
+		Label:      "Supplier",
+		Custom:     true,
+		Createable: true,
+		Updateable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true, Updateable: true},
+			{Name: "External_Id__c", Type: storage.FieldTypeString, Createable: true, Updateable: true, ExternalId: true},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	path := "/services/data/v58.0/sobjects/Supplier__c/External_Id__c/"
+
+	resp, body := doRequest(t, client, http.MethodPatch, path+"ABC123", map[string]interface{}{"Name": "Acme"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	var created struct {
+		ID      string `json:"id"`
+		Success bool   `json:"success"`
+		Created bool   `json:"created"`
+	}
+	if err := json.Unmarshal(body, &created); err != nil || created.ID == "" || !created.Success || !created.Created {
+		t.Fatalf("Expected a created response, got %s", body)
+	}
+
+	resp, body = doRequest(t, client, http.MethodPatch, path+"ABC123", map[string]interface{}{"Name": "Acme Corp"}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", resp.StatusCode, body)
+	}
+	record, err := client.GetRecord("Supplier__c", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if record["Name"] != "Acme Corp" || record["External_Id__c"] != "ABC123" {
+		t.Errorf("Expected the upsert to update the record, got %v", record)
+	}
+
+	_, _ = emu.Store().CreateRecord("Supplier__c", map[string]interface{}{"Name": "Copy", "External_Id__c": "ABC123"})
+	resp, body = doRequest(t, client, http.MethodPatch, path+"ABC123", map[string]interface{}{"Name": "Ambiguous"}, nil)
+	if resp.StatusCode != http.StatusMultipleChoices || !strings.Contains(string(body), "MULTIPLE_CHOICES") {
+		t.Errorf("Expected 300 MULTIPLE_CHOICES, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = doRequest(t, client, http.MethodPatch, "/services/data/v58.0/sobjects/Supplier__c/Name/Acme", map[string]interface{}{}, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a field that is not an external ID, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+// TestUpsertMatching tests that upsert matches external IDs case-insensitively
+// unless the field is case-sensitive, and creates one record under concurrency
+func TestUpsertMatching(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	_ = emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Supplier__c",
+		Label:      "Supplier",
+		Custom:     true,
+		Createable: true,
+		Updateable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true, Updateable: true},
+			{Name: "External_Id__c", Type: storage.FieldTypeString, Createable: true, Updateable: true, ExternalId: true, Nillable: true},
+			{Name: "Code__c", Type: storage.FieldTypeString, Createable: true, Updateable: true, ExternalId: true, CaseSensitive: true, Nillable: true},
+		},
+	})
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	path := "/services/data/v58.0/sobjects/Supplier__c/"
+
+	resp, body := doRequest(t, client, http.MethodPatch, path+"External_Id__c/ABC123", map[string]interface{}{"Name": "Acme"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	resp, body = doRequest(t, client, http.MethodPatch, path+"External_Id__c/abc123", map[string]interface{}{"Name": "Acme Corp"}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected a differently cased value to update, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = doRequest(t, client, http.MethodPatch, path+"Code__c/X1", map[string]interface{}{"Name": "Upper"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", resp.StatusCode, body)
+	}
+	resp, body = doRequest(t, client, http.MethodPatch, path+"Code__c/x1", map[string]interface{}{"Name": "Lower"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("Expected a case-sensitive field to create a new record, got %d: %s", resp.StatusCode, body)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, _ = emu.Store().UpsertRecordAs("", "Supplier__c", "External_Id__c", "NEW1", storage.Record{"Name": "Concurrent"})
+		}()
+	}
+	wg.Wait()
+
+	result, err := client.Query("SELECT Id FROM Supplier__c WHERE External_Id__c = 'NEW1'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if result.TotalSize != 1 {
+		t.Errorf("Expected concurrent upserts to create one record, got %d", result.TotalSize)
+	}
+}
+
+// TestRequiredFields tests creates and updates missing required fields
+func TestRequiredFields(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Acme"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   map[string]interface{}
+		fields []string
+	}{
+		{"contact without LastName", http.MethodPost, "/services/data/v58.0/sobjects/Contact",
+			map[string]interface{}{"FirstName": "Ann"}, []string{"LastName"}},
+		{"empty opportunity", http.MethodPost, "/services/data/v58.0/sobjects/Opportunity",
+			map[string]interface{}{"Amount": 100}, []string{"Name", "CloseDate", "StageName"}},
+		{"blank account name", http.MethodPost, "/services/data/v58.0/sobjects/Account",
+			map[string]interface{}{"Name": ""}, []string{"Name"}},
+		{"clearing account name", http.MethodPatch, "/services/data/v58.0/sobjects/Account/" + created.ID,
+			map[string]interface{}{"Name": nil}, []string{"Name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := doRequest(t, client, tt.method, tt.path, tt.body, nil)
+			var errs []struct {
+				ErrorCode string   `json:"errorCode"`
+				Fields    []string `json:"fields"`
+			}
+			if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0].ErrorCode != "REQUIRED_FIELD_MISSING" {
+				t.Fatalf("Expected 400 REQUIRED_FIELD_MISSING, got %d %s", resp.StatusCode, body)
+			}
+			if strings.Join(errs[0].Fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("Expected fields %v, got %v", tt.fields, errs[0].Fields)
+			}
+		})
+	}
+
+	record, _ := emu.Store().GetRecord("Account", created.ID)
+	if record["Name"] != "Acme" {
+		t.Errorf("Expected the account to keep its name, got %v", record["Name"])
+	}
+}
+
+// TestFieldValidation tests writes checked against each field's type
+func TestFieldValidation(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	colors := []storage.PicklistValue{
+		{Value: "Red", Label: "Red", Active: true},
+		{Value: "Blue", Label: "Blue", Active: true},
+		{Value: "Green", Label: "Green", Active: false},
+	}
+	if err := emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Gadget__c",
+		Label:      "Gadget",
+		Custom:     true,
+		Createable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Label: "Gadget ID", Type: storage.FieldTypeID},
+			{Name: "Name", Label: "Name", Type: storage.FieldTypeString, Length: 10, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Count__c", Label: "Count", Type: storage.FieldTypeInteger, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Weight__c", Label: "Weight", Type: storage.FieldTypeDouble, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Price__c", Label: "Price", Type: storage.FieldTypeCurrency, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Released__c", Label: "Released", Type: storage.FieldTypeDate, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Checked__c", Label: "Checked", Type: storage.FieldTypeDatetime, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Color__c", Label: "Color", Type: storage.FieldTypePicklist, Nillable: true, Createable: true, Updateable: true, RestrictedPicklist: true, PicklistValues: colors},
+			{Name: "Colors__c", Label: "Colors", Type: storage.FieldTypeMultiPicklist, Nillable: true, Createable: true, Updateable: true, RestrictedPicklist: true, PicklistValues: colors},
+			{Name: "Shade__c", Label: "Shade", Type: storage.FieldTypePicklist, Nillable: true, Createable: true, Updateable: true, PicklistValues: colors},
+		},
+	}); err != nil {
+		t.Fatalf("RegisterSObject failed: %v", err)
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	valid := map[string]interface{}{
+		"Name":        "Widget",
+		"Count__c":    3,
+		"Weight__c":   "12.5",
+		"Price__c":    9.99,
+		"Released__c": "2024-01-31",
+		"Checked__c":  "2024-01-31T10:00:00.000+0000",
+		"Color__c":    "Red",
+		"Colors__c":   "Red;Blue",
+		"Shade__c":    "Mauve",
+	}
+	created, err := client.CreateRecord("Gadget__c", valid)
+	if err != nil {
+		t.Fatalf("Expected valid values to be accepted: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		field     string
+		value     interface{}
+		errorCode string
+	}{
+		{"int", "Count__c", "three", "INVALID_FIELD"},
+		{"int with a fraction", "Count__c", 1.5, "INVALID_FIELD"},
+		{"double", "Weight__c", "heavy", "INVALID_FIELD"},
+		{"currency", "Price__c", true, "INVALID_FIELD"},
+		{"date", "Released__c", "2024-13-01", "INVALID_FIELD"},
+		{"datetime", "Checked__c", "yesterday", "INVALID_FIELD"},
+		{"string length", "Name", "Much too long", "STRING_TOO_LONG"},
+		{"restricted picklist", "Color__c", "Purple", "INVALID_OR_NULL_FOR_RESTRICTED_PICKLIST"},
+		{"inactive picklist value", "Color__c", "Green", "INVALID_OR_NULL_FOR_RESTRICTED_PICKLIST"},
+		{"restricted multipicklist", "Colors__c", "Red;Purple", "INVALID_OR_NULL_FOR_RESTRICTED_PICKLIST"},
+		{"unknown field", "Size__c", "L", "INVALID_FIELD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, write := range []struct {
+				method string
+				path   string
+			}{
+				{http.MethodPost, "/services/data/v58.0/sobjects/Gadget__c"},
+				{http.MethodPatch, "/services/data/v58.0/sobjects/Gadget__c/" + created.ID},
+			} {
+				resp, body := doRequest(t, client, write.method, write.path, map[string]interface{}{tt.field: tt.value}, nil)
+				var errs []struct {
+					ErrorCode string   `json:"errorCode"`
+					Fields    []string `json:"fields"`
+				}
+				if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0].ErrorCode != tt.errorCode {
+					t.Errorf("%s: expected 400 %s, got %d %s", write.method, tt.errorCode, resp.StatusCode, body)
+				} else if len(errs[0].Fields) != 1 || errs[0].Fields[0] != tt.field {
+					t.Errorf("%s: expected fields [%s], got %v", write.method, tt.field, errs[0].Fields)
+				}
+			}
+		})
+	}
+
+	record, _ := emu.Store().GetRecord("Gadget__c", created.ID)
+	if record["Name"] != "Widget" || record["Color__c"] != "Red" {
+		t.Errorf("Expected rejected updates to leave the record unchanged, got %v", record)
+	}
+}
+
+// TestUndeleteAndPurge tests the undelete endpoint and purging the recycle bin
+func TestUndeleteAndPurge(t *testing.T) {
+	emu := emulator.New(emulator.WithRecycleBinRetention(500 * time.Millisecond))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	var ids []string
+	for _, name := range []string{"Restored", "Purged"} {
+		created, err := client.CreateRecord("Account", map[string]interface{}{"Name": name})
+		if err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+		if err := client.DeleteRecord("Account", created.ID); err != nil {
+			t.Fatalf("DeleteRecord failed: %v", err)
+		}
+		ids = append(ids, created.ID)
+	}
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account/"+ids[0]+"/undelete", nil, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"success":true`) {
+		t.Fatalf("Expected 200 from undelete, got %d: %s", resp.StatusCode, body)
+	}
+	result, err := client.Query("SELECT Name FROM Account")
+	if err != nil || result.TotalSize != 1 || result.Records[0]["Name"] != "Restored" {
+		t.Errorf("Expected only the undeleted account, got %v (%v)", result, err)
+	}
+
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account/"+ids[0]+"/undelete", nil, nil)
+	if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "UNDELETE_FAILED") {
+		t.Errorf("Expected 400 UNDELETE_FAILED for a live record, got %d: %s", resp.StatusCode, body)
+	}
+	resp, _ = doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account/001000000000000AAA/undelete", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown record, got %d", resp.StatusCode)
+	}
+
+	// Records inside the retention are kept
+	if purged := emu.PurgeRecycleBin(); purged != 0 {
+		t.Errorf("Expected nothing purged within the retention, got %d", purged)
+	}
+	time.Sleep(600 * time.Millisecond)
+	if purged := emu.PurgeRecycleBin(); purged != 1 {
+		t.Errorf("Expected 1 record purged, got %d", purged)
+	}
+
+	records, err := emu.Store().GetAllRecordsWithDeleted("Account")
+	if err != nil || len(records) != 1 || records[0]["Id"] != ids[0] {
+		t.Errorf("Expected queryAll to see only the undeleted account, got %v (%v)", records, err)
+	}
+	resp, _ = doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account/"+ids[1]+"/undelete", nil, nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 undeleting a purged record, got %d", resp.StatusCode)
+	}
+}
+
+// TestBlobFields tests uploading file bodies and downloading them back
+func TestBlobFields(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	payload := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x10, '\n'}
+
+	download := func(path string) (*http.Response, []byte) {
+		t.Helper()
+		resp, body := doRequest(t, client, http.MethodGet, path, nil, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 downloading %s, got %d: %s", path, resp.StatusCode, body)
+		}
+		return resp, body
+	}
+
+	// JSON create with the body base64-encoded
+	version, err := client.CreateRecord("ContentVersion", map[string]interface{}{
+		"Title":        "Logo",
+		"PathOnClient": "logo.png",
+		"VersionData":  base64.StdEncoding.EncodeToString(payload),
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	record, err := client.GetRecord("ContentVersion", version.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	dataURL := "/services/data/v58.0/sobjects/ContentVersion/" + version.ID + "/VersionData"
+	if record["VersionData"] != dataURL || record["ContentSize"] != float64(len(payload)) {
+		t.Errorf("Expected the VersionData URL and size, got %v", record)
+	}
+	resp, body := download(dataURL)
+	if !bytes.Equal(body, payload) || resp.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("Expected the uploaded PNG, got %q (%s)", body, resp.Header.Get("Content-Type"))
+	}
+
+	// Multipart create with the body as a binary part
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "With Attachment"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	entity, _ := form.CreatePart(textproto.MIMEHeader{
+		"Content-Disposition": {`form-data; name="entity_attachment"`},
+		"Content-Type":        {"application/json"},
+	})
+	_ = json.NewEncoder(entity).Encode(map[string]interface{}{
+		"Name": "report.bin", "ContentType": "application/pdf", "ParentId": account.ID,
+	})
+	part, _ := form.CreateFormFile("Body", "report.bin")
+	_, _ = part.Write(payload)
+	_ = form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, baseURL+"/services/data/v58.0/sobjects/Attachment", &buf)
+	req.Header.Set("Authorization", "Bearer "+client.AccessToken)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	createResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer func() { _ = createResp.Body.Close() }()
+	var created rest.SObjectResponse
+	if err := json.NewDecoder(createResp.Body).Decode(&created); err != nil || createResp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201 for the multipart create, got %d (%v)", createResp.StatusCode, err)
+	}
+
+	resp, body = download("/services/data/v58.0/sobjects/Attachment/" + created.ID + "/Body")
+	if !bytes.Equal(body, payload) || resp.Header.Get("Content-Type") != "application/pdf" {
+		t.Errorf("Expected the uploaded attachment, got %q (%s)", body, resp.Header.Get("Content-Type"))
+	}
+
+	if resp, _ := doRequest(t, client, http.MethodGet, "/services/data/v58.0/sobjects/Attachment/"+created.ID+"/Name", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for a field that is not a body, got %d", resp.StatusCode)
+	}
+}
+
+// TestAutoNumberFields tests that auto-number fields take sequential,
+// formatted values on create
+func TestAutoNumberFields(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	var numbers []interface{}
+	for _, subject := range []string{"First", "Second"} {
+		created, err := client.CreateRecord("Case", map[string]interface{}{"Subject": subject})
+		if err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+		record, err := client.GetRecord("Case", created.ID)
+		if err != nil {
+			t.Fatalf("GetRecord failed: %v", err)
+		}
+		numbers = append(numbers, record["CaseNumber"])
+	}
+	if numbers[0] != "00000001" || numbers[1] != "00000002" {
+		t.Errorf("Expected CaseNumbers 00000001 and 00000002, got %v", numbers)
+	}
+
+	// Each object has its own sequence, and formats may add text
+	if err := emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:       "Ticket__c",
+		Label:      "Ticket",
+		Custom:     true,
+		Createable: true,
+		Queryable:  true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, AutoNumber: true, DisplayFormat: "T-{0000}"},
+		},
+	}); err != nil {
+		t.Fatalf("RegisterSObject failed: %v", err)
+	}
+	if _, err := client.CreateRecord("Ticket__c", map[string]interface{}{}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Ordering Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if _, err := client.CreateRecord("Order", map[string]interface{}{"AccountId": account.ID, "EffectiveDate": "2024-01-15"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	result, err := client.Query("SELECT Name FROM Ticket__c")
+	if err != nil || len(result.Records) != 1 || result.Records[0]["Name"] != "T-0001" {
+		t.Errorf("Expected ticket T-0001, got %v (%v)", result, err)
+	}
+	result, err = client.Query("SELECT OrderNumber FROM Order")
+	if err != nil || len(result.Records) != 1 || result.Records[0]["OrderNumber"] != "00000001" {
+		t.Errorf("Expected order 00000001, got %v (%v)", result, err)
+	}
+
+	describe, err := client.DescribeSObject("Case")
+	if err != nil {
+		t.Fatalf("DescribeSObject failed: %v", err)
+	}
+	for _, f := range describe["fields"].([]interface{}) {
+		field := f.(map[string]interface{})
+		if field["name"] == "CaseNumber" && field["autoNumber"] != true {
+			t.Errorf("Expected CaseNumber to be described as autoNumber, got %v", field)
+		}
+	}
+}
+
+// TestFormulaFields tests that formula fields are computed on read and
+// cannot be written
+func TestFormulaFields(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	for _, field := range []storage.FieldDefinition{
+		{Name: "RevenuePerEmployee__c", Label: "Revenue Per Employee", Type: storage.FieldTypeCurrency, Precision: 18, Scale: 2, Nillable: true, Calculated: true, CalculatedFormula: "AnnualRevenue / NumberOfEmployees"},
+		{Name: "Summary__c", Label: "Summary", Type: storage.FieldTypeString, Length: 255, Nillable: true, Calculated: true, CalculatedFormula: "Name & ' (' & Industry & ')'"},
+	} {
+		if err := emu.Store().AddField("Account", field); err != nil {
+			t.Fatalf("AddField failed: %v", err)
+		}
+	}
+
+	created, err := client.CreateRecord("Account", map[string]interface{}{
+		"Name":              "Formula Co",
+		"Industry":          "Technology",
+		"AnnualRevenue":     1000000,
+		"NumberOfEmployees": 300,
+	})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	record, err := client.GetRecord("Account", created.ID)
+	if err != nil {
+		t.Fatalf("GetRecord failed: %v", err)
+	}
+	if record["RevenuePerEmployee__c"] != 3333.33 {
+		t.Errorf("Expected RevenuePerEmployee__c 3333.33, got %v", record["RevenuePerEmployee__c"])
+	}
+	if record["Summary__c"] != "Formula Co (Technology)" {
+		t.Errorf("Expected Summary__c 'Formula Co (Technology)', got %v", record["Summary__c"])
+	}
+
+	// Formulas follow the fields they reference
+	if err := client.UpdateRecord("Account", created.ID, map[string]interface{}{"NumberOfEmployees": 500}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	result, err := client.Query("SELECT Summary__c, RevenuePerEmployee__c FROM Account WHERE RevenuePerEmployee__c = 2000")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(result.Records) != 1 || result.Records[0]["Summary__c"] != "Formula Co (Technology)" {
+		t.Errorf("Expected the account by its formula value, got %v", result.Records)
+	}
+
+	resp, body := doRequest(t, client, http.MethodPatch, "/services/data/v58.0/sobjects/Account/"+created.ID,
+		map[string]interface{}{"Summary__c": "Overwritten"}, nil)
+	var errs []map[string]interface{}
+	if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0]["errorCode"] != "INVALID_FIELD_FOR_INSERT_UPDATE" {
+		t.Errorf("Expected 400 INVALID_FIELD_FOR_INSERT_UPDATE, got %d %s", resp.StatusCode, body)
+	}
+}
+
+// TestCascadeDelete tests that deleting a parent deletes its cascade
+// children and undeleting it restores them
+func TestCascadeDelete(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Cascade Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	for _, name := range []string{"One", "Two", "Three"} {
+		if _, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": name, "AccountId": account.ID}); err != nil {
+			t.Fatalf("CreateRecord failed: %v", err)
+		}
+	}
+	if _, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": "Unrelated"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	if err := client.DeleteRecord("Account", account.ID); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+	result, err := client.Query("SELECT LastName FROM Contact")
+	if err != nil || result.TotalSize != 1 || result.Records[0]["LastName"] != "Unrelated" {
+		t.Errorf("Expected only the unrelated contact after the delete, got %v (%v)", result, err)
+	}
+
+	resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Account/"+account.ID+"/undelete", nil, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from undelete, got %d: %s", resp.StatusCode, body)
+	}
+	result, err = client.Query("SELECT LastName FROM Contact WHERE AccountId = '" + account.ID + "'")
+	if err != nil || result.TotalSize != 3 {
+		t.Errorf("Expected the three contacts restored with their account, got %v (%v)", result, err)
+	}
+
+	// Rolling back the deletion restores the cascade children too
+	resp, body = doRequest(t, client, http.MethodDelete, "/services/data/v58.0/composite/sobjects?allOrNone=true&ids="+account.ID+",000000000000000AAA", nil, nil)
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected the allOrNone delete to fail, got %d: %s", resp.StatusCode, body)
+	}
+	resp, body = doRequest(t, client, http.MethodPost, "/services/data/v58.0/composite/graph", map[string]interface{}{
+		"graphs": []map[string]interface{}{
+			{
+				"graphId": "delete",
+				"compositeRequest": []map[string]interface{}{
+					{"method": "DELETE", "url": "/services/data/v58.0/sobjects/Account/" + account.ID, "referenceId": "remove"},
+					{"method": "POST", "url": "/services/data/v58.0/sobjects/Contact", "referenceId": "con", "body": map[string]interface{}{"FirstName": "No LastName"}},
+				},
+			},
+		},
+	}, nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"isSuccessful":false`) {
+		t.Fatalf("Expected the graph to fail, got %d: %s", resp.StatusCode, body)
+	}
+	result, err = client.Query("SELECT LastName FROM Contact WHERE AccountId = '" + account.ID + "'")
+	if err != nil || result.TotalSize != 3 {
+		t.Errorf("Expected the three contacts kept by the rollbacks, got %v (%v)", result, err)
+	}
+	all, _ := emu.Store().GetAllRecordsWithDeleted("Contact")
+	if len(all) != 4 {
+		t.Errorf("Expected nothing left in the recycle bin, got %d contacts", len(all))
+	}
+}
+
+// TestRestrictedDelete tests that a record referenced through a
+// restrict-delete lookup cannot be deleted
+func TestRestrictedDelete(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	if err := emu.Store().RegisterSObject(storage.SObjectDefinition{
+		Name:        "Invoice__c",
+		Label:       "Invoice",
+		LabelPlural: "Invoices",
+		Custom:      true,
+		Createable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: []storage.FieldDefinition{
+			{Name: "Id", Type: storage.FieldTypeID},
+			{Name: "Name", Type: storage.FieldTypeString, Createable: true},
+			{Name: "Account__c", Type: storage.FieldTypeReference, Nillable: true, Createable: true, Updateable: true,
+				ReferenceTo: []string{"Account"}, RelationshipName: "Account__r", RestrictedDelete: true},
+		},
+	}); err != nil {
+		t.Fatalf("RegisterSObject failed: %v", err)
+	}
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Restricted Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	invoice, err := client.CreateRecord("Invoice__c", map[string]interface{}{"Name": "INV-1", "Account__c": account.ID})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	path := "/services/data/v58.0/sobjects/Account/" + account.ID
+	resp, body := doRequest(t, client, http.MethodDelete, path, nil, nil)
+	var errs []map[string]interface{}
+	if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0]["errorCode"] != "DELETE_FAILED" {
+		t.Fatalf("Expected 400 DELETE_FAILED, got %d %s", resp.StatusCode, body)
+	}
+	if !strings.Contains(errs[0]["message"].(string), invoice.ID) {
+		t.Errorf("Expected the message to name the blocking invoice, got %v", errs[0]["message"])
+	}
+	if _, err := client.GetRecord("Account", account.ID); err != nil {
+		t.Errorf("Expected the account to survive, got %v", err)
+	}
+
+	// Once the reference is gone the delete succeeds
+	if err := client.DeleteRecord("Invoice__c", invoice.ID); err != nil {
+		t.Fatalf("DeleteRecord failed: %v", err)
+	}
+	if resp, body := doRequest(t, client, http.MethodDelete, path, nil, nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting the unreferenced account, got %d %s", resp.StatusCode, body)
+	}
+}
+
+// TestReferenceValidation tests that lookups must name an existing record
+// of a referenced object
+func TestReferenceValidation(t *testing.T) {
+	emu := emulator.New()
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Lookup Co"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	contact, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": "Valid", "AccountId": account.ID})
+	if err != nil {
+		t.Fatalf("Expected a valid lookup to succeed, got %v", err)
+	}
+
+	// A missing Account, then a Contact ID where an Account ID belongs
+	missing := account.ID[:3] + "000000000000ZZZ"
+	for _, accountID := range []string{missing, contact.ID} {
+		resp, body := doRequest(t, client, http.MethodPost, "/services/data/v58.0/sobjects/Contact",
+			map[string]interface{}{"LastName": "Invalid", "AccountId": accountID}, nil)
+		var errs []map[string]interface{}
+		if resp.StatusCode != http.StatusBadRequest || json.Unmarshal(body, &errs) != nil || errs[0]["errorCode"] != "INVALID_CROSS_REFERENCE_KEY" {
+			t.Errorf("create with AccountId %s: expected 400 INVALID_CROSS_REFERENCE_KEY, got %d %s", accountID, resp.StatusCode, body)
+		}
+
+		resp, body = doRequest(t, client, http.MethodPatch, "/services/data/v58.0/sobjects/Contact/"+contact.ID,
+			map[string]interface{}{"AccountId": accountID}, nil)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), "INVALID_CROSS_REFERENCE_KEY") {
+			t.Errorf("update with AccountId %s: expected 400 INVALID_CROSS_REFERENCE_KEY, got %d %s", accountID, resp.StatusCode, body)
+		}
+	}
+
+	record, err := client.GetRecord("Contact", contact.ID)
+	if err != nil || record["AccountId"] != account.ID {
+		t.Errorf("Expected the contact to keep its account, got %v (%v)", record, err)
+	}
+}
@@ -0,0 +1,202 @@
+package integration_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	sfclient "github.com/MASA-JAPAN/go-salesforce-api-client"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/emulator"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// cometd posts Bayeux messages to the CometD endpoint and decodes the reply
+func cometd(t *testing.T, client *sfclient.Client, messages ...map[string]interface{}) []map[string]interface{} {
+	t.Helper()
+
+	resp, body := doRequest(t, client, http.MethodPost, "/cometd/58.0", messages, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from CometD, got %d: %s", resp.StatusCode, body)
+	}
+	var replies []map[string]interface{}
+	if err := json.Unmarshal(body, &replies); err != nil {
+		t.Fatalf("Failed to decode CometD reply: %v", err)
+	}
+	return replies
+}
+
+// TestStreamingAPI tests subscribing to a channel over CometD and receiving
+// the events published to it
+func TestStreamingAPI(t *testing.T) {
+	emu := emulator.New(emulator.WithStreamingTimeout(100 * time.Millisecond))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+
+	replies := cometd(t, client, map[string]interface{}{
+		"channel":                  "/meta/handshake",
+		"version":                  "1.0",
+		"supportedConnectionTypes": []string{"long-polling"},
+	})
+	clientID, _ := replies[0]["clientId"].(string)
+	if replies[0]["successful"] != true || clientID == "" {
+		t.Fatalf("Expected a successful handshake, got %v", replies)
+	}
+
+	replies = cometd(t, client, map[string]interface{}{
+		"channel": "/meta/subscribe", "clientId": clientID, "subscription": "/topic/AccountUpdates",
+	})
+	if replies[0]["successful"] != true || replies[0]["subscription"] != "/topic/AccountUpdates" {
+		t.Fatalf("Expected a successful subscription, got %v", replies)
+	}
+
+	// Events before the subscription are not delivered
+	emu.PublishEvent("/event/Unsubscribed__e", map[string]interface{}{"Message__c": "ignored"})
+	emu.PublishEvent("/topic/AccountUpdates", map[string]interface{}{"Id": "001000000000001AAA", "Name": "First"})
+	emu.PublishEvent("/topic/AccountUpdates", map[string]interface{}{"Id": "001000000000002AAA", "Name": "Second"})
+
+	connect := map[string]interface{}{"channel": "/meta/connect", "clientId": clientID, "connectionType": "long-polling"}
+	replies = cometd(t, client, connect)
+	if len(replies) != 3 || replies[2]["channel"] != "/meta/connect" || replies[2]["successful"] != true {
+		t.Fatalf("Expected two events and the connect reply, got %v", replies)
+	}
+	for i, name := range []string{"First", "Second"} {
+		data, _ := replies[i]["data"].(map[string]interface{})
+		event, _ := data["event"].(map[string]interface{})
+		sobject, _ := data["sobject"].(map[string]interface{})
+		if replies[i]["channel"] != "/topic/AccountUpdates" || sobject["Name"] != name || event["replayId"] != float64(i+1) {
+			t.Errorf("Event %d: expected %s with replayId %d, got %v", i, name, i+1, replies[i])
+		}
+	}
+
+	// A connect with nothing queued waits for the next event or the timeout
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		emu.PublishEvent("/topic/AccountUpdates", map[string]interface{}{"Name": "Third"})
+	}()
+	if replies = cometd(t, client, connect); len(replies) != 2 {
+		t.Errorf("Expected the event published during the long poll, got %v", replies)
+	}
+	if replies = cometd(t, client, connect); len(replies) != 1 || replies[0]["successful"] != true {
+		t.Errorf("Expected only the connect reply after the timeout, got %v", replies)
+	}
+
+	replies = cometd(t, client, map[string]interface{}{
+		"channel": "/meta/subscribe", "clientId": "unknown", "subscription": "/topic/AccountUpdates",
+	})
+	if replies[0]["successful"] != false || replies[0]["error"] != "403::Unknown client" {
+		t.Errorf("Expected unknown clients to be rejected, got %v", replies)
+	}
+}
+
+// TestPlatformEvents tests publishing platform events through the sObjects
+// API to Streaming API subscribers
+func TestPlatformEvents(t *testing.T) {
+	emu := emulator.New(emulator.WithStreamingTimeout(100 * time.Millisecond))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	if err := emu.Store().RegisterPlatformEvent("Order_Event__e", storage.FieldDefinition{
+		Name: "OrderNumber__c", Label: "Order Number", Type: storage.FieldTypeString, Length: 20,
+		Nillable: true, Createable: true,
+	}); err != nil {
+		t.Fatalf("RegisterPlatformEvent failed: %v", err)
+	}
+	if err := emu.Store().RegisterPlatformEvent("Order_Event"); err == nil {
+		t.Error("Expected names without __e to be rejected")
+	}
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	replies := cometd(t, client, map[string]interface{}{"channel": "/meta/handshake", "version": "1.0"})
+	clientID, _ := replies[0]["clientId"].(string)
+	cometd(t, client, map[string]interface{}{
+		"channel": "/meta/subscribe", "clientId": clientID, "subscription": "/event/Order_Event__e",
+	})
+
+	published, err := client.CreateRecord("Order_Event__e", map[string]interface{}{"OrderNumber__c": "ORD-42"})
+	if err != nil {
+		t.Fatalf("Publishing the event failed: %v", err)
+	}
+	if !published.Success || len(published.ID) != 36 {
+		t.Errorf("Expected success with an event UUID, got %+v", published)
+	}
+	if _, err := client.CreateRecord("Order_Event__e", map[string]interface{}{"Missing__c": "x"}); err == nil {
+		t.Error("Expected an event with an unknown field to be rejected")
+	}
+
+	replies = cometd(t, client, map[string]interface{}{"channel": "/meta/connect", "clientId": clientID, "connectionType": "long-polling"})
+	if len(replies) != 2 {
+		t.Fatalf("Expected the event and the connect reply, got %v", replies)
+	}
+	data, _ := replies[0]["data"].(map[string]interface{})
+	payload, _ := data["payload"].(map[string]interface{})
+	if replies[0]["channel"] != "/event/Order_Event__e" || payload["OrderNumber__c"] != "ORD-42" || payload["EventUuid"] != published.ID {
+		t.Errorf("Expected the published event, got %v", replies[0])
+	}
+	if payload["CreatedById"] != emu.Store().GetDefaultUserID() {
+		t.Errorf("Expected the event to be created by the session user, got %v", payload["CreatedById"])
+	}
+
+	result, err := client.Query("SELECT Id FROM Order_Event__e")
+	if err != nil || result.TotalSize != 0 {
+		t.Errorf("Expected no queryable event records, got %v (%v)", result, err)
+	}
+}
+
+// TestChangeDataCapture tests recording and streaming change events for
+// CDC-enabled objects
+func TestChangeDataCapture(t *testing.T) {
+	emu := emulator.New(emulator.WithCDC("Account"), emulator.WithStreamingTimeout(100*time.Millisecond))
+	baseURL := emu.Start()
+	defer emu.Stop()
+
+	client := createAuthenticatedClient(t, emu, baseURL)
+	replies := cometd(t, client, map[string]interface{}{"channel": "/meta/handshake", "version": "1.0"})
+	clientID, _ := replies[0]["clientId"].(string)
+	cometd(t, client, map[string]interface{}{
+		"channel": "/meta/subscribe", "clientId": clientID, "subscription": "/data/AccountChangeEvent",
+	})
+
+	account, err := client.CreateRecord("Account", map[string]interface{}{"Name": "Tracked"})
+	if err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+	if err := client.UpdateRecord("Account", account.ID, map[string]interface{}{"Name": "Renamed"}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+	if _, err := client.CreateRecord("Contact", map[string]interface{}{"LastName": "Untracked"}); err != nil {
+		t.Fatalf("CreateRecord failed: %v", err)
+	}
+
+	events := emu.ChangeEvents()
+	if len(events) != 2 {
+		t.Fatalf("Expected a CREATE and an UPDATE event, got %+v", events)
+	}
+	created, updated := events[0], events[1]
+	if created.Header.ChangeType != storage.ChangeTypeCreate || created.Header.RecordIDs[0] != account.ID || created.Fields["Name"] != "Tracked" {
+		t.Errorf("Expected the CREATE event, got %+v", created)
+	}
+	if updated.Header.ChangeType != storage.ChangeTypeUpdate || updated.Fields["Name"] != "Renamed" {
+		t.Errorf("Expected the UPDATE event, got %+v", updated)
+	}
+	changed := strings.Join(updated.Header.ChangedFields, ",")
+	if !strings.Contains(changed, "Name") || strings.Contains(changed, "CreatedDate") {
+		t.Errorf("Expected Name among the changed fields, got %v", updated.Header.ChangedFields)
+	}
+
+	replies = cometd(t, client, map[string]interface{}{"channel": "/meta/connect", "clientId": clientID, "connectionType": "long-polling"})
+	if len(replies) != 3 {
+		t.Fatalf("Expected two change events and the connect reply, got %v", replies)
+	}
+	for i, changeType := range []string{"CREATE", "UPDATE"} {
+		data, _ := replies[i]["data"].(map[string]interface{})
+		payload, _ := data["payload"].(map[string]interface{})
+		header, _ := payload["ChangeEventHeader"].(map[string]interface{})
+		if replies[i]["channel"] != "/data/AccountChangeEvent" || header["changeType"] != changeType || header["entityName"] != "Account" {
+			t.Errorf("Event %d: expected a %s change event, got %v", i, changeType, replies[i])
+		}
+	}
+}
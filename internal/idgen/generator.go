@@ -83,6 +83,21 @@ func NewGeneratorWithPrefix(prefix string) *Generator {
 	}
 }
 
+// Count returns how many IDs the generator has generated
+func (g *Generator) Count() uint64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.counter
+}
+
+// SetCount sets how many IDs the generator has generated, as when restoring
+// a snapshot
+func (g *Generator) SetCount(count uint64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.counter = count
+}
+
 // Generate creates a new unique 18-character Salesforce ID
 func (g *Generator) Generate() string {
 	g.mu.Lock()
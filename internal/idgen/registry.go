@@ -0,0 +1,96 @@
+package idgen
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// prefixAlphabet is the character set of key prefixes, in the order custom
+// prefixes are handed out
+const prefixAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Registry maps object types to key prefixes at runtime. It starts with the
+// standard prefixes and hands out unique prefixes to custom objects, so an
+// object type can always be recovered from an ID.
+type Registry struct {
+	mu       sync.RWMutex
+	byType   map[string]string
+	byPrefix map[string]string
+}
+
+// NewRegistry creates a registry seeded with StandardPrefixes
+func NewRegistry() *Registry {
+	r := &Registry{
+		byType:   make(map[string]string),
+		byPrefix: make(map[string]string),
+	}
+	for objectType, prefix := range StandardPrefixes {
+		r.byType[objectType] = prefix
+		r.byPrefix[prefix] = objectType
+	}
+	return r
+}
+
+// Register assigns prefix to objectType, replacing any prefix it had. It
+// fails if the prefix is malformed or already belongs to another object type.
+func (r *Registry) Register(objectType, prefix string) error {
+	if len(prefix) != 3 || strings.Trim(prefix, prefixAlphabet) != "" {
+		return fmt.Errorf("invalid key prefix: %s", prefix)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if owner, ok := r.byPrefix[prefix]; ok && owner != objectType {
+		return fmt.Errorf("key prefix %s is already used by %s", prefix, owner)
+	}
+	if old, ok := r.byType[objectType]; ok {
+		delete(r.byPrefix, old)
+	}
+	r.byType[objectType] = prefix
+	r.byPrefix[prefix] = objectType
+	return nil
+}
+
+// Assign returns the prefix of objectType, allocating an unused one if it has
+// none. Allocation starts from the "a0" + first letter prefix NewGenerator
+// uses and increments the last two characters until a free one is found.
+func (r *Registry) Assign(objectType string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if prefix, ok := r.byType[objectType]; ok {
+		return prefix
+	}
+
+	start := 0
+	if len(objectType) > 0 {
+		start = max(strings.IndexByte(prefixAlphabet, objectType[0]), 0)
+	}
+	n := len(prefixAlphabet)
+	for i := 0; i < n*n; i++ {
+		index := start + i
+		prefix := "a" + string(prefixAlphabet[index/n%n]) + string(prefixAlphabet[index%n])
+		if _, taken := r.byPrefix[prefix]; !taken {
+			r.byType[objectType] = prefix
+			r.byPrefix[prefix] = objectType
+			return prefix
+		}
+	}
+	return "a00"
+}
+
+// Prefix returns the prefix registered for objectType, if any
+func (r *Registry) Prefix(objectType string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byType[objectType]
+}
+
+// ObjectType returns the object type whose prefix starts id, if any
+func (r *Registry) ObjectType(id string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.byPrefix[GetPrefix(id)]
+}
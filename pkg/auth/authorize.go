@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"time"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// authCodeLifetime is how long an authorization code can be exchanged
+const authCodeLifetime = 15 * time.Minute
+
+// authCode is an issued authorization code awaiting exchange
+type authCode struct {
+	clientID            string
+	redirectURI         string
+	codeChallenge       string
+	codeChallengeMethod string
+	scope               string
+	expiresAt           time.Time
+}
+
+// HandleAuthorize handles GET /services/oauth2/authorize. There is no login
+// page: the request is approved immediately and redirected with a code.
+func (h *Handler) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.respondError(w, "invalid_request", "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("response_type") != "code" {
+		h.respondError(w, "unsupported_response_type", "response type not supported", http.StatusBadRequest)
+		return
+	}
+
+	clientID := query.Get("client_id")
+	cred, ok := h.credentials[clientID]
+	if !ok {
+		h.respondError(w, sferrors.ErrorCodeInvalidClientID, authErrorDescriptions[sferrors.ErrorCodeInvalidClientID], http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.grantScope(cred, query.Get("scope")); !ok {
+		h.respondInvalidScope(w, clientID)
+		return
+	}
+
+	redirectURI := query.Get("redirect_uri")
+	redirect, err := url.Parse(redirectURI)
+	if redirectURI == "" || err != nil {
+		h.respondError(w, "redirect_uri_mismatch", "redirect_uri must match configuration", http.StatusBadRequest)
+		return
+	}
+
+	method := query.Get("code_challenge_method")
+	if query.Get("code_challenge") != "" && method == "" {
+		method = "plain"
+	}
+	if method != "" && method != "plain" && method != "S256" {
+		h.respondError(w, "invalid_request", "invalid code_challenge_method", http.StatusBadRequest)
+		return
+	}
+
+	code := generateAuthCode()
+	h.mu.Lock()
+	h.authCodes[code] = &authCode{
+		clientID:            clientID,
+		redirectURI:         redirectURI,
+		codeChallenge:       query.Get("code_challenge"),
+		codeChallengeMethod: method,
+		scope:               query.Get("scope"),
+		expiresAt:           time.Now().Add(authCodeLifetime),
+	}
+	h.mu.Unlock()
+
+	params := redirect.Query()
+	params.Set("code", code)
+	if state := query.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (h *Handler) handleAuthorizationCodeFlow(w http.ResponseWriter, r *http.Request) {
+	clientID := r.FormValue("client_id")
+
+	// Codes are single use, so consume it before validating
+	h.mu.Lock()
+	code, ok := h.authCodes[r.FormValue("code")]
+	delete(h.authCodes, r.FormValue("code"))
+	h.mu.Unlock()
+
+	if !ok || time.Now().After(code.expiresAt) || code.clientID != clientID || code.redirectURI != r.FormValue("redirect_uri") {
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "invalid authorization code", http.StatusBadRequest)
+		return
+	}
+
+	cred := h.credentials[clientID]
+	if code.codeChallenge != "" {
+		if !verifyCodeChallenge(code.codeChallenge, code.codeChallengeMethod, r.FormValue("code_verifier")) {
+			h.respondError(w, sferrors.ErrorCodeInvalidGrant, "invalid code verifier", http.StatusBadRequest)
+			return
+		}
+	} else if !cred.Public && cred.ClientSecret != r.FormValue("client_secret") {
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "authentication failure", http.StatusBadRequest)
+		return
+	}
+
+	// Create session
+	scope, ok := h.grantScope(cred, code.scope)
+	if !ok {
+		h.respondInvalidScope(w, clientID)
+		return
+	}
+	grant := Grant{
+		Scope:        scope,
+		ClientID:     cred.ClientID,
+		Username:     cred.Username,
+		RefreshToken: allowsRefresh(scope),
+	}
+	session := h.sessions.CreateGrantedSession(h.instanceURL, h.userFor(cred), h.orgID, grant)
+	h.respondSuccess(w, session)
+}
+
+// verifyCodeChallenge checks a PKCE code_verifier against its challenge
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if verifier == "" {
+		return false
+	}
+	if method == "S256" {
+		sum := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+	}
+	return verifier == challenge
+}
+
+func generateAuthCode() string {
+	bytes := make([]byte, 16)
+	_, _ = rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
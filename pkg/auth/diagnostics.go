@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"log"
+	"strings"
+)
+
+// SetLogger enables verbose auth diagnostics: each failed token request logs
+// which credential field did not match. Secrets and passwords are never
+// logged, and responses to the client are unchanged. nil disables logging.
+func (h *Handler) SetLogger(logger *log.Logger) {
+	h.logger = logger
+}
+
+// logf logs a diagnostic if a logger is set
+func (h *Handler) logf(format string, args ...interface{}) {
+	if h.logger != nil {
+		h.logger.Printf(format, args...)
+	}
+}
+
+// passwordMismatch describes why a password grant does not match cred, or
+// returns "" if it does
+func passwordMismatch(cred Credential, clientSecret, username, password string) string {
+	switch {
+	case !cred.Public && cred.ClientSecret != clientSecret:
+		return "client_secret mismatch" + nearMatch(cred.ClientSecret, clientSecret)
+	case cred.Username != username:
+		return "username mismatch" + nearMatch(cred.Username, username)
+	case cred.Password != password:
+		return "password mismatch" + nearMatch(cred.Password, password)
+	}
+	return ""
+}
+
+// nearMatch hints that a mismatched value only differs in case or
+// surrounding whitespace, the usual copy-paste mistakes
+func nearMatch(expected, actual string) string {
+	if strings.EqualFold(strings.TrimSpace(expected), strings.TrimSpace(actual)) {
+		return " (differs only in case or surrounding whitespace)"
+	}
+	return ""
+}
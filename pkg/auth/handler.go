@@ -1,9 +1,12 @@
 package auth
 
 import (
+	"crypto/rsa"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
@@ -15,6 +18,18 @@ type Credential struct {
 	ClientSecret string
 	Username     string
 	Password     string
+
+	// Scopes are the scopes granted to this client (empty grants the
+	// handler's default scope)
+	Scopes []string
+
+	// Public marks a client that has no secret (e.g. mobile or SPA apps);
+	// client_secret is not validated for it in the password flow
+	Public bool
+
+	// UserID is the User the credential logs in as (empty means the
+	// handler's default user)
+	UserID string
 }
 
 // Handler handles OAuth2 authentication
@@ -24,17 +39,109 @@ type Handler struct {
 	instanceURL string
 	userID      string
 	orgID       string
+	errors      *sferrors.ErrorRecorder
+
+	// Forced OAuth errors for the next auth attempt, keyed by ClientID
+	authErrors map[string]string
+
+	// Login lockout simulation (0 threshold disables it)
+	lockoutThreshold int
+	failedLogins     map[string]int // keyed by Username
+
+	// Authorization codes awaiting exchange, keyed by code
+	authCodes map[string]*authCode
+
+	mu sync.Mutex // guards authErrors, failedLogins and authCodes
+
+	// Token response fields
+	scope            string
+	includeExpiresIn bool
+
+	// enforceScopes rejects requests from sessions without the scope their
+	// path needs; see requiredScopes
+	enforceScopes bool
+
+	// passwordRefreshTokens issues refresh tokens from the password flow,
+	// which Salesforce never does
+	passwordRefreshTokens bool
+
+	// logger receives diagnostics for failed token requests (nil disables them)
+	logger *log.Logger
+
+	// jwtKey verifies JWT bearer assertions (nil rejects the flow)
+	jwtKey *rsa.PublicKey
 }
 
 // NewHandler creates a new auth handler
 func NewHandler(instanceURL, userID, orgID string, tokenLifetime time.Duration) *Handler {
 	return &Handler{
-		credentials: make(map[string]Credential),
-		sessions:    NewSessionManager(tokenLifetime),
-		instanceURL: instanceURL,
-		userID:      userID,
-		orgID:       orgID,
+		credentials:  make(map[string]Credential),
+		authErrors:   make(map[string]string),
+		failedLogins: make(map[string]int),
+		authCodes:    make(map[string]*authCode),
+		sessions:     NewSessionManager(tokenLifetime),
+		instanceURL:  instanceURL,
+		userID:       userID,
+		orgID:        orgID,
+		scope:        DefaultScope,
+	}
+}
+
+// DefaultScope is the scope reported in token responses unless overridden
+const DefaultScope = "api refresh_token"
+
+// SetScope sets the scope reported in token responses (empty omits it)
+func (h *Handler) SetScope(scope string) {
+	h.scope = scope
+}
+
+// SetEnforceScopes controls whether requests require the scope their path
+// needs. By default every session may call every endpoint.
+func (h *Handler) SetEnforceScopes(enforce bool) {
+	h.enforceScopes = enforce
+}
+
+// SetPasswordRefreshTokens controls whether the password flow issues a
+// refresh token when the granted scope allows one. Salesforce only issues
+// them from the authorization code flow, so this is off by default.
+func (h *Handler) SetPasswordRefreshTokens(issue bool) {
+	h.passwordRefreshTokens = issue
+}
+
+// grantScope returns the scope granted to cred when requested is asked for.
+// Requested scopes the client was not granted are dropped; ok is false when
+// none of them are.
+func (h *Handler) grantScope(cred Credential, requested string) (scope string, ok bool) {
+	allowed := cred.Scopes
+	if len(allowed) == 0 {
+		allowed = strings.Fields(h.scope)
+	}
+	if requested == "" {
+		return strings.Join(allowed, " "), true
 	}
+
+	granted := []string{}
+	for _, scope := range strings.Fields(requested) {
+		for _, a := range allowed {
+			if a == scope || a == "full" {
+				granted = append(granted, scope)
+				break
+			}
+		}
+	}
+	return strings.Join(granted, " "), len(granted) > 0
+}
+
+// respondInvalidScope rejects a token request whose scopes were not granted
+func (h *Handler) respondInvalidScope(w http.ResponseWriter, clientID string) {
+	h.logf("auth: client_id %q requested no scope it was granted", clientID)
+	h.respondError(w, sferrors.ErrorCodeInvalidScope, "the requested scope is not allowed", http.StatusBadRequest)
+}
+
+// SetIncludeExpiresIn controls whether token responses report expires_in.
+// Salesforce omits it by default, but some OAuth clients rely on it.
+func (h *Handler) SetIncludeExpiresIn(include bool) {
+	h.includeExpiresIn = include
 }
 
 // AddCredential adds a valid credential
@@ -42,19 +149,97 @@ func (h *Handler) AddCredential(cred Credential) {
 	h.credentials[cred.ClientID] = cred
 }
 
+// userFor returns the ID of the User cred logs in as
+func (h *Handler) userFor(cred Credential) string {
+	if cred.UserID != "" {
+		return cred.UserID
+	}
+	return h.userID
+}
+
 // SetInstanceURL updates the instance URL
 func (h *Handler) SetInstanceURL(url string) {
 	h.instanceURL = url
 }
 
+// SetErrorRecorder sets the recorder that retains error responses
+func (h *Handler) SetErrorRecorder(recorder *sferrors.ErrorRecorder) {
+	h.errors = recorder
+}
+
+// SetAuthError makes the next auth attempt for clientID fail with the given
+// OAuth error code (e.g. inactive_user, invalid_client_id, user_is_locked)
+func (h *Handler) SetAuthError(clientID, oauthError string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.authErrors[clientID] = oauthError
+}
+
+// takeAuthError returns and clears the forced error for clientID, if any
+func (h *Handler) takeAuthError(clientID string) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	oauthError, ok := h.authErrors[clientID]
+	if ok {
+		delete(h.authErrors, clientID)
+	}
+	return oauthError, ok
+}
+
+// SetLoginLockout locks a username out after threshold consecutive failed
+// password logins, even for correct credentials, until ResetLoginAttempts
+func (h *Handler) SetLoginLockout(threshold int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lockoutThreshold = threshold
+}
+
+// ResetLoginAttempts clears all failed login counters, unlocking every user
+func (h *Handler) ResetLoginAttempts() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failedLogins = make(map[string]int)
+}
+
+// isLockedOut reports whether username has reached the lockout threshold
+func (h *Handler) isLockedOut(username string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.lockoutThreshold > 0 && h.failedLogins[username] >= h.lockoutThreshold
+}
+
+// recordLogin updates the failed login counter for username
+func (h *Handler) recordLogin(username string, success bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lockoutThreshold <= 0 {
+		return
+	}
+	if success {
+		delete(h.failedLogins, username)
+		return
+	}
+	h.failedLogins[username]++
+}
+
+// authErrorDescriptions maps OAuth error codes to Salesforce's descriptions
+var authErrorDescriptions = map[string]string{
+	sferrors.ErrorCodeInactiveUser:    "user is inactive",
+	sferrors.ErrorCodeInvalidClientID: "client identifier invalid",
+	sferrors.ErrorCodeUserIsLocked:    "user is locked out",
+}
+
 // TokenResponse is the OAuth2 token response
 type TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	InstanceURL string `json:"instance_url"`
-	ID          string `json:"id"`
-	TokenType   string `json:"token_type"`
-	IssuedAt    string `json:"issued_at"`
-	Signature   string `json:"signature"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	InstanceURL  string `json:"instance_url"`
+	ID           string `json:"id"`
+	TokenType    string `json:"token_type"`
+	IssuedAt     string `json:"issued_at"`
+	Signature    string `json:"signature"`
+	Scope        string `json:"scope,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
 }
 
 // HandleOAuth handles POST /services/oauth2/token
@@ -69,6 +254,15 @@ func (h *Handler) HandleOAuth(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if oauthError, ok := h.takeAuthError(r.FormValue("client_id")); ok {
+		description, known := authErrorDescriptions[oauthError]
+		if !known {
+			description = "authentication failure"
+		}
+		h.respondError(w, oauthError, description, http.StatusBadRequest)
+		return
+	}
+
 	grantType := r.FormValue("grant_type")
 
 	switch grantType {
@@ -76,6 +270,12 @@ func (h *Handler) HandleOAuth(w http.ResponseWriter, r *http.Request) {
 		h.handlePasswordFlow(w, r)
 	case "client_credentials":
 		h.handleClientCredentialsFlow(w, r)
+	case "authorization_code":
+		h.handleAuthorizationCodeFlow(w, r)
+	case "refresh_token":
+		h.handleRefreshTokenFlow(w, r)
+	case JWTBearerGrantType:
+		h.handleJWTBearerFlow(w, r)
 	default:
 		h.respondError(w, sferrors.ErrorCodeUnsupportedGrantType, "Grant type not supported", http.StatusBadRequest)
 	}
@@ -87,23 +287,75 @@ func (h *Handler) handlePasswordFlow(w http.ResponseWriter, r *http.Request) {
 	username := r.FormValue("username")
 	password := r.FormValue("password")
 
+	if h.isLockedOut(username) {
+		h.respondError(w, sferrors.ErrorCodeUserIsLocked, authErrorDescriptions[sferrors.ErrorCodeUserIsLocked], http.StatusBadRequest)
+		return
+	}
+
 	// Validate credentials
 	cred, ok := h.credentials[clientID]
 	if !ok {
+		h.logf("auth: password grant failed: client_id %q unknown", clientID)
 		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "authentication failure", http.StatusBadRequest)
 		return
 	}
 
-	if cred.ClientSecret != clientSecret || cred.Username != username || cred.Password != password {
+	if reason := passwordMismatch(cred, clientSecret, username, password); reason != "" {
+		h.logf("auth: password grant failed for client_id %q: %s", clientID, reason)
+		h.recordLogin(username, false)
 		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "authentication failure", http.StatusBadRequest)
 		return
 	}
+	h.recordLogin(username, true)
 
 	// Create session
-	session := h.sessions.CreateSession(h.instanceURL, h.userID, h.orgID)
+	scope, ok := h.grantScope(cred, r.FormValue("scope"))
+	if !ok {
+		h.respondInvalidScope(w, clientID)
+		return
+	}
+	grant := Grant{
+		Scope:        scope,
+		ClientID:     cred.ClientID,
+		Username:     cred.Username,
+		RefreshToken: h.passwordRefreshTokens && allowsRefresh(scope),
+	}
+	session := h.sessions.CreateGrantedSession(h.instanceURL, h.userFor(cred), h.orgID, grant)
+	h.respondSuccess(w, session)
+}
+
+// handleRefreshTokenFlow issues a new access token for a refresh token. The
+// refresh token stays valid and is not returned again.
+func (h *Handler) handleRefreshTokenFlow(w http.ResponseWriter, r *http.Request) {
+	clientID := r.FormValue("client_id")
+
+	cred, ok := h.credentials[clientID]
+	if !ok || (!cred.Public && cred.ClientSecret != r.FormValue("client_secret")) {
+		h.logf("auth: refresh_token grant failed: client_id %q unknown or client_secret mismatch", clientID)
+		h.respondError(w, sferrors.ErrorCodeInvalidClientID, authErrorDescriptions[sferrors.ErrorCodeInvalidClientID], http.StatusBadRequest)
+		return
+	}
+
+	session, ok := h.sessions.RefreshSession(r.FormValue("refresh_token"), clientID)
+	if !ok {
+		h.logf("auth: refresh_token grant failed for client_id %q: unknown refresh token", clientID)
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "expired access/refresh token", http.StatusBadRequest)
+		return
+	}
 	h.respondSuccess(w, session)
 }
 
+// allowsRefresh reports whether a granted scope explicitly lets the client
+// refresh its access token
+func allowsRefresh(scope string) bool {
+	for _, granted := range strings.Fields(scope) {
+		if granted == "refresh_token" || granted == "offline_access" {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handler) handleClientCredentialsFlow(w http.ResponseWriter, r *http.Request) {
 	clientID := r.FormValue("client_id")
 	clientSecret := r.FormValue("client_secret")
@@ -111,28 +363,51 @@ func (h *Handler) handleClientCredentialsFlow(w http.ResponseWriter, r *http.Req
 	// Validate credentials
 	cred, ok := h.credentials[clientID]
 	if !ok {
+		h.logf("auth: client_credentials grant failed: client_id %q unknown", clientID)
 		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "authentication failure", http.StatusBadRequest)
 		return
 	}
 
-	if cred.ClientSecret != clientSecret {
+	// Public clients cannot authenticate as themselves
+	if cred.Public || cred.ClientSecret != clientSecret {
+		if cred.Public {
+			h.logf("auth: client_credentials grant failed for client_id %q: client is public", clientID)
+		} else {
+			h.logf("auth: client_credentials grant failed for client_id %q: client_secret mismatch%s", clientID, nearMatch(cred.ClientSecret, clientSecret))
+		}
 		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "authentication failure", http.StatusBadRequest)
 		return
 	}
 
 	// Create session
-	session := h.sessions.CreateSession(h.instanceURL, h.userID, h.orgID)
+	scope, ok := h.grantScope(cred, r.FormValue("scope"))
+	if !ok {
+		h.respondInvalidScope(w, clientID)
+		return
+	}
+	grant := Grant{
+		Scope:    scope,
+		ClientID: cred.ClientID,
+		Username: cred.Username,
+	}
+	session := h.sessions.CreateGrantedSession(h.instanceURL, h.userFor(cred), h.orgID, grant)
 	h.respondSuccess(w, session)
 }
 
 func (h *Handler) respondSuccess(w http.ResponseWriter, session *Session) {
 	response := TokenResponse{
-		AccessToken: session.AccessToken,
-		InstanceURL: session.InstanceURL,
-		ID:          h.instanceURL + "/id/00D000000000000AAA/" + h.userID,
-		TokenType:   session.TokenType,
-		IssuedAt:    formatIssuedAt(session.IssuedAt),
-		Signature:   "mock_signature",
+		AccessToken:  session.AccessToken,
+		RefreshToken: session.RefreshToken,
+		InstanceURL:  session.InstanceURL,
+		ID:           h.instanceURL + "/id/" + session.OrgID + "/" + session.UserID,
+		TokenType:    session.TokenType,
+		IssuedAt:     formatIssuedAt(session.IssuedAt),
+		Signature:    "mock_signature",
+		Scope:        session.Scope,
+	}
+	if h.includeExpiresIn {
+		// Tokens issued with a negative lifetime are already expired
+		response.ExpiresIn = max(0, int(session.ExpiresAt.Sub(session.IssuedAt).Seconds()))
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -141,6 +416,8 @@ func (h *Handler) respondSuccess(w http.ResponseWriter, session *Session) {
 }
 
 func (h *Handler) respondError(w http.ResponseWriter, errorCode, description string, status int) {
+	h.errors.Record(status, errorCode, description)
+
 	response := sferrors.NewOAuthError(errorCode, description)
 
 	w.Header().Set("Content-Type", "application/json")
@@ -167,9 +444,33 @@ func (h *Handler) ValidateRequest(r *http.Request) (*Session, error) {
 		return nil, sferrors.NewInvalidSessionError()
 	}
 
+	if h.enforceScopes && !hasAnyScope(session, requiredScopes(r.URL.Path)) {
+		return nil, sferrors.NewInsufficientScopeError()
+	}
+
 	return session, nil
 }
 
+// requiredScopes returns the scopes, any one of which a session needs for
+// path when scopes are enforced. The identity URL and userinfo need an
+// identity scope; every other endpoint needs api. The web and visualforce
+// scopes gate pages the emulator does not serve, so they are never required.
+func requiredScopes(path string) []string {
+	if strings.HasPrefix(path, "/id/") || strings.HasPrefix(path, "/services/oauth2/userinfo") {
+		return []string{"id", "openid", "profile"}
+	}
+	return []string{"api"}
+}
+
+func hasAnyScope(session *Session, scopes []string) bool {
+	for _, scope := range scopes {
+		if session.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
 // GetSessionManager returns the session manager for direct access
 func (h *Handler) GetSessionManager() *SessionManager {
 	return h.sessions
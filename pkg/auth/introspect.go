@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// IntrospectionResponse is the RFC 7662 token introspection response
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Nbf       int64  `json:"nbf,omitempty"`
+}
+
+// HandleIntrospect handles POST /services/oauth2/introspect
+func (h *Handler) HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.respondError(w, "invalid_request", "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.respondError(w, "invalid_request", "Invalid form data", http.StatusBadRequest)
+		return
+	}
+
+	// The caller must authenticate as a known client
+	cred, ok := h.credentials[r.FormValue("client_id")]
+	if !ok || (!cred.Public && cred.ClientSecret != r.FormValue("client_secret")) {
+		h.respondError(w, sferrors.ErrorCodeInvalidClientID, authErrorDescriptions[sferrors.ErrorCodeInvalidClientID], http.StatusUnauthorized)
+		return
+	}
+
+	response := IntrospectionResponse{}
+	if session, ok := h.sessions.GetSession(r.FormValue("token")); ok {
+		response = IntrospectionResponse{
+			Active:    true,
+			Scope:     session.Scope,
+			ClientID:  session.ClientID,
+			Username:  session.Username,
+			Sub:       h.instanceURL + "/id/" + session.OrgID + "/" + session.UserID,
+			TokenType: "access_token",
+			Exp:       session.ExpiresAt.Unix(),
+			Iat:       session.IssuedAt.Unix(),
+			Nbf:       session.IssuedAt.Unix(),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// JWTBearerGrantType is the grant_type of the OAuth JWT bearer flow
+const JWTBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// jwtAudiences are the login URLs an assertion may be addressed to besides
+// the emulator's own instance URL
+var jwtAudiences = []string{"https://login.salesforce.com", "https://test.salesforce.com"}
+
+// jwtClaims are the assertion claims the JWT bearer flow checks
+type jwtClaims struct {
+	Issuer   string      `json:"iss"`
+	Subject  string      `json:"sub"`
+	Audience interface{} `json:"aud"`
+	Expiry   int64       `json:"exp"`
+}
+
+// SetJWTKey sets the public key that signs JWT bearer assertions. The flow
+// is rejected until a key is set.
+func (h *Handler) SetJWTKey(key *rsa.PublicKey) {
+	h.jwtKey = key
+}
+
+// handleJWTBearerFlow issues a session for a signed assertion whose iss is
+// a client ID and whose sub is that client's username
+func (h *Handler) handleJWTBearerFlow(w http.ResponseWriter, r *http.Request) {
+	claims, err := h.parseAssertion(r.FormValue("assertion"))
+	if err != nil {
+		h.logf("auth: jwt-bearer grant failed: %v", err)
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "invalid assertion", http.StatusBadRequest)
+		return
+	}
+
+	cred, ok := h.credentials[claims.Issuer]
+	if !ok {
+		h.logf("auth: jwt-bearer grant failed: iss %q unknown", claims.Issuer)
+		h.respondError(w, sferrors.ErrorCodeInvalidClientID, authErrorDescriptions[sferrors.ErrorCodeInvalidClientID], http.StatusBadRequest)
+		return
+	}
+	if cred.Username != claims.Subject {
+		h.logf("auth: jwt-bearer grant failed for client_id %q: sub mismatch%s", claims.Issuer, nearMatch(cred.Username, claims.Subject))
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "user hasn't approved this consumer", http.StatusBadRequest)
+		return
+	}
+	if time.Now().Unix() >= claims.Expiry {
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "expired assertion", http.StatusBadRequest)
+		return
+	}
+	if !h.validAudience(claims.Audience) {
+		h.respondError(w, sferrors.ErrorCodeInvalidGrant, "audience is invalid", http.StatusBadRequest)
+		return
+	}
+
+	// Assertions are reissued rather than refreshed, so no refresh token
+	scope, ok := h.grantScope(cred, r.FormValue("scope"))
+	if !ok {
+		h.respondInvalidScope(w, claims.Issuer)
+		return
+	}
+	grant := Grant{
+		Scope:    scope,
+		ClientID: cred.ClientID,
+		Username: cred.Username,
+	}
+	session := h.sessions.CreateGrantedSession(h.instanceURL, h.userFor(cred), h.orgID, grant)
+	h.respondSuccess(w, session)
+}
+
+// parseAssertion verifies an RS256 assertion against the configured key and
+// decodes its claims
+func (h *Handler) parseAssertion(assertion string) (*jwtClaims, error) {
+	if h.jwtKey == nil {
+		return nil, errors.New("no JWT key configured")
+	}
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("assertion is not a JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, errors.New("unsupported alg " + header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(h.jwtKey, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("signature does not match the JWT key")
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// validAudience reports whether aud, a string or list of strings, names a
+// login URL or the instance
+func (h *Handler) validAudience(aud interface{}) bool {
+	var audiences []string
+	switch v := aud.(type) {
+	case string:
+		audiences = []string{v}
+	case []interface{}:
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				audiences = append(audiences, s)
+			}
+		}
+	}
+
+	for _, a := range audiences {
+		a = strings.TrimSuffix(a, "/")
+		if a == h.instanceURL {
+			return true
+		}
+		for _, allowed := range jwtAudiences {
+			if a == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return errors.New("malformed JWT segment")
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed JWT segment")
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package auth
 
 import (
 	"crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
+	"io"
+	mathrand "math/rand/v2"
+	"strings"
 	"sync"
 	"time"
 )
@@ -10,12 +14,37 @@ import (
 // Session represents an authenticated session
 type Session struct {
 	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
 	InstanceURL  string    `json:"instance_url"`
 	TokenType    string    `json:"token_type"`
 	IssuedAt     time.Time `json:"issued_at"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	UserID       string    `json:"-"`
 	OrgID        string    `json:"-"`
+	Scope        string    `json:"-"`
+	ClientID     string    `json:"-"`
+	Username     string    `json:"-"`
+}
+
+// Grant describes what an OAuth flow granted to a new session
+type Grant struct {
+	// Scope is the space-separated granted scope (empty grants all scopes)
+	Scope string
+
+	// ClientID and Username identify who the session was issued to
+	ClientID string
+	Username string
+
+	// RefreshToken mints a refresh token along with the access token
+	RefreshToken bool
+}
+
+// refreshGrant is what a refresh token grants to the sessions it issues
+type refreshGrant struct {
+	instanceURL string
+	userID      string
+	orgID       string
+	grant       Grant
 }
 
 // IsValid checks if the session is still valid
@@ -23,11 +52,31 @@ func (s *Session) IsValid() bool {
 	return time.Now().Before(s.ExpiresAt)
 }
 
+// HasScope reports whether the session was granted scope. Sessions without an
+// explicit scope, and those granted "full", have every scope.
+func (s *Session) HasScope(scope string) bool {
+	if s.Scope == "" {
+		return true
+	}
+	for _, granted := range strings.Fields(s.Scope) {
+		if granted == scope || granted == "full" {
+			return true
+		}
+	}
+	return false
+}
+
 // SessionManager manages active sessions
 type SessionManager struct {
 	mu       sync.RWMutex
 	sessions map[string]*Session
 	lifetime time.Duration
+
+	// refreshTokens never expire, so they outlive the sessions they came with
+	refreshTokens map[string]*refreshGrant
+
+	// tokenSource, when set, replaces crypto/rand for reproducible tokens
+	tokenSource io.Reader
 }
 
 // NewSessionManager creates a new session manager
@@ -36,27 +85,65 @@ func NewSessionManager(lifetime time.Duration) *SessionManager {
 		lifetime = 2 * time.Hour
 	}
 	return &SessionManager{
-		sessions: make(map[string]*Session),
-		lifetime: lifetime,
+		sessions:      make(map[string]*Session),
+		lifetime:      lifetime,
+		refreshTokens: make(map[string]*refreshGrant),
 	}
 }
 
-// CreateSession creates a new session
+// CreateSession creates a new session with every scope
 func (m *SessionManager) CreateSession(instanceURL, userID, orgID string) *Session {
+	return m.CreateGrantedSession(instanceURL, userID, orgID, Grant{})
+}
+
+// CreateGrantedSession creates a new session limited to what grant allows
+func (m *SessionManager) CreateGrantedSession(instanceURL, userID, orgID string, grant Grant) *Session {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	session := m.createSession(instanceURL, userID, orgID, grant)
+	if grant.RefreshToken {
+		grant.RefreshToken = false
+		session.RefreshToken = m.generateToken()
+		m.refreshTokens[session.RefreshToken] = &refreshGrant{
+			instanceURL: instanceURL,
+			userID:      userID,
+			orgID:       orgID,
+			grant:       grant,
+		}
+	}
+	return session
+}
+
+// RefreshSession creates a new session from a refresh token issued to
+// clientID, with the scope of the session the token came with
+func (m *SessionManager) RefreshSession(refreshToken, clientID string) (*Session, bool) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	token := generateToken()
+	refresh, ok := m.refreshTokens[refreshToken]
+	if !ok || refresh.grant.ClientID != clientID {
+		return nil, false
+	}
+	return m.createSession(refresh.instanceURL, refresh.userID, refresh.orgID, refresh.grant), true
+}
+
+// createSession stores a new session. Callers must hold m.mu.
+func (m *SessionManager) createSession(instanceURL, userID, orgID string, grant Grant) *Session {
+	token := m.generateToken()
 	now := time.Now()
 
 	session := &Session{
-		AccessToken:  token,
-		InstanceURL:  instanceURL,
-		TokenType:    "Bearer",
-		IssuedAt:     now,
-		ExpiresAt:    now.Add(m.lifetime),
-		UserID:       userID,
-		OrgID:        orgID,
+		AccessToken: token,
+		InstanceURL: instanceURL,
+		TokenType:   "Bearer",
+		IssuedAt:    now,
+		ExpiresAt:   now.Add(m.lifetime),
+		UserID:      userID,
+		OrgID:       orgID,
+		Scope:       grant.Scope,
+		ClientID:    grant.ClientID,
+		Username:    grant.Username,
 	}
 
 	m.sessions[token] = session
@@ -88,6 +175,18 @@ func (m *SessionManager) InvalidateSession(accessToken string) {
 	delete(m.sessions, accessToken)
 }
 
+// ExpireAll expires every session now. Refresh tokens stay valid, so
+// clients can recover by refreshing.
+func (m *SessionManager) ExpireAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, session := range m.sessions {
+		session.ExpiresAt = now
+	}
+}
+
 // CleanExpired removes all expired sessions
 func (m *SessionManager) CleanExpired() {
 	m.mu.Lock()
@@ -100,9 +199,24 @@ func (m *SessionManager) CleanExpired() {
 	}
 }
 
-// generateToken generates a random access token
-func generateToken() string {
+// SetTokenSeed makes generated tokens reproducible: two managers seeded with
+// the same value issue the same sequence of tokens
+func (m *SessionManager) SetTokenSeed(seed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var key [32]byte
+	binary.LittleEndian.PutUint64(key[:], uint64(seed))
+	m.tokenSource = mathrand.NewChaCha8(key)
+}
+
+// generateToken generates a random access token. Callers must hold m.mu.
+func (m *SessionManager) generateToken() string {
 	bytes := make([]byte, 32)
-	_, _ = rand.Read(bytes)
+	if m.tokenSource != nil {
+		_, _ = m.tokenSource.Read(bytes)
+	} else {
+		_, _ = rand.Read(bytes)
+	}
 	return hex.EncodeToString(bytes)
 }
@@ -7,9 +7,11 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
 	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
 )
 
@@ -18,6 +20,9 @@ type Handler struct {
 	store       storage.Store
 	authHandler *auth.Handler
 	apiVersion  string
+	soql        *soql.Engine
+	errors      *sferrors.ErrorRecorder
+	delay       time.Duration
 }
 
 // NewHandler creates a new bulk API handler
@@ -26,14 +31,37 @@ func NewHandler(store storage.Store, authHandler *auth.Handler, apiVersion strin
 		store:       store,
 		authHandler: authHandler,
 		apiVersion:  apiVersion,
+		soql:        soql.NewEngine(store, apiVersion),
 	}
 }
 
+// SetErrorRecorder sets the recorder that retains error responses
+func (h *Handler) SetErrorRecorder(recorder *sferrors.ErrorRecorder) {
+	h.errors = recorder
+}
+
+// SetProcessingDelay keeps jobs InProgress for d before they complete
+func (h *Handler) SetProcessingDelay(d time.Duration) {
+	h.delay = d
+}
+
 // JobRequest represents a request to create a bulk job
 type JobRequest struct {
-	Operation   string `json:"operation"`
-	Query       string `json:"query"`
-	ContentType string `json:"contentType,omitempty"`
+	Operation       string `json:"operation"`
+	Query           string `json:"query"`
+	ContentType     string `json:"contentType,omitempty"`
+	LineEnding      string `json:"lineEnding,omitempty"`
+	ColumnDelimiter string `json:"columnDelimiter,omitempty"`
+}
+
+// columnDelimiters maps the Bulk API columnDelimiter values to CSV separators
+var columnDelimiters = map[string]rune{
+	"BACKQUOTE": '`',
+	"CARET":     '^',
+	"COMMA":     ',',
+	"PIPE":      '|',
+	"SEMICOLON": ';',
+	"TAB":       '\t',
 }
 
 // JobResponse represents a bulk job response
@@ -76,6 +104,16 @@ func (h *Handler) HandleJobs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// sessionUserID returns the ID of the User whose session made r, or "" for
+// the default user
+func (h *Handler) sessionUserID(r *http.Request) string {
+	session, err := h.authHandler.ValidateRequest(r)
+	if err != nil {
+		return ""
+	}
+	return session.UserID
+}
+
 // HandleJobByID handles requests to /services/data/vXX.X/jobs/query/{jobId}[/results]
 func (h *Handler) HandleJobByID(w http.ResponseWriter, r *http.Request) {
 	// Validate auth
@@ -137,12 +175,33 @@ func (h *Handler) handleCreateJob(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The Bulk API 1.0 header is accepted in place of the body field
+	if req.LineEnding == "" {
+		req.LineEnding = r.Header.Get("Sforce-Line-Ending")
+	}
+	if req.LineEnding != "" && req.LineEnding != "LF" && req.LineEnding != "CRLF" {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid lineEnding: " + req.LineEnding, ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+	if _, ok := columnDelimiters[req.ColumnDelimiter]; req.ColumnDelimiter != "" && !ok {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid columnDelimiter: " + req.ColumnDelimiter, ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+
 	// Create bulk job
 	job, err := h.store.CreateBulkJob(storage.BulkJobConfig{
-		Operation:   req.Operation,
-		Object:      objectType,
-		Query:       req.Query,
-		ContentType: req.ContentType,
+		Operation:         req.Operation,
+		Object:            objectType,
+		Query:             req.Query,
+		ContentType:       req.ContentType,
+		LineEnding:        req.LineEnding,
+		ColumnDelimiter:   req.ColumnDelimiter,
+		DisableBatchRetry: strings.EqualFold(r.Header.Get("Sforce-Disable-Batch-Retry"), "true"),
+		CreatedByID:       h.sessionUserID(r),
 	})
 	if err != nil {
 		h.respondError(w, []sferrors.SalesforceError{
@@ -275,7 +334,7 @@ func (h *Handler) handleGetResults(w http.ResponseWriter, r *http.Request, jobID
 	w.Header().Set("Content-Type", "text/csv")
 	w.WriteHeader(http.StatusOK)
 
-	h.writeCSV(w, results.Records)
+	h.writeCSV(w, job, results.Records)
 }
 
 // processJob processes a bulk query job
@@ -283,6 +342,11 @@ func (h *Handler) processJob(jobID, query string) {
 	// Update state to InProgress
 	_ = h.store.UpdateBulkJobState(jobID, storage.JobStateInProgress)
 
+	time.Sleep(h.delay)
+	if job, err := h.store.GetBulkJob(jobID); err != nil || job.State == storage.JobStateAborted {
+		return
+	}
+
 	// Execute the query
 	records, err := h.executeQuery(query)
 	if err != nil {
@@ -297,53 +361,41 @@ func (h *Handler) processJob(jobID, query string) {
 	_ = h.store.UpdateBulkJobState(jobID, storage.JobStateJobComplete)
 }
 
-// executeQuery executes a SOQL query for bulk processing
+// executeQuery executes a SOQL query for bulk processing. A COUNT() query
+// yields a single row holding the count in an expr0 column.
 func (h *Handler) executeQuery(query string) ([]storage.Record, error) {
-	// Parse FROM clause to get object type
-	fromMatch := regexp.MustCompile(`(?i)FROM\s+(\w+)`).FindStringSubmatch(query)
-	if fromMatch == nil {
-		return nil, nil
-	}
-	objectType := fromMatch[1]
-
-	// Get all records (simplified - doesn't handle full SOQL)
-	records, err := h.store.GetAllRecords(objectType)
+	result, err := h.soql.Execute(query)
 	if err != nil {
 		return nil, err
 	}
 
-	// Parse SELECT fields
-	selectMatch := regexp.MustCompile(`(?i)^SELECT\s+(.+?)\s+FROM\s+`).FindStringSubmatch(query)
-	if selectMatch == nil {
-		return records, nil
-	}
-
-	fields := parseFields(selectMatch[1])
-
-	// Project fields
-	result := make([]storage.Record, len(records))
-	for i, record := range records {
-		projected := make(storage.Record)
-		for _, field := range fields {
-			if val, ok := record[field]; ok {
-				projected[field] = val
-			}
-		}
-		result[i] = projected
+	if result.Count {
+		return []storage.Record{{"expr0": result.TotalSize}}, nil
 	}
-
-	return result, nil
+	return result.Records, nil
 }
 
-// writeCSV writes records as CSV
-func (h *Handler) writeCSV(w http.ResponseWriter, records []storage.Record) {
+// writeCSV writes records as CSV using the job's delimiter and line ending
+func (h *Handler) writeCSV(w http.ResponseWriter, job *storage.BulkJob, records []storage.Record) {
 	writer := csv.NewWriter(w)
+	if delimiter, ok := columnDelimiters[job.ColumnDelimiter]; ok {
+		writer.Comma = delimiter
+	}
+	writer.UseCRLF = job.LineEnding == "CRLF"
 	defer writer.Flush()
 
 	if len(records) == 0 {
 		return
 	}
 
+	// Relationship fields become dotted columns such as Account.Name
+	flattened := make([]storage.Record, len(records))
+	for i, record := range records {
+		flattened[i] = make(storage.Record)
+		flattenRecord(flattened[i], "", record)
+	}
+	records = flattened
+
 	// Get headers from first record
 	var headers []string
 	for key := range records[0] {
@@ -370,6 +422,21 @@ func (h *Handler) writeCSV(w http.ResponseWriter, records []storage.Record) {
 	}
 }
 
+// flattenRecord copies record into dst, naming nested relationship fields by
+// their dotted path and dropping attributes
+func flattenRecord(dst storage.Record, prefix string, record storage.Record) {
+	for key, val := range record {
+		if key == "attributes" {
+			continue
+		}
+		if nested, ok := val.(storage.Record); ok {
+			flattenRecord(dst, prefix+key+".", nested)
+			continue
+		}
+		dst[prefix+key] = val
+	}
+}
+
 func (h *Handler) jobToResponse(job *storage.BulkJob) JobResponse {
 	return JobResponse{
 		ID:                     job.ID,
@@ -383,8 +450,8 @@ func (h *Handler) jobToResponse(job *storage.BulkJob) JobResponse {
 		ContentType:            job.ContentType,
 		ApiVersion:             job.ApiVersion,
 		JobType:                job.JobType,
-		LineEnding:             "LF",
-		ColumnDelimiter:        "COMMA",
+		LineEnding:             job.LineEnding,
+		ColumnDelimiter:        job.ColumnDelimiter,
 		NumberRecordsProcessed: job.NumberRecordsProcessed,
 		Retries:                0,
 		TotalProcessingTime:    0,
@@ -392,6 +459,10 @@ func (h *Handler) jobToResponse(job *storage.BulkJob) JobResponse {
 }
 
 func (h *Handler) respondError(w http.ResponseWriter, errors []sferrors.SalesforceError, status int) {
+	for _, e := range errors {
+		h.errors.Record(status, e.ErrorCode, e.Message)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(errors)
@@ -411,17 +482,6 @@ func extractObjectFromQuery(query string) string {
 	return ""
 }
 
-func parseFields(fieldsStr string) []string {
-	var fields []string
-	for _, f := range strings.Split(fieldsStr, ",") {
-		f = strings.TrimSpace(f)
-		if f != "" {
-			fields = append(fields, f)
-		}
-	}
-	return fields
-}
-
 func toString(val interface{}) string {
 	if val == nil {
 		return ""
@@ -0,0 +1,420 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// IngestJobRequest represents a request to create an ingest job
+type IngestJobRequest struct {
+	Object              string `json:"object"`
+	Operation           string `json:"operation"`
+	ExternalIDFieldName string `json:"externalIdFieldName,omitempty"`
+	ContentType         string `json:"contentType,omitempty"`
+	LineEnding          string `json:"lineEnding,omitempty"`
+	ColumnDelimiter     string `json:"columnDelimiter,omitempty"`
+}
+
+// IngestJobResponse represents an ingest job response
+type IngestJobResponse struct {
+	JobResponse
+	ExternalIDFieldName string `json:"externalIdFieldName,omitempty"`
+	NumberRecordsFailed int    `json:"numberRecordsFailed"`
+}
+
+// ingestOperations are the supported ingest job operations
+var ingestOperations = map[string]bool{
+	"insert": true,
+	"update": true,
+	"upsert": true,
+	"delete": true,
+}
+
+// HandleIngestJobs handles POST/GET /services/data/vXX.X/jobs/ingest
+func (h *Handler) HandleIngestJobs(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.authHandler.ValidateRequest(r); err != nil {
+		h.respondError(w, []sferrors.SalesforceError{err.(sferrors.SalesforceError)}, http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		h.handleCreateIngestJob(w, r)
+	case "GET":
+		h.handleListJobs(w, r)
+	default:
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewMethodNotAllowedError(r.Method),
+		}, http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleIngestJobByID handles requests to
+// /services/data/vXX.X/jobs/ingest/{jobId}[/batches|/successfulResults|/failedResults|/unprocessedrecords]
+func (h *Handler) HandleIngestJobByID(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.authHandler.ValidateRequest(r); err != nil {
+		h.respondError(w, []sferrors.SalesforceError{err.(sferrors.SalesforceError)}, http.StatusUnauthorized)
+		return
+	}
+
+	matches := regexp.MustCompile(`/jobs/ingest/([^/]+)(?:/([^/]+))?/?$`).FindStringSubmatch(r.URL.Path)
+	if matches == nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid job ID", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+		return
+	}
+	jobID, resource := matches[1], matches[2]
+
+	method := r.Method
+	switch {
+	case resource == "" && method == "GET":
+		h.handleGetIngestJob(w, r, jobID)
+	case resource == "" && method == "PATCH":
+		h.handleUpdateIngestJob(w, r, jobID)
+	case resource == "" && method == "DELETE":
+		h.handleDeleteJob(w, r, jobID)
+	case resource == "batches" && method == "PUT":
+		h.handleUploadIngestData(w, r, jobID)
+	case (resource == "successfulResults" || resource == "failedResults" || resource == "unprocessedrecords") && method == "GET":
+		h.handleGetIngestResults(w, r, jobID, resource)
+	case resource != "" && resource != "batches" && resource != "successfulResults" && resource != "failedResults" && resource != "unprocessedrecords":
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "The requested resource does not exist", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+	default:
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewMethodNotAllowedError(method),
+		}, http.StatusMethodNotAllowed)
+	}
+}
+
+// handleCreateIngestJob handles POST /services/data/vXX.X/jobs/ingest
+func (h *Handler) handleCreateIngestJob(w http.ResponseWriter, r *http.Request) {
+	var req IngestJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if !h.store.HasSObject(req.Object) {
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewInvalidTypeError(req.Object),
+		}, http.StatusBadRequest)
+		return
+	}
+	if !ingestOperations[req.Operation] {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid operation: " + req.Operation, ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+	if req.Operation == "upsert" && req.ExternalIDFieldName == "" {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "externalIdFieldName is required for upsert", ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+	if req.LineEnding != "" && req.LineEnding != "LF" && req.LineEnding != "CRLF" {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid lineEnding: " + req.LineEnding, ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+	if _, ok := columnDelimiters[req.ColumnDelimiter]; req.ColumnDelimiter != "" && !ok {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid columnDelimiter: " + req.ColumnDelimiter, ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.store.CreateBulkJob(storage.BulkJobConfig{
+		Operation:           req.Operation,
+		Object:              req.Object,
+		ContentType:         req.ContentType,
+		LineEnding:          req.LineEnding,
+		ColumnDelimiter:     req.ColumnDelimiter,
+		JobType:             "V2Ingest",
+		ExternalIDFieldName: req.ExternalIDFieldName,
+		CreatedByID:         h.sessionUserID(r),
+	})
+	if err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	h.respondJSON(w, h.ingestJobToResponse(job), http.StatusOK)
+}
+
+// handleGetIngestJob handles GET /services/data/vXX.X/jobs/ingest/{jobId}
+func (h *Handler) handleGetIngestJob(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, err := h.store.GetBulkJob(jobID)
+	if err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Job not found", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+		return
+	}
+
+	h.respondJSON(w, h.ingestJobToResponse(job), http.StatusOK)
+}
+
+// handleUploadIngestData handles PUT /services/data/vXX.X/jobs/ingest/{jobId}/batches
+func (h *Handler) handleUploadIngestData(w http.ResponseWriter, r *http.Request, jobID string) {
+	job, err := h.store.GetBulkJob(jobID)
+	if err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Job not found", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+		return
+	}
+
+	reader := csv.NewReader(r.Body)
+	if delimiter, ok := columnDelimiters[job.ColumnDelimiter]; ok {
+		reader.Comma = delimiter
+	}
+	rows, err := reader.ReadAll()
+	if err != nil || len(rows) == 0 {
+		message := "CSV data is empty"
+		if err != nil {
+			message = err.Error()
+		}
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: message, ErrorCode: sferrors.ErrorCodeInvalidOperation},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store.AppendBulkJobData(jobID, rows[0], rows[1:]); err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidOperation},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleUpdateIngestJob handles PATCH /services/data/vXX.X/jobs/ingest/{jobId}.
+// UploadComplete starts processing the uploaded rows; Aborted stops the job.
+func (h *Handler) handleUpdateIngestJob(w http.ResponseWriter, r *http.Request, jobID string) {
+	var req struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.store.GetBulkJob(jobID)
+	if err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Job not found", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+		return
+	}
+
+	switch storage.JobState(req.State) {
+	case storage.JobStateUploadComplete:
+		if job.State != storage.JobStateOpen {
+			h.respondError(w, []sferrors.SalesforceError{
+				{Message: "Job is not open: " + string(job.State), ErrorCode: sferrors.ErrorCodeInvalidOperation},
+			}, http.StatusBadRequest)
+			return
+		}
+		_ = h.store.UpdateBulkJobState(jobID, storage.JobStateUploadComplete)
+		job.State = storage.JobStateUploadComplete
+		go h.processIngestJob(jobID)
+	case storage.JobStateAborted:
+		_ = h.store.UpdateBulkJobState(jobID, storage.JobStateAborted)
+		job.State = storage.JobStateAborted
+	default:
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Invalid state: " + req.State, ErrorCode: sferrors.ErrorCodeInvalidField},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	h.respondJSON(w, h.ingestJobToResponse(job), http.StatusOK)
+}
+
+// handleGetIngestResults handles GET /services/data/vXX.X/jobs/ingest/{jobId}/{resource}
+// for successfulResults, failedResults and unprocessedrecords
+func (h *Handler) handleGetIngestResults(w http.ResponseWriter, r *http.Request, jobID, resource string) {
+	job, err := h.store.GetBulkJob(jobID)
+	if err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			{Message: "Job not found", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	switch resource {
+	case "successfulResults":
+		_ = writeSuccessfulResults(w, job.Header, job.RecordResults)
+	case "failedResults":
+		_ = writeFailedResults(w, job.Header, job.RecordResults)
+	case "unprocessedrecords":
+		_ = writeUnprocessedRecords(w, job.Header, job.Rows[len(job.RecordResults):])
+	}
+}
+
+// processIngestJob runs the uploaded rows of an ingest job against the store
+func (h *Handler) processIngestJob(jobID string) {
+	_ = h.store.UpdateBulkJobState(jobID, storage.JobStateInProgress)
+
+	time.Sleep(h.delay)
+	job, err := h.store.GetBulkJob(jobID)
+	if err != nil || job.State == storage.JobStateAborted {
+		return
+	}
+
+	description, err := h.store.DescribeSObject(job.Object)
+	if err != nil {
+		_ = h.store.UpdateBulkJobState(jobID, storage.JobStateFailed)
+		return
+	}
+	fields := make(map[string]storage.FieldDefinition, len(description.Fields))
+	for _, field := range description.Fields {
+		fields[field.Name] = field
+	}
+
+	results := make([]storage.BulkRecordResult, len(job.Rows))
+	for i, row := range job.Rows {
+		results[i] = h.processIngestRow(job, fields, row)
+	}
+
+	_ = h.store.SetBulkJobRecordResults(jobID, results)
+	_ = h.store.UpdateBulkJobState(jobID, storage.JobStateJobComplete)
+}
+
+// processIngestRow applies one uploaded row with the job's operation, as
+// the user who created the job
+func (h *Handler) processIngestRow(job *storage.BulkJob, fields map[string]storage.FieldDefinition, row []string) storage.BulkRecordResult {
+	result := storage.BulkRecordResult{Row: row}
+	record := storage.Record{}
+	for i, name := range job.Header {
+		if i < len(row) && row[i] != "" {
+			record[name] = csvValue(fields[name], row[i])
+		}
+	}
+
+	id, _ := record["Id"].(string)
+	delete(record, "Id")
+
+	var err error
+	switch job.Operation {
+	case "insert":
+		result.ID, err = h.store.CreateRecordAs(job.CreatedById, job.Object, record)
+		result.Created = err == nil
+	case "update":
+		result.ID = id
+		if err = requireID(job.Operation, id); err == nil {
+			err = h.store.UpdateRecordAs(job.CreatedById, job.Object, id, record)
+		}
+	case "delete":
+		result.ID = id
+		if err = requireID(job.Operation, id); err == nil {
+			err = h.store.DeleteRecordAs(job.CreatedById, job.Object, id)
+		}
+	case "upsert":
+		value := record[job.ExternalIDFieldName]
+		if value == nil {
+			err = sferrors.SalesforceError{
+				Message:   "missing value for external id field: " + job.ExternalIDFieldName,
+				ErrorCode: sferrors.ErrorCodeRequiredFieldMissing,
+				Fields:    []string{job.ExternalIDFieldName},
+			}
+			break
+		}
+		result.ID, result.Created, err = h.store.UpsertRecordAs(job.CreatedById, job.Object, job.ExternalIDFieldName, toString(value), record)
+	}
+
+	if err != nil {
+		result.Errors = []storage.BulkRecordError{recordError(err)}
+	}
+	return result
+}
+
+// requireID rejects an update or delete row without an Id
+func requireID(operation, id string) error {
+	if id == "" {
+		return sferrors.SalesforceError{
+			Message:   "Id not specified in an " + operation + " call",
+			ErrorCode: sferrors.ErrorCodeMissingArgument,
+		}
+	}
+	return nil
+}
+
+// csvValue converts an uploaded CSV value to the field's type. #N/A sets a
+// field to null.
+func csvValue(field storage.FieldDefinition, value string) interface{} {
+	if value == "#N/A" {
+		return nil
+	}
+	switch field.Type {
+	case storage.FieldTypeInteger:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	case storage.FieldTypeDouble, storage.FieldTypeCurrency, storage.FieldTypePercent:
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// recordError converts a store error to a per-record bulk error
+func recordError(err error) storage.BulkRecordError {
+	var sfErr sferrors.SalesforceError
+	if errors.As(err, &sfErr) {
+		return storage.BulkRecordError{StatusCode: sfErr.ErrorCode, Message: sfErr.Message, Fields: sfErr.Fields}
+	}
+	if strings.HasPrefix(err.Error(), "record not found") {
+		return storage.BulkRecordError{StatusCode: sferrors.ErrorCodeInvalidCrossReferenceKey, Message: "invalid cross reference id"}
+	}
+	return storage.BulkRecordError{StatusCode: sferrors.ErrorCodeInvalidField, Message: err.Error()}
+}
+
+// writeUnprocessedRecords writes the unprocessedrecords CSV: the uploaded
+// rows that were not processed, under the uploaded header
+func writeUnprocessedRecords(w io.Writer, header []string, rows [][]string) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+func (h *Handler) ingestJobToResponse(job *storage.BulkJob) IngestJobResponse {
+	return IngestJobResponse{
+		JobResponse:         h.jobToResponse(job),
+		ExternalIDFieldName: job.ExternalIDFieldName,
+		NumberRecordsFailed: job.NumberRecordsFailed,
+	}
+}
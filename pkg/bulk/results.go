@@ -0,0 +1,64 @@
+package bulk
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// writeSuccessfulResults writes the successfulResults CSV: sf__Id and
+// sf__Created followed by the uploaded columns
+func writeSuccessfulResults(w io.Writer, header []string, results []storage.BulkRecordResult) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(append([]string{"sf__Id", "sf__Created"}, header...)); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if !result.Success() {
+			continue
+		}
+		row := append([]string{result.ID, strconv.FormatBool(result.Created)}, result.Row...)
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeFailedResults writes the failedResults CSV: sf__Id (set for updates
+// and deletes) and sf__Error followed by the uploaded columns
+func writeFailedResults(w io.Writer, header []string, results []storage.BulkRecordResult) error {
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(append([]string{"sf__Id", "sf__Error"}, header...)); err != nil {
+		return err
+	}
+	for _, result := range results {
+		if result.Success() {
+			continue
+		}
+		row := append([]string{result.ID, formatRecordErrors(result.Errors)}, result.Row...)
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// formatRecordErrors renders errors as Data Loader does in sf__Error:
+// STATUS_CODE:message:field1,field2 --
+func formatRecordErrors(errs []storage.BulkRecordError) string {
+	parts := make([]string, len(errs))
+	for i, e := range errs {
+		parts[i] = e.StatusCode + ":" + e.Message + ":" + strings.Join(e.Fields, ",") + " --"
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,66 @@
+package emulator
+
+import (
+	"net/http"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// clientError is an error response injected with SetClientError or
+// FailNextRequests
+type clientError struct {
+	status int
+	err    sferrors.SalesforceError
+}
+
+// callOptionsClient returns the client name from a Sforce-Call-Options
+// header such as "client=SampleApp/1.0, defaultNamespace=acme"
+func callOptionsClient(r *http.Request) string {
+	for _, option := range strings.Split(r.Header.Get("Sforce-Call-Options"), ",") {
+		key, value, ok := strings.Cut(option, "=")
+		if ok && strings.TrimSpace(key) == "client" {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// SetClientError makes every API request whose Sforce-Call-Options header
+// names client fail with status and err, until ClearClientErrors is called.
+// Other clients are unaffected, for multi-client test scenarios.
+func (e *Emulator) SetClientError(client string, status int, err sferrors.SalesforceError) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clientErrors[client] = clientError{status: status, err: err}
+}
+
+// ClearClientErrors removes all errors set with SetClientError
+func (e *Emulator) ClearClientErrors() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.clientErrors = make(map[string]clientError)
+}
+
+// serveCallOptions logs the request with its client name and answers it with
+// the client's injected error, if any. It reports whether it responded.
+func (e *Emulator) serveCallOptions(w http.ResponseWriter, r *http.Request) bool {
+	client := callOptionsClient(r)
+	if e.config.RequestLogger != nil {
+		e.config.RequestLogger.Printf("%s %s client=%q", r.Method, r.URL.Path, client)
+	}
+	if client == "" {
+		return false
+	}
+
+	e.mu.Lock()
+	injected, ok := e.clientErrors[client]
+	e.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	e.errors.Record(injected.status, injected.err.ErrorCode, injected.err.Message)
+	writeJSON(w, []sferrors.SalesforceError{injected.err}, injected.status)
+	return true
+}
@@ -1,25 +1,41 @@
 package emulator
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/bulk"
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/metadata"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/rest"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/streaming"
 )
 
 // Emulator represents a Salesforce API emulator
 type Emulator struct {
 	server      *httptest.Server
-	store       *storage.MemoryStore
+	store       storage.Store
+	memory      *storage.MemoryStore // store's MemoryStore, if it has one
 	config      *Config
 	authHandler *auth.Handler
 	restRouter  *rest.Router
 	bulkHandler *bulk.Handler
+	metadata    *metadata.Handler
+	streaming   *streaming.Handler
 	mux         *http.ServeMux
+	errors      *sferrors.ErrorRecorder
+
+	mu           sync.Mutex
+	clientErrors map[string]clientError // keyed by Sforce-Call-Options client
+	failures     []clientError          // failures for the next API requests
 }
 
 // New creates a new Salesforce emulator with the given options
@@ -29,37 +45,115 @@ func New(opts ...Option) *Emulator {
 		opt(config)
 	}
 
-	store := storage.NewMemoryStore()
+	var store storage.Store = storage.NewMemoryStore()
+	if config.Store != nil {
+		store = config.Store
+	}
+	memory := memoryStoreOf(store)
+	if memory != nil {
+		configureMemoryStore(memory, config)
+	} else if options := memoryOptions(config); len(options) > 0 {
+		panic(fmt.Sprintf("emulator: %s need a storage.MemoryStore, which %T is not built on",
+			strings.Join(options, ", "), store))
+	}
 
 	e := &Emulator{
-		store:  store,
-		config: config,
-		mux:    http.NewServeMux(),
+		store:        store,
+		memory:       memory,
+		config:       config,
+		mux:          http.NewServeMux(),
+		clientErrors: make(map[string]clientError),
 	}
 
+	if config.ErrorCaptureLimit > 0 {
+		e.errors = sferrors.NewErrorRecorder(config.ErrorCaptureLimit)
+	}
+	e.seedUsers()
+
 	return e
 }
 
+// seedUsers creates the Users of WithUser and binds their credentials to
+// them. Invalid user fields are a setup mistake, so they panic.
+func (e *Emulator) seedUsers() {
+	defaultUser, _ := e.store.GetRecord("User", e.store.GetDefaultUserID())
+	for i, user := range e.config.Users {
+		username := user.Credential.Username
+		record := storage.Record{
+			"Username":  username,
+			"Email":     username,
+			"LastName":  strings.SplitN(username, "@", 2)[0],
+			"ProfileId": defaultUser["ProfileId"],
+			"IsActive":  true,
+		}
+		for name, value := range user.Fields {
+			record[name] = value
+		}
+		if _, ok := record["Alias"]; !ok {
+			alias, _ := record["LastName"].(string)
+			if len(alias) > 8 {
+				alias = alias[:8]
+			}
+			record["Alias"] = alias
+		}
+
+		id, err := e.store.CreateRecord("User", record)
+		if err != nil {
+			panic(fmt.Sprintf("emulator: seeding user %s: %v", username, err))
+		}
+		e.config.Users[i].Credential.UserID = id
+	}
+}
+
 // Start starts the emulator server and returns the base URL
 func (e *Emulator) Start() string {
 	// Create the test server first to get the URL
 	e.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for key, values := range e.config.ResponseHeaders {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		if e.serveCallOptions(w, r) || e.serveFailure(w, r) || e.serveRateLimit(w, r) {
+			return
+		}
 		e.mux.ServeHTTP(w, r)
 	}))
 
+	// The Organization record reports the instance it is served from
+	if e.memory != nil {
+		e.memory.SetOrganization(e.config.OrgID, e.config.OrgName, e.server.URL)
+	}
+
 	// Initialize handlers with the server URL
 	e.authHandler = auth.NewHandler(
 		e.server.URL,
 		e.store.GetDefaultUserID(),
-		"00D000000000000AAA",
+		e.config.OrgID,
 		e.config.TokenLifetime,
 	)
 
+	e.authHandler.SetErrorRecorder(e.errors)
+	e.authHandler.SetScope(e.config.OAuthScope)
+	e.authHandler.SetIncludeExpiresIn(e.config.IncludeExpiresIn)
+	e.authHandler.SetEnforceScopes(e.config.EnforceScopes)
+	e.authHandler.SetPasswordRefreshTokens(e.config.PasswordRefreshTokens)
+	e.authHandler.SetLoginLockout(e.config.LoginLockoutThreshold)
+	e.authHandler.SetLogger(e.config.AuthLogger)
+	e.authHandler.SetJWTKey(e.config.JWTKey)
+	if e.config.DeterministicTokens {
+		e.authHandler.GetSessionManager().SetTokenSeed(e.config.TokenSeed)
+	}
+
 	// Add credentials
 	for _, cred := range e.config.Credentials {
 		e.authHandler.AddCredential(cred)
 	}
 
+	for _, user := range e.config.Users {
+		e.authHandler.AddCredential(user.Credential)
+	}
+
 	// If no credentials configured, add a default one
 	if len(e.config.Credentials) == 0 {
 		e.authHandler.AddCredential(auth.Credential{
@@ -72,9 +166,34 @@ func (e *Emulator) Start() string {
 
 	// Create REST router
 	e.restRouter = rest.NewRouter(e.store, e.authHandler, e.config.APIVersion)
+	e.restRouter.SetErrorRecorder(e.errors)
+	e.restRouter.SetAllowQueryPost(e.config.AllowQueryPost)
+	e.restRouter.SetWarningFunc(e.config.WarningFunc)
+	e.restRouter.SetCompositeLimit(e.config.CompositeLimit)
+	e.restRouter.SetIncludeSystemFields(e.config.IncludeSystemFields)
 
 	// Create Bulk handler
 	e.bulkHandler = bulk.NewHandler(e.store, e.authHandler, e.config.APIVersion)
+	e.bulkHandler.SetErrorRecorder(e.errors)
+	e.bulkHandler.SetProcessingDelay(e.config.BulkProcessingDelay)
+
+	// Create Metadata API handler
+	e.metadata = metadata.NewHandler(e.store, e.authHandler, e.config.APIVersion)
+
+	// Create Streaming API handler
+	e.streaming = streaming.NewHandler(e.authHandler)
+	e.streaming.SetErrorRecorder(e.errors)
+	e.streaming.SetTimeout(e.config.StreamingTimeout)
+	if e.memory != nil {
+		e.memory.SetEventPublisher(func(eventType string, event storage.Record) {
+			if storage.IsPlatformEvent(eventType) {
+				e.streaming.Publish("/event/"+eventType, event)
+				return
+			}
+			e.streaming.Publish("/data/"+eventType, event)
+			e.streaming.Publish("/data/ChangeEvents", event)
+		})
+	}
 
 	// Setup routes
 	e.setupRoutes()
@@ -85,10 +204,24 @@ func (e *Emulator) Start() string {
 func (e *Emulator) setupRoutes() {
 	// OAuth endpoints
 	e.mux.HandleFunc("/services/oauth2/token", e.authHandler.HandleOAuth)
+	e.mux.HandleFunc("/services/oauth2/authorize", e.authHandler.HandleAuthorize)
+	e.mux.HandleFunc("/services/oauth2/introspect", e.authHandler.HandleIntrospect)
 
 	// Bulk API endpoints
 	e.mux.HandleFunc("/services/data/v"+e.config.APIVersion+"/jobs/query", e.bulkHandler.HandleJobs)
 	e.mux.HandleFunc("/services/data/v"+e.config.APIVersion+"/jobs/query/", e.bulkHandler.HandleJobByID)
+	e.mux.HandleFunc("/services/data/v"+e.config.APIVersion+"/jobs/ingest", e.bulkHandler.HandleIngestJobs)
+	e.mux.HandleFunc("/services/data/v"+e.config.APIVersion+"/jobs/ingest/", e.bulkHandler.HandleIngestJobByID)
+
+	// Metadata API (SOAP) endpoints
+	e.metadata.RegisterRoutes(e.mux)
+
+	// Streaming API endpoint; CometD clients may append the meta channel
+	e.mux.HandleFunc("/cometd/"+e.config.APIVersion, e.streaming.HandleCometD)
+	e.mux.HandleFunc("/cometd/"+e.config.APIVersion+"/", e.streaming.HandleCometD)
+
+	// Emulator administration endpoints
+	e.mux.HandleFunc("/_emulator/sobjects/", e.handleTruncate)
 
 	// All other REST API endpoints
 	e.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -96,8 +229,34 @@ func (e *Emulator) setupRoutes() {
 	})
 }
 
+// handleTruncate handles DELETE /_emulator/sobjects/{objectType}, removing
+// every record of the type for cleanup between tests
+func (e *Emulator) handleTruncate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSON(w, []sferrors.SalesforceError{sferrors.NewMethodNotAllowedError(r.Method)}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	objectType := strings.Trim(strings.TrimPrefix(r.URL.Path, "/_emulator/sobjects/"), "/")
+	if err := e.store.Truncate(objectType); err != nil {
+		writeJSON(w, []sferrors.SalesforceError{sferrors.NewObjectNotFoundError(objectType)}, http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
+
 // Stop stops the emulator server
 func (e *Emulator) Stop() {
+	if e.streaming != nil {
+		e.streaming.Close()
+	}
 	if e.server != nil {
 		e.server.Close()
 	}
@@ -112,13 +271,173 @@ func (e *Emulator) URL() string {
 }
 
 // Store returns the underlying storage for direct manipulation
-func (e *Emulator) Store() *storage.MemoryStore {
+func (e *Emulator) Store() storage.Store {
 	return e.store
 }
 
+// memoryStoreOf returns the MemoryStore holding store's data: store itself,
+// the one a store such as sqlite.Store is built on, or nil. The org,
+// operation log, Change Data Capture, API limits and streaming events need
+// one.
+func memoryStoreOf(store storage.Store) *storage.MemoryStore {
+	switch s := store.(type) {
+	case *storage.MemoryStore:
+		return s
+	case interface{ Memory() *storage.MemoryStore }:
+		return s.Memory()
+	}
+	return nil
+}
+
+// memoryOptions returns the options set in config that configure a
+// MemoryStore. New panics if they are used with a store that has none
+// rather than silently ignoring them.
+func memoryOptions(config *Config) []string {
+	var options []string
+	if config.StageProbabilities != nil {
+		options = append(options, "WithStageProbabilities")
+	}
+	if config.OperationLogLimit != 0 {
+		options = append(options, "WithOperationLogLimit")
+	}
+	if config.OperationLogObject {
+		options = append(options, "WithOperationLogObject")
+	}
+	if config.RecycleBinRetention != 0 {
+		options = append(options, "WithRecycleBinRetention")
+	}
+	if len(config.ChangeDataCapture) > 0 {
+		options = append(options, "WithCDC")
+	}
+	if config.RateLimit > 0 {
+		options = append(options, "WithRateLimit")
+	}
+	return options
+}
+
+// configureMemoryStore applies the options that configure a MemoryStore
+func configureMemoryStore(store *storage.MemoryStore, config *Config) {
+	if config.StageProbabilities != nil {
+		store.SetStageProbabilities(config.StageProbabilities)
+	}
+	store.SetOrganization(config.OrgID, config.OrgName, "")
+	if config.OperationLogLimit != 0 {
+		store.SetOperationLogLimit(config.OperationLogLimit)
+	}
+	if config.OperationLogObject {
+		store.EnableOperationLogObject()
+	}
+	if config.RecycleBinRetention != 0 {
+		store.SetRecycleBinRetention(config.RecycleBinRetention)
+	}
+	if len(config.ChangeDataCapture) > 0 {
+		store.EnableChangeDataCapture(config.ChangeDataCapture...)
+	}
+	if config.RateLimit > 0 {
+		store.SetDailyAPIRequestLimit(config.RateLimit)
+	}
+}
+
+// Query runs a SOQL query directly against the store, without HTTP or auth.
+// The result reports totalSize as the REST API does, so COUNT() queries
+// give their count with no records.
+func (e *Emulator) Query(query string) (*soql.Result, error) {
+	return soql.NewEngine(e.store, e.config.APIVersion).Execute(query)
+}
+
 // Reset clears all data and resets to initial state
 func (e *Emulator) Reset() {
 	e.store.Reset()
+	e.errors.Reset()
+
+	// Seeded users are recreated with new IDs
+	e.seedUsers()
+	if e.authHandler != nil {
+		for _, user := range e.config.Users {
+			e.authHandler.AddCredential(user.Credential)
+		}
+	}
+}
+
+// Save writes a snapshot of the store to the file at path
+func (e *Emulator) Save(path string) error {
+	snapshotter, ok := e.store.(interface{ Snapshot() ([]byte, error) })
+	if !ok {
+		return fmt.Errorf("emulator: %T does not support snapshots", e.store)
+	}
+	data, err := snapshotter.Snapshot()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Load replaces the store's state with the snapshot saved at path
+func (e *Emulator) Load(path string) error {
+	restorer, ok := e.store.(interface{ Restore([]byte) error })
+	if !ok {
+		return fmt.Errorf("emulator: %T does not support snapshots", e.store)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return restorer.Restore(data)
+}
+
+// LastErrors returns the most recent error responses, oldest first.
+// Capture must be enabled with WithErrorCapture; otherwise nil is returned.
+func (e *Emulator) LastErrors() []sferrors.CapturedError {
+	return e.errors.Errors()
+}
+
+// ResetErrors discards all captured error responses
+func (e *Emulator) ResetErrors() {
+	e.errors.Reset()
+}
+
+// OperationLog returns the creates, updates and deletes made since the
+// emulator started or the log was last reset, oldest first
+func (e *Emulator) OperationLog() []storage.Operation {
+	if e.memory == nil {
+		return nil
+	}
+	return e.memory.OperationLog()
+}
+
+// ResetOperationLog discards the recorded operations
+func (e *Emulator) ResetOperationLog() {
+	if e.memory != nil {
+		e.memory.ResetOperationLog()
+	}
+}
+
+// ChangeEvents returns the change events recorded for the objects of
+// WithCDC, oldest first
+func (e *Emulator) ChangeEvents() []storage.ChangeEvent {
+	if e.memory == nil {
+		return nil
+	}
+	return e.memory.ChangeEvents()
+}
+
+// PurgeRecycleBin permanently removes the records deleted longer ago than
+// the recycle bin retention, returning how many were removed
+func (e *Emulator) PurgeRecycleBin() int {
+	if e.memory == nil {
+		return 0
+	}
+	return e.memory.PurgeRecycleBin()
+}
+
+// PublishEvent delivers payload to the Streaming API clients subscribed to
+// channel, such as /topic/AccountUpdates or /event/Order_Event__e. The
+// emulator must be started.
+func (e *Emulator) PublishEvent(channel string, payload map[string]interface{}) {
+	if e.streaming == nil {
+		return
+	}
+	e.streaming.Publish(channel, payload)
 }
 
 // AuthHandler returns the auth handler for creating sessions directly
@@ -126,6 +445,33 @@ func (e *Emulator) AuthHandler() *auth.Handler {
 	return e.authHandler
 }
 
+// SetAuthError makes the next auth attempt for clientID fail with the given
+// OAuth error code. The emulator must be started.
+func (e *Emulator) SetAuthError(clientID, oauthError string) {
+	if e.authHandler == nil {
+		return
+	}
+	e.authHandler.SetAuthError(clientID, oauthError)
+}
+
+// ResetLoginAttempts clears failed login counters, unlocking locked-out users
+func (e *Emulator) ResetLoginAttempts() {
+	if e.authHandler == nil {
+		return
+	}
+	e.authHandler.ResetLoginAttempts()
+}
+
+// ExpireAllSessions expires every access token issued so far, so the next
+// API call with one fails with INVALID_SESSION_ID. Refresh tokens keep
+// working. The emulator must be started.
+func (e *Emulator) ExpireAllSessions() {
+	if e.authHandler == nil {
+		return
+	}
+	e.authHandler.GetSessionManager().ExpireAll()
+}
+
 // CreateTestSession creates a test session and returns the access token
 func (e *Emulator) CreateTestSession() string {
 	if e.authHandler == nil {
@@ -134,7 +480,33 @@ func (e *Emulator) CreateTestSession() string {
 	session := e.authHandler.GetSessionManager().CreateSession(
 		e.server.URL,
 		e.store.GetDefaultUserID(),
-		"00D000000000000AAA",
+		e.config.OrgID,
+	)
+	return session.AccessToken
+}
+
+// CreateTestSessionFor creates a test session for the User userID limited to
+// scopes and returns the access token. An empty userID means the default user
+// and no scopes grants every scope. It returns "" if the emulator is not
+// started or the user does not exist.
+func (e *Emulator) CreateTestSessionFor(userID string, scopes ...string) string {
+	if e.authHandler == nil {
+		return ""
+	}
+	if userID == "" {
+		userID = e.store.GetDefaultUserID()
+	}
+	user, err := e.store.GetRecord("User", userID)
+	if err != nil {
+		return ""
+	}
+
+	username, _ := user["Username"].(string)
+	session := e.authHandler.GetSessionManager().CreateGrantedSession(
+		e.server.URL,
+		userID,
+		e.config.OrgID,
+		auth.Grant{Scope: strings.Join(scopes, " "), Username: username},
 	)
 	return session.AccessToken
 }
@@ -0,0 +1,52 @@
+package emulator
+
+import (
+	"net/http"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// FailNextRequests makes the next n API requests fail with errorCode, for
+// testing retry and re-authentication logic. INVALID_SESSION_ID fails with
+// 401 and REQUEST_LIMIT_EXCEEDED with 403; other codes fail with 400.
+// Calls add to failures still pending. OAuth endpoints are not affected.
+func (e *Emulator) FailNextRequests(n int, errorCode string) {
+	failure := clientError{
+		status: http.StatusBadRequest,
+		err:    sferrors.SalesforceError{Message: errorCode, ErrorCode: errorCode},
+	}
+	switch errorCode {
+	case sferrors.ErrorCodeInvalidSessionID:
+		failure = clientError{status: http.StatusUnauthorized, err: sferrors.NewInvalidSessionError()}
+	case sferrors.ErrorCodeRequestLimitExceeded:
+		failure = clientError{status: http.StatusForbidden, err: sferrors.NewRateLimitError()}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i := 0; i < n; i++ {
+		e.failures = append(e.failures, failure)
+	}
+}
+
+// serveFailure answers an API request with the next pending failure, if
+// any. It reports whether it responded.
+func (e *Emulator) serveFailure(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/services/data/") {
+		return false
+	}
+
+	e.mu.Lock()
+	if len(e.failures) == 0 {
+		e.mu.Unlock()
+		return false
+	}
+	failure := e.failures[0]
+	e.failures = e.failures[1:]
+	e.mu.Unlock()
+
+	e.errors.Record(failure.status, failure.err.ErrorCode, failure.err.Message)
+	writeJSON(w, []sferrors.SalesforceError{failure.err}, failure.status)
+	return true
+}
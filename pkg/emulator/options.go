@@ -1,9 +1,14 @@
 package emulator
 
 import (
+	"crypto/rsa"
+	"log"
+	"net/http"
 	"time"
 
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/rest"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
 )
 
 // Config holds the emulator configuration
@@ -11,23 +16,130 @@ type Config struct {
 	// APIVersion is the Salesforce API version to emulate (default: "58.0")
 	APIVersion string
 
+	// OrgID and OrgName identify the org in tokens and its Organization
+	// record (default: storage.DefaultOrgID and storage.DefaultOrgName)
+	OrgID   string
+	OrgName string
+
 	// Credentials are the valid OAuth credentials
 	Credentials []auth.Credential
 
-	// TokenLifetime is how long tokens are valid (default: 2 hours)
+	// Users are seeded User records, each with the credential that logs in
+	// as it
+	Users []UserConfig
+
+	// TokenLifetime is how long tokens are valid (default: 2 hours). A
+	// negative lifetime issues tokens that are already expired.
 	TokenLifetime time.Duration
 
 	// Port is the port to listen on (0 for random)
 	Port int
+
+	// OAuthScope is the scope reported in token responses (default: "api refresh_token")
+	OAuthScope string
+
+	// EnforceScopes rejects requests from sessions without the scope their
+	// endpoint needs: api, or id/openid/profile for the identity URL
+	EnforceScopes bool
+
+	// PasswordRefreshTokens lets the password flow issue refresh tokens
+	PasswordRefreshTokens bool
+
+	// IncludeExpiresIn adds expires_in to token responses
+	IncludeExpiresIn bool
+
+	// DeterministicTokens makes access tokens reproducible from TokenSeed
+	DeterministicTokens bool
+
+	// TokenSeed seeds the token generator when DeterministicTokens is set
+	TokenSeed int64
+
+	// LoginLockoutThreshold is how many consecutive failed password logins
+	// lock a username out (0 disables lockout)
+	LoginLockoutThreshold int
+
+	// StageProbabilities overrides the Opportunity StageName -> Probability
+	// mapping (nil keeps storage.DefaultStageProbabilities)
+	StageProbabilities map[string]float64
+
+	// AllowQueryPost enables the non-standard POST variant of /query
+	AllowQueryPost bool
+
+	// ResponseHeaders are added to every response, e.g. headers a gateway
+	// would inject in front of Salesforce
+	ResponseHeaders http.Header
+
+	// WarningFunc attaches warnings to successful create and update
+	// responses (nil reports none)
+	WarningFunc rest.WarningFunc
+
+	// CompositeLimit is the most subrequests a composite request may hold
+	// (0 uses Salesforce's limit of 25)
+	CompositeLimit int
+
+	// IncludeSystemFields keeps IsDeleted in record responses that did not
+	// ask for it
+	IncludeSystemFields bool
+
+	// BulkProcessingDelay keeps bulk query jobs InProgress for at least this
+	// long before they complete
+	BulkProcessingDelay time.Duration
+
+	// ChangeDataCapture are the objects whose writes record change events
+	ChangeDataCapture []string
+
+	// StreamingTimeout is how long a CometD /meta/connect waits for events
+	// (0 keeps streaming.DefaultTimeout)
+	StreamingTimeout time.Duration
+
+	// JWTKey verifies the signature of JWT bearer assertions (nil rejects
+	// the JWT bearer flow)
+	JWTKey *rsa.PublicKey
+
+	// AuthLogger receives diagnostics naming the credential field a failed
+	// token request did not match (nil disables them)
+	AuthLogger *log.Logger
+
+	// RequestLogger logs every request with the client named in its
+	// Sforce-Call-Options header (nil disables it)
+	RequestLogger *log.Logger
+
+	// OperationLogLimit is how many creates, updates and deletes OperationLog
+	// keeps (0 keeps storage.DefaultOperationLogLimit, negative disables it)
+	OperationLogLimit int
+
+	// OperationLogObject exposes the operation log to SOQL as the
+	// OperationLog virtual object
+	OperationLogObject bool
+
+	// RecycleBinRetention is how long deleted records stay in the recycle
+	// bin before PurgeRecycleBin removes them (0 keeps
+	// storage.DefaultRecycleBinRetention)
+	RecycleBinRetention time.Duration
+
+	// RateLimit is how many authenticated API requests are allowed before
+	// they fail with REQUEST_LIMIT_EXCEEDED (0 keeps
+	// storage.DefaultDailyAPIRequestLimit)
+	RateLimit int
+
+	// ErrorCaptureLimit is how many error responses to retain for LastErrors
+	// (0 disables capture)
+	ErrorCaptureLimit int
+
+	// Store holds the emulator's data (nil uses a new storage.MemoryStore)
+	Store storage.Store
 }
 
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
 		APIVersion:    "58.0",
+		OrgID:         storage.DefaultOrgID,
+		OrgName:       storage.DefaultOrgName,
 		Credentials:   []auth.Credential{},
 		TokenLifetime: 2 * time.Hour,
 		Port:          0,
+		OAuthScope:    auth.DefaultScope,
 	}
 }
 
@@ -60,7 +172,41 @@ func WithCredential(clientID, clientSecret, username, password string) Option {
 	}
 }
 
-// WithTokenLifetime sets the token lifetime
+// UserConfig is a User seeded by WithUser
+type UserConfig struct {
+	// Credential logs in as the user
+	Credential auth.Credential
+
+	// Fields are the User's fields. Username and Email default to the
+	// credential's username, and LastName, Alias and ProfileId are filled in
+	// when missing.
+	Fields map[string]interface{}
+}
+
+// WithUser seeds a User record and adds a credential that logs in as it, so
+// records written with its sessions carry its ID in CreatedById and
+// LastModifiedById. The default credential is still added unless
+// WithCredentials or WithCredential is used too.
+func WithUser(cred auth.Credential, fields map[string]interface{}) Option {
+	return func(c *Config) {
+		c.Users = append(c.Users, UserConfig{Credential: cred, Fields: fields})
+	}
+}
+
+// WithPublicClient adds a public OAuth client that authenticates without a secret
+func WithPublicClient(clientID, username, password string) Option {
+	return func(c *Config) {
+		c.Credentials = append(c.Credentials, auth.Credential{
+			ClientID: clientID,
+			Username: username,
+			Password: password,
+			Public:   true,
+		})
+	}
+}
+
+// WithTokenLifetime sets the token lifetime. A negative d issues tokens that
+// are already expired, so every API call fails with INVALID_SESSION_ID.
 func WithTokenLifetime(d time.Duration) Option {
 	return func(c *Config) {
 		c.TokenLifetime = d
@@ -73,3 +219,209 @@ func WithPort(port int) Option {
 		c.Port = port
 	}
 }
+
+// WithOAuthScope sets the scope reported in token responses (empty omits it)
+func WithOAuthScope(scope string) Option {
+	return func(c *Config) {
+		c.OAuthScope = scope
+	}
+}
+
+// WithScopeEnforcement rejects requests from sessions lacking the scope their
+// endpoint needs
+func WithScopeEnforcement() Option {
+	return func(c *Config) {
+		c.EnforceScopes = true
+	}
+}
+
+// WithPasswordRefreshTokens makes the username-password flow return a
+// refresh token when the granted scope includes refresh_token. Salesforce
+// only issues them from the authorization code flow.
+func WithPasswordRefreshTokens() Option {
+	return func(c *Config) {
+		c.PasswordRefreshTokens = true
+	}
+}
+
+// WithExpiresIn adds expires_in, derived from the token lifetime, to token responses
+func WithExpiresIn() Option {
+	return func(c *Config) {
+		c.IncludeExpiresIn = true
+	}
+}
+
+// WithDeterministicTokens makes issued access tokens reproducible across runs
+func WithDeterministicTokens(seed int64) Option {
+	return func(c *Config) {
+		c.DeterministicTokens = true
+		c.TokenSeed = seed
+	}
+}
+
+// WithErrorCapture retains the last n error responses, accessible via LastErrors
+func WithErrorCapture(n int) Option {
+	return func(c *Config) {
+		c.ErrorCaptureLimit = n
+	}
+}
+
+// WithLoginLockout locks a username out after threshold consecutive failed logins
+func WithLoginLockout(threshold int) Option {
+	return func(c *Config) {
+		c.LoginLockoutThreshold = threshold
+	}
+}
+
+// WithStageProbabilities overrides the Probability defaulted from Opportunity.StageName
+func WithStageProbabilities(probabilities map[string]float64) Option {
+	return func(c *Config) {
+		c.StageProbabilities = probabilities
+	}
+}
+
+// WithQueryPost accepts SOQL in a JSON body on POST /query, for queries too
+// long for a URL. Salesforce has no such endpoint.
+func WithQueryPost() Option {
+	return func(c *Config) {
+		c.AllowQueryPost = true
+	}
+}
+
+// WithResponseHeader adds a header to every response. It can be given
+// multiple times to set several headers.
+func WithResponseHeader(key, value string) Option {
+	return func(c *Config) {
+		if c.ResponseHeaders == nil {
+			c.ResponseHeaders = make(http.Header)
+		}
+		c.ResponseHeaders.Add(key, value)
+	}
+}
+
+// WithWarnings attaches the warnings fn returns to successful create and
+// update responses, e.g. to report fields a lenient org would ignore
+func WithWarnings(fn rest.WarningFunc) Option {
+	return func(c *Config) {
+		c.WarningFunc = fn
+	}
+}
+
+// WithCompositeLimit sets the most subrequests a composite request may hold
+// before it is rejected with LIMIT_EXCEEDED
+func WithCompositeLimit(limit int) Option {
+	return func(c *Config) {
+		c.CompositeLimit = limit
+	}
+}
+
+// WithOrganization sets the org ID and name reported in tokens and by the
+// Organization record
+func WithOrganization(id, name string) Option {
+	return func(c *Config) {
+		c.OrgID = id
+		c.OrgName = name
+	}
+}
+
+// WithSystemFields includes system fields such as IsDeleted in record
+// responses even when they were not requested
+func WithSystemFields() Option {
+	return func(c *Config) {
+		c.IncludeSystemFields = true
+	}
+}
+
+// WithBulkProcessingDelay keeps bulk query jobs InProgress for d before they
+// complete, so clients polling for job state see it change
+func WithBulkProcessingDelay(d time.Duration) Option {
+	return func(c *Config) {
+		c.BulkProcessingDelay = d
+	}
+}
+
+// WithJWTKey enables the JWT bearer flow for RS256 assertions signed with
+// the private half of key
+func WithJWTKey(key *rsa.PublicKey) Option {
+	return func(c *Config) {
+		c.JWTKey = key
+	}
+}
+
+// WithAuthLogger logs which credential field a failed token request did not
+// match, e.g. "username mismatch". Secrets are never logged and the client
+// still gets a generic invalid_grant.
+func WithAuthLogger(logger *log.Logger) Option {
+	return func(c *Config) {
+		c.AuthLogger = logger
+	}
+}
+
+// WithRequestLogger logs the method, path and Sforce-Call-Options client of
+// every request
+func WithRequestLogger(logger *log.Logger) Option {
+	return func(c *Config) {
+		c.RequestLogger = logger
+	}
+}
+
+// WithOperationLogLimit keeps the last n creates, updates and deletes in
+// OperationLog (negative disables the log)
+func WithOperationLogLimit(n int) Option {
+	return func(c *Config) {
+		c.OperationLogLimit = n
+	}
+}
+
+// WithRecycleBinRetention sets how long deleted records stay in the recycle
+// bin before PurgeRecycleBin removes them
+func WithRecycleBinRetention(d time.Duration) Option {
+	return func(c *Config) {
+		c.RecycleBinRetention = d
+	}
+}
+
+// WithOperationLogObject makes the operation log queryable as the
+// OperationLog virtual object
+func WithOperationLogObject() Option {
+	return func(c *Config) {
+		c.OperationLogObject = true
+	}
+}
+
+// WithRateLimit allows maxDailyRequests authenticated API requests instead
+// of storage.DefaultDailyAPIRequestLimit; later requests fail with 403
+// REQUEST_LIMIT_EXCEEDED.
+func WithRateLimit(maxDailyRequests int) Option {
+	return func(c *Config) {
+		c.RateLimit = maxDailyRequests
+	}
+}
+
+// WithStreamingTimeout sets how long a CometD /meta/connect long poll waits
+// for events before returning none
+func WithStreamingTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.StreamingTimeout = d
+	}
+}
+
+// WithCDC enables Change Data Capture for the given objects: every write
+// records a change event, published to /data/{Object}ChangeEvent and
+// /data/ChangeEvents
+func WithCDC(objectTypes ...string) Option {
+	return func(c *Config) {
+		c.ChangeDataCapture = append(c.ChangeDataCapture, objectTypes...)
+	}
+}
+
+// WithStore serves the emulator's data from store instead of a new
+// storage.MemoryStore, for example a sqlite.Store that outlives the process.
+// WithStageProbabilities, WithOperationLogLimit, WithOperationLogObject,
+// WithRecycleBinRetention, WithCDC and WithRateLimit configure the
+// MemoryStore a store is built on, so New panics if store has none.
+func WithStore(store storage.Store) Option {
+	return func(c *Config) {
+		c.Store = store
+	}
+}
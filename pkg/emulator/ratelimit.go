@@ -0,0 +1,49 @@
+package emulator
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// apiRequestCounter is a store that counts API requests against the daily
+// limit itself, as sqlite.Store does to save the count
+type apiRequestCounter interface {
+	ConsumeAPIRequest() (used, max int, ok bool)
+}
+
+// serveRateLimit counts an authenticated API request against the daily
+// limit and reports the usage in a Sforce-Limit-Info header, unless one is
+// set with WithResponseHeader. It rejects the request once the limit is
+// reached and reports whether it responded.
+func (e *Emulator) serveRateLimit(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.HasPrefix(r.URL.Path, "/services/data/") {
+		return false
+	}
+	counter, ok := e.store.(apiRequestCounter)
+	if !ok && e.memory != nil {
+		counter, ok = e.memory, true
+	}
+	if !ok {
+		return false
+	}
+	// Unauthenticated requests are left to be rejected without counting
+	if _, err := e.authHandler.ValidateRequest(r); err != nil {
+		return false
+	}
+
+	used, max, ok := counter.ConsumeAPIRequest()
+	if w.Header().Get("Sforce-Limit-Info") == "" {
+		w.Header().Set("Sforce-Limit-Info", fmt.Sprintf("api-usage=%d/%d", used, max))
+	}
+	if ok {
+		return false
+	}
+
+	err := sferrors.NewRateLimitError()
+	e.errors.Record(http.StatusForbidden, err.ErrorCode, err.Message)
+	writeJSON(w, []sferrors.SalesforceError{err}, http.StatusForbidden)
+	return true
+}
@@ -2,6 +2,8 @@ package errors
 
 import (
 	"fmt"
+	"strings"
+	"sync"
 )
 
 // SalesforceError represents a Salesforce API error response
@@ -17,25 +19,40 @@ func (e SalesforceError) Error() string {
 
 // Common Salesforce error codes
 const (
-	ErrorCodeNotFound                = "NOT_FOUND"
-	ErrorCodeInvalidField            = "INVALID_FIELD"
-	ErrorCodeRequiredFieldMissing    = "REQUIRED_FIELD_MISSING"
-	ErrorCodeDuplicateValue          = "DUPLICATE_VALUE"
-	ErrorCodeMalformedQuery          = "MALFORMED_QUERY"
-	ErrorCodeInvalidSessionID        = "INVALID_SESSION_ID"
-	ErrorCodeInvalidGrant            = "invalid_grant"
-	ErrorCodeJSONParserError         = "JSON_PARSER_ERROR"
-	ErrorCodeInvalidQueryFilterOp    = "INVALID_QUERY_FILTER_OPERATOR"
-	ErrorCodeEntityDeleted           = "ENTITY_IS_DELETED"
-	ErrorCodeUnableToLockRow         = "UNABLE_TO_LOCK_ROW"
-	ErrorCodeFieldIntegrity          = "FIELD_INTEGRITY_EXCEPTION"
-	ErrorCodeInvalidType             = "INVALID_TYPE"
-	ErrorCodeInvalidOperation        = "INVALID_OPERATION"
-	ErrorCodeStringTooLong           = "STRING_TOO_LONG"
-	ErrorCodeInvalidCrossReferenceKey = "INVALID_CROSS_REFERENCE_KEY"
-	ErrorCodeUnsupportedGrantType    = "unsupported_grant_type"
-	ErrorCodeMethodNotAllowed        = "METHOD_NOT_ALLOWED"
-	ErrorCodeRequestLimitExceeded    = "REQUEST_LIMIT_EXCEEDED"
+	ErrorCodeNotFound                           = "NOT_FOUND"
+	ErrorCodeInvalidField                       = "INVALID_FIELD"
+	ErrorCodeRequiredFieldMissing               = "REQUIRED_FIELD_MISSING"
+	ErrorCodeDuplicateValue                     = "DUPLICATE_VALUE"
+	ErrorCodeMalformedQuery                     = "MALFORMED_QUERY"
+	ErrorCodeMalformedSearch                    = "MALFORMED_SEARCH"
+	ErrorCodeInvalidSessionID                   = "INVALID_SESSION_ID"
+	ErrorCodeInvalidGrant                       = "invalid_grant"
+	ErrorCodeInvalidScope                       = "invalid_scope"
+	ErrorCodeJSONParserError                    = "JSON_PARSER_ERROR"
+	ErrorCodeInvalidQueryFilterOp               = "INVALID_QUERY_FILTER_OPERATOR"
+	ErrorCodeEntityDeleted                      = "ENTITY_IS_DELETED"
+	ErrorCodeUnableToLockRow                    = "UNABLE_TO_LOCK_ROW"
+	ErrorCodeFieldIntegrity                     = "FIELD_INTEGRITY_EXCEPTION"
+	ErrorCodeInvalidType                        = "INVALID_TYPE"
+	ErrorCodeInvalidOperation                   = "INVALID_OPERATION"
+	ErrorCodeStringTooLong                      = "STRING_TOO_LONG"
+	ErrorCodeInvalidCrossReferenceKey           = "INVALID_CROSS_REFERENCE_KEY"
+	ErrorCodeUnsupportedGrantType               = "unsupported_grant_type"
+	ErrorCodeInactiveUser                       = "inactive_user"
+	ErrorCodeInvalidClientID                    = "invalid_client_id"
+	ErrorCodeUserIsLocked                       = "user_is_locked"
+	ErrorCodeMethodNotAllowed                   = "METHOD_NOT_ALLOWED"
+	ErrorCodeRequestLimitExceeded               = "REQUEST_LIMIT_EXCEEDED"
+	ErrorCodeLimitExceeded                      = "LIMIT_EXCEEDED"
+	ErrorCodeMultipleChoices                    = "MULTIPLE_CHOICES"
+	ErrorCodeMissingArgument                    = "MISSING_ARGUMENT"
+	ErrorCodeUndeleteFailed                     = "UNDELETE_FAILED"
+	ErrorCodeProcessingHalted                   = "PROCESSING_HALTED"
+	ErrorCodeBatchProcessingHalted              = "BATCH_PROCESSING_HALTED"
+	ErrorCodeInvalidOrNullForRestrictedPicklist = "INVALID_OR_NULL_FOR_RESTRICTED_PICKLIST"
+	ErrorCodeDuplicateDeveloperName             = "DUPLICATE_DEVELOPER_NAME"
+	ErrorCodeInvalidFieldForInsertUpdate        = "INVALID_FIELD_FOR_INSERT_UPDATE"
+	ErrorCodeDeleteFailed                       = "DELETE_FAILED"
 )
 
 // NewNotFoundError creates a not found error
@@ -80,6 +97,14 @@ func NewMalformedQueryError(details string) SalesforceError {
 	}
 }
 
+// NewMalformedSearchError creates a SOSL search error
+func NewMalformedSearchError(details string) SalesforceError {
+	return SalesforceError{
+		Message:   details,
+		ErrorCode: ErrorCodeMalformedSearch,
+	}
+}
+
 // NewInvalidFieldError creates an invalid field error
 func NewInvalidFieldError(fieldName, objectType string) SalesforceError {
 	return SalesforceError{
@@ -97,6 +122,14 @@ func NewInvalidSessionError() SalesforceError {
 	}
 }
 
+// NewInsufficientScopeError creates an error for sessions lacking the api scope
+func NewInsufficientScopeError() SalesforceError {
+	return SalesforceError{
+		Message:   "This session is not valid for use with the REST API",
+		ErrorCode: ErrorCodeInvalidSessionID,
+	}
+}
+
 // NewJSONParserError creates a JSON parsing error
 func NewJSONParserError(details string) SalesforceError {
 	return SalesforceError{
@@ -122,6 +155,25 @@ func NewInvalidTypeError(objectType string) SalesforceError {
 	}
 }
 
+// NewAttributesTypeError creates the error for a record whose attributes.type
+// names a different object than the one being written
+func NewAttributesTypeError(attributesType, objectType string) SalesforceError {
+	return SalesforceError{
+		Message:   fmt.Sprintf("attributes.type '%s' does not match sObject type '%s'", attributesType, objectType),
+		ErrorCode: ErrorCodeInvalidType,
+	}
+}
+
+// NewMultipleChoicesError creates the error for an upsert whose external ID
+// matches more than one record
+func NewMultipleChoicesError(field string, ids []string) SalesforceError {
+	return SalesforceError{
+		Message:   fmt.Sprintf("More than one record found for external id field: %s [%s]", field, strings.Join(ids, ", ")),
+		ErrorCode: ErrorCodeMultipleChoices,
+		Fields:    []string{field},
+	}
+}
+
 // NewMethodNotAllowedError creates a method not allowed error
 func NewMethodNotAllowedError(method string) SalesforceError {
 	return SalesforceError{
@@ -138,6 +190,15 @@ func NewRateLimitError() SalesforceError {
 	}
 }
 
+// NewSubrequestLimitError creates the error for a composite request with
+// more than limit subrequests
+func NewSubrequestLimitError(limit int) SalesforceError {
+	return SalesforceError{
+		Message:   fmt.Sprintf("Exceeded max number of subrequests: %d", limit),
+		ErrorCode: ErrorCodeLimitExceeded,
+	}
+}
+
 // OAuthError represents an OAuth error response
 type OAuthError struct {
 	Error            string `json:"error"`
@@ -151,3 +212,68 @@ func NewOAuthError(errorType, description string) OAuthError {
 		ErrorDescription: description,
 	}
 }
+
+// CapturedError is an error response retained by an ErrorRecorder
+type CapturedError struct {
+	Status    int    `json:"status"`
+	ErrorCode string `json:"errorCode"`
+	Message   string `json:"message"`
+}
+
+// ErrorRecorder retains the most recent error responses sent by the emulator.
+// A nil recorder is valid and records nothing.
+type ErrorRecorder struct {
+	mu     sync.Mutex
+	limit  int
+	errors []CapturedError
+}
+
+// NewErrorRecorder creates a recorder that keeps the last limit errors
+func NewErrorRecorder(limit int) *ErrorRecorder {
+	return &ErrorRecorder{limit: limit}
+}
+
+// Record stores an error response, evicting the oldest once the limit is reached
+func (r *ErrorRecorder) Record(status int, errorCode, message string) {
+	if r == nil || r.limit <= 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errors = append(r.errors, CapturedError{
+		Status:    status,
+		ErrorCode: errorCode,
+		Message:   message,
+	})
+	if len(r.errors) > r.limit {
+		r.errors = r.errors[len(r.errors)-r.limit:]
+	}
+}
+
+// Errors returns the retained errors, oldest first
+func (r *ErrorRecorder) Errors() []CapturedError {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]CapturedError, len(r.errors))
+	copy(result, r.errors)
+	return result
+}
+
+// Reset discards all retained errors
+func (r *ErrorRecorder) Reset() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.errors = nil
+}
@@ -0,0 +1,314 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// xsiNamespace is the namespace of the xsi:type attribute naming the type
+// of a metadata element
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// Metadata is a metadata component in a CRUD request, such as
+// <metadata xsi:type="CustomField">. Content is decoded once the type is known.
+type Metadata struct {
+	Type    string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	Content []byte `xml:",innerxml"`
+}
+
+// CreateMetadataRequest represents a createMetadata request
+type CreateMetadataRequest struct {
+	Metadata []Metadata `xml:"metadata"`
+}
+
+// UpdateMetadataRequest represents an updateMetadata request
+type UpdateMetadataRequest struct {
+	Metadata []Metadata `xml:"metadata"`
+}
+
+// DeleteMetadataRequest represents a deleteMetadata request
+type DeleteMetadataRequest struct {
+	Type      string   `xml:"type"`
+	FullNames []string `xml:"fullNames"`
+}
+
+// ReadMetadataRequest represents a readMetadata request
+type ReadMetadataRequest struct {
+	Type      string   `xml:"type"`
+	FullNames []string `xml:"fullNames"`
+}
+
+// SaveResult is the outcome of creating, updating or deleting a component
+type SaveResult struct {
+	Errors   []MetadataError `xml:"errors,omitempty"`
+	FullName string          `xml:"fullName"`
+	Success  bool            `xml:"success"`
+}
+
+// MetadataError describes why a component could not be saved
+type MetadataError struct {
+	Message    string `xml:"message"`
+	StatusCode string `xml:"statusCode"`
+}
+
+// customObject decodes the component as a CustomObject
+func (m Metadata) customObject() (CustomObject, error) {
+	var object CustomObject
+	err := xml.Unmarshal(wrapContent("CustomObject", m.Content), &object)
+	return object, err
+}
+
+// customField decodes the component as a CustomField
+func (m Metadata) customField() (CustomField, error) {
+	var field CustomField
+	err := xml.Unmarshal(wrapContent("CustomField", m.Content), &field)
+	return field, err
+}
+
+func wrapContent(name string, content []byte) []byte {
+	return []byte("<" + name + ">" + string(content) + "</" + name + ">")
+}
+
+// handleCreateMetadata handles createMetadata requests
+func (h *Handler) handleCreateMetadata(w http.ResponseWriter, req *CreateMetadataRequest) {
+	results := make([]SaveResult, len(req.Metadata))
+	for i, component := range req.Metadata {
+		results[i] = h.saveMetadata(component, true)
+	}
+	h.respondMetadataResults(w, "createMetadataResponse", results)
+}
+
+// handleUpdateMetadata handles updateMetadata requests
+func (h *Handler) handleUpdateMetadata(w http.ResponseWriter, req *UpdateMetadataRequest) {
+	results := make([]SaveResult, len(req.Metadata))
+	for i, component := range req.Metadata {
+		results[i] = h.saveMetadata(component, false)
+	}
+	h.respondMetadataResults(w, "updateMetadataResponse", results)
+}
+
+// saveMetadata creates a component, or updates an existing one
+func (h *Handler) saveMetadata(component Metadata, create bool) SaveResult {
+	switch component.Type {
+	case "CustomObject":
+		object, err := component.customObject()
+		if err != nil {
+			return failedResult("", sferrors.ErrorCodeInvalidField, err.Error())
+		}
+		return h.saveCustomObject(object, create)
+	case "CustomField":
+		field, err := component.customField()
+		if err != nil {
+			return failedResult("", sferrors.ErrorCodeInvalidField, err.Error())
+		}
+		return h.saveCustomField(field, create)
+	}
+	return failedResult("", sferrors.ErrorCodeInvalidType, "Unsupported metadata type: "+component.Type)
+}
+
+func (h *Handler) saveCustomObject(object CustomObject, create bool) SaveResult {
+	exists := h.store.HasSObject(object.FullName)
+	switch {
+	case object.FullName == "":
+		return failedResult("", sferrors.ErrorCodeMissingArgument, "fullName is required")
+	case create && exists:
+		return failedResult(object.FullName, sferrors.ErrorCodeDuplicateDeveloperName,
+			"There is already a Custom Object named "+object.FullName)
+	case !create && !exists:
+		return failedResult(object.FullName, sferrors.ErrorCodeInvalidCrossReferenceKey,
+			"In field: fullName - no CustomObject named "+object.FullName+" found")
+	}
+
+	if create {
+		if _, err := applyCustomObject(h.store, object); err != nil {
+			return failedResult(object.FullName, sferrors.ErrorCodeFieldIntegrity, err.Error())
+		}
+		return SaveResult{FullName: object.FullName, Success: true}
+	}
+
+	// An update relabels the object and saves each field it lists
+	description, err := h.store.DescribeSObject(object.FullName)
+	if err != nil {
+		return failedResult(object.FullName, sferrors.ErrorCodeInvalidCrossReferenceKey, err.Error())
+	}
+	definition := description.SObjectDefinition
+	if object.Label != "" {
+		definition.Label = object.Label
+	}
+	if object.PluralLabel != "" {
+		definition.LabelPlural = object.PluralLabel
+	}
+	if definition.Custom {
+		if err := h.store.RegisterSObject(definition); err != nil {
+			return failedResult(object.FullName, sferrors.ErrorCodeFieldIntegrity, err.Error())
+		}
+	}
+	for _, field := range object.Fields {
+		field.FullName = object.FullName + "." + field.FullName
+		exists := h.fieldExists(field.FullName)
+		if result := h.saveCustomField(field, !exists); !result.Success {
+			result.FullName = object.FullName
+			return result
+		}
+	}
+	return SaveResult{FullName: object.FullName, Success: true}
+}
+
+func (h *Handler) saveCustomField(field CustomField, create bool) SaveResult {
+	fullName := field.FullName
+	objectType, fieldName, ok := strings.Cut(fullName, ".")
+	if !ok || !h.store.HasSObject(objectType) {
+		return failedResult(fullName, sferrors.ErrorCodeInvalidCrossReferenceKey,
+			"In field: fullName - no CustomObject named "+objectType+" found")
+	}
+	exists := h.fieldExists(fullName)
+	if create && exists {
+		return failedResult(fullName, sferrors.ErrorCodeDuplicateDeveloperName,
+			"There is already a field named "+fieldName+" on "+objectType)
+	}
+	if !create && !exists {
+		return failedResult(fullName, sferrors.ErrorCodeInvalidCrossReferenceKey,
+			"In field: fullName - no CustomField named "+fullName+" found")
+	}
+
+	field.FullName = fieldName
+	definition, err := field.definition()
+	if err != nil {
+		return failedResult(fullName, sferrors.ErrorCodeInvalidField, err.Error())
+	}
+	if create {
+		err = h.store.AddField(objectType, definition)
+	} else {
+		err = h.store.UpdateField(objectType, definition)
+	}
+	if err != nil {
+		return failedResult(fullName, sferrors.ErrorCodeFieldIntegrity, err.Error())
+	}
+	return SaveResult{FullName: fullName, Success: true}
+}
+
+// fieldExists reports whether the field named Object.Field exists
+func (h *Handler) fieldExists(fullName string) bool {
+	objectType, fieldName, _ := strings.Cut(fullName, ".")
+	description, err := h.store.DescribeSObject(objectType)
+	if err != nil {
+		return false
+	}
+	for _, field := range description.Fields {
+		if field.Name == fieldName {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDeleteMetadata handles deleteMetadata requests. Standard objects
+// and fields cannot be deleted.
+func (h *Handler) handleDeleteMetadata(w http.ResponseWriter, req *DeleteMetadataRequest) {
+	results := make([]SaveResult, len(req.FullNames))
+	for i, fullName := range req.FullNames {
+		var err error
+		switch req.Type {
+		case "CustomObject":
+			err = h.store.UnregisterSObject(fullName)
+		case "CustomField":
+			objectType, fieldName, _ := strings.Cut(fullName, ".")
+			if !strings.HasSuffix(fieldName, "__c") {
+				err = fmt.Errorf("cannot delete standard field: %s", fullName)
+			} else {
+				err = h.store.RemoveField(objectType, fieldName)
+			}
+		default:
+			results[i] = failedResult(fullName, sferrors.ErrorCodeInvalidType, "Unsupported metadata type: "+req.Type)
+			continue
+		}
+		if err != nil {
+			results[i] = failedResult(fullName, sferrors.ErrorCodeInvalidCrossReferenceKey, err.Error())
+			continue
+		}
+		results[i] = SaveResult{FullName: fullName, Success: true}
+	}
+	h.respondMetadataResults(w, "deleteMetadataResponse", results)
+}
+
+// handleReadMetadata handles readMetadata requests, returning a records
+// element for each named component that exists
+func (h *Handler) handleReadMetadata(w http.ResponseWriter, req *ReadMetadataRequest) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for _, fullName := range req.FullNames {
+		var record interface{}
+		switch req.Type {
+		case "CustomObject":
+			description, err := h.store.DescribeSObject(fullName)
+			if err != nil {
+				continue
+			}
+			record = customObjectFor(description.SObjectDefinition)
+		case "CustomField":
+			objectType, fieldName, _ := strings.Cut(fullName, ".")
+			description, err := h.store.DescribeSObject(objectType)
+			if err != nil {
+				continue
+			}
+			for _, field := range description.Fields {
+				if field.Name == fieldName {
+					custom := customFieldFor(field)
+					custom.FullName = fullName
+					record = custom
+				}
+			}
+		default:
+			h.respondSOAPFault(w, "sf:INVALID_TYPE", "Unsupported metadata type: "+req.Type)
+			return
+		}
+		if record == nil {
+			continue
+		}
+		_ = enc.EncodeElement(record, xml.StartElement{
+			Name: xml.Name{Local: "records"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "xsi:type"}, Value: req.Type}},
+		})
+	}
+	_ = enc.Flush()
+
+	h.respondMetadataXML(w, "readMetadataResponse", "<result>"+buf.String()+"</result>")
+}
+
+func failedResult(fullName, statusCode, message string) SaveResult {
+	return SaveResult{
+		Errors:   []MetadataError{{Message: message, StatusCode: statusCode}},
+		FullName: fullName,
+	}
+}
+
+func (h *Handler) respondMetadataResults(w http.ResponseWriter, response string, results []SaveResult) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for _, result := range results {
+		if err := enc.EncodeElement(result, xml.StartElement{Name: xml.Name{Local: "result"}}); err != nil {
+			h.respondSOAPFault(w, "soapenv:Server", err.Error())
+			return
+		}
+	}
+	_ = enc.Flush()
+	h.respondMetadataXML(w, response, buf.String())
+}
+
+func (h *Handler) respondMetadataXML(w http.ResponseWriter, response, content string) {
+	body := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns="http://soap.sforce.com/2006/04/metadata" xmlns:xsi="%s">
+  <soapenv:Body>
+    <%s>%s</%s>
+  </soapenv:Body>
+</soapenv:Envelope>`, xsiNamespace, response, content, response)
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(body))
+}
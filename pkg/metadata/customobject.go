@@ -0,0 +1,458 @@
+package metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// CustomObject is the metadata of an object, as in objects/{Name}.object
+type CustomObject struct {
+	XMLName          xml.Name      `xml:"CustomObject"`
+	Xmlns            string        `xml:"xmlns,attr,omitempty"`
+	FullName         string        `xml:"fullName,omitempty"`
+	Label            string        `xml:"label,omitempty"`
+	PluralLabel      string        `xml:"pluralLabel,omitempty"`
+	NameField        *CustomField  `xml:"nameField,omitempty"`
+	DeploymentStatus string        `xml:"deploymentStatus,omitempty"`
+	SharingModel     string        `xml:"sharingModel,omitempty"`
+	Fields           []CustomField `xml:"fields"`
+}
+
+// CustomField is the metadata of a field, nested in a CustomObject
+type CustomField struct {
+	FullName         string    `xml:"fullName,omitempty"`
+	Label            string    `xml:"label,omitempty"`
+	Type             string    `xml:"type,omitempty"`
+	Length           int       `xml:"length,omitempty"`
+	Precision        int       `xml:"precision,omitempty"`
+	Scale            int       `xml:"scale,omitempty"`
+	Required         bool      `xml:"required,omitempty"`
+	Unique           bool      `xml:"unique,omitempty"`
+	ExternalID       bool      `xml:"externalId,omitempty"`
+	DefaultValue     string    `xml:"defaultValue,omitempty"`
+	DisplayFormat    string    `xml:"displayFormat,omitempty"`
+	Formula          string    `xml:"formula,omitempty"`
+	ReferenceTo      string    `xml:"referenceTo,omitempty"`
+	RelationshipName string    `xml:"relationshipName,omitempty"`
+	DeleteConstraint string    `xml:"deleteConstraint,omitempty"`
+	ValueSet         *ValueSet `xml:"valueSet,omitempty"`
+}
+
+// ValueSet holds a picklist field's values
+type ValueSet struct {
+	Restricted         bool                `xml:"restricted,omitempty"`
+	ValueSetDefinition *ValueSetDefinition `xml:"valueSetDefinition,omitempty"`
+}
+
+// ValueSetDefinition lists a picklist's values
+type ValueSetDefinition struct {
+	Values []CustomValue `xml:"value"`
+}
+
+// CustomValue is one picklist value
+type CustomValue struct {
+	FullName string `xml:"fullName"`
+	Default  bool   `xml:"default"`
+	Label    string `xml:"label,omitempty"`
+}
+
+// fieldTypes maps Metadata API field types to the store's field types
+var fieldTypes = map[string]storage.FieldType{
+	"AutoNumber":          storage.FieldTypeString,
+	"Checkbox":            storage.FieldTypeBoolean,
+	"Currency":            storage.FieldTypeCurrency,
+	"Date":                storage.FieldTypeDate,
+	"DateTime":            storage.FieldTypeDatetime,
+	"Email":               storage.FieldTypeEmail,
+	"Html":                storage.FieldTypeRichTextArea,
+	"Lookup":              storage.FieldTypeReference,
+	"LongTextArea":        storage.FieldTypeLongTextArea,
+	"MasterDetail":        storage.FieldTypeReference,
+	"MultiselectPicklist": storage.FieldTypeMultiPicklist,
+	"Number":              storage.FieldTypeDouble,
+	"Percent":             storage.FieldTypePercent,
+	"Phone":               storage.FieldTypePhone,
+	"Picklist":            storage.FieldTypePicklist,
+	"Text":                storage.FieldTypeString,
+	"TextArea":            storage.FieldTypeTextArea,
+	"Time":                storage.FieldTypeTime,
+	"Url":                 storage.FieldTypeURL,
+}
+
+// deployComponent is a component read from a deploy ZIP
+type deployComponent struct {
+	FileName string
+	Object   CustomObject
+}
+
+// readDeployZip returns the CustomObject components of a deploy ZIP. Files
+// that fail to parse are returned as component failures.
+func readDeployZip(data []byte) ([]deployComponent, []DeployMessage, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var components []deployComponent
+	var failures []DeployMessage
+	for _, file := range archive.File {
+		if path.Ext(file.Name) != ".object" || path.Base(path.Dir(file.Name)) != "objects" {
+			continue
+		}
+		fullName := strings.TrimSuffix(path.Base(file.Name), ".object")
+
+		object, err := readCustomObject(file)
+		if err == nil {
+			object.FullName = fullName
+			err = object.validate()
+		}
+		if err != nil {
+			failures = append(failures, DeployMessage{
+				ComponentType: "CustomObject",
+				FileName:      file.Name,
+				FullName:      fullName,
+				Problem:       err.Error(),
+				ProblemType:   "Error",
+			})
+			continue
+		}
+		components = append(components, deployComponent{FileName: file.Name, Object: object})
+	}
+	return components, failures, nil
+}
+
+func readCustomObject(file *zip.File) (CustomObject, error) {
+	var object CustomObject
+	rc, err := file.Open()
+	if err != nil {
+		return object, err
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return object, err
+	}
+	if err := xml.Unmarshal(data, &object); err != nil {
+		return object, fmt.Errorf("Error parsing file: %v", err)
+	}
+	return object, nil
+}
+
+// validate checks the fields of a CustomObject can be converted
+func (o CustomObject) validate() error {
+	for _, field := range o.Fields {
+		if _, err := field.definition(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyCustomObject registers a deployed object, or adds the deployed
+// custom fields to an object the store already has. It reports whether the
+// object was created.
+func applyCustomObject(store storage.Store, object CustomObject) (bool, error) {
+	if store.HasSObject(object.FullName) {
+		description, err := store.DescribeSObject(object.FullName)
+		if err != nil {
+			return false, err
+		}
+		existing := make(map[string]bool, len(description.Fields))
+		for _, field := range description.Fields {
+			existing[field.Name] = true
+		}
+		for _, field := range object.Fields {
+			if existing[field.FullName] {
+				continue
+			}
+			definition, err := field.definition()
+			if err != nil {
+				return false, err
+			}
+			if err := store.AddField(object.FullName, definition); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+
+	definition, err := object.definition()
+	if err != nil {
+		return false, err
+	}
+	return true, store.RegisterSObject(definition)
+}
+
+// definition converts a custom object to its schema, adding the standard
+// fields every custom object has
+func (o CustomObject) definition() (storage.SObjectDefinition, error) {
+	label := o.Label
+	if label == "" {
+		label = strings.ReplaceAll(strings.TrimSuffix(o.FullName, "__c"), "_", " ")
+	}
+	plural := o.PluralLabel
+	if plural == "" {
+		plural = label + "s"
+	}
+
+	nameField := storage.FieldDefinition{Name: "Name", Label: label + " Name", Type: storage.FieldTypeString, Length: 80, Createable: true, Updateable: true}
+	if o.NameField != nil && o.NameField.Label != "" {
+		nameField.Label = o.NameField.Label
+	}
+	if o.NameField != nil && o.NameField.Type == "AutoNumber" {
+		nameField.Createable = false
+		nameField.Updateable = false
+		nameField.AutoNumber = true
+		nameField.DisplayFormat = o.NameField.DisplayFormat
+	}
+
+	fields := []storage.FieldDefinition{
+		{Name: "Id", Label: "Record ID", Type: storage.FieldTypeID},
+		nameField,
+		{Name: "OwnerId", Label: "Owner ID", Type: storage.FieldTypeReference, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+	}
+	for _, field := range o.Fields {
+		definition, err := field.definition()
+		if err != nil {
+			return storage.SObjectDefinition{}, err
+		}
+		fields = append(fields, definition)
+	}
+	fields = append(fields,
+		storage.FieldDefinition{Name: "CreatedDate", Label: "Created Date", Type: storage.FieldTypeDatetime},
+		storage.FieldDefinition{Name: "CreatedById", Label: "Created By ID", Type: storage.FieldTypeReference, ReferenceTo: []string{"User"}},
+		storage.FieldDefinition{Name: "LastModifiedDate", Label: "Last Modified Date", Type: storage.FieldTypeDatetime},
+		storage.FieldDefinition{Name: "LastModifiedById", Label: "Last Modified By ID", Type: storage.FieldTypeReference, ReferenceTo: []string{"User"}},
+		storage.FieldDefinition{Name: "SystemModstamp", Label: "System Modstamp", Type: storage.FieldTypeDatetime},
+		storage.FieldDefinition{Name: "IsDeleted", Label: "Deleted", Type: storage.FieldTypeBoolean},
+	)
+
+	return storage.SObjectDefinition{
+		Name:        o.FullName,
+		Label:       label,
+		LabelPlural: plural,
+		Custom:      true,
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields:      fields,
+	}, nil
+}
+
+// definition converts a custom field to its schema
+func (f CustomField) definition() (storage.FieldDefinition, error) {
+	if f.FullName == "" {
+		return storage.FieldDefinition{}, fmt.Errorf("Field fullName is required")
+	}
+	fieldType, ok := fieldTypes[f.Type]
+	if !ok {
+		return storage.FieldDefinition{}, fmt.Errorf("%s: Unknown type name '%s'", f.FullName, f.Type)
+	}
+
+	label := f.Label
+	if label == "" {
+		label = strings.ReplaceAll(strings.TrimSuffix(f.FullName, "__c"), "_", " ")
+	}
+	field := storage.FieldDefinition{
+		Name:       f.FullName,
+		Label:      label,
+		Type:       fieldType,
+		Length:     f.Length,
+		Precision:  f.Precision,
+		Scale:      f.Scale,
+		Nillable:   !f.Required && f.Type != "Checkbox",
+		Createable: f.Formula == "",
+		Updateable: f.Formula == "",
+		Unique:     f.Unique,
+		ExternalId: f.ExternalID,
+	}
+	if f.Formula != "" {
+		field.Calculated = true
+		field.CalculatedFormula = f.Formula
+	}
+
+	switch f.Type {
+	case "Text", "Email", "Phone":
+		if field.Length == 0 {
+			field.Length = 255
+		}
+	case "Checkbox":
+		field.DefaultValue = f.DefaultValue == "true"
+	case "AutoNumber":
+		field.Length = 30
+		field.Nillable = false
+		field.Createable = false
+		field.Updateable = false
+		field.AutoNumber = true
+		field.DisplayFormat = f.DisplayFormat
+	case "Lookup", "MasterDetail":
+		field.ReferenceTo = []string{f.ReferenceTo}
+		field.RelationshipName = strings.TrimSuffix(f.FullName, "__c") + "__r"
+		if f.RelationshipName != "" {
+			field.ChildRelationshipName = f.RelationshipName + "__r"
+		}
+		field.CascadeDelete = f.Type == "MasterDetail" || f.DeleteConstraint == "Cascade"
+		field.RestrictedDelete = f.DeleteConstraint == "Restrict"
+	case "Picklist", "MultiselectPicklist":
+		if f.ValueSet != nil {
+			field.RestrictedPicklist = f.ValueSet.Restricted
+			if f.ValueSet.ValueSetDefinition != nil {
+				for _, value := range f.ValueSet.ValueSetDefinition.Values {
+					label := value.Label
+					if label == "" {
+						label = value.FullName
+					}
+					field.PicklistValues = append(field.PicklistValues, storage.PicklistValue{
+						Value:        value.FullName,
+						Label:        label,
+						Active:       true,
+						DefaultValue: value.Default,
+					})
+				}
+			}
+		}
+	}
+	return field, nil
+}
+
+// deployDetails renders the details element of a checkDeployStatus result
+func deployDetails(status *DeploymentStatus) string {
+	details := struct {
+		XMLName            xml.Name        `xml:"details"`
+		ComponentFailures  []DeployMessage `xml:"componentFailures"`
+		ComponentSuccesses []DeployMessage `xml:"componentSuccesses"`
+	}{
+		ComponentFailures:  status.ComponentFailures,
+		ComponentSuccesses: status.ComponentSuccesses,
+	}
+	data, err := xml.Marshal(details)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// metadataTypes maps the store's field types back to Metadata API types
+var metadataTypes = map[storage.FieldType]string{
+	storage.FieldTypeBoolean:       "Checkbox",
+	storage.FieldTypeCurrency:      "Currency",
+	storage.FieldTypeDate:          "Date",
+	storage.FieldTypeDatetime:      "DateTime",
+	storage.FieldTypeDouble:        "Number",
+	storage.FieldTypeEmail:         "Email",
+	storage.FieldTypeInteger:       "Number",
+	storage.FieldTypeLongTextArea:  "LongTextArea",
+	storage.FieldTypeMultiPicklist: "MultiselectPicklist",
+	storage.FieldTypePercent:       "Percent",
+	storage.FieldTypePhone:         "Phone",
+	storage.FieldTypePicklist:      "Picklist",
+	storage.FieldTypeReference:     "Lookup",
+	storage.FieldTypeRichTextArea:  "Html",
+	storage.FieldTypeString:        "Text",
+	storage.FieldTypeTextArea:      "TextArea",
+	storage.FieldTypeTime:          "Time",
+	storage.FieldTypeURL:           "Url",
+}
+
+// systemFields are fields every object has, which metadata files omit
+var systemFields = map[string]bool{
+	"Id":               true,
+	"IsDeleted":        true,
+	"CreatedDate":      true,
+	"CreatedById":      true,
+	"LastModifiedDate": true,
+	"LastModifiedById": true,
+	"SystemModstamp":   true,
+}
+
+// customObjectFor converts a schema to its CustomObject metadata. Custom
+// objects describe their Name field as the nameField.
+func customObjectFor(schema storage.SObjectDefinition) CustomObject {
+	object := CustomObject{
+		FullName:    schema.Name,
+		Label:       schema.Label,
+		PluralLabel: schema.LabelPlural,
+	}
+	if schema.Custom {
+		object.DeploymentStatus = "Deployed"
+		object.SharingModel = "ReadWrite"
+	}
+
+	for _, field := range schema.Fields {
+		if systemFields[field.Name] {
+			continue
+		}
+		if schema.Custom && (field.Name == "Name" || field.Name == "OwnerId") {
+			if field.Name == "Name" {
+				object.NameField = &CustomField{Label: field.Label, Type: "Text"}
+				if field.AutoNumber {
+					object.NameField.Type = "AutoNumber"
+					object.NameField.DisplayFormat = field.DisplayFormat
+				}
+			}
+			continue
+		}
+		object.Fields = append(object.Fields, customFieldFor(field))
+	}
+	return object
+}
+
+// customFieldFor converts a field definition to its CustomField metadata
+func customFieldFor(field storage.FieldDefinition) CustomField {
+	custom := CustomField{
+		FullName:   field.Name,
+		Label:      field.Label,
+		Type:       metadataTypes[field.Type],
+		Length:     field.Length,
+		Precision:  field.Precision,
+		Scale:      field.Scale,
+		Required:   !field.Nillable && field.Createable && field.Type != storage.FieldTypeBoolean,
+		Unique:     field.Unique,
+		ExternalID: field.ExternalId,
+		Formula:    field.CalculatedFormula,
+	}
+	if field.DefaultValue != nil {
+		custom.DefaultValue = fmt.Sprint(field.DefaultValue)
+	}
+	if field.AutoNumber {
+		custom.Type = "AutoNumber"
+		custom.Length = 0
+		custom.Required = false
+		custom.DisplayFormat = field.DisplayFormat
+	}
+	if len(field.ReferenceTo) > 0 {
+		custom.ReferenceTo = field.ReferenceTo[0]
+		custom.RelationshipName = strings.TrimSuffix(field.ChildRelationshipName, "__r")
+		if field.CascadeDelete {
+			custom.DeleteConstraint = "Cascade"
+		} else if field.RestrictedDelete {
+			custom.DeleteConstraint = "Restrict"
+		}
+	}
+	if len(field.PicklistValues) > 0 {
+		values := make([]CustomValue, len(field.PicklistValues))
+		for i, pv := range field.PicklistValues {
+			values[i] = CustomValue{FullName: pv.Value, Default: pv.DefaultValue, Label: pv.Label}
+		}
+		custom.ValueSet = &ValueSet{
+			Restricted:         field.RestrictedPicklist,
+			ValueSetDefinition: &ValueSetDefinition{Values: values},
+		}
+	}
+	return custom
+}
@@ -50,6 +50,24 @@ type DeploymentStatus struct {
 	StartDate        time.Time
 	CompletedDate    time.Time
 	ErrorMessage     string
+	ComponentSuccesses []DeployMessage
+	ComponentFailures  []DeployMessage
+
+	// components are the parsed components applied once the deploy runs
+	components []deployComponent
+}
+
+// DeployMessage reports the outcome of deploying one component
+type DeployMessage struct {
+	Changed       bool   `xml:"changed"`
+	ComponentType string `xml:"componentType"`
+	Created       bool   `xml:"created"`
+	Deleted       bool   `xml:"deleted"`
+	FileName      string `xml:"fileName"`
+	FullName      string `xml:"fullName"`
+	Problem       string `xml:"problem,omitempty"`
+	ProblemType   string `xml:"problemType,omitempty"`
+	Success       bool   `xml:"success"`
 }
 
 // RetrievalStatus tracks a retrieval
@@ -88,6 +106,12 @@ type SOAPBody struct {
 	CancelDeploy        *CancelDeployRequest        `xml:"cancelDeploy"`
 	Retrieve            *RetrieveRequest            `xml:"retrieve"`
 	CheckRetrieveStatus *CheckRetrieveStatusRequest `xml:"checkRetrieveStatus"`
+	CreateMetadata      *CreateMetadataRequest      `xml:"createMetadata"`
+	UpdateMetadata      *UpdateMetadataRequest      `xml:"updateMetadata"`
+	DeleteMetadata      *DeleteMetadataRequest      `xml:"deleteMetadata"`
+	ReadMetadata        *ReadMetadataRequest        `xml:"readMetadata"`
+	ListMetadata        *ListMetadataRequest        `xml:"listMetadata"`
+	DescribeMetadata    *DescribeMetadataRequest    `xml:"describeMetadata"`
 }
 
 // DeployRequest represents a deploy request
@@ -190,6 +214,18 @@ func (h *Handler) HandleSOAP(w http.ResponseWriter, r *http.Request) {
 		h.handleRetrieve(w, envelope.Body.Retrieve)
 	case envelope.Body.CheckRetrieveStatus != nil:
 		h.handleCheckRetrieveStatus(w, envelope.Body.CheckRetrieveStatus)
+	case envelope.Body.CreateMetadata != nil:
+		h.handleCreateMetadata(w, envelope.Body.CreateMetadata)
+	case envelope.Body.UpdateMetadata != nil:
+		h.handleUpdateMetadata(w, envelope.Body.UpdateMetadata)
+	case envelope.Body.DeleteMetadata != nil:
+		h.handleDeleteMetadata(w, envelope.Body.DeleteMetadata)
+	case envelope.Body.ReadMetadata != nil:
+		h.handleReadMetadata(w, envelope.Body.ReadMetadata)
+	case envelope.Body.ListMetadata != nil:
+		h.handleListMetadata(w, envelope.Body.ListMetadata)
+	case envelope.Body.DescribeMetadata != nil:
+		h.handleDescribeMetadata(w, envelope.Body.DescribeMetadata)
 	default:
 		h.respondSOAPFault(w, "soapenv:Client", "Unsupported operation")
 	}
@@ -204,12 +240,19 @@ func (h *Handler) handleDeploy(w http.ResponseWriter, req *DeployRequest) {
 	}
 
 	// Decode base64 to verify it's valid
-	_, err := base64.StdEncoding.DecodeString(req.ZipFile)
+	data, err := base64.StdEncoding.DecodeString(req.ZipFile)
 	if err != nil {
 		h.respondSOAPFault(w, "sf:INVALID_ZIP", "Invalid base64 encoding for ZipFile")
 		return
 	}
 
+	// Components are parsed up front; malformed ones fail the deployment
+	components, failures, err := readDeployZip(data)
+	if err != nil {
+		h.respondSOAPFault(w, "sf:INVALID_ZIP", "Invalid ZIP file: "+err.Error())
+		return
+	}
+
 	// Create deployment
 	h.mu.Lock()
 	deployID := generateID("0Af")
@@ -220,7 +263,9 @@ func (h *Handler) handleDeploy(w http.ResponseWriter, req *DeployRequest) {
 		Success:          false,
 		CheckOnly:        req.DeployOptions.CheckOnly,
 		StartDate:        time.Now(),
-		NumberComponentsTotal: 1,
+		NumberComponentsTotal: len(components) + len(failures),
+		ComponentFailures: failures,
+		components:       components,
 	}
 	h.deployments[deployID] = status
 	h.mu.Unlock()
@@ -252,18 +297,57 @@ func (h *Handler) processDeploy(deployID string) {
 	time.Sleep(100 * time.Millisecond)
 
 	h.mu.Lock()
-	status.Status = "Succeeded"
+	defer h.mu.Unlock()
+	if status.Done {
+		return
+	}
+
+	// Nothing is applied if any component failed or this is a validation
+	if len(status.ComponentFailures) == 0 {
+		for _, component := range status.components {
+			message := DeployMessage{
+				ComponentType: "CustomObject",
+				FileName:      component.FileName,
+				FullName:      component.Object.FullName,
+				Success:       true,
+			}
+			if !status.CheckOnly {
+				created, err := applyCustomObject(h.store, component.Object)
+				if err != nil {
+					message.Success = false
+					message.Problem = err.Error()
+					message.ProblemType = "Error"
+					status.ComponentFailures = append(status.ComponentFailures, message)
+					continue
+				}
+				message.Created = created
+				message.Changed = !created
+			}
+			status.ComponentSuccesses = append(status.ComponentSuccesses, message)
+		}
+	}
+
 	status.Done = true
-	status.Success = true
-	status.NumberComponentsDeployed = status.NumberComponentsTotal
 	status.CompletedDate = time.Now()
-	h.mu.Unlock()
+	status.NumberComponentErrors = len(status.ComponentFailures)
+	status.NumberComponentsDeployed = len(status.ComponentSuccesses)
+	if status.NumberComponentErrors > 0 {
+		status.Status = "Failed"
+		status.ErrorMessage = fmt.Sprintf("%d component(s) failed to deploy", status.NumberComponentErrors)
+		return
+	}
+	status.Status = "Succeeded"
+	status.Success = true
 }
 
 // handleCheckDeployStatus handles check deploy status requests
 func (h *Handler) handleCheckDeployStatus(w http.ResponseWriter, req *CheckDeployStatusRequest) {
 	h.mu.RLock()
 	status, ok := h.deployments[req.AsyncProcessId]
+	var snapshot DeploymentStatus
+	if ok {
+		snapshot = *status
+	}
 	h.mu.RUnlock()
 
 	if !ok {
@@ -271,7 +355,7 @@ func (h *Handler) handleCheckDeployStatus(w http.ResponseWriter, req *CheckDeplo
 		return
 	}
 
-	h.respondCheckDeployStatus(w, status, req.IncludeDetails)
+	h.respondCheckDeployStatus(w, &snapshot, req.IncludeDetails)
 }
 
 // handleCancelDeploy handles cancel deploy requests
@@ -310,14 +394,14 @@ func (h *Handler) handleRetrieve(w http.ResponseWriter, req *RetrieveRequest) {
 	h.mu.Unlock()
 
 	// Simulate async retrieval
-	go h.processRetrieve(retrieveID)
+	go h.processRetrieve(retrieveID, req.RetrieveRequest.Unpackaged)
 
 	// Return async result
 	h.respondRetrieveResult(w, retrieveID, false, "Pending")
 }
 
 // processRetrieve simulates retrieval processing
-func (h *Handler) processRetrieve(retrieveID string) {
+func (h *Handler) processRetrieve(retrieveID string, manifest *Package) {
 	h.mu.Lock()
 	status := h.retrievals[retrieveID]
 	h.mu.Unlock()
@@ -334,15 +418,20 @@ func (h *Handler) processRetrieve(retrieveID string) {
 
 	time.Sleep(100 * time.Millisecond)
 
-	// Create a simple ZIP file (just a package.xml)
-	zipContent := createMinimalZip()
+	// Build the ZIP from the store's current schema
+	zipContent, err := retrieveZip(h.store, manifest, strings.TrimPrefix(h.apiVersion, "v"))
 
 	h.mu.Lock()
-	status.Status = "Succeeded"
 	status.Done = true
-	status.Success = true
-	status.ZipFile = base64.StdEncoding.EncodeToString(zipContent)
 	status.CompletedDate = time.Now()
+	if err != nil {
+		status.Status = "Failed"
+		status.ErrorMessage = err.Error()
+	} else {
+		status.Status = "Succeeded"
+		status.Success = true
+		status.ZipFile = base64.StdEncoding.EncodeToString(zipContent)
+	}
 	h.mu.Unlock()
 }
 
@@ -350,6 +439,10 @@ func (h *Handler) processRetrieve(retrieveID string) {
 func (h *Handler) handleCheckRetrieveStatus(w http.ResponseWriter, req *CheckRetrieveStatusRequest) {
 	h.mu.RLock()
 	status, ok := h.retrievals[req.AsyncProcessId]
+	var snapshot RetrievalStatus
+	if ok {
+		snapshot = *status
+	}
 	h.mu.RUnlock()
 
 	if !ok {
@@ -357,7 +450,7 @@ func (h *Handler) handleCheckRetrieveStatus(w http.ResponseWriter, req *CheckRet
 		return
 	}
 
-	h.respondCheckRetrieveStatus(w, status, req.IncludeZip)
+	h.respondCheckRetrieveStatus(w, &snapshot, req.IncludeZip)
 }
 
 func (h *Handler) respondSOAPFault(w http.ResponseWriter, faultCode, faultString string) {
@@ -401,12 +494,23 @@ func (h *Handler) respondCheckDeployStatus(w http.ResponseWriter, status *Deploy
 		successStr = "true"
 	}
 
+	details := ""
+	if includeDetails {
+		details = deployDetails(status)
+	}
+	errorMessage := ""
+	if status.ErrorMessage != "" {
+		errorMessage = "<errorMessage>" + xmlEscape(status.ErrorMessage) + "</errorMessage>"
+	}
+
 	response := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:sf="http://soap.sforce.com/2006/04/metadata">
   <soapenv:Body>
     <checkDeployStatusResponse>
       <result>
         <checkOnly>%t</checkOnly>
+        %s
+        %s
         <done>%t</done>
         <id>%s</id>
         <numberComponentErrors>%d</numberComponentErrors>
@@ -420,7 +524,7 @@ func (h *Handler) respondCheckDeployStatus(w http.ResponseWriter, status *Deploy
       </result>
     </checkDeployStatusResponse>
   </soapenv:Body>
-</soapenv:Envelope>`, status.CheckOnly, status.Done, status.ID, status.NumberComponentErrors,
+</soapenv:Envelope>`, status.CheckOnly, details, errorMessage, status.Done, status.ID, status.NumberComponentErrors,
 		status.NumberComponentsDeployed, status.NumberComponentsTotal,
 		status.NumberTestsCompleted, status.NumberTestsTotal, status.Status, successStr)
 
@@ -476,6 +580,9 @@ func (h *Handler) respondCheckRetrieveStatus(w http.ResponseWriter, status *Retr
 	if includeZip && status.ZipFile != "" {
 		zipElement = fmt.Sprintf("<zipFile>%s</zipFile>", status.ZipFile)
 	}
+	if status.ErrorMessage != "" {
+		zipElement = "<errorMessage>" + xmlEscape(status.ErrorMessage) + "</errorMessage>"
+	}
 
 	response := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
 <soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:sf="http://soap.sforce.com/2006/04/metadata">
@@ -502,17 +609,6 @@ func generateID(prefix string) string {
 	return fmt.Sprintf("%s%015d", prefix, time.Now().UnixNano()%1000000000000000)
 }
 
-// createMinimalZip creates a minimal ZIP file with just package.xml
-func createMinimalZip() []byte {
-	// This is a minimal valid ZIP file containing package.xml
-	// In a real implementation, this would be a properly constructed ZIP
-	packageXML := `<?xml version="1.0" encoding="UTF-8"?>
-<Package xmlns="http://soap.sforce.com/2006/04/metadata">
-    <version>58.0</version>
-</Package>`
-	return []byte(packageXML)
-}
-
 // RegisterRoutes registers the metadata API routes
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	path := fmt.Sprintf("/services/Soap/m/%s", strings.TrimPrefix(h.apiVersion, "v"))
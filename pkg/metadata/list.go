@@ -0,0 +1,144 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListMetadataRequest represents a listMetadata request
+type ListMetadataRequest struct {
+	Queries     []ListMetadataQuery `xml:"queries"`
+	AsOfVersion string              `xml:"asOfVersion"`
+}
+
+// ListMetadataQuery names a metadata type to list
+type ListMetadataQuery struct {
+	Type   string `xml:"type"`
+	Folder string `xml:"folder"`
+}
+
+// DescribeMetadataRequest represents a describeMetadata request
+type DescribeMetadataRequest struct {
+	AsOfVersion string `xml:"asOfVersion"`
+}
+
+// FileProperties describes a component listed by listMetadata
+type FileProperties struct {
+	CreatedDate      string `xml:"createdDate"`
+	FileName         string `xml:"fileName"`
+	FullName         string `xml:"fullName"`
+	ID               string `xml:"id"`
+	LastModifiedDate string `xml:"lastModifiedDate"`
+	ManageableState  string `xml:"manageableState,omitempty"`
+	Type             string `xml:"type"`
+}
+
+// DescribeMetadataObject describes a metadata type the handler supports
+type DescribeMetadataObject struct {
+	ChildXMLNames []string `xml:"childXmlNames"`
+	DirectoryName string   `xml:"directoryName"`
+	InFolder      bool     `xml:"inFolder"`
+	MetaFile      bool     `xml:"metaFile"`
+	Suffix        string   `xml:"suffix"`
+	Name          string   `xml:"xmlName"`
+}
+
+// supportedTypes are the metadata types deploy, retrieve and the CRUD calls
+// handle
+var supportedTypes = []DescribeMetadataObject{
+	{ChildXMLNames: []string{"CustomField"}, DirectoryName: "objects", Suffix: "object", Name: "CustomObject"},
+}
+
+// handleListMetadata handles listMetadata requests, listing the objects and
+// custom fields the store has
+func (h *Handler) handleListMetadata(w http.ResponseWriter, req *ListMetadataRequest) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	var properties []FileProperties
+	for _, query := range req.Queries {
+		switch query.Type {
+		case "CustomObject":
+			for _, name := range h.objectNames() {
+				description, err := h.store.DescribeSObject(name)
+				if err != nil {
+					continue
+				}
+				file := FileProperties{
+					CreatedDate:      now,
+					FileName:         "objects/" + name + ".object",
+					FullName:         name,
+					LastModifiedDate: now,
+					Type:             "CustomObject",
+				}
+				if description.Custom {
+					file.ID = componentID("01I", description.KeyPrefix)
+					file.ManageableState = "unmanaged"
+				}
+				properties = append(properties, file)
+			}
+		case "CustomField":
+			for _, name := range h.objectNames() {
+				description, err := h.store.DescribeSObject(name)
+				if err != nil {
+					continue
+				}
+				for _, field := range description.Fields {
+					if !strings.HasSuffix(field.Name, "__c") {
+						continue
+					}
+					properties = append(properties, FileProperties{
+						CreatedDate:      now,
+						FileName:         "objects/" + name + ".object",
+						FullName:         name + "." + field.Name,
+						ID:               componentID("00N", description.KeyPrefix+field.Name),
+						LastModifiedDate: now,
+						ManageableState:  "unmanaged",
+						Type:             "CustomField",
+					})
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for _, file := range properties {
+		_ = enc.EncodeElement(file, xml.StartElement{Name: xml.Name{Local: "result"}})
+	}
+	_ = enc.Flush()
+	h.respondMetadataXML(w, "listMetadataResponse", buf.String())
+}
+
+// handleDescribeMetadata handles describeMetadata requests
+func (h *Handler) handleDescribeMetadata(w http.ResponseWriter, req *DescribeMetadataRequest) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+	for _, object := range supportedTypes {
+		_ = enc.EncodeElement(object, xml.StartElement{Name: xml.Name{Local: "metadataObjects"}})
+	}
+	_ = enc.Flush()
+	h.respondMetadataXML(w, "describeMetadataResponse", "<result>"+buf.String()+
+		"<organizationNamespace></organizationNamespace><partialSaveAllowed>true</partialSaveAllowed>"+
+		"<testRequired>false</testRequired></result>")
+}
+
+// objectNames returns the sorted names of the store's objects
+func (h *Handler) objectNames() []string {
+	names := h.store.GetSObjectList()
+	sort.Strings(names)
+	return names
+}
+
+// componentID derives a stable 18-character component ID from key
+func componentID(prefix, key string) string {
+	var sum uint64
+	for _, c := range key {
+		sum = sum*31 + uint64(c)
+	}
+	unique := strings.Repeat("0", 12) + strings.ToUpper(strconv.FormatUint(sum, 36))
+	return prefix + unique[len(unique)-12:] + "AAA"
+}
@@ -0,0 +1,110 @@
+package metadata
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"sort"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// metadataNamespace is the XML namespace of Metadata API files
+const metadataNamespace = "http://soap.sforce.com/2006/04/metadata"
+
+// retrieveZip builds the ZIP of a retrieve: the manifest as package.xml and
+// an objects/{Name}.object file for each CustomObject member the store has.
+// The * member retrieves every custom object.
+func retrieveZip(store storage.Store, manifest *Package, version string) ([]byte, error) {
+	if manifest == nil {
+		manifest = &Package{}
+	}
+	if manifest.Version == "" {
+		manifest.Version = version
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	if err := writeXMLFile(archive, "package.xml", struct {
+		XMLName xml.Name `xml:"Package"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Package
+	}{Xmlns: metadataNamespace, Package: *manifest}); err != nil {
+		return nil, err
+	}
+
+	for _, name := range retrieveObjectNames(store, manifest) {
+		description, err := store.DescribeSObject(name)
+		if err != nil {
+			continue
+		}
+		object := customObjectFor(description.SObjectDefinition)
+		object.Xmlns = metadataNamespace
+		object.FullName = ""
+		if err := writeXMLFile(archive, "objects/"+name+".object", object); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// retrieveObjectNames lists the objects a manifest's CustomObject members
+// name, skipping those the store does not have
+func retrieveObjectNames(store storage.Store, manifest *Package) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, types := range manifest.Types {
+		if types.Name != "CustomObject" {
+			continue
+		}
+		for _, member := range types.Members {
+			candidates := []string{member}
+			if member == "*" {
+				candidates = customObjectNames(store)
+			}
+			for _, name := range candidates {
+				if !seen[name] && store.HasSObject(name) {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// customObjectNames returns the sorted names of the store's custom objects
+func customObjectNames(store storage.Store) []string {
+	global, err := store.DescribeGlobal()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, sobject := range global.SObjects {
+		if sobject.Custom {
+			names = append(names, sobject.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeXMLFile(archive *zip.Writer, name string, v interface{}) error {
+	data, err := xml.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
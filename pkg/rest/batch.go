@@ -0,0 +1,74 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// BatchRequest is the body of a composite batch request
+type BatchRequest struct {
+	BatchRequests []BatchSubrequest `json:"batchRequests"`
+	HaltOnError   bool              `json:"haltOnError"`
+}
+
+// BatchSubrequest is one independent request of a batch
+type BatchSubrequest struct {
+	Method    string                 `json:"method"`
+	URL       string                 `json:"url"`
+	RichInput map[string]interface{} `json:"richInput,omitempty"`
+}
+
+// BatchResponse is the response of a composite batch request
+type BatchResponse struct {
+	HasErrors bool          `json:"hasErrors"`
+	Results   []BatchResult `json:"results"`
+}
+
+// BatchResult is the outcome of one batch subrequest
+type BatchResult struct {
+	StatusCode int         `json:"statusCode"`
+	Result     interface{} `json:"result"`
+}
+
+// handleCompositeBatch handles POST /services/data/vXX.X/composite/batch.
+// Subrequests run independently, without reference chaining; with
+// haltOnError the ones after the first failure are skipped.
+func (r *Router) handleCompositeBatch(w http.ResponseWriter, req *http.Request, params []string) {
+	var request BatchRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	if len(request.BatchRequests) > r.compositeLimit {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewSubrequestLimitError(r.compositeLimit),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	response := BatchResponse{Results: make([]BatchResult, len(request.BatchRequests))}
+	for i, subreq := range request.BatchRequests {
+		if response.HasErrors && request.HaltOnError {
+			response.Results[i] = BatchResult{
+				StatusCode: http.StatusPreconditionFailed,
+				Result: []sferrors.SalesforceError{
+					{Message: "Batch processing halted per request", ErrorCode: sferrors.ErrorCodeBatchProcessingHalted},
+				},
+			}
+			continue
+		}
+
+		subresponse := r.executeSubrequest(req, subreq.Method, subreq.URL, subreq.RichInput, nil)
+		if subresponse.HTTPStatusCode >= 400 {
+			response.HasErrors = true
+		}
+		response.Results[i] = BatchResult{StatusCode: subresponse.HTTPStatusCode, Result: subresponse.Body}
+	}
+
+	r.respondJSON(w, response, http.StatusOK)
+}
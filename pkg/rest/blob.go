@@ -0,0 +1,113 @@
+package rest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// handleRecordSubresource handles /services/data/vXX.X/sobjects/{objectType}/{a}/{b}:
+// GET downloads the body in field b of record a, and PATCH upserts on
+// external ID field a
+func (r *Router) handleRecordSubresource(w http.ResponseWriter, req *http.Request, params []string) {
+	if req.Method == http.MethodPatch {
+		r.handleUpsert(w, req, params)
+		return
+	}
+	r.handleBlob(w, req, params[0], params[1], params[2])
+}
+
+// handleBlob handles GET /services/data/vXX.X/sobjects/{objectType}/{recordID}/{field}
+// for base64 fields such as ContentVersion.VersionData and Attachment.Body,
+// streaming the raw bytes
+func (r *Router) handleBlob(w http.ResponseWriter, req *http.Request, objectType, recordID, field string) {
+	if !r.store.HasSObject(objectType) {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewInvalidTypeError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+
+	data, err := r.store.GetBlob(objectType, recordID, field)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewNotFoundError(objectType, recordID),
+		}, http.StatusNotFound)
+		return
+	}
+	record, _ := r.store.GetRecord(objectType, recordID)
+
+	w.Header().Set("Content-Type", blobContentType(record))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+// blobContentType is the Content-Type of a record's body: its ContentType
+// field if set, else the type of its file name's extension
+func blobContentType(record storage.Record) string {
+	if contentType := stringField(record, "ContentType"); contentType != "" {
+		return contentType
+	}
+	for _, name := range []string{"PathOnClient", "Name"} {
+		if contentType := mime.TypeByExtension(path.Ext(stringField(record, name))); contentType != "" {
+			return contentType
+		}
+	}
+	return "application/octet-stream"
+}
+
+// decodeRecordBody decodes the record of a create request. Besides JSON,
+// it accepts multipart/form-data whose entity_* part (entity_content,
+// entity_attachment, ...) holds the JSON fields and whose other parts are
+// binary values of the base64 fields they are named after.
+func decodeRecordBody(req *http.Request) (storage.Record, error) {
+	var record storage.Record
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		err := json.NewDecoder(req.Body).Decode(&record)
+		return record, err
+	}
+
+	reader, err := req.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	blobs := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		if name := part.FormName(); strings.HasPrefix(name, "entity_") {
+			if err := json.Unmarshal(data, &record); err != nil {
+				return nil, err
+			}
+		} else {
+			blobs[name] = base64.StdEncoding.EncodeToString(data)
+		}
+	}
+	if record == nil {
+		return nil, errors.New("multipart request has no entity_content part")
+	}
+
+	for name, value := range blobs {
+		record[name] = value
+	}
+	return record, nil
+}
@@ -1,14 +1,29 @@
 package rest
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 
 	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
 )
 
+// DefaultCompositeLimit is Salesforce's limit on subrequests per composite request
+const DefaultCompositeLimit = 25
+
+// SetCompositeLimit sets the most subrequests a composite request may hold
+// (0 or less restores DefaultCompositeLimit)
+func (r *Router) SetCompositeLimit(limit int) {
+	if limit <= 0 {
+		limit = DefaultCompositeLimit
+	}
+	r.compositeLimit = limit
+}
+
 // CompositeRequest represents a composite API request
 type CompositeRequest struct {
 	AllOrNone        bool               `json:"allOrNone"`
@@ -21,6 +36,7 @@ type CompositeSubrequest struct {
 	URL         string                 `json:"url"`
 	ReferenceID string                 `json:"referenceId"`
 	Body        map[string]interface{} `json:"body,omitempty"`
+	HTTPHeaders map[string]string      `json:"httpHeaders,omitempty"`
 }
 
 // CompositeResponse represents the response from a composite request
@@ -54,7 +70,49 @@ func (r *Router) handleCompositeSObjects(w http.ResponseWriter, req *http.Reques
 	}
 }
 
-// handleCompositeCreate handles batch create operations
+// writeUndo restores a record written as part of an all-or-nothing request
+type writeUndo struct {
+	objectType string
+	recordID   string
+	previous   storage.Record
+}
+
+// undoWrites rolls back writes, newest first
+func (r *Router) undoWrites(undo []writeUndo) {
+	for i := len(undo) - 1; i >= 0; i-- {
+		_ = r.store.RestoreRecord(undo[i].objectType, undo[i].recordID, undo[i].previous)
+	}
+}
+
+// rollBackCollection undoes a failed all-or-none collection request. Rows
+// that succeeded are reported as halted instead.
+func (r *Router) rollBackCollection(results []SObjectResponse, undo []writeUndo, created bool) {
+	r.undoWrites(undo)
+	for i := range results {
+		if !results[i].Success {
+			continue
+		}
+		if created {
+			results[i].ID = ""
+		}
+		results[i].Success = false
+		results[i].Errors = []interface{}{sferrors.SalesforceError{
+			Message:   "The transaction was rolled back since another operation in the same transaction failed.",
+			ErrorCode: sferrors.ErrorCodeProcessingHalted,
+		}}
+	}
+}
+
+// collectionError reports a failed row of a collection request
+func collectionError(message, errorCode string) SObjectResponse {
+	return SObjectResponse{
+		Success: false,
+		Errors:  []interface{}{sferrors.SalesforceError{Message: message, ErrorCode: errorCode}},
+	}
+}
+
+// handleCompositeCreate handles batch create operations. With allOrNone,
+// records created before a failure are removed again.
 func (r *Router) handleCompositeCreate(w http.ResponseWriter, req *http.Request) {
 	var request CompositeSObjectsRequest
 	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
@@ -64,27 +122,17 @@ func (r *Router) handleCompositeCreate(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	userID := r.sessionUserID(req)
 	var results []SObjectResponse
+	var undo []writeUndo
 	var hasError bool
 
 	for _, record := range request.Records {
 		// Get object type from attributes
-		attrs, ok := record["attributes"].(map[string]interface{})
-		if !ok {
-			results = append(results, SObjectResponse{
-				Success: false,
-				Errors:  []interface{}{"Missing attributes.type"},
-			})
-			hasError = true
-			continue
-		}
-
+		attrs, _ := record["attributes"].(map[string]interface{})
 		objectType, ok := attrs["type"].(string)
 		if !ok {
-			results = append(results, SObjectResponse{
-				Success: false,
-				Errors:  []interface{}{"Missing attributes.type"},
-			})
+			results = append(results, collectionError("Missing attributes.type", sferrors.ErrorCodeMissingArgument))
 			hasError = true
 			continue
 		}
@@ -92,11 +140,11 @@ func (r *Router) handleCompositeCreate(w http.ResponseWriter, req *http.Request)
 		// Remove attributes from record before creating
 		delete(record, "attributes")
 
-		id, err := r.store.CreateRecord(objectType, record)
+		id, err := r.store.CreateRecordAs(userID, objectType, record)
 		if err != nil {
 			results = append(results, SObjectResponse{
 				Success: false,
-				Errors:  []interface{}{err.Error()},
+				Errors:  []interface{}{storeError(err)},
 			})
 			hasError = true
 		} else {
@@ -105,13 +153,12 @@ func (r *Router) handleCompositeCreate(w http.ResponseWriter, req *http.Request)
 				Success: true,
 				Errors:  []interface{}{},
 			})
+			undo = append(undo, writeUndo{objectType: objectType, recordID: id})
 		}
 	}
 
-	// If allOrNone is true and there was an error, rollback would happen here
-	// For simplicity, we're not implementing true transactions in the emulator
-
 	if hasError && request.AllOrNone {
+		r.rollBackCollection(results, undo, true)
 		r.respondJSON(w, results, http.StatusBadRequest)
 		return
 	}
@@ -119,7 +166,8 @@ func (r *Router) handleCompositeCreate(w http.ResponseWriter, req *http.Request)
 	r.respondJSON(w, results, http.StatusCreated)
 }
 
-// handleCompositeUpdate handles batch update operations
+// handleCompositeUpdate handles batch update operations. With allOrNone,
+// records updated before a failure get their previous values back.
 func (r *Router) handleCompositeUpdate(w http.ResponseWriter, req *http.Request) {
 	var request CompositeSObjectsRequest
 	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
@@ -129,27 +177,17 @@ func (r *Router) handleCompositeUpdate(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	userID := r.sessionUserID(req)
 	var results []SObjectResponse
+	var undo []writeUndo
 	var hasError bool
 
 	for _, record := range request.Records {
 		// Get object type from attributes
-		attrs, ok := record["attributes"].(map[string]interface{})
-		if !ok {
-			results = append(results, SObjectResponse{
-				Success: false,
-				Errors:  []interface{}{"Missing attributes.type"},
-			})
-			hasError = true
-			continue
-		}
-
+		attrs, _ := record["attributes"].(map[string]interface{})
 		objectType, ok := attrs["type"].(string)
 		if !ok {
-			results = append(results, SObjectResponse{
-				Success: false,
-				Errors:  []interface{}{"Missing attributes.type"},
-			})
+			results = append(results, collectionError("Missing attributes.type", sferrors.ErrorCodeMissingArgument))
 			hasError = true
 			continue
 		}
@@ -157,10 +195,7 @@ func (r *Router) handleCompositeUpdate(w http.ResponseWriter, req *http.Request)
 		// Get record ID
 		id, ok := record["Id"].(string)
 		if !ok {
-			results = append(results, SObjectResponse{
-				Success: false,
-				Errors:  []interface{}{"Missing Id field"},
-			})
+			results = append(results, collectionError("Missing Id field", sferrors.ErrorCodeMissingArgument))
 			hasError = true
 			continue
 		}
@@ -169,12 +204,13 @@ func (r *Router) handleCompositeUpdate(w http.ResponseWriter, req *http.Request)
 		delete(record, "attributes")
 		delete(record, "Id")
 
-		err := r.store.UpdateRecord(objectType, id, record)
+		previous, _ := r.store.GetRecord(objectType, id)
+		err := r.store.UpdateRecordAs(userID, objectType, id, record)
 		if err != nil {
 			results = append(results, SObjectResponse{
 				ID:      id,
 				Success: false,
-				Errors:  []interface{}{err.Error()},
+				Errors:  []interface{}{storeError(err)},
 			})
 			hasError = true
 		} else {
@@ -183,10 +219,12 @@ func (r *Router) handleCompositeUpdate(w http.ResponseWriter, req *http.Request)
 				Success: true,
 				Errors:  []interface{}{},
 			})
+			undo = append(undo, writeUndo{objectType: objectType, recordID: id, previous: previous})
 		}
 	}
 
 	if hasError && request.AllOrNone {
+		r.rollBackCollection(results, undo, false)
 		r.respondJSON(w, results, http.StatusBadRequest)
 		return
 	}
@@ -195,7 +233,8 @@ func (r *Router) handleCompositeUpdate(w http.ResponseWriter, req *http.Request)
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleCompositeDelete handles batch delete operations
+// handleCompositeDelete handles batch delete operations. With allOrNone,
+// records deleted before a failure are taken back out of the recycle bin.
 func (r *Router) handleCompositeDelete(w http.ResponseWriter, req *http.Request) {
 	// Get IDs from query parameter
 	ids := req.URL.Query().Get("ids")
@@ -208,8 +247,10 @@ func (r *Router) handleCompositeDelete(w http.ResponseWriter, req *http.Request)
 
 	allOrNone := req.URL.Query().Get("allOrNone") == "true"
 
+	userID := r.sessionUserID(req)
 	idList := strings.Split(ids, ",")
 	var results []SObjectResponse
+	var undo []writeUndo
 	var hasError bool
 
 	for _, id := range idList {
@@ -217,23 +258,22 @@ func (r *Router) handleCompositeDelete(w http.ResponseWriter, req *http.Request)
 
 		// Try to find and delete the record
 		// We need to determine the object type from the ID prefix
-		objectType := determineObjectType(id)
+		objectType := r.store.ObjectTypeForID(id)
 		if objectType == "" {
-			results = append(results, SObjectResponse{
-				ID:      id,
-				Success: false,
-				Errors:  []interface{}{"Unable to determine object type from ID"},
-			})
+			result := collectionError("Unable to determine object type from ID", sferrors.ErrorCodeInvalidCrossReferenceKey)
+			result.ID = id
+			results = append(results, result)
 			hasError = true
 			continue
 		}
 
-		err := r.store.DeleteRecord(objectType, id)
+		previous, _ := r.store.GetRecord(objectType, id)
+		err := r.store.DeleteRecordAs(userID, objectType, id)
 		if err != nil {
 			results = append(results, SObjectResponse{
 				ID:      id,
 				Success: false,
-				Errors:  []interface{}{err.Error()},
+				Errors:  []interface{}{storeError(err)},
 			})
 			hasError = true
 		} else {
@@ -242,10 +282,12 @@ func (r *Router) handleCompositeDelete(w http.ResponseWriter, req *http.Request)
 				Success: true,
 				Errors:  []interface{}{},
 			})
+			undo = append(undo, writeUndo{objectType: objectType, recordID: id, previous: previous})
 		}
 	}
 
 	if hasError && allOrNone {
+		r.rollBackCollection(results, undo, false)
 		r.respondJSON(w, results, http.StatusBadRequest)
 		return
 	}
@@ -263,6 +305,13 @@ func (r *Router) handleComposite(w http.ResponseWriter, req *http.Request, param
 		return
 	}
 
+	if len(request.CompositeRequest) > r.compositeLimit {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewSubrequestLimitError(r.compositeLimit),
+		}, http.StatusBadRequest)
+		return
+	}
+
 	response := CompositeResponse{
 		CompositeResponse: make([]CompositeSubresponse, len(request.CompositeRequest)),
 	}
@@ -275,7 +324,7 @@ func (r *Router) handleComposite(w http.ResponseWriter, req *http.Request, param
 		url := substituteReferences(subreq.URL, refResults)
 		body := substituteBodyReferences(subreq.Body, refResults)
 
-		subresponse := r.executeSubrequest(subreq.Method, url, body)
+		subresponse := r.executeSubrequest(req, subreq.Method, url, body, subreq.HTTPHeaders)
 		subresponse.ReferenceID = subreq.ReferenceID
 
 		response.CompositeResponse[i] = subresponse
@@ -287,101 +336,89 @@ func (r *Router) handleComposite(w http.ResponseWriter, req *http.Request, param
 	r.respondJSON(w, response, http.StatusOK)
 }
 
-// executeSubrequest executes a single composite subrequest
-func (r *Router) executeSubrequest(method, url string, body map[string]interface{}) CompositeSubresponse {
-	// This is a simplified implementation
-	// In a real implementation, we would route this through the normal HTTP handler
+// subrequestSkippedHeaders are the parent request headers that describe the
+// parent's own connection or body, so they are not passed on to subrequests.
+var subrequestSkippedHeaders = map[string]bool{
+	"Connection":          true,
+	"Content-Encoding":    true,
+	"Content-Length":      true,
+	"Expect":              true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
 
-	response := CompositeSubresponse{
-		HTTPHeaders: map[string]string{
-			"Content-Type": "application/json",
-		},
+// executeSubrequest replays a composite subrequest through the router, so
+// subrequests behave exactly like the top-level endpoints. The parent's
+// headers are passed on, and the subrequest's own headers override them.
+// URLs relative to /services/data, as batch requests use them, are accepted
+// too.
+func (r *Router) executeSubrequest(parent *http.Request, method, url string, body map[string]interface{}, headers map[string]string) CompositeSubresponse {
+	if !strings.HasPrefix(url, "/") {
+		url = "/services/data/" + url
 	}
 
-	// Parse the URL to determine the operation
-	// Example: /services/data/v58.0/sobjects/Account/001...
-	if strings.Contains(url, "/sobjects/") {
-		parts := strings.Split(url, "/sobjects/")
-		if len(parts) == 2 {
-			pathParts := strings.Split(strings.TrimPrefix(parts[1], "/"), "/")
-			objectType := pathParts[0]
-
-			switch method {
-			case "POST":
-				id, err := r.store.CreateRecord(objectType, body)
-				if err != nil {
-					response.HTTPStatusCode = 400
-					response.Body = []sferrors.SalesforceError{{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField}}
-				} else {
-					response.HTTPStatusCode = 201
-					response.Body = SObjectResponse{ID: id, Success: true, Errors: []interface{}{}}
-				}
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return subrequestError(http.StatusBadRequest, sferrors.NewJSONParserError(err.Error()))
+		}
+		reader = bytes.NewReader(data)
+	}
 
-			case "GET":
-				if len(pathParts) > 1 {
-					recordID := pathParts[1]
-					record, err := r.store.GetRecord(objectType, recordID)
-					if err != nil {
-						response.HTTPStatusCode = 404
-						response.Body = []sferrors.SalesforceError{sferrors.NewNotFoundError(objectType, recordID)}
-					} else {
-						response.HTTPStatusCode = 200
-						response.Body = record
-					}
-				}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return subrequestError(http.StatusBadRequest, sferrors.SalesforceError{
+			Message:   "Invalid subrequest URL: " + url,
+			ErrorCode: sferrors.ErrorCodeInvalidField,
+		})
+	}
+	for name, values := range parent.Header {
+		if !subrequestSkippedHeaders[http.CanonicalHeaderKey(name)] {
+			req.Header[name] = append([]string(nil), values...)
+		}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
 
-			case "PATCH":
-				if len(pathParts) > 1 {
-					recordID := pathParts[1]
-					err := r.store.UpdateRecord(objectType, recordID, body)
-					if err != nil {
-						response.HTTPStatusCode = 400
-						response.Body = []sferrors.SalesforceError{{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField}}
-					} else {
-						response.HTTPStatusCode = 204
-						response.Body = nil
-					}
-				}
+	recorder := httptest.NewRecorder()
+	r.ServeHTTP(recorder, req)
 
-			case "DELETE":
-				if len(pathParts) > 1 {
-					recordID := pathParts[1]
-					err := r.store.DeleteRecord(objectType, recordID)
-					if err != nil {
-						response.HTTPStatusCode = 404
-						response.Body = []sferrors.SalesforceError{sferrors.NewNotFoundError(objectType, recordID)}
-					} else {
-						response.HTTPStatusCode = 204
-						response.Body = nil
-					}
-				}
-			}
-		}
-	} else if strings.Contains(url, "/query") {
-		// Handle query requests
-		queryStr := ""
-		if idx := strings.Index(url, "?q="); idx != -1 {
-			queryStr = url[idx+3:]
+	response := CompositeSubresponse{
+		HTTPHeaders:    map[string]string{},
+		HTTPStatusCode: recorder.Code,
+	}
+	for _, header := range []string{"Content-Type", "Location"} {
+		if value := recorder.Header().Get(header); value != "" {
+			response.HTTPHeaders[header] = value
 		}
-		if queryStr != "" {
-			records, err := r.executeSOQL(queryStr)
-			if err != nil {
-				response.HTTPStatusCode = 400
-				response.Body = []sferrors.SalesforceError{sferrors.NewMalformedQueryError(err.Error())}
-			} else {
-				response.HTTPStatusCode = 200
-				response.Body = QueryResponse{
-					TotalSize: len(records),
-					Done:      true,
-					Records:   records,
-				}
-			}
+	}
+	if recorder.Body.Len() > 0 {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response.Body); err != nil {
+			response.Body = recorder.Body.String()
 		}
 	}
-
 	return response
 }
 
+// subrequestError is a failed subresponse for a subrequest that could not
+// be replayed
+func subrequestError(status int, err sferrors.SalesforceError) CompositeSubresponse {
+	return CompositeSubresponse{
+		Body:           []sferrors.SalesforceError{err},
+		HTTPHeaders:    map[string]string{},
+		HTTPStatusCode: status,
+	}
+}
+
 // substituteReferences replaces @{refId.field} patterns in URLs
 func substituteReferences(url string, refs map[string]interface{}) string {
 	// Find all @{...} patterns
@@ -433,24 +470,3 @@ func substituteBodyReferences(body map[string]interface{}, refs map[string]inter
 	}
 	return result
 }
-
-// determineObjectType determines the object type from a Salesforce ID prefix
-func determineObjectType(id string) string {
-	if len(id) < 3 {
-		return ""
-	}
-	prefix := id[:3]
-
-	prefixMap := map[string]string{
-		"001": "Account",
-		"003": "Contact",
-		"00Q": "Lead",
-		"006": "Opportunity",
-		"500": "Case",
-		"005": "User",
-		"00T": "Task",
-		"00U": "Event",
-	}
-
-	return prefixMap[prefix]
-}
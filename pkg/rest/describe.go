@@ -4,7 +4,7 @@ import (
 	"net/http"
 
 	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
-	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
 )
 
 // handleLimits handles GET /services/data/vXX.X/limits
@@ -52,47 +52,53 @@ func (r *Router) handleRecordCount(w http.ResponseWriter, req *http.Request, par
 	r.respondJSON(w, response, http.StatusOK)
 }
 
-// handleToolingQuery handles GET /services/data/vXX.X/tooling/query
+// handleToolingQuery handles GET /services/data/vXX.X/tooling/query,
+// running SOQL against the Tooling API objects
 func (r *Router) handleToolingQuery(w http.ResponseWriter, req *http.Request, params []string) {
-	query := req.URL.Query().Get("q")
-	if query == "" {
-		r.respondError(w, []sferrors.SalesforceError{
-			sferrors.NewMalformedQueryError("No query string provided"),
-		}, http.StatusBadRequest)
-		return
-	}
-
-	// For tooling API, we can reuse the SOQL parser but with tooling objects
-	// For now, return an empty result set as tooling objects aren't fully implemented
-	response := QueryResponse{
-		TotalSize: 0,
-		Done:      true,
-		Records:   []storage.Record{},
-	}
-
-	r.respondJSON(w, response, http.StatusOK)
+	r.serveQuery(w, req, soql.NewEngine(r.store.Tooling(), r.apiVersion).Execute)
 }
 
 // handleToolingSObject handles GET/POST /services/data/vXX.X/tooling/sobjects/{type}
 func (r *Router) handleToolingSObject(w http.ResponseWriter, req *http.Request, params []string) {
 	objectType := params[0]
+	tooling := r.store.Tooling()
+
+	if !tooling.HasSObject(objectType) {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewObjectNotFoundError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
 
 	switch req.Method {
 	case "GET":
-		// Return describe for tooling object
-		r.respondJSON(w, map[string]interface{}{
-			"name":       objectType,
-			"label":      objectType,
-			"queryable":  true,
-			"createable": true,
-			"updateable": true,
-			"deletable":  true,
-			"fields":     []interface{}{},
-		}, http.StatusOK)
+		description, err := tooling.DescribeSObject(objectType)
+		if err != nil {
+			r.respondError(w, []sferrors.SalesforceError{
+				sferrors.NewObjectNotFoundError(objectType),
+			}, http.StatusNotFound)
+			return
+		}
+		r.respondJSON(w, description, http.StatusOK)
 	case "POST":
-		// Create tooling record (simplified - just return success)
+		record, err := decodeRecordBody(req)
+		if err != nil {
+			r.respondError(w, []sferrors.SalesforceError{
+				sferrors.NewJSONParserError(err.Error()),
+			}, http.StatusBadRequest)
+			return
+		}
+
+		id, err := tooling.CreateRecordAs(r.sessionUserID(req), objectType, record)
+		if err != nil {
+			r.respondError(w, []sferrors.SalesforceError{
+				storeError(err),
+			}, http.StatusBadRequest)
+			return
+		}
+
 		r.respondJSON(w, SObjectResponse{
-			ID:      "00N000000000000AAA",
+			ID:      id,
 			Success: true,
 			Errors:  []interface{}{},
 		}, http.StatusCreated)
@@ -0,0 +1,169 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// GraphRequest is the body of a composite graph request
+type GraphRequest struct {
+	Graphs []Graph `json:"graphs"`
+}
+
+// Graph is a named set of subrequests that succeed or fail together
+type Graph struct {
+	GraphID          string                `json:"graphId"`
+	CompositeRequest []CompositeSubrequest `json:"compositeRequest"`
+}
+
+// GraphResponse is the response of a composite graph request
+type GraphResponse struct {
+	Graphs []GraphResult `json:"graphs"`
+}
+
+// GraphResult is the outcome of one graph
+type GraphResult struct {
+	GraphID       string            `json:"graphId"`
+	GraphResponse CompositeResponse `json:"graphResponse"`
+	IsSuccessful  bool              `json:"isSuccessful"`
+}
+
+// handleCompositeGraph handles POST /services/data/vXX.X/composite/graph.
+// Graphs run independently; within one, a failed subrequest rolls back the
+// writes made before it and halts the rest.
+func (r *Router) handleCompositeGraph(w http.ResponseWriter, req *http.Request, params []string) {
+	var request GraphRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	response := GraphResponse{Graphs: make([]GraphResult, len(request.Graphs))}
+	for i, graph := range request.Graphs {
+		response.Graphs[i] = r.executeGraph(req, graph)
+	}
+
+	r.respondJSON(w, response, http.StatusOK)
+}
+
+// executeGraph runs a graph's subrequests in order with reference
+// substitution, rolling all of them back if one fails
+func (r *Router) executeGraph(req *http.Request, graph Graph) GraphResult {
+	responses := make([]CompositeSubresponse, len(graph.CompositeRequest))
+	refResults := make(map[string]interface{})
+	var undo []writeUndo
+
+	failed := -1
+	for i, subreq := range graph.CompositeRequest {
+		url := substituteReferences(subreq.URL, refResults)
+		body := substituteBodyReferences(subreq.Body, refResults)
+
+		objectType, path := sobjectTarget(url)
+		var recordID string
+		var previous storage.Record
+		if subreq.Method == "PATCH" || subreq.Method == "DELETE" {
+			recordID = r.targetRecordID(objectType, path)
+		}
+		if recordID != "" {
+			previous, _ = r.store.GetRecord(objectType, recordID)
+		}
+
+		subresponse := r.executeSubrequest(req, subreq.Method, url, body, subreq.HTTPHeaders)
+		subresponse.ReferenceID = subreq.ReferenceID
+		responses[i] = subresponse
+		refResults[subreq.ReferenceID] = subresponse.Body
+
+		if subresponse.HTTPStatusCode >= 400 {
+			failed = i
+			break
+		}
+		created, _ := subresponse.Body.(map[string]interface{})
+		switch {
+		case subresponse.HTTPStatusCode == http.StatusCreated && created["id"] != nil:
+			// Creates, including upserts that inserted, are removed again
+			id, _ := created["id"].(string)
+			undo = append(undo, writeUndo{objectType: objectType, recordID: id})
+		case subreq.Method == "PATCH" || subreq.Method == "DELETE":
+			undo = append(undo, writeUndo{objectType: objectType, recordID: recordID, previous: previous})
+		}
+	}
+
+	if failed < 0 {
+		return GraphResult{
+			GraphID:       graph.GraphID,
+			GraphResponse: CompositeResponse{CompositeResponse: responses},
+			IsSuccessful:  true,
+		}
+	}
+
+	r.undoWrites(undo)
+	for i, subreq := range graph.CompositeRequest {
+		if i == failed {
+			continue
+		}
+		responses[i] = CompositeSubresponse{
+			Body: []sferrors.SalesforceError{{
+				Message:   "The transaction was rolled back since another operation in the same transaction failed.",
+				ErrorCode: sferrors.ErrorCodeProcessingHalted,
+			}},
+			HTTPHeaders:    map[string]string{},
+			HTTPStatusCode: http.StatusBadRequest,
+			ReferenceID:    subreq.ReferenceID,
+		}
+	}
+
+	return GraphResult{
+		GraphID:       graph.GraphID,
+		GraphResponse: CompositeResponse{CompositeResponse: responses},
+		IsSuccessful:  false,
+	}
+}
+
+// sobjectTarget returns the object type a subrequest URL such as
+// /services/data/v58.0/sobjects/Account/001... addresses and the path
+// segments after it
+func sobjectTarget(target string) (objectType string, path []string) {
+	parts := strings.SplitN(target, "/sobjects/", 2)
+	if len(parts) != 2 {
+		return "", nil
+	}
+	parts[1] = strings.SplitN(parts[1], "?", 2)[0]
+	segments := strings.Split(strings.Trim(parts[1], "/"), "/")
+	return segments[0], segments[1:]
+}
+
+// targetRecordID returns the ID of the record a PATCH or DELETE subrequest
+// writes. An upsert by external ID, /sobjects/Account/Field__c/value,
+// writes the record the value matches, or creates one if none does.
+func (r *Router) targetRecordID(objectType string, path []string) string {
+	switch len(path) {
+	case 1:
+		return path[0]
+	case 2:
+		description, err := r.store.DescribeSObject(objectType)
+		if err != nil {
+			return ""
+		}
+		value, err := url.PathUnescape(path[1])
+		if err != nil {
+			return ""
+		}
+		for _, field := range description.Fields {
+			if field.Name != path[0] || !isExternalIDField(description.Fields, field.Name) {
+				continue
+			}
+			records, _ := r.store.GetAllRecords(objectType)
+			if ids := storage.ExternalIDMatches(records, field, value); len(ids) == 1 {
+				return ids[0]
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,156 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// UserInfoResponse is the OpenID Connect userinfo document
+type UserInfoResponse struct {
+	Sub               string            `json:"sub"`
+	UserID            string            `json:"user_id"`
+	OrganizationID    string            `json:"organization_id"`
+	PreferredUsername string            `json:"preferred_username"`
+	Nickname          string            `json:"nickname"`
+	Name              string            `json:"name"`
+	GivenName         string            `json:"given_name"`
+	FamilyName        string            `json:"family_name"`
+	Email             string            `json:"email"`
+	EmailVerified     bool              `json:"email_verified"`
+	Active            bool              `json:"active"`
+	UserType          string            `json:"user_type"`
+	URLs              map[string]string `json:"urls"`
+}
+
+// handleUserInfo handles GET/POST /services/oauth2/userinfo. OAuth paths
+// skip the router's session check, so the token is validated here.
+func (r *Router) handleUserInfo(w http.ResponseWriter, req *http.Request, params []string) {
+	session, err := r.authHandler.ValidateRequest(req)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{err.(sferrors.SalesforceError)}, http.StatusUnauthorized)
+		return
+	}
+
+	user, _ := r.store.GetRecord("User", session.UserID)
+	r.respondJSON(w, UserInfoResponse{
+		Sub:               identityURL(session),
+		UserID:            session.UserID,
+		OrganizationID:    session.OrgID,
+		PreferredUsername: sessionUsername(session, user),
+		Nickname:          stringField(user, "Alias"),
+		Name:              stringField(user, "Name"),
+		GivenName:         stringField(user, "FirstName"),
+		FamilyName:        stringField(user, "LastName"),
+		Email:             stringField(user, "Email"),
+		EmailVerified:     true,
+		Active:            user["IsActive"] != false,
+		UserType:          "STANDARD",
+		URLs:              r.identityURLs(session),
+	}, http.StatusOK)
+}
+
+// IdentityResponse is the Identity URL response describing a user
+type IdentityResponse struct {
+	ID             string            `json:"id"`
+	AssertedUser   bool              `json:"asserted_user"`
+	UserID         string            `json:"user_id"`
+	OrganizationID string            `json:"organization_id"`
+	Username       string            `json:"username"`
+	NickName       string            `json:"nick_name"`
+	DisplayName    string            `json:"display_name"`
+	Email          string            `json:"email"`
+	EmailVerified  bool              `json:"email_verified"`
+	FirstName      string            `json:"first_name"`
+	LastName       string            `json:"last_name"`
+	Photos         map[string]string `json:"photos"`
+	URLs           map[string]string `json:"urls"`
+	Active         bool              `json:"active"`
+	UserType       string            `json:"user_type"`
+}
+
+// handleIdentity handles GET /id/{orgId}/{userId}, the identity URL of
+// token responses. Any user of the session's org can be looked up;
+// asserted_user tells whether it is the session's own.
+func (r *Router) handleIdentity(w http.ResponseWriter, req *http.Request, params []string) {
+	session, err := r.authHandler.ValidateRequest(req)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{err.(sferrors.SalesforceError)}, http.StatusUnauthorized)
+		return
+	}
+
+	orgID, userID := params[0], params[1]
+	user, err := r.store.GetRecord("User", userID)
+	if orgID != session.OrgID || err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			{Message: "The requested resource does not exist", ErrorCode: sferrors.ErrorCodeNotFound},
+		}, http.StatusNotFound)
+		return
+	}
+
+	username := stringField(user, "Username")
+	if userID == session.UserID {
+		username = sessionUsername(session, user)
+	}
+	picture := session.InstanceURL + "/profilephoto/005/F"
+	r.respondJSON(w, IdentityResponse{
+		ID:             session.InstanceURL + "/id/" + orgID + "/" + userID,
+		AssertedUser:   userID == session.UserID,
+		UserID:         userID,
+		OrganizationID: orgID,
+		Username:       username,
+		NickName:       stringField(user, "Alias"),
+		DisplayName:    stringField(user, "Name"),
+		Email:          stringField(user, "Email"),
+		EmailVerified:  true,
+		FirstName:      stringField(user, "FirstName"),
+		LastName:       stringField(user, "LastName"),
+		Photos: map[string]string{
+			"picture":   picture,
+			"thumbnail": picture + "/T",
+		},
+		URLs:     r.identityURLs(session),
+		Active:   user["IsActive"] != false,
+		UserType: "STANDARD",
+	}, http.StatusOK)
+}
+
+// identityURL is the identity URL of a session's user, as reported in
+// token responses
+func identityURL(session *auth.Session) string {
+	return session.InstanceURL + "/id/" + session.OrgID + "/" + session.UserID
+}
+
+// sessionUsername is the username a session logged in with, or the User
+// record's when the session was not issued through a login
+func sessionUsername(session *auth.Session, user storage.Record) string {
+	if session.Username != "" {
+		return session.Username
+	}
+	return stringField(user, "Username")
+}
+
+// identityURLs lists the API endpoints available to a session's user
+func (r *Router) identityURLs(session *auth.Session) map[string]string {
+	base := session.InstanceURL
+	rest := base + "/services/data/v" + r.apiVersion + "/"
+	return map[string]string{
+		"enterprise":    base + "/services/Soap/c/" + r.apiVersion + "/" + session.OrgID,
+		"metadata":      base + "/services/Soap/m/" + r.apiVersion + "/" + session.OrgID,
+		"partner":       base + "/services/Soap/u/" + r.apiVersion + "/" + session.OrgID,
+		"rest":          rest,
+		"sobjects":      rest + "sobjects/",
+		"search":        rest + "search/",
+		"query":         rest + "query/",
+		"profile":       base + "/" + session.UserID,
+		"custom_domain": base,
+	}
+}
+
+// stringField returns a string field of record, or "" if it is unset
+func stringField(record storage.Record, name string) string {
+	value, _ := record[name].(string)
+	return value
+}
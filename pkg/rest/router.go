@@ -5,18 +5,44 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
 	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/sosl"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
 )
 
 // Router handles REST API routing
 type Router struct {
 	store       storage.Store
+	soql        *soql.Engine
+	sosl        *sosl.Engine
 	authHandler *auth.Handler
 	apiVersion  string
 	routes      []route
+	errors      *sferrors.ErrorRecorder
+
+	// allowQueryPost enables the non-standard POST variant of /query
+	allowQueryPost bool
+
+	// warnings attaches warnings to successful creates and updates
+	warnings WarningFunc
+
+	// compositeLimit is the most subrequests a composite request may hold
+	compositeLimit int
+
+	// includeSystemFields keeps fields such as IsDeleted in record responses
+	// that did not ask for them
+	includeSystemFields bool
+
+	// queryStates holds the remaining records of paginated queries by
+	// locator. Locators are numbered per router, so emulators never share
+	// them.
+	queryMu     sync.Mutex
+	queryStates map[string]*queryState
+	queryIDGen  int
 }
 
 type route struct {
@@ -28,14 +54,40 @@ type route struct {
 // NewRouter creates a new REST API router
 func NewRouter(store storage.Store, authHandler *auth.Handler, apiVersion string) *Router {
 	r := &Router{
-		store:       store,
-		authHandler: authHandler,
-		apiVersion:  apiVersion,
+		store:          store,
+		soql:           soql.NewEngine(store, apiVersion),
+		sosl:           sosl.NewEngine(store, apiVersion),
+		authHandler:    authHandler,
+		apiVersion:     apiVersion,
+		compositeLimit: DefaultCompositeLimit,
+		queryStates:    make(map[string]*queryState),
 	}
 	r.setupRoutes()
 	return r
 }
 
+// SetErrorRecorder sets the recorder that retains error responses
+func (r *Router) SetErrorRecorder(recorder *sferrors.ErrorRecorder) {
+	r.errors = recorder
+}
+
+// sessionUserID returns the ID of the User whose session made req, or ""
+// for the default user
+func (r *Router) sessionUserID(req *http.Request) string {
+	session, err := r.authHandler.ValidateRequest(req)
+	if err != nil {
+		return ""
+	}
+	return session.UserID
+}
+
+// SetAllowQueryPost enables POST /query with the SOQL in a JSON body
+// ({"query": "..."}) for queries too long for a URL. Salesforce has no such
+// endpoint, so it is disabled by default.
+func (r *Router) SetAllowQueryPost(allow bool) {
+	r.allowQueryPost = allow
+}
+
 func (r *Router) setupRoutes() {
 	version := regexp.QuoteMeta(r.apiVersion)
 
@@ -56,15 +108,40 @@ func (r *Router) setupRoutes() {
 			methods: []string{"GET"},
 			handler: r.handleDescribeSObject,
 		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/sobjects/([^/]+)/describe/approvalLayouts(?:/([^/]+))?/?$`),
+			methods: []string{"GET"},
+			handler: r.handleApprovalLayouts,
+		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/sobjects/([^/]+)/updated/?$`),
+			methods: []string{"GET"},
+			handler: r.handleGetUpdated,
+		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/sobjects/([^/]+)/deleted/?$`),
+			methods: []string{"GET"},
+			handler: r.handleGetDeleted,
+		},
 		{
 			pattern: regexp.MustCompile(`^/services/data/v` + version + `/sobjects/([^/]+)/([^/]+)/?$`),
 			methods: []string{"GET", "PATCH", "DELETE"},
 			handler: r.handleSObjectRecord,
 		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/sobjects/([^/]+)/([^/]+)/undelete/?$`),
+			methods: []string{"POST"},
+			handler: r.handleUndelete,
+		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/sobjects/([^/]+)/([^/]+)/([^/]+)/?$`),
+			methods: []string{"GET", "PATCH"},
+			handler: r.handleRecordSubresource,
+		},
 		// Query
 		{
 			pattern: regexp.MustCompile(`^/services/data/v` + version + `/query/?$`),
-			methods: []string{"GET"},
+			methods: []string{"GET", "POST"},
 			handler: r.handleQuery,
 		},
 		{
@@ -72,12 +149,43 @@ func (r *Router) setupRoutes() {
 			methods: []string{"GET"},
 			handler: r.handleQueryMore,
 		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/queryAll/?$`),
+			methods: []string{"GET", "POST"},
+			handler: r.handleQueryAll,
+		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/queryAll/([^/]+)/?$`),
+			methods: []string{"GET"},
+			handler: r.handleQueryMore,
+		},
+		// Search
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/search/?$`),
+			methods: []string{"GET"},
+			handler: r.handleSearch,
+		},
 		// Composite
 		{
 			pattern: regexp.MustCompile(`^/services/data/v` + version + `/composite/sobjects/?$`),
 			methods: []string{"POST", "PATCH", "DELETE"},
 			handler: r.handleCompositeSObjects,
 		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/composite/tree/([^/]+)/?$`),
+			methods: []string{"POST"},
+			handler: r.handleCompositeTree,
+		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/composite/batch/?$`),
+			methods: []string{"POST"},
+			handler: r.handleCompositeBatch,
+		},
+		{
+			pattern: regexp.MustCompile(`^/services/data/v` + version + `/composite/graph/?$`),
+			methods: []string{"POST"},
+			handler: r.handleCompositeGraph,
+		},
 		{
 			pattern: regexp.MustCompile(`^/services/data/v` + version + `/composite/?$`),
 			methods: []string{"POST"},
@@ -94,6 +202,17 @@ func (r *Router) setupRoutes() {
 			methods: []string{"GET"},
 			handler: r.handleRecordCount,
 		},
+		// Identity
+		{
+			pattern: regexp.MustCompile(`^/services/oauth2/userinfo/?$`),
+			methods: []string{"GET", "POST"},
+			handler: r.handleUserInfo,
+		},
+		{
+			pattern: regexp.MustCompile(`^/id/([^/]+)/([^/]+)/?$`),
+			methods: []string{"GET"},
+			handler: r.handleIdentity,
+		},
 		// Tooling API
 		{
 			pattern: regexp.MustCompile(`^/services/data/v` + version + `/tooling/query/?$`),
@@ -120,6 +239,10 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if wantsPrettyJSON(req) {
+		w = &prettyWriter{ResponseWriter: w}
+	}
+
 	// Check authentication for non-OAuth endpoints
 	if !strings.HasPrefix(req.URL.Path, "/services/oauth2/") {
 		_, err := r.authHandler.ValidateRequest(req)
@@ -129,6 +252,20 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
+	// Allow clients that cannot send PATCH to tunnel it through POST. As in
+	// Salesforce, PATCH is the only method that can be tunneled.
+	if req.Method == http.MethodPost {
+		if override := req.URL.Query().Get("_HttpMethod"); override != "" {
+			if !strings.EqualFold(override, http.MethodPatch) {
+				r.respondError(w, []sferrors.SalesforceError{
+					sferrors.NewMethodNotAllowedError(override),
+				}, http.StatusMethodNotAllowed)
+				return
+			}
+			req.Method = http.MethodPatch
+		}
+	}
+
 	// Find matching route
 	path := req.URL.Path
 	for _, route := range r.routes {
@@ -162,13 +299,43 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 }
 
 func (r *Router) respondError(w http.ResponseWriter, errors []sferrors.SalesforceError, status int) {
+	for _, e := range errors {
+		r.errors.Record(status, e.ErrorCode, e.Message)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(errors)
+	_ = newJSONEncoder(w).Encode(errors)
 }
 
 func (r *Router) respondJSON(w http.ResponseWriter, data interface{}, status int) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(data)
+	_ = newJSONEncoder(w).Encode(data)
+}
+
+// prettyWriter marks a response whose JSON should be indented
+type prettyWriter struct {
+	http.ResponseWriter
+}
+
+// wantsPrettyJSON reports whether the request asked for indented JSON, via
+// ?pretty=true, ?prettyPrint=true or the X-PrettyPrint header Salesforce honours
+func wantsPrettyJSON(req *http.Request) bool {
+	query := req.URL.Query()
+	for _, value := range []string{query.Get("pretty"), query.Get("prettyPrint"), req.Header.Get("X-PrettyPrint")} {
+		if value == "true" || value == "1" {
+			return true
+		}
+	}
+	return false
+}
+
+// newJSONEncoder returns an encoder for w, indenting for pretty responses
+func newJSONEncoder(w http.ResponseWriter) *json.Encoder {
+	encoder := json.NewEncoder(w)
+	if _, ok := w.(*prettyWriter); ok {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder
 }
@@ -0,0 +1,34 @@
+package rest
+
+import (
+	"net/http"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// SearchResponse represents a SOSL search response
+type SearchResponse struct {
+	SearchRecords []storage.Record `json:"searchRecords"`
+}
+
+// handleSearch handles GET /services/data/vXX.X/search?q=FIND {...}
+func (r *Router) handleSearch(w http.ResponseWriter, req *http.Request, params []string) {
+	search := req.URL.Query().Get("q")
+	if search == "" {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewMalformedSearchError("No search string provided"),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	records, err := r.sosl.Search(search)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewMalformedSearchError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	r.respondJSON(w, SearchResponse{SearchRecords: records}, http.StatusOK)
+}
@@ -2,7 +2,10 @@ package rest
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
 	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
@@ -10,9 +13,10 @@ import (
 
 // SObjectResponse is the response for create/update operations
 type SObjectResponse struct {
-	ID      string        `json:"id"`
-	Success bool          `json:"success"`
-	Errors  []interface{} `json:"errors"`
+	ID       string        `json:"id"`
+	Success  bool          `json:"success"`
+	Errors   []interface{} `json:"errors"`
+	Warnings []Warning     `json:"warnings,omitempty"`
 }
 
 // handleDescribeGlobal handles GET /services/data/vXX.X/sobjects/
@@ -55,6 +59,139 @@ func (r *Router) handleDescribeSObject(w http.ResponseWriter, req *http.Request,
 	r.respondJSON(w, description, http.StatusOK)
 }
 
+// ApprovalLayoutsResponse is the response for describe/approvalLayouts
+type ApprovalLayoutsResponse struct {
+	ApprovalLayouts []storage.ApprovalLayout `json:"approvalLayouts"`
+}
+
+// handleApprovalLayouts handles GET /services/data/vXX.X/sobjects/{objectType}/describe/approvalLayouts[/{processName}]
+func (r *Router) handleApprovalLayouts(w http.ResponseWriter, req *http.Request, params []string) {
+	objectType, processName := params[0], params[1]
+
+	layouts, err := r.store.ApprovalLayouts(objectType, processName)
+	if err != nil || (processName != "" && len(layouts) == 0) {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewObjectNotFoundError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+
+	r.respondJSON(w, ApprovalLayoutsResponse{ApprovalLayouts: layouts}, http.StatusOK)
+}
+
+// deletedDateFormat is the timestamp format used by getDeleted and getUpdated
+const deletedDateFormat = "2006-01-02T15:04:05.000+0000"
+
+// DeletedRecordInfo is one entry of a getDeleted response
+type DeletedRecordInfo struct {
+	ID          string `json:"id"`
+	DeletedDate string `json:"deletedDate"`
+}
+
+// GetDeletedResponse is the response for getDeleted
+type GetDeletedResponse struct {
+	DeletedRecords        []DeletedRecordInfo `json:"deletedRecords"`
+	EarliestDateAvailable string              `json:"earliestDateAvailable"`
+	LatestDateCovered     string              `json:"latestDateCovered"`
+}
+
+// handleGetDeleted handles GET /services/data/vXX.X/sobjects/{objectType}/deleted/?start=...&end=...
+func (r *Router) handleGetDeleted(w http.ResponseWriter, req *http.Request, params []string) {
+	objectType := params[0]
+
+	start, end, ok := r.replicationWindow(w, req)
+	if !ok {
+		return
+	}
+
+	deleted, err := r.store.GetDeleted(objectType, start, end)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewObjectNotFoundError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+
+	response := GetDeletedResponse{
+		DeletedRecords:        make([]DeletedRecordInfo, len(deleted)),
+		EarliestDateAvailable: start.Format(deletedDateFormat),
+		LatestDateCovered:     end.Format(deletedDateFormat),
+	}
+	for i, record := range deleted {
+		response.DeletedRecords[i] = DeletedRecordInfo{
+			ID:          record.ID,
+			DeletedDate: record.DeletedDate.Format(deletedDateFormat),
+		}
+	}
+
+	r.respondJSON(w, response, http.StatusOK)
+}
+
+// GetUpdatedResponse is the response for getUpdated
+type GetUpdatedResponse struct {
+	IDs               []string `json:"ids"`
+	LatestDateCovered string   `json:"latestDateCovered"`
+}
+
+// handleGetUpdated handles GET /services/data/vXX.X/sobjects/{objectType}/updated/?start=...&end=...
+// It reports the live records whose SystemModstamp falls in the window, so
+// creates count as updates and deleted records are left to getDeleted.
+func (r *Router) handleGetUpdated(w http.ResponseWriter, req *http.Request, params []string) {
+	objectType := params[0]
+
+	start, end, ok := r.replicationWindow(w, req)
+	if !ok {
+		return
+	}
+
+	records, err := r.store.GetAllRecords(objectType)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewObjectNotFoundError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+
+	response := GetUpdatedResponse{
+		IDs:               []string{},
+		LatestDateCovered: end.Format(deletedDateFormat),
+	}
+	for _, record := range records {
+		stamp, _ := record["SystemModstamp"].(string)
+		modified, err := time.Parse(time.RFC3339, stamp)
+		if err != nil || modified.Before(start) || modified.After(end) {
+			continue
+		}
+		id, _ := record["Id"].(string)
+		response.IDs = append(response.IDs, id)
+	}
+
+	r.respondJSON(w, response, http.StatusOK)
+}
+
+// replicationWindow reads the start and end parameters of getDeleted and
+// getUpdated, defaulting to the last 30 days. It responds with an error and
+// returns false if either is not an RFC 3339 date.
+func (r *Router) replicationWindow(w http.ResponseWriter, req *http.Request) (time.Time, time.Time, bool) {
+	end := time.Now().UTC()
+	start := end.AddDate(0, 0, -30)
+	for name, target := range map[string]*time.Time{"start": &start, "end": &end} {
+		value := req.URL.Query().Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			r.respondError(w, []sferrors.SalesforceError{
+				{Message: "Invalid " + name + " date: " + value, ErrorCode: sferrors.ErrorCodeInvalidField},
+			}, http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		*target = parsed.UTC()
+	}
+	return start, end, true
+}
+
 // handleCreateRecord handles POST /services/data/vXX.X/sobjects/{objectType}/
 func (r *Router) handleCreateRecord(w http.ResponseWriter, req *http.Request, objectType string) {
 	// Check if object type exists
@@ -66,27 +203,33 @@ func (r *Router) handleCreateRecord(w http.ResponseWriter, req *http.Request, ob
 	}
 
 	// Parse request body
-	var record storage.Record
-	if err := json.NewDecoder(req.Body).Decode(&record); err != nil {
+	record, err := decodeRecordBody(req)
+	if err != nil {
 		r.respondError(w, []sferrors.SalesforceError{
 			sferrors.NewJSONParserError(err.Error()),
 		}, http.StatusBadRequest)
 		return
 	}
 
+	if err := stripAttributes(objectType, record); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{*err}, http.StatusBadRequest)
+		return
+	}
+
 	// Create record
-	id, err := r.store.CreateRecord(objectType, record)
+	id, err := r.store.CreateRecordAs(r.sessionUserID(req), objectType, record)
 	if err != nil {
 		r.respondError(w, []sferrors.SalesforceError{
-			{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField},
+			storeError(err),
 		}, http.StatusBadRequest)
 		return
 	}
 
 	response := SObjectResponse{
-		ID:      id,
-		Success: true,
-		Errors:  []interface{}{},
+		ID:       id,
+		Success:  true,
+		Errors:   []interface{}{},
+		Warnings: r.warningsFor("create", objectType, record),
 	}
 
 	r.respondJSON(w, response, http.StatusCreated)
@@ -118,6 +261,12 @@ func (r *Router) handleSObjectRecord(w http.ResponseWriter, req *http.Request, p
 // handleGetRecord handles GET /services/data/vXX.X/sobjects/{objectType}/{recordID}
 func (r *Router) handleGetRecord(w http.ResponseWriter, req *http.Request, objectType, recordID string) {
 	record, err := r.store.GetRecord(objectType, recordID)
+	if err == nil && req.URL.Query().Get("updateMru") == "true" {
+		if err = r.store.MarkRecentlyViewed(objectType, recordID); err == nil {
+			// Read it again so the response has the new LastViewedDate
+			record, err = r.store.GetRecord(objectType, recordID)
+		}
+	}
 	if err != nil {
 		r.respondError(w, []sferrors.SalesforceError{
 			sferrors.NewNotFoundError(objectType, recordID),
@@ -127,7 +276,15 @@ func (r *Router) handleGetRecord(w http.ResponseWriter, req *http.Request, objec
 
 	// Handle field selection
 	fields := req.URL.Query().Get("fields")
-	if fields != "" {
+	if fields == "" {
+		r.hideSystemFields(record)
+	} else {
+		if field := r.unknownField(objectType, record, parseFieldList(fields)); field != "" {
+			r.respondError(w, []sferrors.SalesforceError{
+				sferrors.NewInvalidFieldError(field, objectType),
+			}, http.StatusBadRequest)
+			return
+		}
 		record = selectFields(record, fields)
 	}
 
@@ -145,8 +302,13 @@ func (r *Router) handleUpdateRecord(w http.ResponseWriter, req *http.Request, ob
 		return
 	}
 
+	if err := stripAttributes(objectType, updates); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{*err}, http.StatusBadRequest)
+		return
+	}
+
 	// Update record
-	err := r.store.UpdateRecord(objectType, recordID, updates)
+	err := r.store.UpdateRecordAs(r.sessionUserID(req), objectType, recordID, updates)
 	if err != nil {
 		if err.Error() == "record not found: "+recordID {
 			r.respondError(w, []sferrors.SalesforceError{
@@ -155,18 +317,39 @@ func (r *Router) handleUpdateRecord(w http.ResponseWriter, req *http.Request, ob
 			return
 		}
 		r.respondError(w, []sferrors.SalesforceError{
-			{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField},
+			storeError(err),
 		}, http.StatusBadRequest)
 		return
 	}
 
+	// Return the updated record instead of 204 when the client asks for it
+	if strings.Contains(req.Header.Get("Prefer"), "return=representation") {
+		record, err := r.store.GetRecord(objectType, recordID)
+		if err == nil {
+			r.hideSystemFields(record)
+			r.respondJSON(w, record, http.StatusOK)
+			return
+		}
+	}
+
+	// Warnings need a body, so they turn the 204 into a 200
+	if warnings := r.warningsFor("update", objectType, updates); len(warnings) > 0 {
+		r.respondJSON(w, SObjectResponse{
+			ID:       recordID,
+			Success:  true,
+			Errors:   []interface{}{},
+			Warnings: warnings,
+		}, http.StatusOK)
+		return
+	}
+
 	// 204 No Content on success
 	w.WriteHeader(http.StatusNoContent)
 }
 
 // handleDeleteRecord handles DELETE /services/data/vXX.X/sobjects/{objectType}/{recordID}
 func (r *Router) handleDeleteRecord(w http.ResponseWriter, req *http.Request, objectType, recordID string) {
-	err := r.store.DeleteRecord(objectType, recordID)
+	err := r.store.DeleteRecordAs(r.sessionUserID(req), objectType, recordID)
 	if err != nil {
 		if err.Error() == "record not found: "+recordID {
 			r.respondError(w, []sferrors.SalesforceError{
@@ -175,7 +358,7 @@ func (r *Router) handleDeleteRecord(w http.ResponseWriter, req *http.Request, ob
 			return
 		}
 		r.respondError(w, []sferrors.SalesforceError{
-			{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField},
+			storeError(err),
 		}, http.StatusBadRequest)
 		return
 	}
@@ -184,6 +367,101 @@ func (r *Router) handleDeleteRecord(w http.ResponseWriter, req *http.Request, ob
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handleUndelete handles POST /services/data/vXX.X/sobjects/{objectType}/{id}/undelete,
+// restoring a record from the recycle bin
+func (r *Router) handleUndelete(w http.ResponseWriter, req *http.Request, params []string) {
+	objectType, recordID := params[0], params[1]
+	if !r.store.HasSObject(objectType) {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewInvalidTypeError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+
+	if err := r.store.UndeleteRecordAs(r.sessionUserID(req), objectType, recordID); err != nil {
+		if err.Error() == "record not found: "+recordID {
+			r.respondError(w, []sferrors.SalesforceError{
+				sferrors.NewNotFoundError(objectType, recordID),
+			}, http.StatusNotFound)
+			return
+		}
+		r.respondError(w, []sferrors.SalesforceError{
+			{Message: "Entity is not in the recycle bin", ErrorCode: sferrors.ErrorCodeUndeleteFailed, Fields: []string{}},
+		}, http.StatusBadRequest)
+		return
+	}
+
+	r.respondJSON(w, SObjectResponse{ID: recordID, Success: true, Errors: []interface{}{}}, http.StatusOK)
+}
+
+// systemFields are stored on every record but only returned when asked for
+var systemFields = []string{"IsDeleted"}
+
+// SetIncludeSystemFields controls whether record responses include system
+// fields such as IsDeleted when the request did not name them
+func (r *Router) SetIncludeSystemFields(include bool) {
+	r.includeSystemFields = include
+}
+
+// storeError converts an error from a store write to the Salesforce error
+// reported for it. Plain errors are reported as INVALID_FIELD.
+func storeError(err error) sferrors.SalesforceError {
+	var sfErr sferrors.SalesforceError
+	if errors.As(err, &sfErr) {
+		return sfErr
+	}
+	return sferrors.SalesforceError{Message: err.Error(), ErrorCode: sferrors.ErrorCodeInvalidField}
+}
+
+// stripAttributes removes the attributes object from a record being written.
+// It fails if attributes.type names an object other than objectType.
+func stripAttributes(objectType string, record storage.Record) *sferrors.SalesforceError {
+	attrs, _ := record["attributes"].(map[string]interface{})
+	delete(record, "attributes")
+	if attrType, ok := attrs["type"].(string); ok && !strings.EqualFold(attrType, objectType) {
+		err := sferrors.NewAttributesTypeError(attrType, objectType)
+		return &err
+	}
+	return nil
+}
+
+// hideSystemFields removes the system fields from a record response unless
+// they are configured to be included
+func (r *Router) hideSystemFields(record storage.Record) {
+	if r.includeSystemFields {
+		return
+	}
+	for _, field := range systemFields {
+		delete(record, field)
+	}
+}
+
+// unknownField returns the first of fields that is neither described on
+// objectType nor present on record, or "" if all of them exist
+func (r *Router) unknownField(objectType string, record storage.Record, fields []string) string {
+	description, err := r.store.DescribeSObject(objectType)
+	if err != nil {
+		return ""
+	}
+
+	for _, field := range fields {
+		if _, ok := record[field]; ok {
+			continue
+		}
+		described := false
+		for _, f := range description.Fields {
+			if strings.EqualFold(f.Name, field) {
+				described = true
+				break
+			}
+		}
+		if !described {
+			return field
+		}
+	}
+	return ""
+}
+
 // selectFields filters a record to only include specified fields
 func selectFields(record storage.Record, fieldsStr string) storage.Record {
 	if fieldsStr == "" {
@@ -0,0 +1,198 @@
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// TreeRequest is the body of a composite tree request
+type TreeRequest struct {
+	Records []storage.Record `json:"records"`
+}
+
+// TreeResponse is the response of a composite tree request
+type TreeResponse struct {
+	HasErrors bool         `json:"hasErrors"`
+	Results   []TreeResult `json:"results"`
+}
+
+// TreeResult maps a referenceId to the created record's ID, or to the
+// errors that prevented the tree from being created
+type TreeResult struct {
+	ReferenceID string      `json:"referenceId"`
+	ID          string      `json:"id,omitempty"`
+	Errors      []TreeError `json:"errors,omitempty"`
+}
+
+// TreeError is an error reported for one node of a tree
+type TreeError struct {
+	StatusCode string   `json:"statusCode"`
+	Message    string   `json:"message"`
+	Fields     []string `json:"fields"`
+}
+
+// treeNode is a record of a tree request with its nested child collections
+type treeNode struct {
+	objectType  string
+	referenceID string
+	record      storage.Record
+	children    []treeChildren
+}
+
+// treeChildren is a child collection resolved to its relationship
+type treeChildren struct {
+	relationship storage.ChildRelationship
+	nodes        []*treeNode
+}
+
+// handleCompositeTree handles POST /services/data/vXX.X/composite/tree/{objectType}.
+// The whole tree is validated before anything is created: each node's
+// attributes.type must match its object and every nested collection must be
+// a child relationship of its parent.
+func (r *Router) handleCompositeTree(w http.ResponseWriter, req *http.Request, params []string) {
+	objectType := params[0]
+	if !r.store.HasSObject(objectType) {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewInvalidTypeError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+
+	var request TreeRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	seen := map[string]bool{}
+	var roots []*treeNode
+	for _, record := range request.Records {
+		node, failure := r.parseTreeNode(objectType, record, seen)
+		if failure != nil {
+			r.respondJSON(w, TreeResponse{HasErrors: true, Results: []TreeResult{*failure}}, http.StatusBadRequest)
+			return
+		}
+		roots = append(roots, node)
+	}
+
+	// The tree is all or nothing: records created before a failure are
+	// rolled back
+	var results []TreeResult
+	var undo []writeUndo
+	for _, node := range roots {
+		if failure := r.createTreeNode(r.sessionUserID(req), node, &results, &undo); failure != nil {
+			r.undoWrites(undo)
+			r.respondJSON(w, TreeResponse{HasErrors: true, Results: []TreeResult{*failure}}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	r.respondJSON(w, TreeResponse{HasErrors: false, Results: results}, http.StatusCreated)
+}
+
+// parseTreeNode validates a tree record and splits off its child collections
+func (r *Router) parseTreeNode(objectType string, record storage.Record, seen map[string]bool) (*treeNode, *TreeResult) {
+	attrs, _ := record["attributes"].(map[string]interface{})
+	referenceID, _ := attrs["referenceId"].(string)
+	if referenceID == "" {
+		return nil, treeFailure("", sferrors.ErrorCodeInvalidField, "Include a reference ID for each record in the request.")
+	}
+	if seen[referenceID] {
+		return nil, treeFailure(referenceID, sferrors.ErrorCodeInvalidField, fmt.Sprintf("Duplicate ReferenceId provided in the request: %s", referenceID))
+	}
+	seen[referenceID] = true
+
+	fields := storage.Record{}
+	for key, value := range record {
+		fields[key] = value
+	}
+	if err := stripAttributes(objectType, fields); err != nil {
+		return nil, treeFailure(referenceID, err.ErrorCode, err.Message)
+	}
+
+	// Child collections are the fields holding a records array
+	var keys []string
+	for key, value := range fields {
+		if collection, ok := value.(map[string]interface{}); ok {
+			if _, ok := collection["records"].([]interface{}); ok {
+				keys = append(keys, key)
+			}
+		}
+	}
+	sort.Strings(keys)
+
+	node := &treeNode{objectType: objectType, referenceID: referenceID, record: fields}
+	for _, key := range keys {
+		items := fields[key].(map[string]interface{})["records"].([]interface{})
+		delete(fields, key)
+
+		relationship, ok := r.childRelationship(objectType, key)
+		if !ok {
+			return nil, treeFailure(referenceID, sferrors.ErrorCodeInvalidField, fmt.Sprintf("Invalid child relationship '%s' on %s", key, objectType))
+		}
+
+		children := treeChildren{relationship: relationship}
+		for _, item := range items {
+			child, _ := item.(map[string]interface{})
+			childNode, failure := r.parseTreeNode(relationship.ChildSObject, child, seen)
+			if failure != nil {
+				return nil, failure
+			}
+			children.nodes = append(children.nodes, childNode)
+		}
+		node.children = append(node.children, children)
+	}
+	return node, nil
+}
+
+// createTreeNode creates a node and then its children, linked to it through
+// their relationship field, appending a result and an undo for each record
+// created
+func (r *Router) createTreeNode(userID string, node *treeNode, results *[]TreeResult, undo *[]writeUndo) *TreeResult {
+	id, err := r.store.CreateRecordAs(userID, node.objectType, node.record)
+	if err != nil {
+		sfErr := storeError(err)
+		return treeFailure(node.referenceID, sfErr.ErrorCode, sfErr.Message)
+	}
+	*results = append(*results, TreeResult{ReferenceID: node.referenceID, ID: id})
+	*undo = append(*undo, writeUndo{objectType: node.objectType, recordID: id})
+
+	for _, children := range node.children {
+		for _, child := range children.nodes {
+			child.record[children.relationship.Field] = id
+			if failure := r.createTreeNode(userID, child, results, undo); failure != nil {
+				return failure
+			}
+		}
+	}
+	return nil
+}
+
+// childRelationship finds the child relationship named name on objectType
+func (r *Router) childRelationship(objectType, name string) (storage.ChildRelationship, bool) {
+	description, err := r.store.DescribeSObject(objectType)
+	if err != nil {
+		return storage.ChildRelationship{}, false
+	}
+	for _, relationship := range description.ChildRelationships {
+		if strings.EqualFold(relationship.RelationshipName, name) {
+			return relationship, true
+		}
+	}
+	return storage.ChildRelationship{}, false
+}
+
+func treeFailure(referenceID, statusCode, message string) *TreeResult {
+	return &TreeResult{
+		ReferenceID: referenceID,
+		Errors:      []TreeError{{StatusCode: statusCode, Message: message, Fields: []string{}}},
+	}
+}
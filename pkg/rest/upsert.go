@@ -0,0 +1,81 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// UpsertResponse is the response for an upsert that created a record
+type UpsertResponse struct {
+	SObjectResponse
+	Created bool `json:"created"`
+}
+
+// handleUpsert handles PATCH /services/data/vXX.X/sobjects/{objectType}/{field}/{value}.
+// The record whose external ID field matches value is updated; if there is
+// none one is created, and if there are several nothing is written.
+func (r *Router) handleUpsert(w http.ResponseWriter, req *http.Request, params []string) {
+	objectType, field, value := params[0], params[1], params[2]
+
+	description, err := r.store.DescribeSObject(objectType)
+	if err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewInvalidTypeError(objectType),
+		}, http.StatusNotFound)
+		return
+	}
+	if !isExternalIDField(description.Fields, field) {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewNotFoundError(objectType, field),
+		}, http.StatusNotFound)
+		return
+	}
+
+	var record storage.Record
+	if err := json.NewDecoder(req.Body).Decode(&record); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+	if err := stripAttributes(objectType, record); err != nil {
+		r.respondError(w, []sferrors.SalesforceError{*err}, http.StatusBadRequest)
+		return
+	}
+
+	id, created, err := r.store.UpsertRecordAs(r.sessionUserID(req), objectType, field, value, record)
+	if err != nil {
+		sfErr := storeError(err)
+		status := http.StatusBadRequest
+		switch sfErr.ErrorCode {
+		case sferrors.ErrorCodeMultipleChoices:
+			status = http.StatusMultipleChoices
+		case sferrors.ErrorCodeNotFound:
+			status = http.StatusNotFound
+		}
+		r.respondError(w, []sferrors.SalesforceError{sfErr}, status)
+		return
+	}
+	if !created {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	r.respondJSON(w, UpsertResponse{
+		SObjectResponse: SObjectResponse{ID: id, Success: true, Errors: []interface{}{}},
+		Created:         true,
+	}, http.StatusCreated)
+}
+
+// isExternalIDField reports whether records can be upserted by field: Id or
+// a field marked as an external ID
+func isExternalIDField(fields []storage.FieldDefinition, name string) bool {
+	for _, field := range fields {
+		if field.Name == name {
+			return field.Name == "Id" || field.ExternalId
+		}
+	}
+	return false
+}
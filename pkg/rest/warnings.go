@@ -0,0 +1,28 @@
+package rest
+
+import "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+
+// Warning is a non-fatal message returned with a successful create or update
+type Warning struct {
+	Message    string   `json:"message"`
+	StatusCode string   `json:"statusCode,omitempty"`
+	Fields     []string `json:"fields,omitempty"`
+}
+
+// WarningFunc returns the warnings to report for a successful create or
+// update. operation is "create" or "update" and record is the request body.
+type WarningFunc func(operation, objectType string, record storage.Record) []Warning
+
+// SetWarningFunc sets the hook that attaches warnings to create and update
+// responses. Without one, responses carry no warnings.
+func (r *Router) SetWarningFunc(fn WarningFunc) {
+	r.warnings = fn
+}
+
+// warningsFor runs the warning hook, if any
+func (r *Router) warningsFor(operation, objectType string, record storage.Record) []Warning {
+	if r.warnings == nil {
+		return nil
+	}
+	return r.warnings(operation, objectType, record)
+}
@@ -0,0 +1,333 @@
+package soql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+var (
+	groupByPattern    = regexp.MustCompile(`(?i)\s+GROUP\s+BY\s+(.+?)(?:\s+HAVING\s|\s+ORDER\s+BY\s|\s+LIMIT\s|\s+OFFSET\s|\s*$)`)
+	havingPattern     = regexp.MustCompile(`(?i)\s+HAVING\s+(.+?)(?:\s+ORDER\s+BY\s|\s+LIMIT\s|\s+OFFSET\s|\s*$)`)
+	functionPattern   = regexp.MustCompile(`(?i)^(\w+)\s*\(\s*([\w.]*)\s*\)(?:\s+(\w+))?$`)
+	callPattern       = regexp.MustCompile(`(\w+)\s*\(\s*([\w.]*)\s*\)`)
+	countQueryPattern = regexp.MustCompile(`(?i)^SELECT\s+COUNT\s*\(\s*\)\s+FROM\s`)
+)
+
+// aggregateFunctions are the SOQL functions that summarize a group
+var aggregateFunctions = map[string]bool{
+	"COUNT": true, "COUNT_DISTINCT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+}
+
+// dateFunctions are the SOQL functions that extract part of a date for grouping
+var dateFunctions = map[string]func(time.Time) interface{}{
+	"CALENDAR_YEAR":    func(t time.Time) interface{} { return t.Year() },
+	"CALENDAR_QUARTER": func(t time.Time) interface{} { return (int(t.Month())-1)/3 + 1 },
+	"CALENDAR_MONTH":   func(t time.Time) interface{} { return int(t.Month()) },
+	"DAY_IN_MONTH":     func(t time.Time) interface{} { return t.Day() },
+	"HOUR_IN_DAY":      func(t time.Time) interface{} { return t.Hour() },
+	"DAY_ONLY":         func(t time.Time) interface{} { return t.Format("2006-01-02") },
+}
+
+// selectExpr is a parsed entry of an aggregate query's SELECT list
+type selectExpr struct {
+	function string // upper-cased function name, empty for plain fields
+	field    string
+	alias    string
+}
+
+// key returns the normalized expression used to match SELECT and GROUP BY entries
+func (e selectExpr) key() string {
+	if e.function == "" {
+		return strings.ToLower(e.field)
+	}
+	return e.function + "(" + strings.ToLower(e.field) + ")"
+}
+
+// parseSelectExpr parses a field, function call, or aliased function call
+func parseSelectExpr(s string) selectExpr {
+	if match := functionPattern.FindStringSubmatch(strings.TrimSpace(s)); match != nil {
+		return selectExpr{function: strings.ToUpper(match[1]), field: match[2], alias: match[3]}
+	}
+	return selectExpr{field: strings.TrimSpace(s)}
+}
+
+// isAggregateQuery reports whether the query groups or filters groups of
+// records, or selects an aggregate function of a field. The bare COUNT()
+// form is not included.
+func isAggregateQuery(query string, fields []string) bool {
+	if groupByPattern.MatchString(query) || havingPattern.MatchString(query) {
+		return true
+	}
+	for _, f := range fields {
+		expr := parseSelectExpr(f)
+		if aggregateFunctions[expr.function] && expr.field != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isCountQuery reports whether query is a bare SELECT COUNT() FROM ... query,
+// which only reports its row count
+func isCountQuery(query string) bool {
+	return countQueryPattern.MatchString(strings.TrimSpace(query)) && !isAggregateQuery(query, nil)
+}
+
+// aggregateRecords groups records by the GROUP BY expressions, drops the
+// groups the HAVING clause rejects and evaluates the SELECT list per group,
+// naming unaliased expressions expr0, expr1, ...
+func (e *Engine) aggregateRecords(records []storage.Record, fields []string, query string) ([]storage.Record, error) {
+	var groupExprs []selectExpr
+	if match := groupByPattern.FindStringSubmatch(query); match != nil {
+		for _, g := range strings.Split(match[1], ",") {
+			expr := parseSelectExpr(g)
+			if expr.function != "" && dateFunctions[expr.function] == nil {
+				return nil, fmt.Errorf("invalid GROUP BY expression: %s", strings.TrimSpace(g))
+			}
+			groupExprs = append(groupExprs, expr)
+		}
+	}
+
+	selectExprs := make([]selectExpr, len(fields))
+	for i, f := range fields {
+		expr := parseSelectExpr(f)
+		if expr.function != "" && !aggregateFunctions[expr.function] && dateFunctions[expr.function] == nil {
+			return nil, fmt.Errorf("unknown function: %s", expr.function)
+		}
+		if !aggregateFunctions[expr.function] && !containsExpr(groupExprs, expr) {
+			return nil, fmt.Errorf("field must be grouped or aggregated: %s", f)
+		}
+		selectExprs[i] = expr
+	}
+
+	var having *whereExpr
+	var havingCalls map[string]selectExpr
+	if match := havingPattern.FindStringSubmatch(query); match != nil {
+		var err error
+		if having, havingCalls, err = parseHaving(match[1], groupExprs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Group records, keeping each group's key values
+	type group struct {
+		values  []interface{}
+		records []storage.Record
+	}
+	groups := map[string]*group{}
+	var order []string
+	for _, record := range records {
+		values := make([]interface{}, len(groupExprs))
+		for i, expr := range groupExprs {
+			values[i] = evaluateGroupExpr(record, expr)
+		}
+		key := fmt.Sprintf("%#v", values)
+		if _, ok := groups[key]; !ok {
+			groups[key] = &group{values: values}
+			order = append(order, key)
+		}
+		groups[key].records = append(groups[key].records, record)
+	}
+
+	// An ungrouped aggregate query always returns one row
+	if len(groupExprs) == 0 && len(order) == 0 {
+		groups[""] = &group{}
+		order = append(order, "")
+	}
+
+	// Order groups by their key values for stable results
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := groups[order[i]].values, groups[order[j]].values
+		for k := range a {
+			if equals(a[k], b[k]) {
+				continue
+			}
+			if a[k] == nil || b[k] == nil {
+				return a[k] == nil
+			}
+			return lessThan(a[k], b[k])
+		}
+		return false
+	})
+
+	result := make([]storage.Record, 0, len(order))
+	for _, key := range order {
+		g := groups[key]
+		if having != nil && !having.matches(e, havingValues(g.values, g.records, groupExprs, havingCalls), "AggregateResult") {
+			continue
+		}
+		row := storage.Record{
+			"attributes": map[string]interface{}{"type": "AggregateResult"},
+		}
+		exprIndex := 0
+		for _, expr := range selectExprs {
+			name := expr.alias
+			if name == "" && expr.function == "" {
+				name = expr.field
+			}
+			if name == "" {
+				name = fmt.Sprintf("expr%d", exprIndex)
+				exprIndex++
+			}
+
+			if aggregateFunctions[expr.function] {
+				row[name] = evaluateAggregate(expr, g.records)
+			} else {
+				for i, groupExpr := range groupExprs {
+					if groupExpr.key() == expr.key() {
+						row[name] = g.values[i]
+					}
+				}
+			}
+		}
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+// parseHaving parses a HAVING clause. Each function call in it is replaced
+// by a placeholder field, returned with the call it stands for; other
+// fields must be grouped.
+func parseHaving(clause string, groupExprs []selectExpr) (*whereExpr, map[string]selectExpr, error) {
+	calls := map[string]selectExpr{}
+	var err error
+	clause = callPattern.ReplaceAllStringFunc(clause, func(call string) string {
+		expr := parseSelectExpr(call)
+		if !aggregateFunctions[expr.function] && !containsExpr(groupExprs, expr) {
+			err = fmt.Errorf("invalid HAVING expression: %s", call)
+		}
+		name := fmt.Sprintf("having%d", len(calls))
+		calls[name] = expr
+		return name
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	having, err := parseWhere(clause)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, cond := range having.conditions() {
+		if _, ok := calls[cond.field]; !ok && !containsExpr(groupExprs, selectExpr{field: cond.field}) {
+			return nil, nil, fmt.Errorf("field must be grouped or aggregated: %s", cond.field)
+		}
+	}
+	return having, calls, nil
+}
+
+// havingValues returns the values a HAVING clause sees for a group: its
+// grouped fields and the placeholders of its function calls
+func havingValues(values []interface{}, records []storage.Record, groupExprs []selectExpr, calls map[string]selectExpr) storage.Record {
+	row := storage.Record{}
+	for i, expr := range groupExprs {
+		if expr.function == "" {
+			row[expr.field] = values[i]
+		}
+	}
+	for name, call := range calls {
+		switch {
+		case call.function == "COUNT" && call.field == "":
+			row[name] = len(records)
+		case aggregateFunctions[call.function]:
+			row[name] = evaluateAggregate(call, records)
+		default:
+			for i, expr := range groupExprs {
+				if expr.key() == call.key() {
+					row[name] = values[i]
+				}
+			}
+		}
+	}
+	return row
+}
+
+func containsExpr(exprs []selectExpr, expr selectExpr) bool {
+	for _, e := range exprs {
+		if e.key() == expr.key() {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluateGroupExpr returns the grouping value of a field or date function
+func evaluateGroupExpr(record storage.Record, expr selectExpr) interface{} {
+	val := record[expr.field]
+	if expr.function == "" || val == nil {
+		return val
+	}
+
+	t, ok := parseDateValue(val)
+	if !ok {
+		return nil
+	}
+	return dateFunctions[expr.function](t)
+}
+
+// parseDateValue parses the date and datetime formats stored on records
+func parseDateValue(val interface{}) (time.Time, bool) {
+	s, ok := val.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05.000-0700", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// evaluateAggregate computes an aggregate function over a group's records
+func evaluateAggregate(expr selectExpr, records []storage.Record) interface{} {
+	var values []interface{}
+	for _, record := range records {
+		if val := record[expr.field]; val != nil {
+			values = append(values, val)
+		}
+	}
+
+	switch expr.function {
+	case "COUNT":
+		return len(values)
+	case "COUNT_DISTINCT":
+		distinct := map[string]bool{}
+		for _, v := range values {
+			distinct[fmt.Sprintf("%v", v)] = true
+		}
+		return len(distinct)
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	switch expr.function {
+	case "SUM", "AVG":
+		sum := 0.0
+		for _, v := range values {
+			n, _ := toFloat(v)
+			sum += n
+		}
+		if expr.function == "AVG" {
+			return sum / float64(len(values))
+		}
+		return sum
+	case "MIN", "MAX":
+		best := values[0]
+		for _, v := range values[1:] {
+			if (expr.function == "MIN" && lessThan(v, best)) || (expr.function == "MAX" && greaterThan(v, best)) {
+				best = v
+			}
+		}
+		return best
+	}
+	return nil
+}
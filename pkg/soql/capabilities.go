@@ -0,0 +1,72 @@
+package soql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// fieldDefinition returns the definition of a field directly on objectType,
+// or nil for relationship paths and undescribed fields
+func (e *Engine) fieldDefinition(objectType, field string) *storage.FieldDefinition {
+	if strings.Contains(field, ".") {
+		return nil
+	}
+	description, err := e.store.DescribeSObject(objectType)
+	if err != nil {
+		return nil
+	}
+	for i, f := range description.Fields {
+		if strings.EqualFold(f.Name, field) {
+			return &description.Fields[i]
+		}
+	}
+	return nil
+}
+
+// checkFieldCapabilities rejects fields used in a clause their describe
+// capabilities do not allow, as Salesforce does for e.g. long text areas
+func (e *Engine) checkFieldCapabilities(objectType, query, whereClause string, sortKeys []sortKey, fields []string) error {
+	if whereClause != "" {
+		expr, err := parseWhere(whereClause)
+		if err != nil {
+			return err
+		}
+		for _, cond := range expr.conditions() {
+			if f := e.fieldDefinition(objectType, cond.field); f != nil && !f.IsFilterable() {
+				return fmt.Errorf("field '%s' can not be filtered in a query call", f.Name)
+			}
+		}
+	}
+
+	for _, key := range sortKeys {
+		if f := e.fieldDefinition(objectType, key.field); f != nil && !f.IsSortable() {
+			return fmt.Errorf("field '%s' can not be sorted in a query call", f.Name)
+		}
+	}
+
+	if match := groupByPattern.FindStringSubmatch(query); match != nil {
+		for _, g := range strings.Split(match[1], ",") {
+			expr := parseSelectExpr(g)
+			if expr.function != "" {
+				continue
+			}
+			if f := e.fieldDefinition(objectType, expr.field); f != nil && !f.IsGroupable() {
+				return fmt.Errorf("field '%s' can not be grouped in a query call", f.Name)
+			}
+		}
+	}
+
+	for _, field := range fields {
+		expr := parseSelectExpr(field)
+		if !aggregateFunctions[expr.function] || expr.field == "" {
+			continue
+		}
+		if f := e.fieldDefinition(objectType, expr.field); f != nil && !f.IsAggregatable() {
+			return fmt.Errorf("field %s does not support aggregate operator %s", f.Name, expr.function)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package soql
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateLiteralPattern matches a comparison against a date literal such as
+// CreatedDate >= LAST_N_DAYS:7
+var dateLiteralPattern = regexp.MustCompile(`(?i)^([\w.]+)\s*(=|!=|<>|<=|>=|<|>)\s*(` +
+	`TODAY|YESTERDAY|TOMORROW|THIS_WEEK|LAST_WEEK|NEXT_WEEK|THIS_MONTH|LAST_MONTH|NEXT_MONTH|` +
+	`THIS_YEAR|LAST_YEAR|NEXT_YEAR|LAST_N_DAYS:\d+|NEXT_N_DAYS:\d+)$`)
+
+// dateRange is the span a date literal stands for, from start up to but
+// not including end
+type dateRange struct {
+	start, end time.Time
+}
+
+// resolveDateLiteral expands a date literal into the range it covers
+// relative to now. Weeks start on Sunday and all ranges are in UTC.
+func resolveDateLiteral(literal string, now time.Time) (dateRange, bool) {
+	now = now.UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := func(start, n int) dateRange {
+		return dateRange{today.AddDate(0, 0, start), today.AddDate(0, 0, start+n)}
+	}
+	week := today.AddDate(0, 0, -int(today.Weekday()))
+	month := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	year := time.Date(today.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+
+	name, arg, _ := strings.Cut(strings.ToUpper(literal), ":")
+	switch name {
+	case "TODAY":
+		return days(0, 1), true
+	case "YESTERDAY":
+		return days(-1, 1), true
+	case "TOMORROW":
+		return days(1, 1), true
+	case "THIS_WEEK":
+		return dateRange{week, week.AddDate(0, 0, 7)}, true
+	case "LAST_WEEK":
+		return dateRange{week.AddDate(0, 0, -7), week}, true
+	case "NEXT_WEEK":
+		return dateRange{week.AddDate(0, 0, 7), week.AddDate(0, 0, 14)}, true
+	case "THIS_MONTH":
+		return dateRange{month, month.AddDate(0, 1, 0)}, true
+	case "LAST_MONTH":
+		return dateRange{month.AddDate(0, -1, 0), month}, true
+	case "NEXT_MONTH":
+		return dateRange{month.AddDate(0, 1, 0), month.AddDate(0, 2, 0)}, true
+	case "THIS_YEAR":
+		return dateRange{year, year.AddDate(1, 0, 0)}, true
+	case "LAST_YEAR":
+		return dateRange{year.AddDate(-1, 0, 0), year}, true
+	case "NEXT_YEAR":
+		return dateRange{year.AddDate(1, 0, 0), year.AddDate(2, 0, 0)}, true
+	case "LAST_N_DAYS", "NEXT_N_DAYS":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return dateRange{}, false
+		}
+		// LAST_N_DAYS runs from n days ago through today; NEXT_N_DAYS
+		// starts tomorrow
+		if name == "LAST_N_DAYS" {
+			return days(-n, n+1), true
+		}
+		return days(1, n), true
+	}
+	return dateRange{}, false
+}
+
+// matches compares a stored date or datetime against the range: = and !=
+// test membership, and the ordering operators compare against its bounds
+func (r dateRange) matches(val interface{}, operator string) bool {
+	t, ok := parseDateValue(val)
+	if !ok {
+		return false
+	}
+
+	switch operator {
+	case "=":
+		return !t.Before(r.start) && t.Before(r.end)
+	case "!=", "<>":
+		return t.Before(r.start) || !t.Before(r.end)
+	case "<":
+		return t.Before(r.start)
+	case "<=":
+		return t.Before(r.end)
+	case ">":
+		return !t.Before(r.end)
+	case ">=":
+		return !t.Before(r.start)
+	}
+	return false
+}
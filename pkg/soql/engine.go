@@ -0,0 +1,421 @@
+// Package soql implements the SOQL engine shared by the REST, composite and
+// bulk query paths.
+package soql
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// Engine executes SOQL queries against a Store
+type Engine struct {
+	store      storage.Store
+	apiVersion string
+}
+
+// NewEngine creates a SOQL engine over store. apiVersion is used in the
+// attribute URLs of related records.
+func NewEngine(store storage.Store, apiVersion string) *Engine {
+	return &Engine{
+		store:      store,
+		apiVersion: apiVersion,
+	}
+}
+
+// Result is the outcome of a query. Count queries (SELECT COUNT() FROM ...)
+// report the number of matching rows in TotalSize and return no records.
+type Result struct {
+	TotalSize int
+	Records   []storage.Record
+	Count     bool
+}
+
+// allRowsPattern matches the ALL ROWS clause that includes deleted records
+var allRowsPattern = regexp.MustCompile(`(?i)\s+ALL\s+ROWS\s*$`)
+
+// Query parses and executes a SOQL query
+func (e *Engine) Query(query string) ([]storage.Record, error) {
+	records, _, err := e.execute(query, nil, false)
+	return records, err
+}
+
+// Execute parses and executes a SOQL query, reporting the total size the
+// same way for every caller so COUNT() behaves identically across the REST,
+// composite and bulk paths
+func (e *Engine) Execute(query string) (*Result, error) {
+	return e.executeResult(query, false)
+}
+
+// ExecuteAll is Execute for queryAll: soft-deleted and archived records are
+// included, as if the query ended in ALL ROWS
+func (e *Engine) ExecuteAll(query string) (*Result, error) {
+	return e.executeResult(query, true)
+}
+
+func (e *Engine) executeResult(query string, allRows bool) (*Result, error) {
+	records, _, err := e.execute(query, nil, allRows)
+	if err != nil {
+		return nil, err
+	}
+
+	if isCountQuery(query) {
+		return &Result{TotalSize: len(records), Records: []storage.Record{}, Count: true}, nil
+	}
+	return &Result{TotalSize: len(records), Records: records}, nil
+}
+
+// execute runs a SOQL query, optionally limited to the children of one
+// parent record. Soft-deleted records are included when allRows is set or
+// the query ends in ALL ROWS. more reports whether LIMIT left matching
+// records out.
+func (e *Engine) execute(query string, scope *childScope, allRows bool) (records []storage.Record, more bool, err error) {
+	// Simple SOQL parser - handles basic SELECT ... FROM ... WHERE ... ORDER BY ... LIMIT
+	query = strings.TrimSpace(query)
+	if allRowsPattern.MatchString(query) {
+		query = allRowsPattern.ReplaceAllString(query, "")
+		allRows = true
+	}
+
+	// Child subqueries are parsed separately from the outer clauses
+	query, subqueries := extractSubqueries(query)
+
+	// Parse SELECT clause
+	selectMatch := regexp.MustCompile(`(?i)^SELECT\s+(.+?)\s+FROM\s+`).FindStringSubmatch(query)
+	if selectMatch == nil {
+		return nil, false, fmt.Errorf("invalid SOQL: missing SELECT or FROM clause")
+	}
+	fields := parseSelectFields(selectMatch[1])
+	for _, field := range fields {
+		if typeOfStartPattern.MatchString(field) {
+			if _, err := parseTypeOf(field); err != nil {
+				return nil, false, err
+			}
+		}
+	}
+
+	// Parse FROM clause
+	fromMatch := regexp.MustCompile(`(?i)FROM\s+(\w+)`).FindStringSubmatch(query)
+	if fromMatch == nil {
+		return nil, false, fmt.Errorf("invalid SOQL: missing FROM clause")
+	}
+	objectType := fromMatch[1]
+
+	// Check if object exists
+	if !e.store.HasSObject(objectType) {
+		return nil, false, fmt.Errorf("sObject type '%s' is not supported", objectType)
+	}
+
+	whereMatch := regexp.MustCompile(`(?i)WHERE\s+(.+?)(?:\s+GROUP\s+BY|\s+HAVING\s|\s+ORDER\s+BY|\s+LIMIT|\s+OFFSET|\s*$)`).FindStringSubmatch(query)
+	var whereClause string
+	if whereMatch != nil {
+		whereClause = whereMatch[1]
+	}
+	sortKeys, err := parseOrderBy(query)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := e.checkFieldCapabilities(objectType, query, whereClause, sortKeys, fields); err != nil {
+		return nil, false, err
+	}
+
+	// Get all records
+	var allRecords []storage.Record
+	if allRows {
+		allRecords, err = e.store.GetAllRecordsWithDeleted(objectType)
+	} else {
+		allRecords, err = e.store.GetAllRecords(objectType)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if scope != nil {
+		allRecords = scope.filter(allRecords)
+	}
+
+	// Apply WHERE clause if present
+	if whereClause != "" {
+		allRecords, err = e.filterRecords(allRecords, objectType, whereClause)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Aggregate queries return one AggregateResult row per group
+	aggregate := isAggregateQuery(query, fields)
+	if aggregate {
+		allRecords, err = e.aggregateRecords(allRecords, fields, query)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Apply ORDER BY if present
+	if len(sortKeys) > 0 {
+		allRecords = e.sortRecords(allRecords, objectType, sortKeys)
+	}
+
+	// Apply OFFSET if present; rows are skipped before LIMIT is applied
+	offsetMatch := regexp.MustCompile(`(?i)OFFSET\s+(\d+)`).FindStringSubmatch(query)
+	if offsetMatch != nil {
+		offset, _ := strconv.Atoi(offsetMatch[1])
+		if offset < len(allRecords) {
+			allRecords = allRecords[offset:]
+		} else {
+			allRecords = []storage.Record{}
+		}
+	}
+
+	// Apply LIMIT if present
+	limitMatch := regexp.MustCompile(`(?i)LIMIT\s+(\d+)`).FindStringSubmatch(query)
+	if limitMatch != nil {
+		limit, _ := strconv.Atoi(limitMatch[1])
+		if limit < len(allRecords) {
+			allRecords = allRecords[:limit]
+			more = true
+		}
+	}
+
+	if aggregate {
+		return allRecords, more, nil
+	}
+
+	// Project fields
+	result := make([]storage.Record, len(allRecords))
+	for i, record := range allRecords {
+		result[i] = e.projectFields(record, fields, objectType)
+		for placeholder, subquery := range subqueries {
+			if err := e.projectSubquery(result[i], record, objectType, subquery, allRows); err != nil {
+				return nil, false, err
+			}
+			delete(result[i], placeholder)
+		}
+	}
+
+	return result, more, nil
+}
+
+// parseSelectFields parses the SELECT field list. TYPEOF ... END expressions
+// contain their own comma-separated field lists and are kept as one entry.
+func parseSelectFields(fieldsStr string) []string {
+	var fields []string
+	var typeOf []string
+	for _, f := range strings.Split(fieldsStr, ",") {
+		f = strings.TrimSpace(f)
+		if typeOf == nil && typeOfStartPattern.MatchString(f) {
+			typeOf = []string{}
+		}
+		if typeOf != nil {
+			typeOf = append(typeOf, f)
+			if typeOfEndPattern.MatchString(f) {
+				fields = append(fields, strings.Join(typeOf, ", "))
+				typeOf = nil
+			}
+			continue
+		}
+		if f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if typeOf != nil {
+		fields = append(fields, strings.Join(typeOf, ", "))
+	}
+	return fields
+}
+
+var (
+	typeOfStartPattern = regexp.MustCompile(`(?i)^TYPEOF\s`)
+	typeOfEndPattern   = regexp.MustCompile(`(?i)\sEND$`)
+)
+
+// typeOfExpr is a parsed TYPEOF expression:
+// TYPEOF What WHEN Account THEN Name WHEN Opportunity THEN Amount ELSE Id END
+type typeOfExpr struct {
+	relationship string
+	whens        map[string][]string
+	elseFields   []string
+}
+
+// parseTypeOf parses a TYPEOF ... END select entry
+func parseTypeOf(expr string) (*typeOfExpr, error) {
+	tokens := strings.Fields(strings.ReplaceAll(expr, ",", " , "))
+	if len(tokens) < 3 || !strings.EqualFold(tokens[0], "TYPEOF") || !strings.EqualFold(tokens[len(tokens)-1], "END") {
+		return nil, fmt.Errorf("invalid TYPEOF expression: %s", expr)
+	}
+
+	result := &typeOfExpr{
+		relationship: tokens[1],
+		whens:        make(map[string][]string),
+	}
+
+	currentType := ""
+	inElse := false
+	for i := 2; i < len(tokens)-1; i++ {
+		token := tokens[i]
+		switch {
+		case strings.EqualFold(token, "WHEN"):
+			if i+2 >= len(tokens)-1 || !strings.EqualFold(tokens[i+2], "THEN") {
+				return nil, fmt.Errorf("invalid TYPEOF expression: expected WHEN <type> THEN")
+			}
+			currentType = strings.ToLower(tokens[i+1])
+			result.whens[currentType] = []string{}
+			i += 2
+		case strings.EqualFold(token, "ELSE"):
+			inElse = true
+		case token == ",":
+			continue
+		case inElse:
+			result.elseFields = append(result.elseFields, token)
+		case currentType != "":
+			result.whens[currentType] = append(result.whens[currentType], token)
+		default:
+			return nil, fmt.Errorf("invalid TYPEOF expression: unexpected token %s", token)
+		}
+	}
+
+	return result, nil
+}
+
+// projectFields creates a new record with only the selected fields
+func (e *Engine) projectFields(record storage.Record, fields []string, objectType string) storage.Record {
+	result := make(storage.Record)
+
+	// Always include attributes
+	result["attributes"] = map[string]interface{}{
+		"type": objectType,
+		"url":  record["attributes"].(map[string]interface{})["url"],
+	}
+
+	for _, field := range fields {
+		// Handle aggregate functions
+		if strings.HasPrefix(strings.ToUpper(field), "COUNT(") {
+			// For COUNT(), we need special handling at the query level
+			continue
+		}
+
+		// Handle polymorphic TYPEOF expressions
+		if typeOfStartPattern.MatchString(field) {
+			e.projectTypeOf(result, record, objectType, field)
+			continue
+		}
+
+		// Handle relationship fields (e.g., Account.Name, Who.Name)
+		if strings.Contains(field, ".") {
+			e.projectRelationshipField(result, record, objectType, strings.Split(field, "."))
+			continue
+		}
+
+		if val, ok := record[field]; ok {
+			result[field] = val
+		} else {
+			result[field] = nil
+		}
+	}
+
+	return result
+}
+
+// projectRelationshipField resolves a dotted path such as Account.Name or
+// Who.Name and merges the value into the nested parent object on result
+func (e *Engine) projectRelationshipField(result, record storage.Record, objectType string, path []string) {
+	relField, parentType, parent := e.resolveRelationship(record, objectType, path[0])
+	if relField == nil {
+		return
+	}
+	relName := relField.RelationshipName
+
+	if parent == nil {
+		if _, ok := result[relName]; !ok {
+			result[relName] = nil
+		}
+		return
+	}
+
+	nested, ok := result[relName].(storage.Record)
+	if !ok {
+		nested = e.newRelationshipObject(parentType, parent)
+		result[relName] = nested
+	}
+
+	if len(path) == 2 {
+		nested[path[1]] = parent[path[1]]
+		return
+	}
+	e.projectRelationshipField(nested, parent, parentType, path[1:])
+}
+
+// projectTypeOf evaluates a TYPEOF expression, projecting the fields listed
+// for the referenced record's type, or the ELSE fields if no WHEN matches
+func (e *Engine) projectTypeOf(result, record storage.Record, objectType, expr string) {
+	typeOf, err := parseTypeOf(expr)
+	if err != nil {
+		return
+	}
+
+	relField, parentType, parent := e.resolveRelationship(record, objectType, typeOf.relationship)
+	if relField == nil {
+		return
+	}
+	if parent == nil {
+		result[relField.RelationshipName] = nil
+		return
+	}
+
+	fields, ok := typeOf.whens[strings.ToLower(parentType)]
+	if !ok {
+		fields = typeOf.elseFields
+	}
+
+	nested := e.newRelationshipObject(parentType, parent)
+	for _, field := range fields {
+		if strings.Contains(field, ".") {
+			e.projectRelationshipField(nested, parent, parentType, strings.Split(field, "."))
+			continue
+		}
+		nested[field] = parent[field]
+	}
+	result[relField.RelationshipName] = nested
+}
+
+// newRelationshipObject creates the nested object used to embed a related record
+func (e *Engine) newRelationshipObject(objectType string, record storage.Record) storage.Record {
+	return storage.Record{
+		"attributes": map[string]interface{}{
+			"type": objectType,
+			"url":  fmt.Sprintf("/services/data/v%s/sobjects/%s/%s", e.apiVersion, objectType, record["Id"]),
+		},
+	}
+}
+
+// resolveRelationship finds the reference field whose relationship name matches
+// relName and loads the record it points to. Polymorphic fields such as
+// Task.WhoId are resolved by checking each type listed in ReferenceTo.
+func (e *Engine) resolveRelationship(record storage.Record, objectType, relName string) (*storage.FieldDefinition, string, storage.Record) {
+	description, err := e.store.DescribeSObject(objectType)
+	if err != nil {
+		return nil, "", nil
+	}
+
+	for i := range description.Fields {
+		field := &description.Fields[i]
+		if field.Type != storage.FieldTypeReference || !strings.EqualFold(field.RelationshipName, relName) {
+			continue
+		}
+
+		id, _ := record[field.Name].(string)
+		if id == "" {
+			return field, "", nil
+		}
+		for _, target := range field.ReferenceTo {
+			if parent, err := e.store.GetRecord(target, id); err == nil {
+				return field, target, parent
+			}
+		}
+		return field, "", nil
+	}
+
+	return nil, "", nil
+}
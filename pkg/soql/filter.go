@@ -0,0 +1,321 @@
+package soql
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// filterRecords applies WHERE clause filtering
+func (e *Engine) filterRecords(records []storage.Record, objectType, whereClause string) ([]storage.Record, error) {
+	expr, err := parseWhere(whereClause)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []storage.Record
+	for _, record := range records {
+		if expr.matches(e, record, objectType) {
+			result = append(result, record)
+		}
+	}
+
+	return result, nil
+}
+
+// fieldValue returns the value of a field or relationship path such as
+// Account.Industry. ok is false when a parent along the path is null.
+func (e *Engine) fieldValue(record storage.Record, objectType, field string) (interface{}, bool) {
+	path := strings.Split(field, ".")
+	for len(path) > 1 {
+		relField, parentType, parent := e.resolveRelationship(record, objectType, path[0])
+		if relField == nil || parent == nil {
+			return nil, false
+		}
+		record, objectType, path = parent, parentType, path[1:]
+	}
+
+	// Number fields are either null or a value; an empty string is null
+	value := record[path[0]]
+	if isNull(value) || (value == "" && e.isNumberField(objectType, path[0])) {
+		return nil, true
+	}
+	return value, true
+}
+
+// isNull reports whether v is SOQL null: a field that was never set, set to
+// nil, or set to a typed nil such as a nil slice or pointer
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// isNumberField reports whether field on objectType holds numbers. Text
+// fields, unlike number fields, keep the empty string distinct from null.
+func (e *Engine) isNumberField(objectType, field string) bool {
+	f := e.fieldDefinition(objectType, field)
+	if f == nil {
+		return false
+	}
+	switch f.Type {
+	case storage.FieldTypeInteger, storage.FieldTypeDouble, storage.FieldTypeCurrency, storage.FieldTypePercent:
+		return true
+	}
+	return false
+}
+
+type condition struct {
+	field    string
+	operator string
+	value    interface{}
+}
+
+// parseCondition parses a single comparison such as Name = 'Acme'. ok is
+// false when part, as a whole, is not a comparison the engine understands.
+func parseCondition(part string) (cond condition, ok bool) {
+	part = strings.TrimSpace(part)
+
+	// Match: field = 'value'
+	if match := regexp.MustCompile(`(?i)^([\w.]+)\s*(=|!=|<>|<|>|<=|>=|LIKE)\s*'((?:[^'\\]|\\.)*)'$`).FindStringSubmatch(part); match != nil {
+		operator, value := strings.ToUpper(match[2]), match[3]
+		if operator != "LIKE" {
+			value = unescapeString(value)
+		}
+		return condition{
+			field:    match[1],
+			operator: operator,
+			value:    value,
+		}, true
+	}
+
+	// Match: field = number
+	if match := regexp.MustCompile(`^([\w.]+)\s*(=|!=|<>|<|>|<=|>=)\s*(-?\d+(?:\.\d+)?)$`).FindStringSubmatch(part); match != nil {
+		val, _ := strconv.ParseFloat(match[3], 64)
+		return condition{
+			field:    match[1],
+			operator: match[2],
+			value:    val,
+		}, true
+	}
+
+	// Match: field = true/false
+	if match := regexp.MustCompile(`(?i)^([\w.]+)\s*(=|!=)\s*(true|false)$`).FindStringSubmatch(part); match != nil {
+		return condition{
+			field:    match[1],
+			operator: match[2],
+			value:    strings.ToLower(match[3]) == "true",
+		}, true
+	}
+
+	// Match: field = null
+	if match := regexp.MustCompile(`(?i)^([\w.]+)\s*(=|!=)\s*null$`).FindStringSubmatch(part); match != nil {
+		return condition{
+			field:    match[1],
+			operator: match[2],
+			value:    nil,
+		}, true
+	}
+
+	// Match: field IN ('val1', 'val2', ...) or field NOT IN (...)
+	if match := regexp.MustCompile(`(?i)^([\w.]+)\s+(NOT\s+)?IN\s*\(([^)]+)\)$`).FindStringSubmatch(part); match != nil {
+		operator := "IN"
+		if match[2] != "" {
+			operator = "NOT IN"
+		}
+		return condition{
+			field:    match[1],
+			operator: operator,
+			value:    parseInValues(match[3]),
+		}, true
+	}
+
+	// Match: field >= LAST_N_DAYS:7
+	if match := dateLiteralPattern.FindStringSubmatch(part); match != nil {
+		if r, ok := resolveDateLiteral(match[3], time.Now()); ok {
+			return condition{
+				field:    match[1],
+				operator: match[2],
+				value:    r,
+			}, true
+		}
+	}
+
+	return condition{}, false
+}
+
+// unescapeString resolves the escape sequences of a SOQL string literal
+func unescapeString(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseInValues parses the values in an IN clause
+func parseInValues(valuesStr string) []string {
+	var values []string
+	for _, v := range strings.Split(valuesStr, ",") {
+		v = strings.TrimSpace(v)
+		v = strings.Trim(v, "'\"")
+		values = append(values, v)
+	}
+	return values
+}
+
+// matchesCondition checks if a record matches one condition. Conditions on
+// relationship fields whose parent is null only match "= null", and null
+// values never satisfy an ordering comparison.
+func (e *Engine) matchesCondition(record storage.Record, objectType string, cond condition) bool {
+	val, ok := e.fieldValue(record, objectType, cond.field)
+	if !ok && (cond.operator != "=" || cond.value != nil) {
+		return false
+	}
+	switch cond.operator {
+	case "<", ">", "<=", ">=":
+		if val == nil {
+			return false
+		}
+	}
+	if r, ok := cond.value.(dateRange); ok {
+		return r.matches(val, cond.operator)
+	}
+
+	switch cond.operator {
+	case "=":
+		return equals(val, cond.value)
+	case "!=", "<>":
+		return !equals(val, cond.value)
+	case "<":
+		return lessThan(val, cond.value)
+	case ">":
+		return greaterThan(val, cond.value)
+	case "<=":
+		return lessThanOrEqual(val, cond.value)
+	case ">=":
+		return greaterThanOrEqual(val, cond.value)
+	case "LIKE":
+		return matchesLike(val, cond.value.(string))
+	case "IN":
+		return inValues(val, cond.value.([]string))
+	case "NOT IN":
+		return !inValues(val, cond.value.([]string))
+	}
+	return true
+}
+
+func equals(a, b interface{}) bool {
+	if isNull(a) || isNull(b) {
+		return isNull(a) && isNull(b)
+	}
+
+	// Booleans match however the stored value was written
+	if bBool, ok := b.(bool); ok {
+		aBool, ok := toBool(a)
+		return ok && aBool == bBool
+	}
+
+	// Convert to strings for comparison
+	aStr := fmt.Sprintf("%v", a)
+	bStr := fmt.Sprintf("%v", b)
+	return aStr == bStr
+}
+
+func lessThan(a, b interface{}) bool {
+	aNum, aOk := toFloat(a)
+	bNum, bOk := toFloat(b)
+	if aOk && bOk {
+		return aNum < bNum
+	}
+	return fmt.Sprintf("%v", a) < fmt.Sprintf("%v", b)
+}
+
+func greaterThan(a, b interface{}) bool {
+	aNum, aOk := toFloat(a)
+	bNum, bOk := toFloat(b)
+	if aOk && bOk {
+		return aNum > bNum
+	}
+	return fmt.Sprintf("%v", a) > fmt.Sprintf("%v", b)
+}
+
+func lessThanOrEqual(a, b interface{}) bool {
+	return equals(a, b) || lessThan(a, b)
+}
+
+func greaterThanOrEqual(a, b interface{}) bool {
+	return equals(a, b) || greaterThan(a, b)
+}
+
+func toBool(v interface{}) (bool, bool) {
+	switch val := v.(type) {
+	case bool:
+		return val, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(val))
+		return b, err == nil
+	}
+	return false, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(val, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func matchesLike(val interface{}, pattern string) bool {
+	if val == nil {
+		return false
+	}
+	valStr := fmt.Sprintf("%v", val)
+
+	// Convert SQL LIKE pattern to regex
+	pattern = strings.ReplaceAll(pattern, "%", ".*")
+	pattern = strings.ReplaceAll(pattern, "_", ".")
+	pattern = "^" + pattern + "$"
+
+	matched, _ := regexp.MatchString("(?i)"+pattern, valStr)
+	return matched
+}
+
+func inValues(val interface{}, values []string) bool {
+	if val == nil {
+		return false
+	}
+	valStr := fmt.Sprintf("%v", val)
+	for _, v := range values {
+		if valStr == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package soql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+var (
+	orderByPattern = regexp.MustCompile(`(?i)\sORDER\s+BY\s+(.+?)(?:\s+LIMIT\s|\s+OFFSET\s|\s*$)`)
+	sortKeyPattern = regexp.MustCompile(`(?i)^([\w.]+(?:\([\w.]*\))?)(?:\s+(ASC|DESC))?(?:\s+NULLS\s+(FIRST|LAST))?$`)
+)
+
+// sortKey is one field of an ORDER BY clause
+type sortKey struct {
+	field      string
+	descending bool
+	nullsLast  bool
+}
+
+// parseOrderBy parses the ORDER BY clause of query, if any. Nulls sort
+// first in ascending and last in descending order unless NULLS FIRST or
+// NULLS LAST says otherwise.
+func parseOrderBy(query string) ([]sortKey, error) {
+	match := orderByPattern.FindStringSubmatch(query)
+	if match == nil {
+		return nil, nil
+	}
+
+	var keys []sortKey
+	for _, part := range strings.Split(match[1], ",") {
+		m := sortKeyPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid ORDER BY clause: %s", strings.TrimSpace(part))
+		}
+		key := sortKey{field: m[1], descending: strings.EqualFold(m[2], "DESC")}
+		key.nullsLast = key.descending
+		if m[3] != "" {
+			key.nullsLast = strings.EqualFold(m[3], "LAST")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortRecords sorts records by keys, keeping the original order of rows
+// that compare equal on every key
+func (e *Engine) sortRecords(records []storage.Record, objectType string, keys []sortKey) []storage.Record {
+	// Resolve each sort value once rather than on every comparison
+	values := make([][]interface{}, len(records))
+	for i, record := range records {
+		values[i] = make([]interface{}, len(keys))
+		for k, key := range keys {
+			values[i][k], _ = e.fieldValue(record, objectType, key.field)
+		}
+	}
+
+	index := make([]int, len(records))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		a, b := values[index[i]], values[index[j]]
+		for k, key := range keys {
+			aNull, bNull := isNull(a[k]), isNull(b[k])
+			switch {
+			case aNull && bNull:
+				continue
+			case aNull || bNull:
+				return aNull != key.nullsLast
+			case equals(a[k], b[k]):
+				continue
+			case key.descending:
+				return greaterThan(a[k], b[k])
+			default:
+				return lessThan(a[k], b[k])
+			}
+		}
+		return false
+	})
+
+	result := make([]storage.Record, len(records))
+	for i, n := range index {
+		result[i] = records[n]
+	}
+	return result
+}
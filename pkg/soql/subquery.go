@@ -0,0 +1,135 @@
+package soql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+var (
+	subqueryPattern     = regexp.MustCompile(`(?is)^SELECT\s`)
+	subqueryFromPattern = regexp.MustCompile(`(?i)\sFROM\s+(\w+)`)
+)
+
+// SubqueryResult is the QueryResponse-shaped value embedded for a child subquery
+type SubqueryResult struct {
+	TotalSize int              `json:"totalSize"`
+	Done      bool             `json:"done"`
+	Records   []storage.Record `json:"records"`
+}
+
+// childScope restricts a subquery to the children of one parent record
+type childScope struct {
+	field    string
+	parentID string
+}
+
+// filter returns the records whose foreign key points at the parent
+func (c *childScope) filter(records []storage.Record) []storage.Record {
+	result := []storage.Record{}
+	for _, record := range records {
+		if id, _ := record[c.field].(string); id == c.parentID {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// extractSubqueries replaces parenthesized child subqueries in the SELECT
+// list with placeholder field names, so that the outer WHERE, ORDER BY and
+// LIMIT clauses are not confused with the subqueries' own
+func extractSubqueries(query string) (string, map[string]string) {
+	subqueries := map[string]string{}
+	upper := strings.ToUpper(query)
+
+	var b strings.Builder
+	depth, start := 0, 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if depth == 0 && i > 0 && strings.HasPrefix(upper[i:], "FROM") && isSpace(query[i-1]) && (i+4 == len(query) || isSpace(query[i+4])) {
+			// The rest of the query belongs to the outer SELECT
+			b.WriteString(query[i:])
+			break
+		}
+
+		switch {
+		case c == '(':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+			if depth == 0 {
+				inner := strings.TrimSpace(query[start+1 : i])
+				if subqueryPattern.MatchString(inner) {
+					placeholder := fmt.Sprintf("__subquery%d__", len(subqueries))
+					subqueries[placeholder] = inner
+					b.WriteString(placeholder)
+				} else {
+					b.WriteString(query[start : i+1])
+				}
+			}
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+
+	return b.String(), subqueries
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// projectSubquery runs a child subquery such as
+// (SELECT LastName FROM Contacts ORDER BY CreatedDate LIMIT 5) for one parent
+// record and embeds the SubqueryResult under the relationship
+// name. Parents without matching children get null, as in Salesforce.
+func (e *Engine) projectSubquery(result, record storage.Record, objectType, subquery string, allRows bool) error {
+	fromMatch := subqueryFromPattern.FindStringSubmatchIndex(subquery)
+	if fromMatch == nil {
+		return fmt.Errorf("invalid SOQL: missing FROM clause in subquery")
+	}
+	relName := subquery[fromMatch[2]:fromMatch[3]]
+
+	relationship, err := e.resolveChildRelationship(objectType, relName)
+	if err != nil {
+		return err
+	}
+
+	// Query the child object in place of the relationship name
+	childQuery := subquery[:fromMatch[2]] + relationship.ChildSObject + subquery[fromMatch[3]:]
+	id, _ := record["Id"].(string)
+	children, more, err := e.execute(childQuery, &childScope{field: relationship.Field, parentID: id}, allRows)
+	if err != nil {
+		return err
+	}
+
+	if len(children) == 0 {
+		result[relationship.RelationshipName] = nil
+		return nil
+	}
+	result[relationship.RelationshipName] = &SubqueryResult{
+		TotalSize: len(children),
+		Done:      !more,
+		Records:   children,
+	}
+	return nil
+}
+
+// resolveChildRelationship finds the child relationship named relName on objectType
+func (e *Engine) resolveChildRelationship(objectType, relName string) (*storage.ChildRelationship, error) {
+	description, err := e.store.DescribeSObject(objectType)
+	if err != nil {
+		return nil, err
+	}
+	for i := range description.ChildRelationships {
+		if strings.EqualFold(description.ChildRelationships[i].RelationshipName, relName) {
+			return &description.ChildRelationships[i], nil
+		}
+	}
+	return nil, fmt.Errorf("didn't understand relationship '%s' in FROM part of query call", relName)
+}
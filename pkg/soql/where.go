@@ -0,0 +1,195 @@
+package soql
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// whereExpr is a node of a parsed WHERE clause: either an AND/OR of its
+// children, the NOT of its only child or a single comparison
+type whereExpr struct {
+	op       string
+	children []*whereExpr
+	cond     *condition
+}
+
+// parseWhere parses a WHERE clause into an expression tree. OR binds looser
+// than AND, which binds looser than NOT, and parentheses group as in SOQL.
+// Comparisons the engine does not understand fail the query.
+func parseWhere(clause string) (*whereExpr, error) {
+	clause = strings.TrimSpace(clause)
+	if err := checkParens(clause); err != nil {
+		return nil, err
+	}
+
+	for {
+		inner, ok := stripOuterParens(clause)
+		if !ok {
+			break
+		}
+		clause = inner
+	}
+
+	for _, op := range []string{"OR", "AND"} {
+		parts := splitTopLevel(clause, op)
+		if len(parts) < 2 {
+			continue
+		}
+		expr := &whereExpr{op: op}
+		for _, part := range parts {
+			child, err := parseWhere(part)
+			if err != nil {
+				return nil, err
+			}
+			expr.children = append(expr.children, child)
+		}
+		return expr, nil
+	}
+
+	if isKeywordAt(clause, 0, "NOT") {
+		child, err := parseWhere(clause[len("NOT"):])
+		if err != nil {
+			return nil, err
+		}
+		return &whereExpr{op: "NOT", children: []*whereExpr{child}}, nil
+	}
+
+	if cond, ok := parseCondition(clause); ok {
+		return &whereExpr{cond: &cond}, nil
+	}
+	if clause == "" {
+		return nil, fmt.Errorf("unexpected end of WHERE clause")
+	}
+	return nil, fmt.Errorf("unexpected token: '%s'", clause)
+}
+
+// matches evaluates the expression against a record
+func (x *whereExpr) matches(e *Engine, record storage.Record, objectType string) bool {
+	switch x.op {
+	case "AND":
+		for _, child := range x.children {
+			if !child.matches(e, record, objectType) {
+				return false
+			}
+		}
+		return true
+	case "OR":
+		for _, child := range x.children {
+			if child.matches(e, record, objectType) {
+				return true
+			}
+		}
+		return false
+	case "NOT":
+		return !x.children[0].matches(e, record, objectType)
+	}
+	return e.matchesCondition(record, objectType, *x.cond)
+}
+
+// conditions returns every comparison in the expression
+func (x *whereExpr) conditions() []condition {
+	if x.cond != nil {
+		return []condition{*x.cond}
+	}
+	var result []condition
+	for _, child := range x.children {
+		result = append(result, child.conditions()...)
+	}
+	return result
+}
+
+// checkParens reports unbalanced parentheses outside string literals
+func checkParens(clause string) error {
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(clause); i++ {
+		switch c := clause[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '\'':
+			inQuote = !inQuote
+		case c == '(' && !inQuote:
+			depth++
+		case c == ')' && !inQuote:
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("unexpected token: ')'")
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("unbalanced parentheses in WHERE clause")
+	}
+	return nil
+}
+
+// stripOuterParens removes a pair of parentheses wrapping the whole clause
+func stripOuterParens(clause string) (string, bool) {
+	if !strings.HasPrefix(clause, "(") || !strings.HasSuffix(clause, ")") {
+		return clause, false
+	}
+	depth := 0
+	inQuote := false
+	for i := 0; i < len(clause); i++ {
+		switch c := clause[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '\'':
+			inQuote = !inQuote
+		case c == '(' && !inQuote:
+			depth++
+		case c == ')' && !inQuote:
+			depth--
+			if depth == 0 && i < len(clause)-1 {
+				return clause, false
+			}
+		}
+	}
+	return strings.TrimSpace(clause[1 : len(clause)-1]), true
+}
+
+// splitTopLevel splits clause on the keyword op where it appears outside
+// parentheses and string literals
+func splitTopLevel(clause, op string) []string {
+	var parts []string
+	depth := 0
+	inQuote := false
+	start := 0
+	for i := 0; i < len(clause); i++ {
+		switch c := clause[i]; {
+		case c == '\\' && inQuote:
+			i++
+		case c == '\'':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && isKeywordAt(clause, i, op):
+			parts = append(parts, strings.TrimSpace(clause[start:i]))
+			i += len(op) - 1
+			start = i + 1
+		}
+	}
+	return append(parts, strings.TrimSpace(clause[start:]))
+}
+
+// isKeywordAt reports whether keyword starts at clause[i] as a whole word
+func isKeywordAt(clause string, i int, keyword string) bool {
+	end := i + len(keyword)
+	if end > len(clause) || !strings.EqualFold(clause[i:end], keyword) {
+		return false
+	}
+	if i > 0 && !isSpaceOrParen(clause[i-1]) {
+		return false
+	}
+	return end == len(clause) || isSpaceOrParen(clause[end])
+}
+
+func isSpaceOrParen(c byte) bool {
+	return c == '(' || c == ')' || unicode.IsSpace(rune(c))
+}
@@ -0,0 +1,191 @@
+// Package sosl implements SOSL search. Matching records are projected
+// through the SOQL engine, so RETURNING field lists behave like SELECT lists.
+package sosl
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/soql"
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+)
+
+// Engine executes SOSL searches against a Store
+type Engine struct {
+	store storage.Store
+	soql  *soql.Engine
+}
+
+// NewEngine creates a SOSL engine over store
+func NewEngine(store storage.Store, apiVersion string) *Engine {
+	return &Engine{
+		store: store,
+		soql:  soql.NewEngine(store, apiVersion),
+	}
+}
+
+var (
+	findPattern = regexp.MustCompile(`(?is)^\s*FIND\s+\{([^}]*)\}` +
+		`(?:\s+IN\s+(ALL|NAME|EMAIL|PHONE)\s+FIELDS)?` +
+		`(?:\s+RETURNING\s+(.+?))?` +
+		`(?:\s+LIMIT\s+(\d+))?\s*$`)
+	returningPattern = regexp.MustCompile(`^(\w+)\s*(?:\(([^)]*)\))?$`)
+)
+
+// target is an object of the RETURNING clause with its field list
+type target struct {
+	objectType string
+	fields     string
+}
+
+// Search runs a SOSL search such as
+// FIND {Acme} IN NAME FIELDS RETURNING Account(Id, Name), Contact
+// The term matches any part of a searched field, ignoring case. Without
+// RETURNING every object holding user data is searched and only Ids are
+// returned. Records are grouped by object in RETURNING order.
+func (e *Engine) Search(search string) ([]storage.Record, error) {
+	match := findPattern.FindStringSubmatch(search)
+	if match == nil {
+		return nil, fmt.Errorf("invalid SOSL search: %s", search)
+	}
+
+	term := strings.ToLower(strings.Trim(strings.TrimSpace(match[1]), `"*`))
+	if len(term) < 2 {
+		return nil, fmt.Errorf("search term must be longer than one character: %s", match[1])
+	}
+	scope := strings.ToUpper(match[2])
+	if scope == "" {
+		scope = "ALL"
+	}
+
+	targets, err := e.targets(match[3])
+	if err != nil {
+		return nil, err
+	}
+
+	records := []storage.Record{}
+	for _, t := range targets {
+		found, err := e.searchObject(t, term, scope)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+
+	if match[4] != "" {
+		limit, _ := strconv.Atoi(match[4])
+		if len(records) > limit {
+			records = records[:limit]
+		}
+	}
+	return records, nil
+}
+
+// targets parses the RETURNING clause, or lists every searchable object
+// when there is none
+func (e *Engine) targets(returning string) ([]target, error) {
+	if strings.TrimSpace(returning) == "" {
+		var targets []target
+		for _, objectType := range e.store.GetSObjectList() {
+			description, err := e.store.DescribeSObject(objectType)
+			// Only objects holding user data are indexed for search
+			if err == nil && description.Createable && description.Queryable {
+				targets = append(targets, target{objectType: objectType, fields: "Id"})
+			}
+		}
+		return targets, nil
+	}
+
+	var targets []target
+	for _, part := range splitReturning(returning) {
+		m := returningPattern.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, fmt.Errorf("invalid RETURNING clause: %s", strings.TrimSpace(part))
+		}
+		fields := strings.TrimSpace(m[2])
+		if fields == "" {
+			fields = "Id"
+		}
+		targets = append(targets, target{objectType: m[1], fields: fields})
+	}
+	return targets, nil
+}
+
+// splitReturning splits a RETURNING clause on the commas between objects,
+// leaving those inside field lists alone
+func splitReturning(returning string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, c := range returning {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, returning[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, returning[start:])
+}
+
+// searchObject returns the records of one object whose scoped fields
+// contain term, projected to the target's fields
+func (e *Engine) searchObject(t target, term, scope string) ([]storage.Record, error) {
+	description, err := e.store.DescribeSObject(t.objectType)
+	if err != nil {
+		return nil, fmt.Errorf("sObject type '%s' is not supported", t.objectType)
+	}
+	records, err := e.store.GetAllRecords(t.objectType)
+	if err != nil {
+		return nil, err
+	}
+
+	var searched []string
+	for _, field := range description.Fields {
+		if inScope(field, scope) {
+			searched = append(searched, field.Name)
+		}
+	}
+
+	var ids []string
+	for _, record := range records {
+		for _, name := range searched {
+			if value, ok := record[name].(string); ok && strings.Contains(strings.ToLower(value), term) {
+				id, _ := record["Id"].(string)
+				ids = append(ids, "'"+id+"'")
+				break
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return e.soql.Query(fmt.Sprintf("SELECT %s FROM %s WHERE Id IN (%s)", t.fields, t.objectType, strings.Join(ids, ", ")))
+}
+
+// inScope reports whether an IN ... FIELDS scope searches field
+func inScope(field storage.FieldDefinition, scope string) bool {
+	switch scope {
+	case "NAME":
+		return field.Type == storage.FieldTypeString &&
+			(field.Name == "Name" || field.Name == "FirstName" || field.Name == "LastName")
+	case "EMAIL":
+		return field.Type == storage.FieldTypeEmail
+	case "PHONE":
+		return field.Type == storage.FieldTypePhone
+	}
+
+	switch field.Type {
+	case storage.FieldTypeString, storage.FieldTypeTextArea, storage.FieldTypeLongTextArea,
+		storage.FieldTypeRichTextArea, storage.FieldTypeEmail, storage.FieldTypePhone, storage.FieldTypeURL:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package storage
+
+// DefaultDailyAPIRequestLimit is how many API requests are allowed by
+// default, matching the DailyApiRequests Max GetLimits has always reported
+const DefaultDailyAPIRequestLimit = 100000
+
+// SetDailyAPIRequestLimit sets how many API requests ConsumeAPIRequest
+// allows. 0 restores DefaultDailyAPIRequestLimit.
+func (s *MemoryStore) SetDailyAPIRequestLimit(max int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if max <= 0 {
+		max = DefaultDailyAPIRequestLimit
+	}
+	s.apiRequestLimit = max
+}
+
+// SetAPIRequestsUsed sets how many API requests ConsumeAPIRequest has
+// counted, for stores that keep the count across restarts
+func (s *MemoryStore) SetAPIRequestsUsed(used int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiRequestsUsed = used
+}
+
+// ConsumeAPIRequest counts one API request against the daily limit. It
+// returns the requests used and the limit, and ok is false if the limit was
+// already reached, in which case the request is not counted.
+func (s *MemoryStore) ConsumeAPIRequest() (used, max int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.apiRequestsUsed >= s.apiRequestLimit {
+		return s.apiRequestsUsed, s.apiRequestLimit, false
+	}
+	s.apiRequestsUsed++
+	return s.apiRequestsUsed, s.apiRequestLimit, true
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/internal/idgen"
+)
+
+// ApprovalProcess is an approval process registered for an object. Only what
+// describe/approvalLayouts reports is modeled; approvals are not executed.
+type ApprovalProcess struct {
+	Name  string
+	Label string
+
+	// Fields are shown on the approval page layout, in order
+	Fields []string
+}
+
+// ApprovalLayout describes the approval page layout of one approval process
+type ApprovalLayout struct {
+	ID          string               `json:"id"`
+	Label       string               `json:"label"`
+	LayoutItems []ApprovalLayoutItem `json:"layoutItems"`
+	Name        string               `json:"name"`
+}
+
+// ApprovalLayoutItem is a field on an approval page layout
+type ApprovalLayoutItem struct {
+	EditableForNew    bool              `json:"editableForNew"`
+	EditableForUpdate bool              `json:"editableForUpdate"`
+	Label             string            `json:"label"`
+	LayoutComponents  []LayoutComponent `json:"layoutComponents"`
+	Placeholder       bool              `json:"placeholder"`
+	Required          bool              `json:"required"`
+}
+
+// LayoutComponent is the field component of a layout item
+type LayoutComponent struct {
+	DisplayLines int    `json:"displayLines"`
+	TabOrder     int    `json:"tabOrder"`
+	Type         string `json:"type"`
+	Value        string `json:"value"`
+}
+
+// RegisterApprovalProcess registers an approval process on an object so it
+// is reported by describe/approvalLayouts
+func (s *MemoryStore) RegisterApprovalProcess(objectType string, process ApprovalProcess) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	layout := ApprovalLayout{
+		ID:          idgen.NewGeneratorWithPrefix("04a").Generate(),
+		Label:       process.Label,
+		LayoutItems: make([]ApprovalLayoutItem, 0, len(process.Fields)),
+		Name:        process.Name,
+	}
+	for i, name := range process.Fields {
+		item := ApprovalLayoutItem{
+			Label:            name,
+			LayoutComponents: []LayoutComponent{{DisplayLines: 1, TabOrder: i + 1, Type: "Field", Value: name}},
+		}
+		for _, field := range schema.Fields {
+			if field.Name == name {
+				item.Label = field.Label
+				item.Required = !field.Nillable && field.Createable
+				break
+			}
+		}
+		layout.LayoutItems = append(layout.LayoutItems, item)
+	}
+
+	s.approvalLayouts[objectType] = append(s.approvalLayouts[objectType], layout)
+	return nil
+}
+
+// ApprovalLayouts returns the approval layouts registered for an object,
+// optionally limited to the process named processName
+func (s *MemoryStore) ApprovalLayouts(objectType, processName string) ([]ApprovalLayout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.schemas[objectType]; !ok {
+		return nil, fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	layouts := make([]ApprovalLayout, 0, len(s.approvalLayouts[objectType]))
+	for _, layout := range s.approvalLayouts[objectType] {
+		if processName == "" || layout.Name == processName {
+			layouts = append(layouts, layout)
+		}
+	}
+	return layouts, nil
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultAutoNumberFormat is the display format of auto-number fields that
+// do not set one, and of the standard CaseNumber, OrderNumber and
+// ContractNumber fields
+const DefaultAutoNumberFormat = "{00000000}"
+
+// autoNumberToken matches the placeholders of a display format: {0...} for
+// the zero-padded sequence number and {YY}, {YYYY}, {MM} and {DD} for the
+// creation date
+var autoNumberToken = regexp.MustCompile(`\{(0+|YYYY|YY|MM|DD)\}`)
+
+// formatAutoNumber renders the number n with format, e.g. A-{0000} gives
+// A-0042 for 42
+func formatAutoNumber(format string, n int64, now time.Time) string {
+	if format == "" {
+		format = DefaultAutoNumberFormat
+	}
+	return autoNumberToken.ReplaceAllStringFunc(format, func(token string) string {
+		token = strings.Trim(token, "{}")
+		switch token {
+		case "YYYY":
+			return now.Format("2006")
+		case "YY":
+			return now.Format("06")
+		case "MM":
+			return now.Format("01")
+		case "DD":
+			return now.Format("02")
+		}
+		return fmt.Sprintf("%0*d", len(token), n)
+	})
+}
+
+// assignAutoNumbers sets each auto-number field of a new record to the next
+// number of the field's sequence, overwriting any value written to it.
+// Callers must hold s.mu.
+func (s *MemoryStore) assignAutoNumbers(schema SObjectDefinition, record Record, now time.Time) {
+	for _, field := range schema.Fields {
+		if !field.AutoNumber {
+			continue
+		}
+		key := schema.Name + "." + field.Name
+		s.autoNumbers[key]++
+		record[field.Name] = formatAutoNumber(field.DisplayFormat, s.autoNumbers[key], now)
+	}
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// blobSizeFields are the fields reporting the size of an object's body
+var blobSizeFields = map[string]string{
+	"ContentVersion": "ContentSize",
+	"Attachment":     "BodyLength",
+}
+
+// storeBlobs moves the base64 field values of record into the blob store,
+// leaving the URL the body is downloaded from in their place, as Salesforce
+// returns it. Callers must hold s.mu.
+func (s *MemoryStore) storeBlobs(schema SObjectDefinition, recordID string, record Record) error {
+	decoded := map[string][]byte{}
+	for _, field := range schema.Fields {
+		value, ok := record[field.Name].(string)
+		if field.Type != FieldTypeBase64 || !ok || value == "" {
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return sferrors.SalesforceError{
+				Message:   fmt.Sprintf("%s: value not of required type: invalid base64", field.Label),
+				ErrorCode: sferrors.ErrorCodeInvalidField,
+				Fields:    []string{field.Name},
+			}
+		}
+		decoded[field.Name] = data
+	}
+
+	for name, data := range decoded {
+		if s.blobs[recordID] == nil {
+			s.blobs[recordID] = make(map[string][]byte)
+		}
+		s.blobs[recordID][name] = data
+		record[name] = fmt.Sprintf("/services/data/v58.0/sobjects/%s/%s/%s", schema.Name, recordID, name)
+		if sizeField, ok := blobSizeFields[schema.Name]; ok {
+			record[sizeField] = len(data)
+		}
+	}
+	return nil
+}
+
+// GetBlob returns the raw bytes stored in a base64 field of a record, such
+// as ContentVersion.VersionData or Attachment.Body
+func (s *MemoryStore) GetBlob(objectType, recordID, field string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return nil, fmt.Errorf("object type not found: %s", objectType)
+	}
+	record, ok := s.records[objectType][recordID]
+	if isDeleted, _ := record["IsDeleted"].(bool); !ok || isDeleted {
+		return nil, fmt.Errorf("record not found: %s", recordID)
+	}
+	for _, f := range schema.Fields {
+		if f.Name == field && f.Type == FieldTypeBase64 {
+			data, ok := s.blobs[recordID][field]
+			if !ok {
+				return nil, fmt.Errorf("record not found: %s", recordID)
+			}
+			return append([]byte(nil), data...), nil
+		}
+	}
+	return nil, sferrors.NewInvalidFieldError(field, objectType)
+}
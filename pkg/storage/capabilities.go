@@ -0,0 +1,66 @@
+package storage
+
+// longTextLength is the longest text area that can still be filtered,
+// sorted and grouped
+const longTextLength = 255
+
+// isLongText reports whether the field is a long or rich text area
+func (f FieldDefinition) isLongText() bool {
+	switch f.Type {
+	case FieldTypeLongTextArea, FieldTypeRichTextArea:
+		return true
+	case FieldTypeTextArea:
+		return f.Length > longTextLength
+	}
+	return false
+}
+
+// isStructured reports whether the field holds a value SOQL cannot compare
+func (f FieldDefinition) isStructured() bool {
+	switch f.Type {
+	case FieldTypeBase64, FieldTypeAddress, FieldTypeLocation:
+		return true
+	}
+	return false
+}
+
+// IsFilterable reports whether the field can be used in a WHERE clause
+func (f FieldDefinition) IsFilterable() bool {
+	if f.Filterable != nil {
+		return *f.Filterable
+	}
+	return !f.isLongText() && !f.isStructured()
+}
+
+// IsSortable reports whether the field can be used in ORDER BY
+func (f FieldDefinition) IsSortable() bool {
+	if f.Sortable != nil {
+		return *f.Sortable
+	}
+	return !f.isLongText() && !f.isStructured() && f.Type != FieldTypeMultiPicklist
+}
+
+// IsGroupable reports whether the field can be used in GROUP BY
+func (f FieldDefinition) IsGroupable() bool {
+	if f.Groupable != nil {
+		return *f.Groupable
+	}
+	switch f.Type {
+	case FieldTypeDouble, FieldTypeCurrency, FieldTypePercent, FieldTypeDatetime, FieldTypeMultiPicklist:
+		return false
+	}
+	return !f.isLongText() && !f.isStructured()
+}
+
+// IsAggregatable reports whether the field can be passed to an aggregate
+// function such as MAX or COUNT
+func (f FieldDefinition) IsAggregatable() bool {
+	if f.Aggregatable != nil {
+		return *f.Aggregatable
+	}
+	switch f.Type {
+	case FieldTypeBoolean, FieldTypeMultiPicklist:
+		return false
+	}
+	return !f.isLongText() && !f.isStructured()
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// checkRestrictedDelete fails with DELETE_FAILED if a live record refers to
+// record, or to one of the records its deletion would cascade to, through a
+// relationship with RestrictedDelete. Callers must hold s.mu.
+func (s *MemoryStore) checkRestrictedDelete(objectType string, record Record) error {
+	recordID, _ := record["Id"].(string)
+	for _, rel := range s.childRelationships(objectType) {
+		if !rel.CascadeDelete && !rel.RestrictedDelete {
+			continue
+		}
+		for _, id := range s.recordOrder[rel.ChildSObject] {
+			child := s.records[rel.ChildSObject][id]
+			if child == nil || child[rel.Field] != recordID {
+				continue
+			}
+			if _, deleted := s.deletions[rel.ChildSObject][id]; deleted {
+				continue
+			}
+
+			if rel.CascadeDelete {
+				if err := s.checkRestrictedDelete(rel.ChildSObject, child); err != nil {
+					return err
+				}
+				continue
+			}
+			name, _ := record["Name"].(string)
+			if name == "" {
+				name = recordID
+			}
+			return sferrors.SalesforceError{
+				Message: fmt.Sprintf("Your attempt to delete %s could not be completed because it is associated with the following %s.: %s",
+					name, s.schemas[rel.ChildSObject].LabelPlural, id),
+				ErrorCode: sferrors.ErrorCodeDeleteFailed,
+			}
+		}
+	}
+	return nil
+}
+
+// cascadeDelete soft-deletes the records that reference a deleted record
+// through a relationship with CascadeDelete, and their own cascade children
+// in turn. Each is marked as deleted along with recordID so undeleting it
+// restores them. Callers must hold s.mu.
+func (s *MemoryStore) cascadeDelete(objectType, recordID, userID string, now time.Time) {
+	for _, rel := range s.childRelationships(objectType) {
+		if !rel.CascadeDelete {
+			continue
+		}
+		for _, id := range s.recordOrder[rel.ChildSObject] {
+			child := s.records[rel.ChildSObject][id]
+			if child == nil || child[rel.Field] != recordID {
+				continue
+			}
+			if _, deleted := s.deletions[rel.ChildSObject][id]; deleted {
+				continue
+			}
+
+			previous := child.Clone()
+			s.markDeleted(rel.ChildSObject, child, userID, now)
+			deletion := s.deletions[rel.ChildSObject][id]
+			deletion.CascadedFrom = recordID
+			deletion.previous = previous
+			s.deletions[rel.ChildSObject][id] = deletion
+			s.recordOperation(OperationDelete, rel.ChildSObject, id, userID, now)
+			s.recordChange(ChangeTypeDelete, rel.ChildSObject, id, userID, nil, nil, now)
+			s.cascadeDelete(rel.ChildSObject, id, userID, now)
+		}
+	}
+}
+
+// cascadeUndelete restores the records deleted along with recordID, and
+// those deleted along with them. Callers must hold s.mu.
+func (s *MemoryStore) cascadeUndelete(recordID, userID string, now time.Time) {
+	s.eachDeletedWith(recordID, func(objectType, id string, _ DeletedRecord) {
+		if record := s.records[objectType][id]; record != nil {
+			s.markUndeleted(objectType, record, userID, now)
+			s.cascadeUndelete(id, userID, now)
+		}
+	})
+}
+
+// restoreCascaded takes the records deleted along with recordID, and those
+// deleted along with them, back out of the recycle bin as they were before,
+// as RestoreRecord does for recordID itself. Callers must hold s.mu.
+func (s *MemoryStore) restoreCascaded(recordID string) {
+	s.eachDeletedWith(recordID, func(objectType, id string, deletion DeletedRecord) {
+		if deletion.previous != nil {
+			s.records[objectType][id] = deletion.previous
+		} else if record := s.records[objectType][id]; record != nil {
+			record["IsDeleted"] = false
+		}
+		s.markChanged(objectType, id)
+		delete(s.deletions[objectType], id)
+		s.restoreCascaded(id)
+	})
+}
+
+// eachDeletedWith calls fn for each record whose deletion cascaded from
+// recordID, in a deterministic order. Callers must hold s.mu.
+func (s *MemoryStore) eachDeletedWith(recordID string, fn func(objectType, id string, deletion DeletedRecord)) {
+	objectTypes := make([]string, 0, len(s.deletions))
+	for objectType := range s.deletions {
+		objectTypes = append(objectTypes, objectType)
+	}
+	sort.Strings(objectTypes)
+
+	for _, objectType := range objectTypes {
+		for _, id := range s.recordOrder[objectType] {
+			deletion, ok := s.deletions[objectType][id]
+			if ok && deletion.CascadedFrom == recordID {
+				fn(objectType, id, deletion)
+			}
+		}
+	}
+}
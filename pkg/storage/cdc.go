@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Change Data Capture change types
+const (
+	ChangeTypeCreate   = "CREATE"
+	ChangeTypeUpdate   = "UPDATE"
+	ChangeTypeDelete   = "DELETE"
+	ChangeTypeUndelete = "UNDELETE"
+)
+
+// ChangeEventHeader describes the write a change event reports
+type ChangeEventHeader struct {
+	EntityName      string   `json:"entityName"`
+	RecordIDs       []string `json:"recordIds"`
+	ChangeType      string   `json:"changeType"`
+	ChangeOrigin    string   `json:"changeOrigin"`
+	TransactionKey  string   `json:"transactionKey"`
+	SequenceNumber  int      `json:"sequenceNumber"`
+	CommitTimestamp int64    `json:"commitTimestamp"`
+	CommitNumber    int64    `json:"commitNumber"`
+	CommitUser      string   `json:"commitUser"`
+	ChangedFields   []string `json:"changedFields"`
+}
+
+// ChangeEvent is a Change Data Capture event: the header and the values of
+// the fields the write set
+type ChangeEvent struct {
+	Header ChangeEventHeader
+	Fields Record
+}
+
+// ChangeEventName returns the change event entity of objectType, e.g.
+// AccountChangeEvent or Invoice__ChangeEvent
+func ChangeEventName(objectType string) string {
+	if strings.HasSuffix(objectType, "__c") {
+		return strings.TrimSuffix(objectType, "__c") + "__ChangeEvent"
+	}
+	return objectType + "ChangeEvent"
+}
+
+// EnableChangeDataCapture records a change event for every create, update,
+// delete and undelete of the given objects, and publishes it to the event
+// publisher. Objects may be registered later.
+func (s *MemoryStore) EnableChangeDataCapture(objectTypes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, objectType := range objectTypes {
+		s.cdcObjects[objectType] = true
+	}
+}
+
+// ChangeEvents returns the change events recorded since the store was
+// created or reset, oldest first
+func (s *MemoryStore) ChangeEvents() []ChangeEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]ChangeEvent(nil), s.changeEvents...)
+}
+
+// recordChange records and publishes the change event of a write by userID
+// to a record of a CDC-enabled object. Callers must hold s.mu.
+func (s *MemoryStore) recordChange(changeType, objectType, recordID, userID string, previous, current Record, now time.Time) {
+	if !s.cdcObjects[objectType] {
+		return
+	}
+
+	fields := Record{}
+	changed := []string{}
+	switch changeType {
+	case ChangeTypeCreate:
+		for name, value := range current {
+			if value != nil && !isChangeEventExcluded(name) {
+				fields[name] = cloneValue(value)
+			}
+		}
+	case ChangeTypeUpdate:
+		for name, value := range current {
+			if isChangeEventExcluded(name) || fmt.Sprintf("%v", previous[name]) == fmt.Sprintf("%v", value) {
+				continue
+			}
+			fields[name] = cloneValue(value)
+			changed = append(changed, name)
+		}
+		sort.Strings(changed)
+	}
+
+	s.commitNumber++
+	event := ChangeEvent{
+		Header: ChangeEventHeader{
+			EntityName:      objectType,
+			RecordIDs:       []string{recordID},
+			ChangeType:      changeType,
+			ChangeOrigin:    "com/salesforce/api/rest/58.0",
+			TransactionKey:  newUUID(),
+			SequenceNumber:  1,
+			CommitTimestamp: now.UnixMilli(),
+			CommitNumber:    s.commitNumber,
+			CommitUser:      userID,
+			ChangedFields:   changed,
+		},
+		Fields: fields,
+	}
+	s.changeEvents = append(s.changeEvents, event)
+
+	if s.eventPublisher != nil {
+		payload := fields.Clone()
+		payload["ChangeEventHeader"] = event.Header
+		s.eventPublisher(ChangeEventName(objectType), payload)
+	}
+}
+
+// isChangeEventExcluded reports whether a field is left out of change
+// events
+func isChangeEventExcluded(name string) bool {
+	return name == "Id" || name == "attributes" || name == "IsDeleted" || name == "SystemModstamp"
+}
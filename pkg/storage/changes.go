@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// recordKey identifies a record by object type and ID
+type recordKey struct {
+	objectType string
+	id         string
+}
+
+// RecordChange is a record created, changed or removed since changes were
+// last taken
+type RecordChange struct {
+	// Tooling is set for records of Tooling API objects
+	Tooling    bool
+	ObjectType string
+	ID         string
+
+	// Data is the record's JSON form, or nil if the record was removed
+	Data json.RawMessage
+}
+
+// Changes is what a store keeping a MemoryStore in a database needs to save
+// after a write
+type Changes struct {
+	// State is the store as Snapshot serializes it, without the records
+	State []byte
+
+	// Replaced is set when every record was replaced, as by Reset or
+	// Restore. Records then lists every record, and records saved before
+	// are stale.
+	Replaced bool
+
+	Records []RecordChange
+}
+
+// TrackChanges makes the store remember which records each write touches,
+// so a store that saves it to a database can save just those records with
+// TakeChanges. The first TakeChanges returns every record.
+func (s *MemoryStore) TrackChanges() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.startTracking()
+
+	if s.tooling != nil {
+		s.tooling.mu.Lock()
+		defer s.tooling.mu.Unlock()
+		s.tooling.startTracking()
+	}
+}
+
+// TakeChanges returns the records written since changes were last taken,
+// along with the rest of the store's state, and forgets them
+func (s *MemoryStore) TakeChanges() (*Changes, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.snapshot(false)
+	replaced := s.replaced
+	if s.tooling != nil {
+		s.tooling.mu.Lock()
+		defer s.tooling.mu.Unlock()
+		snapshot.Tooling = s.tooling.snapshot(false)
+		replaced = replaced || s.tooling.replaced
+	}
+
+	state, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	changes := &Changes{State: state, Replaced: replaced}
+	if changes.Records, err = s.takeRecordChanges(false, replaced); err != nil {
+		return nil, err
+	}
+	if s.tooling != nil {
+		records, err := s.tooling.takeRecordChanges(true, replaced)
+		if err != nil {
+			return nil, err
+		}
+		changes.Records = append(changes.Records, records...)
+	}
+	return changes, nil
+}
+
+// startTracking starts remembering written records, with every record
+// counted as changed. Callers must hold s.mu.
+func (s *MemoryStore) startTracking() {
+	s.changed = make(map[recordKey]bool)
+	s.changeOrder = nil
+	s.replaced = true
+}
+
+// markChanged remembers that a record was written, if changes are tracked.
+// Callers must hold s.mu.
+func (s *MemoryStore) markChanged(objectType, id string) {
+	if s.changed == nil {
+		return
+	}
+	key := recordKey{objectType: objectType, id: id}
+	if !s.changed[key] {
+		s.changed[key] = true
+		s.changeOrder = append(s.changeOrder, key)
+	}
+}
+
+// clearRecords removes every record of objectType. Callers must hold s.mu.
+func (s *MemoryStore) clearRecords(objectType string) {
+	for _, id := range s.recordOrder[objectType] {
+		s.markChanged(objectType, id)
+	}
+	s.records[objectType] = make(map[string]Record)
+	s.recordOrder[objectType] = nil
+}
+
+// takeRecordChanges serializes the records written since changes were last
+// taken, or every record if all is set, and forgets them. Callers must hold
+// s.mu.
+func (s *MemoryStore) takeRecordChanges(tooling, all bool) ([]RecordChange, error) {
+	keys := s.changeOrder
+	if all {
+		objectTypes := make([]string, 0, len(s.recordOrder))
+		for objectType := range s.recordOrder {
+			objectTypes = append(objectTypes, objectType)
+		}
+		sort.Strings(objectTypes)
+
+		keys = nil
+		for _, objectType := range objectTypes {
+			for _, id := range s.recordOrder[objectType] {
+				keys = append(keys, recordKey{objectType: objectType, id: id})
+			}
+		}
+	}
+
+	changes := make([]RecordChange, 0, len(keys))
+	for _, key := range keys {
+		change := RecordChange{Tooling: tooling, ObjectType: key.objectType, ID: key.id}
+		if record, ok := s.records[key.objectType][key.id]; ok {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return nil, err
+			}
+			change.Data = data
+		}
+		changes = append(changes, change)
+	}
+
+	if s.changed != nil {
+		s.startTracking()
+		s.replaced = false
+	}
+	return changes, nil
+}
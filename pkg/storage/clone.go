@@ -0,0 +1,40 @@
+package storage
+
+// Clone returns a deep copy of the record, so changes to the copy or to any
+// nested map or slice never reach the original
+func (r Record) Clone() Record {
+	if r == nil {
+		return nil
+	}
+	clone := make(Record, len(r))
+	for k, v := range r {
+		clone[k] = cloneValue(v)
+	}
+	return clone
+}
+
+// cloneValue deep-copies the map and slice values that records hold
+func cloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Record:
+		return val.Clone()
+	case map[string]interface{}:
+		return map[string]interface{}(Record(val).Clone())
+	case []interface{}:
+		clone := make([]interface{}, len(val))
+		for i, item := range val {
+			clone[i] = cloneValue(item)
+		}
+		return clone
+	case []Record:
+		clone := make([]Record, len(val))
+		for i, item := range val {
+			clone[i] = item.Clone()
+		}
+		return clone
+	case []string:
+		return append([]string(nil), val...)
+	default:
+		return v
+	}
+}
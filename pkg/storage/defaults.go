@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarshalJSON reports empty formulas, compound field names and controller
+// names as null, as Salesforce describe does, along with the resolved SOQL
+// capabilities
+func (f FieldDefinition) MarshalJSON() ([]byte, error) {
+	type fieldDefinition FieldDefinition
+	return json.Marshal(struct {
+		fieldDefinition
+		DefaultValueFormula *string `json:"defaultValueFormula"`
+		CalculatedFormula   *string `json:"calculatedFormula"`
+		CompoundFieldName   *string `json:"compoundFieldName"`
+		ControllerName      *string `json:"controllerName"`
+		Filterable          bool    `json:"filterable"`
+		Sortable            bool    `json:"sortable"`
+		Groupable           bool    `json:"groupable"`
+		Aggregatable        bool    `json:"aggregatable"`
+	}{
+		fieldDefinition:     fieldDefinition(f),
+		DefaultValueFormula: nullableString(f.DefaultValueFormula),
+		CalculatedFormula:   nullableString(f.CalculatedFormula),
+		CompoundFieldName:   nullableString(f.CompoundFieldName),
+		ControllerName:      nullableString(f.ControllerName),
+		Filterable:          f.IsFilterable(),
+		Sortable:            f.IsSortable(),
+		Groupable:           f.IsGroupable(),
+		Aggregatable:        f.IsAggregatable(),
+	})
+}
+
+func nullableString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// defaultPicklistValue returns the picklist value marked as the default
+func (f FieldDefinition) defaultPicklistValue() (string, bool) {
+	for _, pv := range f.PicklistValues {
+		if pv.DefaultValue && pv.Active {
+			return pv.Value, true
+		}
+	}
+	return "", false
+}
+
+// hasDefault reports whether the field is populated on create when omitted
+func (f FieldDefinition) hasDefault() bool {
+	if f.DefaultValue != nil || f.DefaultValueFormula != "" {
+		return true
+	}
+	_, ok := f.defaultPicklistValue()
+	return ok
+}
+
+// describeFields returns a copy of fields with DefaultedOnCreate derived
+// from the configured defaults
+func describeFields(fields []FieldDefinition) []FieldDefinition {
+	described := make([]FieldDefinition, len(fields))
+	for i, field := range fields {
+		field.DefaultedOnCreate = field.DefaultedOnCreate || field.hasDefault()
+		described[i] = field
+	}
+	return described
+}
+
+// applyDefaults populates omitted fields with their default values, in the
+// same order of precedence describe advertises them
+func applyDefaults(schema SObjectDefinition, record Record) {
+	for _, field := range schema.Fields {
+		if _, ok := record[field.Name]; ok || field.Calculated {
+			continue
+		}
+
+		if field.DefaultValue != nil {
+			record[field.Name] = field.DefaultValue
+		} else if field.DefaultValueFormula != "" {
+			if value, ok := evaluateDefaultFormula(field.DefaultValueFormula, field.Type); ok {
+				record[field.Name] = value
+			}
+		} else if value, ok := field.defaultPicklistValue(); ok {
+			record[field.Name] = value
+		}
+	}
+}
+
+// evaluateDefaultFormula evaluates the simple formulas used for defaults:
+// literals, TODAY() and NOW(). Other formulas are not supported.
+func evaluateDefaultFormula(formula string, fieldType FieldType) (interface{}, bool) {
+	formula = strings.TrimSpace(formula)
+	upper := strings.ToUpper(formula)
+
+	switch {
+	case upper == "TODAY()":
+		return time.Now().UTC().Format("2006-01-02"), true
+	case upper == "NOW()":
+		return time.Now().UTC().Format(time.RFC3339), true
+	case upper == "TRUE" || upper == "FALSE":
+		return upper == "TRUE", true
+	case len(formula) >= 2 && (formula[0] == '\'' || formula[0] == '"') && formula[len(formula)-1] == formula[0]:
+		return formula[1 : len(formula)-1], true
+	}
+
+	if n, err := strconv.ParseFloat(formula, 64); err == nil {
+		if fieldType == FieldTypeInteger {
+			return int(n), true
+		}
+		return n, true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// ExternalIDMatches returns the IDs of the records whose field equals value,
+// the records an upsert on that external ID would update. Values compare
+// case-insensitively unless the field is CaseSensitive; Ids always compare
+// exactly.
+func ExternalIDMatches(records []Record, field FieldDefinition, value string) []string {
+	exact := field.CaseSensitive || field.Name == "Id"
+	var ids []string
+	for _, record := range records {
+		v := record[field.Name]
+		if v == nil {
+			continue
+		}
+		if s := fmt.Sprint(v); s == value || (!exact && strings.EqualFold(s, value)) {
+			id, _ := record["Id"].(string)
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// UpsertRecordAs updates the record whose external ID field matches value
+// as the User userID, or creates one with the field set to value if none
+// does. Matching and writing happen under one lock, so concurrent upserts
+// of a new value create a single record. Several matches fail with
+// MULTIPLE_CHOICES and nothing is written.
+func (s *MemoryStore) UpsertRecordAs(userID, objectType, field, value string, record Record) (id string, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return "", false, fmt.Errorf("object type not found: %s", objectType)
+	}
+	var definition FieldDefinition
+	for _, f := range schema.Fields {
+		if f.Name == field {
+			definition = f
+		}
+	}
+	if definition.Name == "" || (field != "Id" && !definition.ExternalId) {
+		return "", false, sferrors.NewNotFoundError(objectType, field)
+	}
+
+	ids := ExternalIDMatches(s.allRecords(objectType, false), definition, value)
+	switch len(ids) {
+	case 0:
+		// Ids are assigned by the store, so an unknown one cannot be created
+		if field == "Id" {
+			return "", false, sferrors.NewNotFoundError(objectType, value)
+		}
+		record = record.Clone()
+		if record == nil {
+			record = make(Record)
+		}
+		if _, ok := record[field]; !ok {
+			record[field] = value
+		}
+		id, err = s.createRecord(userID, objectType, record)
+		return id, err == nil, err
+	case 1:
+		return ids[0], false, s.updateRecord(userID, objectType, ids[0], record)
+	default:
+		return "", false, sferrors.NewMultipleChoicesError(field, ids)
+	}
+}
@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// evaluateFormulas sets each formula field of record to its
+// CalculatedFormula evaluated over the record's other fields. Formulas that
+// fail to parse or evaluate, e.g. on division by zero, give null.
+func evaluateFormulas(schema SObjectDefinition, record Record) {
+	for _, field := range schema.Fields {
+		if !field.Calculated || field.CalculatedFormula == "" {
+			continue
+		}
+		value, err := evaluateFormula(field.CalculatedFormula, schema, record)
+		if err != nil {
+			record[field.Name] = nil
+			continue
+		}
+		record[field.Name] = formulaResult(field, value)
+	}
+}
+
+// evaluateFormula evaluates a formula of number and string literals, field
+// references, parentheses, the arithmetic operators + - * / and the string
+// concatenation operator &. + concatenates when either side is a string.
+func evaluateFormula(formula string, schema SObjectDefinition, record Record) (interface{}, error) {
+	p := &formulaParser{input: formula, schema: schema, record: record}
+	value, err := p.concat()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q in formula", p.input[p.pos:])
+	}
+	return value, nil
+}
+
+// formulaResult converts an evaluated value to the field's type
+func formulaResult(field FieldDefinition, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	switch field.Type {
+	case FieldTypeInteger:
+		if n, ok := value.(float64); ok {
+			return int(math.Round(n))
+		}
+	case FieldTypeDouble, FieldTypeCurrency, FieldTypePercent:
+		if n, ok := value.(float64); ok && field.Scale > 0 {
+			factor := math.Pow10(field.Scale)
+			return math.Round(n*factor) / factor
+		}
+	case FieldTypeString, FieldTypeTextArea:
+		return formulaString(value)
+	}
+	return value
+}
+
+// formulaParser is a recursive descent parser that evaluates as it parses
+type formulaParser struct {
+	input  string
+	pos    int
+	schema SObjectDefinition
+	record Record
+}
+
+// concat parses additive expressions joined by &
+func (p *formulaParser) concat() (interface{}, error) {
+	left, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume('&') {
+		right, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		left = formulaString(left) + formulaString(right)
+	}
+	return left, nil
+}
+
+// additive parses terms joined by + and -
+func (p *formulaParser) additive() (interface{}, error) {
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.consume('+'):
+			op = '+'
+		case p.consume('-'):
+			op = '-'
+		default:
+			return left, nil
+		}
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		_, leftString := left.(string)
+		_, rightString := right.(string)
+		if op == '+' && (leftString || rightString) {
+			left = formulaString(left) + formulaString(right)
+			continue
+		}
+		left, err = arithmetic(op, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// term parses unary expressions joined by * and /
+func (p *formulaParser) term() (interface{}, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var op byte
+		switch {
+		case p.consume('*'):
+			op = '*'
+		case p.consume('/'):
+			op = '/'
+		default:
+			return left, nil
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left, err = arithmetic(op, left, right)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *formulaParser) unary() (interface{}, error) {
+	if p.consume('-') {
+		value, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return arithmetic('-', 0.0, value)
+	}
+	return p.primary()
+}
+
+// primary parses a literal, field reference or parenthesized expression
+func (p *formulaParser) primary() (interface{}, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of formula")
+	}
+
+	c := p.input[p.pos]
+	switch {
+	case c == '(':
+		p.pos++
+		value, err := p.concat()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(')') {
+			return nil, fmt.Errorf("missing ) in formula")
+		}
+		return value, nil
+	case c == '\'' || c == '"':
+		end := strings.IndexByte(p.input[p.pos+1:], c)
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string in formula")
+		}
+		value := p.input[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.') {
+			p.pos++
+		}
+		return strconv.ParseFloat(p.input[start:p.pos], 64)
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		name := p.input[start:p.pos]
+		switch strings.ToUpper(name) {
+		case "TRUE":
+			return true, nil
+		case "FALSE":
+			return false, nil
+		case "NULL":
+			return nil, nil
+		}
+		return p.field(name), nil
+	}
+	return nil, fmt.Errorf("unexpected %q in formula", c)
+}
+
+// field returns the value of a field reference. Number fields written as
+// strings are read as numbers.
+func (p *formulaParser) field(name string) interface{} {
+	value := formulaValue(p.record[name])
+	s, ok := value.(string)
+	if !ok {
+		return value
+	}
+	for _, field := range p.schema.Fields {
+		if field.Name != name {
+			continue
+		}
+		switch field.Type {
+		case FieldTypeInteger, FieldTypeDouble, FieldTypeCurrency, FieldTypePercent:
+			if s == "" {
+				return nil
+			}
+			if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return n
+			}
+		}
+	}
+	return value
+}
+
+// consume skips c, and any space before it, if it is next
+func (p *formulaParser) consume(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.input) && p.input[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *formulaParser) skipSpace() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// arithmetic applies op to two numbers. Blank operands and division by zero
+// give null, as blank fields do in Salesforce formulas.
+func arithmetic(op byte, left, right interface{}) (interface{}, error) {
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	a, ok := left.(float64)
+	b, ok2 := right.(float64)
+	if !ok || !ok2 {
+		return nil, fmt.Errorf("incorrect operand types for %c", op)
+	}
+	switch op {
+	case '+':
+		return a + b, nil
+	case '-':
+		return a - b, nil
+	case '*':
+		return a * b, nil
+	}
+	if b == 0 {
+		return nil, nil
+	}
+	return a / b, nil
+}
+
+// formulaValue converts a record value for use in a formula, with numbers
+// as float64
+func formulaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case json.Number:
+		if n, err := v.Float64(); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// formulaString renders a value for string concatenation, with null as
+// the empty string
+func formulaString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
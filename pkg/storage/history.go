@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// historyObjectName returns the history object that tracks objectType, e.g.
+// AccountHistory or Invoice__History
+func historyObjectName(objectType string) string {
+	if strings.HasSuffix(objectType, "__c") {
+		return strings.TrimSuffix(objectType, "__c") + "__History"
+	}
+	return objectType + "History"
+}
+
+// historyParentField returns the history field that references the changed
+// record: AccountId on AccountHistory, ParentId on custom object history
+func historyParentField(objectType string) string {
+	if strings.HasSuffix(objectType, "__c") {
+		return "ParentId"
+	}
+	return objectType + "Id"
+}
+
+// EnableFieldHistory tracks changes to fields of objectType. Each update that
+// changes a tracked field adds an entry to the object's history object, which
+// is registered, with a key prefix of its own, the first time tracking is
+// enabled.
+func (s *MemoryStore) EnableFieldHistory(objectType string, fields ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	historyObject := historyObjectName(objectType)
+	if _, ok := s.schemas[historyObject]; !ok {
+		parentField := historyParentField(objectType)
+		s.schemas[historyObject] = SObjectDefinition{
+			Name:        historyObject,
+			Label:       schema.Label + " History",
+			LabelPlural: schema.Label + " History",
+			KeyPrefix:   s.prefixes.Assign(historyObject),
+			Custom:      false,
+			Queryable:   true,
+			Fields: []FieldDefinition{
+				{Name: "Id", Label: "History ID", Type: FieldTypeID, Nillable: false},
+				{Name: parentField, Label: schema.Label + " ID", Type: FieldTypeReference, Nillable: false, ReferenceTo: []string{objectType}, RelationshipName: strings.TrimSuffix(parentField, "Id"), ChildRelationshipName: "Histories"},
+				{Name: "Field", Label: "Changed Field", Type: FieldTypePicklist, Nillable: false},
+				{Name: "OldValue", Label: "Old Value", Type: FieldTypeString, Nillable: true},
+				{Name: "NewValue", Label: "New Value", Type: FieldTypeString, Nillable: true},
+				{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false},
+				{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, ReferenceTo: []string{"User"}},
+				{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false},
+			},
+		}
+		s.records[historyObject] = make(map[string]Record)
+		delete(s.idGenerators, historyObject)
+	}
+
+	if s.trackedFields[objectType] == nil {
+		s.trackedFields[objectType] = make(map[string]bool)
+	}
+	for _, field := range fields {
+		s.trackedFields[objectType][field] = true
+	}
+
+	return nil
+}
+
+// recordFieldHistory adds a history entry for each tracked field whose value
+// differs between previous and current. Callers must hold s.mu.
+func (s *MemoryStore) recordFieldHistory(objectType, recordID string, previous, current Record, userID, now string) {
+	tracked := s.trackedFields[objectType]
+	if len(tracked) == 0 {
+		return
+	}
+
+	fields := make([]string, 0, len(tracked))
+	for field := range tracked {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	historyObject := historyObjectName(objectType)
+	gen := s.getIDGenerator(historyObject)
+	for _, field := range fields {
+		oldValue, newValue := previous[field], current[field]
+		if fmt.Sprintf("%v", oldValue) == fmt.Sprintf("%v", newValue) {
+			continue
+		}
+
+		id := gen.Generate()
+		s.putRecord(historyObject, id, Record{
+			"Id":                           id,
+			historyParentField(objectType): recordID,
+			"Field":                        field,
+			"OldValue":                     oldValue,
+			"NewValue":                     newValue,
+			"CreatedDate":                  now,
+			"CreatedById":                  userID,
+			"IsDeleted":                    false,
+			"attributes": map[string]interface{}{
+				"type": historyObject,
+				"url":  fmt.Sprintf("/services/data/v58.0/sobjects/%s/%s", historyObject, id),
+			},
+		})
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,6 +16,9 @@ type MemoryStore struct {
 	// SObject data: objectType -> recordID -> Record
 	records map[string]map[string]Record
 
+	// Record IDs in insertion order: objectType -> IDs
+	recordOrder map[string][]string
+
 	// Schema definitions: objectType -> SObjectDefinition
 	schemas map[string]SObjectDefinition
 
@@ -24,29 +28,87 @@ type MemoryStore struct {
 	// ID generators per object type
 	idGenerators map[string]*idgen.Generator
 
+	// Key prefixes per object type, used to generate IDs and resolve them
+	prefixes *idgen.Registry
+
 	// Default user ID for system operations
 	defaultUserID string
+
+	// Most recently viewed records, most recent first
+	recentlyViewed []recentView
+
+	// Opportunity StageName -> default Probability
+	stageProbabilities map[string]float64
+
+	// Approval layouts of registered approval processes: objectType -> layouts
+	approvalLayouts map[string][]ApprovalLayout
+
+	// Recycle bin: objectType -> recordID -> deletion metadata
+	deletions           map[string]map[string]DeletedRecord
+	recycleBinRetention time.Duration
+
+	// Fields with history tracking enabled: objectType -> field -> true
+	trackedFields map[string]map[string]bool
+
+	// The org described by the singleton Organization record
+	org organization
+
+	// Creates, updates and deletes, oldest first, capped at operationLimit
+	operations     []Operation
+	operationLimit int
+	operationIDs   *idgen.Generator
+
+	// Receives published platform and change events
+	eventPublisher func(eventType string, event Record)
+
+	// Change Data Capture: enabled objects and the events recorded
+	cdcObjects   map[string]bool
+	changeEvents []ChangeEvent
+	commitNumber int64
+
+	// Raw bytes of base64 fields: recordID -> field -> data
+	blobs map[string]map[string][]byte
+
+	// Daily API request allowance and usage
+	apiRequestLimit int
+	apiRequestsUsed int
+
+	// Last number assigned to each auto-number field: Object.Field -> number
+	autoNumbers map[string]int64
+
+	// Tooling API objects, kept apart from data objects
+	tooling *MemoryStore
+
+	// IDs of rows derived from the schema: objectType:key -> ID
+	derivedIDs map[string]string
+
+	// Records written since changes were last taken, in the order they were
+	// first written, and whether every record was replaced since. Only
+	// tracked once TrackChanges is called.
+	changed     map[recordKey]bool
+	changeOrder []recordKey
+	replaced    bool
 }
 
 // NewMemoryStore creates a new in-memory store with standard objects registered
 func NewMemoryStore() *MemoryStore {
-	store := &MemoryStore{
-		records:      make(map[string]map[string]Record),
-		schemas:      make(map[string]SObjectDefinition),
-		bulkJobs:     make(map[string]*BulkJob),
-		idGenerators: make(map[string]*idgen.Generator),
-	}
+	store := newMemoryStore()
+	store.SetStageProbabilities(DefaultStageProbabilities)
 
 	// Register standard Salesforce objects
 	for _, obj := range StandardSObjects {
+		_ = store.prefixes.Register(obj.Name, obj.KeyPrefix)
 		store.schemas[obj.Name] = obj
 		store.records[obj.Name] = make(map[string]Record)
 	}
 
+	store.seedOrganization()
+	profileID := store.seedProfiles()
+
 	// Create a default user
 	userGen := store.getIDGenerator("User")
 	store.defaultUserID = userGen.Generate()
-	store.records["User"][store.defaultUserID] = Record{
+	store.putRecord("User", store.defaultUserID, Record{
 		"Id":               store.defaultUserID,
 		"Username":         "admin@example.com",
 		"FirstName":        "System",
@@ -55,6 +117,7 @@ func NewMemoryStore() *MemoryStore {
 		"Email":            "admin@example.com",
 		"Alias":            "admin",
 		"IsActive":         true,
+		"ProfileId":        profileID,
 		"CreatedDate":      time.Now().UTC().Format(time.RFC3339),
 		"LastModifiedDate": time.Now().UTC().Format(time.RFC3339),
 		"SystemModstamp":   time.Now().UTC().Format(time.RFC3339),
@@ -62,30 +125,130 @@ func NewMemoryStore() *MemoryStore {
 			"type": "User",
 			"url":  fmt.Sprintf("/services/data/v58.0/sobjects/User/%s", store.defaultUserID),
 		},
-	}
+	})
+
+	store.tooling = newToolingStore(store.defaultUserID)
 
 	return store
 }
 
+// newMemoryStore creates an empty store with no objects registered
+func newMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		records:             make(map[string]map[string]Record),
+		recordOrder:         make(map[string][]string),
+		schemas:             make(map[string]SObjectDefinition),
+		bulkJobs:            make(map[string]*BulkJob),
+		idGenerators:        make(map[string]*idgen.Generator),
+		prefixes:            idgen.NewRegistry(),
+		approvalLayouts:     make(map[string][]ApprovalLayout),
+		trackedFields:       make(map[string]map[string]bool),
+		deletions:           make(map[string]map[string]DeletedRecord),
+		blobs:               make(map[string]map[string][]byte),
+		cdcObjects:          make(map[string]bool),
+		org:                 organization{id: DefaultOrgID, name: DefaultOrgName},
+		operationLimit:      DefaultOperationLogLimit,
+		recycleBinRetention: DefaultRecycleBinRetention,
+		apiRequestLimit:     DefaultDailyAPIRequestLimit,
+		derivedIDs:          make(map[string]string),
+		autoNumbers:         make(map[string]int64),
+	}
+}
+
 func (s *MemoryStore) getIDGenerator(objectType string) *idgen.Generator {
 	if gen, ok := s.idGenerators[objectType]; ok {
 		return gen
 	}
-	gen := idgen.NewGenerator(objectType)
+	gen := idgen.NewGeneratorWithPrefix(s.prefixes.Assign(objectType))
 	s.idGenerators[objectType] = gen
 	return gen
 }
 
-// CreateRecord creates a new record
+// RestoreRecord puts a record back exactly as previous, a copy read before
+// a write, undoing the write without recording it. A nil previous removes a
+// created record entirely, and restoring a deleted record also restores the
+// records its deletion cascaded to. Composite graphs and all-or-none
+// collections use it to roll back.
+func (s *MemoryStore) RestoreRecord(objectType, recordID string, previous Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schemas[objectType]; !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+	_, wasDeleted := s.deletions[objectType][recordID]
+
+	if previous == nil {
+		delete(s.records[objectType], recordID)
+		delete(s.blobs, recordID)
+		s.markChanged(objectType, recordID)
+		order := s.recordOrder[objectType][:0]
+		for _, id := range s.recordOrder[objectType] {
+			if id != recordID {
+				order = append(order, id)
+			}
+		}
+		s.recordOrder[objectType] = order
+	} else {
+		s.putRecord(objectType, recordID, previous.Clone())
+	}
+
+	if isDeleted, _ := previous["IsDeleted"].(bool); !isDeleted {
+		delete(s.deletions[objectType], recordID)
+		if previous != nil && wasDeleted {
+			s.restoreCascaded(recordID)
+		}
+	}
+	return nil
+}
+
+// putRecord stores a new record, remembering its insertion order so
+// GetAllRecords is deterministic. Callers must hold s.mu.
+func (s *MemoryStore) putRecord(objectType, id string, record Record) {
+	if s.records[objectType] == nil {
+		s.records[objectType] = make(map[string]Record)
+	}
+	if _, ok := s.records[objectType][id]; !ok {
+		s.recordOrder[objectType] = append(s.recordOrder[objectType], id)
+	}
+	s.records[objectType][id] = record
+	s.markChanged(objectType, id)
+}
+
+// CreateRecord creates a new record as the default user
 func (s *MemoryStore) CreateRecord(objectType string, record Record) (string, error) {
+	return s.CreateRecordAs("", objectType, record)
+}
+
+// CreateRecordAs creates a new record as the User userID, who becomes its
+// CreatedById and LastModifiedById. An empty userID means the default user.
+func (s *MemoryStore) CreateRecordAs(userID, objectType string, record Record) (string, error) {
+	// Platform events are published rather than stored
+	if IsPlatformEvent(objectType) {
+		return s.publishEvent(userID, objectType, record)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.createRecord(userID, objectType, record)
+}
+
+// createRecord creates a record as CreateRecordAs does. Callers must hold
+// s.mu.
+func (s *MemoryStore) createRecord(userID, objectType string, record Record) (string, error) {
+	userID = s.actingUser(userID)
 
 	// Check if object type exists
-	if _, ok := s.schemas[objectType]; !ok {
+	schema, ok := s.schemas[objectType]
+	if !ok {
 		return "", fmt.Errorf("object type not found: %s", objectType)
 	}
 
+	// The org has exactly one Organization record
+	if objectType == OrganizationObject {
+		return "", fmt.Errorf("cannot create %s records", objectType)
+	}
+
 	// Generate ID
 	gen := s.getIDGenerator(objectType)
 	id := gen.Generate()
@@ -97,17 +260,40 @@ func (s *MemoryStore) CreateRecord(objectType string, record Record) (string, er
 
 	// Create a copy of the record with system fields
 	now := time.Now().UTC().Format(time.RFC3339)
-	newRecord := make(Record)
-	for k, v := range record {
-		newRecord[k] = v
+	newRecord := record.Clone()
+	if newRecord == nil {
+		newRecord = make(Record)
+	}
+	normalizeBooleans(schema, newRecord)
+	if err := validateRecord(schema, newRecord); err != nil {
+		return "", err
+	}
+	if err := applyNumericScale(schema, newRecord); err != nil {
+		return "", err
+	}
+	applyDefaults(schema, newRecord)
+	if err := checkRequiredFields(schema, newRecord); err != nil {
+		return "", err
+	}
+	if err := s.checkReferences(schema, newRecord); err != nil {
+		return "", err
+	}
+	if err := checkPicklistDependencies(schema, newRecord); err != nil {
+		return "", err
 	}
+	s.applyStageProbability(objectType, newRecord, record)
+	if err := s.storeBlobs(schema, id, newRecord); err != nil {
+		return "", err
+	}
+
+	s.assignAutoNumbers(schema, newRecord, time.Now().UTC())
 
 	// Set system fields
 	newRecord["Id"] = id
 	newRecord["CreatedDate"] = now
-	newRecord["CreatedById"] = s.defaultUserID
+	newRecord["CreatedById"] = userID
 	newRecord["LastModifiedDate"] = now
-	newRecord["LastModifiedById"] = s.defaultUserID
+	newRecord["LastModifiedById"] = userID
 	newRecord["SystemModstamp"] = now
 	newRecord["IsDeleted"] = false
 
@@ -130,7 +316,9 @@ func (s *MemoryStore) CreateRecord(objectType string, record Record) (string, er
 		}
 	}
 
-	s.records[objectType][id] = newRecord
+	s.putRecord(objectType, id, newRecord)
+	s.recordOperation(OperationCreate, objectType, id, userID, time.Now().UTC())
+	s.recordChange(ChangeTypeCreate, objectType, id, userID, nil, newRecord, time.Now().UTC())
 
 	return id, nil
 }
@@ -140,7 +328,8 @@ func (s *MemoryStore) GetRecord(objectType, recordID string) (Record, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	if _, ok := s.schemas[objectType]; !ok {
+	schema, ok := s.schemas[objectType]
+	if !ok {
 		return nil, fmt.Errorf("object type not found: %s", objectType)
 	}
 
@@ -159,15 +348,32 @@ func (s *MemoryStore) GetRecord(objectType, recordID string) (Record, error) {
 		return nil, fmt.Errorf("record not found: %s", recordID)
 	}
 
+	// Callers get a copy so they cannot change the stored record
+	record = record.Clone()
+	evaluateFormulas(schema, record)
 	return record, nil
 }
 
-// UpdateRecord updates an existing record
+// UpdateRecord updates an existing record as the default user
 func (s *MemoryStore) UpdateRecord(objectType, recordID string, updates Record) error {
+	return s.UpdateRecordAs("", objectType, recordID, updates)
+}
+
+// UpdateRecordAs updates an existing record as the User userID, who becomes
+// its LastModifiedById. An empty userID means the default user.
+func (s *MemoryStore) UpdateRecordAs(userID, objectType, recordID string, updates Record) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.updateRecord(userID, objectType, recordID, updates)
+}
 
-	if _, ok := s.schemas[objectType]; !ok {
+// updateRecord updates a record as UpdateRecordAs does. Callers must hold
+// s.mu.
+func (s *MemoryStore) updateRecord(userID, objectType, recordID string, updates Record) error {
+	userID = s.actingUser(userID)
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
 		return fmt.Errorf("object type not found: %s", objectType)
 	}
 
@@ -186,6 +392,36 @@ func (s *MemoryStore) UpdateRecord(objectType, recordID string, updates Record)
 		return fmt.Errorf("record not found: %s", recordID)
 	}
 
+	// Validate the updates before any are applied
+	updates = updates.Clone()
+	if err := validateRecord(schema, updates); err != nil {
+		return err
+	}
+	if err := applyNumericScale(schema, updates); err != nil {
+		return err
+	}
+	if err := checkRequiredUpdates(schema, updates); err != nil {
+		return err
+	}
+	if err := s.checkReferences(schema, updates); err != nil {
+		return err
+	}
+	merged := record.Clone()
+	for k, v := range updates {
+		merged[k] = v
+	}
+	if err := checkPicklistDependencies(schema, merged); err != nil {
+		return err
+	}
+	if err := s.storeBlobs(schema, recordID, updates); err != nil {
+		return err
+	}
+
+	previous := make(Record, len(record))
+	for k, v := range record {
+		previous[k] = v
+	}
+
 	// Apply updates
 	now := time.Now().UTC().Format(time.RFC3339)
 	for k, v := range updates {
@@ -193,12 +429,14 @@ func (s *MemoryStore) UpdateRecord(objectType, recordID string, updates Record)
 		if k == "Id" || k == "CreatedDate" || k == "CreatedById" || k == "IsDeleted" || k == "attributes" {
 			continue
 		}
-		record[k] = v
+		record[k] = cloneValue(v)
 	}
+	normalizeBooleans(schema, record)
+	s.applyStageProbability(objectType, record, updates)
 
 	// Update system fields
 	record["LastModifiedDate"] = now
-	record["LastModifiedById"] = s.defaultUserID
+	record["LastModifiedById"] = userID
 	record["SystemModstamp"] = now
 
 	// Update Name field for Contact/Lead/User
@@ -214,16 +452,28 @@ func (s *MemoryStore) UpdateRecord(objectType, recordID string, updates Record)
 		}
 	}
 
+	s.recordFieldHistory(objectType, recordID, previous, record, userID, now)
 	s.records[objectType][recordID] = record
+	s.markChanged(objectType, recordID)
+	s.recordOperation(OperationUpdate, objectType, recordID, userID, time.Now().UTC())
+	s.recordChange(ChangeTypeUpdate, objectType, recordID, userID, previous, record, time.Now().UTC())
 
 	return nil
 }
 
 // DeleteRecord deletes a record (soft delete)
 func (s *MemoryStore) DeleteRecord(objectType, recordID string) error {
+	return s.DeleteRecordAs("", objectType, recordID)
+}
+
+// DeleteRecordAs deletes a record (soft delete) as the User userID, who is
+// recorded as having deleted it. An empty userID means the default user.
+func (s *MemoryStore) DeleteRecordAs(userID, objectType, recordID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	userID = s.actingUser(userID)
+
 	if _, ok := s.schemas[objectType]; !ok {
 		return fmt.Errorf("object type not found: %s", objectType)
 	}
@@ -238,14 +488,25 @@ func (s *MemoryStore) DeleteRecord(objectType, recordID string) error {
 		return fmt.Errorf("record not found: %s", recordID)
 	}
 
-	// Soft delete
-	now := time.Now().UTC().Format(time.RFC3339)
-	record["IsDeleted"] = true
-	record["LastModifiedDate"] = now
-	record["LastModifiedById"] = s.defaultUserID
-	record["SystemModstamp"] = now
+	if objectType == OrganizationObject {
+		return fmt.Errorf("cannot delete %s records", objectType)
+	}
 
-	s.records[objectType][recordID] = record
+	// Deleted records stay in the recycle bin until undeleted
+	if _, deleted := s.deletions[objectType][recordID]; deleted {
+		return fmt.Errorf("record not found: %s", recordID)
+	}
+
+	if err := s.checkRestrictedDelete(objectType, record); err != nil {
+		return err
+	}
+
+	// Soft delete
+	now := time.Now().UTC()
+	s.markDeleted(objectType, record, userID, now)
+	s.recordOperation(OperationDelete, objectType, recordID, userID, now)
+	s.recordChange(ChangeTypeDelete, objectType, recordID, userID, nil, nil, now)
+	s.cascadeDelete(objectType, recordID, userID, now)
 
 	return nil
 }
@@ -259,21 +520,35 @@ func (s *MemoryStore) GetAllRecords(objectType string) ([]Record, error) {
 		return nil, fmt.Errorf("object type not found: %s", objectType)
 	}
 
-	records, ok := s.records[objectType]
-	if !ok {
-		return []Record{}, nil
+	if objectType == RecentlyViewedObject {
+		return s.recentlyViewedRecords(), nil
+	}
+	if objectType == OperationLogObject {
+		return s.operationLogRecords(), nil
 	}
 
+	return s.allRecords(objectType, false), nil
+}
+
+// allRecords returns copies of the records of a type in insertion order,
+// with formula fields evaluated, skipping soft-deleted and archived ones
+// unless includeDeleted is set. Callers must hold s.mu.
+func (s *MemoryStore) allRecords(objectType string, includeDeleted bool) []Record {
+	schema := s.schemas[objectType]
+	records := s.records[objectType]
 	result := make([]Record, 0, len(records))
-	for _, record := range records {
-		// Skip deleted records
-		if isDeleted, ok := record["IsDeleted"].(bool); ok && isDeleted {
+	for _, id := range s.recordOrder[objectType] {
+		record := records[id]
+		isDeleted, _ := record["IsDeleted"].(bool)
+		isArchived, _ := record["IsArchived"].(bool)
+		if (isDeleted || isArchived) && !includeDeleted {
 			continue
 		}
+		record = record.Clone()
+		evaluateFormulas(schema, record)
 		result = append(result, record)
 	}
-
-	return result, nil
+	return result
 }
 
 // CreateRecords creates multiple records
@@ -358,11 +633,21 @@ func (s *MemoryStore) DeleteRecords(objectType string, recordIDs []string) ([]De
 	return results, nil
 }
 
-// RegisterSObject registers a custom SObject definition
+// RegisterSObject registers a custom SObject definition. An explicit
+// KeyPrefix overrides the object's prefix; otherwise a unique one is assigned.
 func (s *MemoryStore) RegisterSObject(definition SObjectDefinition) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if definition.KeyPrefix != "" {
+		if err := s.prefixes.Register(definition.Name, definition.KeyPrefix); err != nil {
+			return err
+		}
+	} else {
+		definition.KeyPrefix = s.prefixes.Assign(definition.Name)
+	}
+	delete(s.idGenerators, definition.Name)
+
 	s.schemas[definition.Name] = definition
 	if s.records[definition.Name] == nil {
 		s.records[definition.Name] = make(map[string]Record)
@@ -371,6 +656,111 @@ func (s *MemoryStore) RegisterSObject(definition SObjectDefinition) error {
 	return nil
 }
 
+// AddField adds a field, such as a custom field, to a registered object.
+// Writes to fields an object does not define are rejected.
+func (s *MemoryStore) AddField(objectType string, field FieldDefinition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+	for _, existing := range schema.Fields {
+		if existing.Name == field.Name {
+			return fmt.Errorf("field already exists: %s.%s", objectType, field.Name)
+		}
+	}
+
+	// The standard schemas are shared, so extend a copy of the fields
+	fields := make([]FieldDefinition, len(schema.Fields), len(schema.Fields)+1)
+	copy(fields, schema.Fields)
+	schema.Fields = append(fields, field)
+	s.schemas[objectType] = schema
+	return nil
+}
+
+// UpdateField replaces the definition of an existing field
+func (s *MemoryStore) UpdateField(objectType string, field FieldDefinition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+	fields := make([]FieldDefinition, len(schema.Fields))
+	copy(fields, schema.Fields)
+	for i, existing := range fields {
+		if existing.Name == field.Name {
+			fields[i] = field
+			schema.Fields = fields
+			s.schemas[objectType] = schema
+			return nil
+		}
+	}
+	return fmt.Errorf("field not found: %s.%s", objectType, field.Name)
+}
+
+// RemoveField removes a field from an object, along with its values
+func (s *MemoryStore) RemoveField(objectType, fieldName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+	fields := make([]FieldDefinition, 0, len(schema.Fields))
+	for _, existing := range schema.Fields {
+		if existing.Name != fieldName {
+			fields = append(fields, existing)
+		}
+	}
+	if len(fields) == len(schema.Fields) {
+		return fmt.Errorf("field not found: %s.%s", objectType, fieldName)
+	}
+	schema.Fields = fields
+	s.schemas[objectType] = schema
+
+	for id, record := range s.records[objectType] {
+		delete(record, fieldName)
+		s.markChanged(objectType, id)
+	}
+	return nil
+}
+
+// UnregisterSObject removes a custom object and all of its records
+func (s *MemoryStore) UnregisterSObject(objectType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+	if !schema.Custom {
+		return fmt.Errorf("cannot delete standard object: %s", objectType)
+	}
+
+	for id := range s.records[objectType] {
+		delete(s.blobs, id)
+		s.markChanged(objectType, id)
+	}
+	delete(s.schemas, objectType)
+	delete(s.records, objectType)
+	delete(s.recordOrder, objectType)
+	delete(s.deletions, objectType)
+	delete(s.idGenerators, objectType)
+	return nil
+}
+
+// ObjectTypeForID returns the object type whose key prefix starts id, or ""
+// if the prefix is not registered
+func (s *MemoryStore) ObjectTypeForID(id string) string {
+	return s.prefixes.ObjectType(id)
+}
+
 // DescribeSObject returns the description of an SObject
 func (s *MemoryStore) DescribeSObject(objectType string) (*SObjectDescription, error) {
 	s.mu.RLock()
@@ -381,6 +771,9 @@ func (s *MemoryStore) DescribeSObject(objectType string) (*SObjectDescription, e
 		return nil, fmt.Errorf("object type not found: %s", objectType)
 	}
 
+	schema.Fields = describeFields(schema.Fields)
+	schema.ChildRelationships = s.childRelationships(objectType)
+
 	return &SObjectDescription{
 		SObjectDefinition: schema,
 		URLs: map[string]string{
@@ -388,6 +781,9 @@ func (s *MemoryStore) DescribeSObject(objectType string) (*SObjectDescription, e
 			"describe":    fmt.Sprintf("/services/data/v58.0/sobjects/%s/describe", objectType),
 			"rowTemplate": fmt.Sprintf("/services/data/v58.0/sobjects/%s/{ID}", objectType),
 		},
+		NamedLayoutInfos: []NamedLayoutInfo{},
+		ActionOverrides:  []ActionOverride{},
+		SupportedScopes:  []ScopeInfo{},
 	}, nil
 }
 
@@ -451,20 +847,38 @@ func (s *MemoryStore) CreateBulkJob(config BulkJobConfig) (*BulkJob, error) {
 	gen := idgen.NewGeneratorWithPrefix("750") // Bulk job prefix
 	jobID := gen.Generate()
 
+	lineEnding := config.LineEnding
+	if lineEnding == "" {
+		lineEnding = "LF"
+	}
+	columnDelimiter := config.ColumnDelimiter
+	if columnDelimiter == "" {
+		columnDelimiter = "COMMA"
+	}
+
+	jobType, state := "V2Query", JobStateUploadComplete
+	if config.JobType == "V2Ingest" {
+		jobType, state = config.JobType, JobStateOpen
+	}
+
 	job := &BulkJob{
 		ID:                     jobID,
 		Operation:              config.Operation,
 		Object:                 config.Object,
-		State:                  JobStateUploadComplete,
+		State:                  state,
 		ContentType:            config.ContentType,
 		CreatedDate:            time.Now().UTC(),
-		CreatedById:            s.defaultUserID,
+		CreatedById:            s.actingUser(config.CreatedByID),
 		SystemModstamp:         time.Now().UTC(),
 		ConcurrencyMode:        "Parallel",
 		ApiVersion:             58.0,
-		JobType:                "V2Query",
+		JobType:                jobType,
 		NumberRecordsProcessed: 0,
 		Query:                  config.Query,
+		LineEnding:             lineEnding,
+		ColumnDelimiter:        columnDelimiter,
+		ExternalIDFieldName:    config.ExternalIDFieldName,
+		DisableBatchRetry:      config.DisableBatchRetry,
 		Results:                []Record{},
 		ResultLocators:         make(map[string]int),
 	}
@@ -484,7 +898,9 @@ func (s *MemoryStore) GetBulkJob(jobID string) (*BulkJob, error) {
 		return nil, fmt.Errorf("job not found: %s", jobID)
 	}
 
-	return job, nil
+	// Return a snapshot so callers can read it while the job is processed
+	snapshot := *job
+	return &snapshot, nil
 }
 
 // UpdateBulkJobState updates the state of a bulk job
@@ -519,6 +935,51 @@ func (s *MemoryStore) SetBulkJobResults(jobID string, results []Record) error {
 	return nil
 }
 
+// AppendBulkJobData adds uploaded CSV rows to an Open ingest job. Every
+// upload to a job must have the same header.
+func (s *MemoryStore) AppendBulkJobData(jobID string, header []string, rows [][]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.bulkJobs[jobID]
+	if !ok {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+	if job.State != JobStateOpen {
+		return fmt.Errorf("job is not open for uploads: %s", job.State)
+	}
+	if job.Header != nil && strings.Join(job.Header, ",") != strings.Join(header, ",") {
+		return fmt.Errorf("header does not match the job's previous uploads")
+	}
+
+	job.Header = header
+	job.Rows = append(job.Rows, rows...)
+	job.SystemModstamp = time.Now().UTC()
+	return nil
+}
+
+// SetBulkJobRecordResults sets the per-row results of an ingest job and
+// its processed and failed counts
+func (s *MemoryStore) SetBulkJobRecordResults(jobID string, results []BulkRecordResult) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.bulkJobs[jobID]
+	if !ok {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	job.RecordResults = results
+	job.NumberRecordsProcessed = len(results)
+	job.NumberRecordsFailed = 0
+	for _, result := range results {
+		if !result.Success() {
+			job.NumberRecordsFailed++
+		}
+	}
+	return nil
+}
+
 // GetBulkJobResults retrieves paginated results from a bulk job
 func (s *MemoryStore) GetBulkJobResults(jobID string, locator string, maxRecords int) (*BulkJobResults, string, error) {
 	s.mu.Lock()
@@ -575,13 +1036,15 @@ func (s *MemoryStore) DeleteBulkJob(jobID string) error {
 	return nil
 }
 
-// GetLimits returns API limits information
+// GetLimits returns API limits information. DailyApiRequests reports the
+// requests counted by ConsumeAPIRequest.
 func (s *MemoryStore) GetLimits() *LimitsInfo {
+	s.mu.RLock()
+	daily := LimitValue{Max: s.apiRequestLimit, Remaining: s.apiRequestLimit - s.apiRequestsUsed}
+	s.mu.RUnlock()
+
 	return &LimitsInfo{
-		DailyApiRequests: LimitValue{
-			Max:       100000,
-			Remaining: 99000,
-		},
+		DailyApiRequests: daily,
 		DailyAsyncApexExecutions: LimitValue{
 			Max:       250000,
 			Remaining: 250000,
@@ -643,6 +1106,24 @@ func (s *MemoryStore) GetRecordCounts(objectTypes []string) map[string]int {
 	return counts
 }
 
+// Truncate hard-deletes every record of one object type, leaving other
+// objects untouched
+func (s *MemoryStore) Truncate(objectType string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schemas[objectType]; !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	for id := range s.records[objectType] {
+		delete(s.blobs, id)
+	}
+	s.clearRecords(objectType)
+	delete(s.deletions, objectType)
+	return nil
+}
+
 // Reset clears all data from the store
 func (s *MemoryStore) Reset() {
 	s.mu.Lock()
@@ -652,14 +1133,27 @@ func (s *MemoryStore) Reset() {
 	for objType := range s.records {
 		s.records[objType] = make(map[string]Record)
 	}
+	s.recordOrder = make(map[string][]string)
+	s.deletions = make(map[string]map[string]DeletedRecord)
+	s.blobs = make(map[string]map[string][]byte)
 
 	// Clear bulk jobs
 	s.bulkJobs = make(map[string]*BulkJob)
 
+	s.recentlyViewed = nil
+	s.operations = nil
+	s.changeEvents = nil
+	s.apiRequestsUsed = 0
+	s.autoNumbers = make(map[string]int64)
+	s.replaced = true
+
+	s.seedOrganization()
+	profileID := s.seedProfiles()
+
 	// Recreate default user
 	userGen := s.getIDGenerator("User")
 	s.defaultUserID = userGen.Generate()
-	s.records["User"][s.defaultUserID] = Record{
+	s.putRecord("User", s.defaultUserID, Record{
 		"Id":               s.defaultUserID,
 		"Username":         "admin@example.com",
 		"FirstName":        "System",
@@ -668,6 +1162,7 @@ func (s *MemoryStore) Reset() {
 		"Email":            "admin@example.com",
 		"Alias":            "admin",
 		"IsActive":         true,
+		"ProfileId":        profileID,
 		"CreatedDate":      time.Now().UTC().Format(time.RFC3339),
 		"LastModifiedDate": time.Now().UTC().Format(time.RFC3339),
 		"SystemModstamp":   time.Now().UTC().Format(time.RFC3339),
@@ -675,7 +1170,20 @@ func (s *MemoryStore) Reset() {
 			"type": "User",
 			"url":  fmt.Sprintf("/services/data/v58.0/sobjects/User/%s", s.defaultUserID),
 		},
+	})
+
+	if s.tooling != nil {
+		s.tooling.resetTooling(s.defaultUserID)
+	}
+}
+
+// actingUser returns userID, or the default user's ID if it is empty.
+// Callers must hold s.mu.
+func (s *MemoryStore) actingUser(userID string) string {
+	if userID == "" {
+		return s.defaultUserID
 	}
+	return userID
 }
 
 // GetDefaultUserID returns the default system user ID
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// normalizeBooleans converts "true"/"false" strings in boolean fields to
+// bools, so records compare the same however their values were sent
+func normalizeBooleans(schema SObjectDefinition, record Record) {
+	for _, field := range schema.Fields {
+		if field.Type != FieldTypeBoolean {
+			continue
+		}
+		s, ok := record[field.Name].(string)
+		if !ok {
+			continue
+		}
+		if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+			record[field.Name] = b
+		}
+	}
+}
+
+// applyNumericScale rounds number fields with a Precision to their Scale, as
+// Salesforce does on save, and rejects values with more integer digits than
+// Precision - Scale allows. Numbers sent as strings are parsed and stored as
+// numbers; empty strings are left as null.
+func applyNumericScale(schema SObjectDefinition, record Record) error {
+	for _, field := range schema.Fields {
+		if field.Precision == 0 {
+			continue
+		}
+		switch field.Type {
+		case FieldTypeCurrency, FieldTypeDouble, FieldTypePercent:
+		default:
+			continue
+		}
+
+		var value float64
+		switch v := record[field.Name].(type) {
+		case int:
+			value = float64(v)
+		case float64:
+			value = roundToScale(v, field.Scale)
+			record[field.Name] = value
+		case json.Number:
+			n, err := v.Float64()
+			if err != nil {
+				return invalidValue(field, v, "value not of required type")
+			}
+			value = roundToScale(n, field.Scale)
+			record[field.Name] = value
+		case string:
+			if v == "" {
+				continue
+			}
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return invalidValue(field, v, "value not of required type")
+			}
+			value = roundToScale(n, field.Scale)
+			record[field.Name] = value
+		default:
+			continue
+		}
+
+		if math.Abs(value) >= math.Pow10(field.Precision-field.Scale) {
+			return sferrors.SalesforceError{
+				Message:   field.Name + ": value outside of valid range on numeric field: " + strconv.FormatFloat(value, 'g', -1, 64),
+				ErrorCode: sferrors.ErrorCodeFieldIntegrity,
+				Fields:    []string{field.Name},
+			}
+		}
+	}
+	return nil
+}
+
+// roundToScale rounds n to scale decimal places
+func roundToScale(n float64, scale int) float64 {
+	factor := math.Pow10(scale)
+	return math.Round(n*factor) / factor
+}
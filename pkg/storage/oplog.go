@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/internal/idgen"
+)
+
+// OperationLogObject is the virtual object exposing the operation log to
+// SOQL once EnableOperationLogObject has been called
+const OperationLogObject = "OperationLog"
+
+// DefaultOperationLogLimit is how many operations the log keeps by default
+const DefaultOperationLogLimit = 1000
+
+// Operation types recorded in the operation log
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+)
+
+// Operation is a write recorded in the operation log
+type Operation struct {
+	ID         string
+	Type       string
+	ObjectType string
+	RecordID   string
+	Timestamp  time.Time
+	UserID     string
+}
+
+// OperationLog returns the recorded creates, updates and deletes, oldest
+// first. Only the most recent operations up to the log's limit are kept.
+func (s *MemoryStore) OperationLog() []Operation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	log := make([]Operation, len(s.operations))
+	copy(log, s.operations)
+	return log
+}
+
+// ResetOperationLog discards all recorded operations
+func (s *MemoryStore) ResetOperationLog() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.operations = nil
+}
+
+// SetOperationLogLimit sets how many operations the log keeps, dropping the
+// oldest beyond it. A limit of 0 or less disables the log.
+func (s *MemoryStore) SetOperationLogLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit < 0 {
+		limit = 0
+	}
+	s.operationLimit = limit
+	if len(s.operations) > limit {
+		s.operations = append([]Operation(nil), s.operations[len(s.operations)-limit:]...)
+	}
+}
+
+// EnableOperationLogObject registers the OperationLog virtual object so the
+// log can be queried with SOQL, e.g.
+// SELECT COUNT() FROM OperationLog WHERE Operation = 'create' AND SObjectType = 'Account'
+func (s *MemoryStore) EnableOperationLogObject() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schemas[OperationLogObject] = SObjectDefinition{
+		Name:        OperationLogObject,
+		Label:       "Operation Log",
+		LabelPlural: "Operation Log",
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Operation ID", Type: FieldTypeID, Nillable: false},
+			{Name: "Operation", Label: "Operation", Type: FieldTypePicklist, Nillable: false,
+				PicklistValues: []PicklistValue{
+					{Value: OperationCreate, Label: OperationCreate, Active: true},
+					{Value: OperationUpdate, Label: OperationUpdate, Active: true},
+					{Value: OperationDelete, Label: OperationDelete, Active: true},
+				},
+			},
+			{Name: "SObjectType", Label: "Object Type", Type: FieldTypeString, Length: 255, Nillable: false},
+			{Name: "RecordId", Label: "Record ID", Type: FieldTypeString, Length: 18, Nillable: false},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false},
+			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, ReferenceTo: []string{"User"}},
+		},
+	}
+	if s.records[OperationLogObject] == nil {
+		s.records[OperationLogObject] = make(map[string]Record)
+	}
+}
+
+// recordOperation appends a write by userID to the operation log, dropping
+// the oldest entry once the limit is reached. Callers must hold s.mu.
+func (s *MemoryStore) recordOperation(kind, objectType, recordID, userID string, now time.Time) {
+	if s.operationLimit <= 0 || objectType == OperationLogObject {
+		return
+	}
+	if s.operationIDs == nil {
+		s.operationIDs = idgen.NewGeneratorWithPrefix("0Ol")
+	}
+	if len(s.operations) >= s.operationLimit {
+		s.operations = s.operations[len(s.operations)-s.operationLimit+1:]
+	}
+	s.operations = append(s.operations, Operation{
+		ID:         s.operationIDs.Generate(),
+		Type:       kind,
+		ObjectType: objectType,
+		RecordID:   recordID,
+		Timestamp:  now,
+		UserID:     userID,
+	})
+}
+
+// operationLogRecords builds OperationLog records, oldest first. Callers
+// must hold s.mu.
+func (s *MemoryStore) operationLogRecords() []Record {
+	result := make([]Record, 0, len(s.operations))
+	for _, op := range s.operations {
+		result = append(result, Record{
+			"Id":          op.ID,
+			"Operation":   op.Type,
+			"SObjectType": op.ObjectType,
+			"RecordId":    op.RecordID,
+			"CreatedDate": op.Timestamp.Format(time.RFC3339),
+			"CreatedById": op.UserID,
+			"attributes": map[string]interface{}{
+				"type": OperationLogObject,
+				"url":  fmt.Sprintf("/services/data/v58.0/sobjects/%s/%s", OperationLogObject, op.ID),
+			},
+		})
+	}
+	return result
+}
@@ -0,0 +1,46 @@
+package storage
+
+// DefaultStageProbabilities maps the standard Opportunity stages to the
+// Probability Salesforce assigns them
+var DefaultStageProbabilities = map[string]float64{
+	"Prospecting":          10,
+	"Qualification":        10,
+	"Needs Analysis":       20,
+	"Value Proposition":    50,
+	"Id. Decision Makers":  60,
+	"Perception Analysis":  70,
+	"Proposal/Price Quote": 75,
+	"Negotiation/Review":   90,
+	"Closed Won":           100,
+	"Closed Lost":          0,
+}
+
+// SetStageProbabilities replaces the StageName -> Probability mapping used to
+// default Opportunity.Probability
+func (s *MemoryStore) SetStageProbabilities(probabilities map[string]float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stageProbabilities = make(map[string]float64, len(probabilities))
+	for stage, probability := range probabilities {
+		s.stageProbabilities[stage] = probability
+	}
+}
+
+// applyStageProbability defaults Probability from StageName when the stage is
+// set by changes and Probability is not. Callers must hold s.mu.
+func (s *MemoryStore) applyStageProbability(objectType string, record, changes Record) {
+	if objectType != "Opportunity" {
+		return
+	}
+	if _, ok := changes["Probability"]; ok {
+		return
+	}
+	stage, ok := changes["StageName"].(string)
+	if !ok {
+		return
+	}
+	if probability, ok := s.stageProbabilities[stage]; ok {
+		record["Probability"] = probability
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// OrganizationObject is the object holding the org's single record
+const OrganizationObject = "Organization"
+
+// DefaultOrgID is the org ID used unless another is configured
+const DefaultOrgID = "00D000000000000AAA"
+
+// DefaultOrgName is the Organization name used unless another is configured
+const DefaultOrgName = "Salesforce Emulator"
+
+// standardProfiles are the profiles every org starts with; the first is
+// assigned to the default user
+var standardProfiles = []string{"System Administrator", "Standard User", "Read Only"}
+
+// organization is what the Organization record is built from
+type organization struct {
+	id          string
+	name        string
+	instanceURL string
+}
+
+// SetOrganization replaces the Organization record with one for the given
+// org ID, name and instance URL
+func (s *MemoryStore) SetOrganization(id, name, instanceURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.org = organization{id: id, name: name, instanceURL: instanceURL}
+	s.seedOrganization()
+}
+
+// seedOrganization (re)creates the singleton Organization record. Callers
+// must hold s.mu.
+func (s *MemoryStore) seedOrganization() {
+	instanceName := ""
+	if u, err := url.Parse(s.org.instanceURL); err == nil {
+		instanceName = u.Host
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	s.clearRecords(OrganizationObject)
+	s.putRecord(OrganizationObject, s.org.id, Record{
+		"Id":                  s.org.id,
+		"Name":                s.org.name,
+		"InstanceName":        instanceName,
+		"OrganizationType":    "Developer Edition",
+		"IsSandbox":           false,
+		"LanguageLocaleKey":   "en_US",
+		"DefaultLocaleSidKey": "en_US",
+		"TimeZoneSidKey":      "America/Los_Angeles",
+		"CreatedDate":         now,
+		"SystemModstamp":      now,
+		"attributes": map[string]interface{}{
+			"type": OrganizationObject,
+			"url":  fmt.Sprintf("/services/data/v58.0/sobjects/%s/%s", OrganizationObject, s.org.id),
+		},
+	})
+}
+
+// seedProfiles creates the standard profiles and returns the ID of the one
+// the default user gets. Callers must hold s.mu.
+func (s *MemoryStore) seedProfiles() string {
+	now := time.Now().UTC().Format(time.RFC3339)
+	gen := s.getIDGenerator("Profile")
+
+	var adminID string
+	for _, name := range standardProfiles {
+		id := gen.Generate()
+		if adminID == "" {
+			adminID = id
+		}
+		s.putRecord("Profile", id, Record{
+			"Id":             id,
+			"Name":           name,
+			"UserType":       "Standard",
+			"CreatedDate":    now,
+			"SystemModstamp": now,
+			"attributes": map[string]interface{}{
+				"type": "Profile",
+				"url":  fmt.Sprintf("/services/data/v58.0/sobjects/Profile/%s", id),
+			},
+		})
+	}
+	return adminID
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// PicklistDependency makes the values allowed in a dependent picklist depend
+// on the value of its controlling field
+type PicklistDependency struct {
+	ControllingField string
+	DependentField   string
+
+	// ValidFor maps each controlling value to the dependent values allowed
+	// with it. Checkbox controllers use the keys "true" and "false".
+	ValidFor map[string][]string
+}
+
+// RegisterPicklistDependency registers a dependent picklist on an object.
+// Describe reports the dependent field with dependentPicklist and
+// controllerName, and writes with a dependent value not allowed for the
+// controlling value fail.
+func (s *MemoryStore) RegisterPicklistDependency(objectType string, dependency PicklistDependency) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schema, ok := s.schemas[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	controller, dependent := -1, -1
+	for i, field := range schema.Fields {
+		switch field.Name {
+		case dependency.ControllingField:
+			controller = i
+		case dependency.DependentField:
+			dependent = i
+		}
+	}
+	if controller < 0 {
+		return fmt.Errorf("field not found: %s.%s", objectType, dependency.ControllingField)
+	}
+	if dependent < 0 {
+		return fmt.Errorf("field not found: %s.%s", objectType, dependency.DependentField)
+	}
+	if t := schema.Fields[dependent].Type; t != FieldTypePicklist && t != FieldTypeMultiPicklist {
+		return fmt.Errorf("%s.%s is not a picklist", objectType, dependency.DependentField)
+	}
+
+	// The standard schemas are shared, so change a copy of the fields
+	fields := make([]FieldDefinition, len(schema.Fields))
+	copy(fields, schema.Fields)
+	field := &fields[dependent]
+	field.ControllerName = dependency.ControllingField
+	field.DependentPicklist = true
+	field.ValidFor = dependency.ValidFor
+	field.PicklistValues = validForBitmaps(controllerValues(fields[controller]), field.PicklistValues, dependency.ValidFor)
+
+	schema.Fields = fields
+	s.schemas[objectType] = schema
+	return nil
+}
+
+// controllerValues lists the values of a controlling field in the order
+// describe's validFor bitmaps index them
+func controllerValues(field FieldDefinition) []string {
+	if field.Type == FieldTypeBoolean {
+		return []string{"false", "true"}
+	}
+	values := make([]string, len(field.PicklistValues))
+	for i, pv := range field.PicklistValues {
+		values[i] = pv.Value
+	}
+	return values
+}
+
+// validForBitmaps returns a copy of values with validFor set: a base64
+// bitmap with bit i set when the value is allowed for controlling value i
+func validForBitmaps(controlling []string, values []PicklistValue, validFor map[string][]string) []PicklistValue {
+	result := make([]PicklistValue, len(values))
+	for i, pv := range values {
+		bitmap := make([]byte, (len(controlling)+7)/8)
+		for c, value := range controlling {
+			if containsString(validFor[value], pv.Value) {
+				bitmap[c/8] |= 0x80 >> (c % 8)
+			}
+		}
+		pv.ValidFor = base64.StdEncoding.EncodeToString(bitmap)
+		result[i] = pv
+	}
+	return result
+}
+
+// checkPicklistDependencies rejects a record whose dependent picklists hold
+// values not allowed for their controlling field's value
+func checkPicklistDependencies(schema SObjectDefinition, record Record) error {
+	for _, field := range schema.Fields {
+		if !field.DependentPicklist {
+			continue
+		}
+		value, _ := record[field.Name].(string)
+		if value == "" {
+			continue
+		}
+
+		var controlling string
+		if v := record[field.ControllerName]; v != nil {
+			controlling = fmt.Sprint(v)
+		}
+		values := []string{value}
+		if field.Type == FieldTypeMultiPicklist {
+			values = strings.Split(value, ";")
+		}
+		for _, v := range values {
+			if !containsString(field.ValidFor[controlling], v) {
+				return sferrors.SalesforceError{
+					Message:   fmt.Sprintf("%s: bad value for dependent picklist field: %s is not valid when %s is '%s'", field.Name, v, field.ControllerName, controlling),
+					ErrorCode: sferrors.ErrorCodeFieldIntegrity,
+					Fields:    []string{field.Name},
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PlatformEventSuffix ends the API names of platform event objects
+const PlatformEventSuffix = "__e"
+
+// IsPlatformEvent reports whether objectType names a platform event
+func IsPlatformEvent(objectType string) bool {
+	return strings.HasSuffix(objectType, PlatformEventSuffix)
+}
+
+// RegisterPlatformEvent registers the platform event name, such as
+// Order_Event__e, with fields besides the standard ReplayId, EventUuid,
+// CreatedDate and CreatedById. Creating an event publishes it instead of
+// storing a record.
+func (s *MemoryStore) RegisterPlatformEvent(name string, fields ...FieldDefinition) error {
+	if !IsPlatformEvent(name) {
+		return fmt.Errorf("platform event name must end with %s: %s", PlatformEventSuffix, name)
+	}
+
+	label := strings.ReplaceAll(strings.TrimSuffix(name, PlatformEventSuffix), "_", " ")
+	definition := SObjectDefinition{
+		Name:        name,
+		Label:       label,
+		LabelPlural: label,
+		Custom:      true,
+		Createable:  true,
+		Fields: append([]FieldDefinition{
+			{Name: "ReplayId", Label: "Replay ID", Type: FieldTypeString, Length: 255, Nillable: true},
+			{Name: "EventUuid", Label: "Event UUID", Type: FieldTypeString, Length: 36, Nillable: true},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false},
+			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, ReferenceTo: []string{"User"}},
+		}, fields...),
+	}
+	return s.RegisterSObject(definition)
+}
+
+// SetEventPublisher sets the function platform events and change events
+// are published to. Change events are published with the store locked, so
+// it must not call back into the store.
+func (s *MemoryStore) SetEventPublisher(publish func(eventType string, event Record)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eventPublisher = publish
+}
+
+// publishEvent validates a platform event created by userID and hands it to
+// the event publisher, returning its EventUuid. Nothing is stored.
+func (s *MemoryStore) publishEvent(userID, eventType string, fields Record) (string, error) {
+	s.mu.Lock()
+	schema, ok := s.schemas[eventType]
+	if !ok {
+		s.mu.Unlock()
+		return "", fmt.Errorf("object type not found: %s", eventType)
+	}
+	userID = s.actingUser(userID)
+	publish := s.eventPublisher
+	s.mu.Unlock()
+
+	event := fields.Clone()
+	if event == nil {
+		event = make(Record)
+	}
+	delete(event, "attributes")
+	normalizeBooleans(schema, event)
+	if err := validateRecord(schema, event); err != nil {
+		return "", err
+	}
+	if err := checkRequiredFields(schema, event); err != nil {
+		return "", err
+	}
+
+	uuid := newUUID()
+	event["EventUuid"] = uuid
+	event["CreatedDate"] = time.Now().UTC().Format(time.RFC3339)
+	event["CreatedById"] = userID
+	if publish != nil {
+		publish(eventType, event)
+	}
+	return uuid, nil
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
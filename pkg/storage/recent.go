@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+// RecentlyViewedObject is the virtual object exposing the MRU list to SOQL
+const RecentlyViewedObject = "RecentlyViewed"
+
+// maxRecentlyViewed caps the MRU list, matching Salesforce's limit
+const maxRecentlyViewed = 200
+
+// recentView is an entry in the MRU list
+type recentView struct {
+	objectType string
+	recordID   string
+	viewedAt   string
+}
+
+// MarkRecentlyViewed moves a record to the front of the MRU list and stamps
+// its LastViewedDate and LastReferencedDate. Deleted records cannot be
+// viewed.
+func (s *MemoryStore) MarkRecentlyViewed(objectType, recordID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, ok := s.records[objectType]
+	if !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	record, ok := records[recordID]
+	if isDeleted, _ := record["IsDeleted"].(bool); !ok || isDeleted {
+		return fmt.Errorf("record not found: %s", recordID)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	record["LastViewedDate"] = now
+	record["LastReferencedDate"] = now
+	s.markChanged(objectType, recordID)
+
+	views := []recentView{{objectType: objectType, recordID: recordID, viewedAt: now}}
+	for _, view := range s.recentlyViewed {
+		if view.recordID != recordID && len(views) < maxRecentlyViewed {
+			views = append(views, view)
+		}
+	}
+	s.recentlyViewed = views
+
+	return nil
+}
+
+// recentlyViewedRecords builds RecentlyViewed records, most recent first.
+// Callers must hold s.mu.
+func (s *MemoryStore) recentlyViewedRecords() []Record {
+	result := make([]Record, 0, len(s.recentlyViewed))
+	for _, view := range s.recentlyViewed {
+		record, ok := s.records[view.objectType][view.recordID]
+		if !ok {
+			continue
+		}
+		if isDeleted, ok := record["IsDeleted"].(bool); ok && isDeleted {
+			continue
+		}
+
+		name, _ := record["Name"].(string)
+		result = append(result, Record{
+			"Id":                 view.recordID,
+			"Name":               name,
+			"Type":               view.objectType,
+			"LastViewedDate":     view.viewedAt,
+			"LastReferencedDate": view.viewedAt,
+			"attributes": map[string]interface{}{
+				"type": RecentlyViewedObject,
+				"url":  fmt.Sprintf("/services/data/v58.0/sobjects/%s/%s", RecentlyViewedObject, view.recordID),
+			},
+		})
+	}
+	return result
+}
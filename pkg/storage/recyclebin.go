@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultRecycleBinRetention is how long deleted records stay in the
+// recycle bin before PurgeRecycleBin removes them, as in Salesforce
+const DefaultRecycleBinRetention = 15 * 24 * time.Hour
+
+// DeletedRecord is the deletion metadata of a soft-deleted record. It backs
+// getDeleted, queryAll and undelete alike.
+type DeletedRecord struct {
+	ID          string
+	DeletedDate time.Time
+	DeletedByID string
+
+	// CascadedFrom is the ID of the record whose deletion deleted this one
+	CascadedFrom string `json:",omitempty"`
+
+	// previous is the record as it was before a cascade deleted it, so a
+	// rolled back deletion of CascadedFrom restores it unchanged
+	previous Record
+}
+
+// GetAllRecordsWithDeleted returns all records of a type including soft-deleted
+// and archived ones, as the system user sees them through queryAll
+func (s *MemoryStore) GetAllRecordsWithDeleted(objectType string) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.schemas[objectType]; !ok {
+		return nil, fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	return s.allRecords(objectType, true), nil
+}
+
+// GetDeleted returns the records of a type deleted between start and end,
+// oldest first
+func (s *MemoryStore) GetDeleted(objectType string, start, end time.Time) ([]DeletedRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.schemas[objectType]; !ok {
+		return nil, fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	result := []DeletedRecord{}
+	for _, deleted := range s.deletions[objectType] {
+		if !deleted.DeletedDate.Before(start) && !deleted.DeletedDate.After(end) {
+			result = append(result, deleted)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].DeletedDate.Before(result[j].DeletedDate)
+	})
+
+	return result, nil
+}
+
+// UndeleteRecord restores a soft-deleted record as the default user
+func (s *MemoryStore) UndeleteRecord(objectType, recordID string) error {
+	return s.UndeleteRecordAs("", objectType, recordID)
+}
+
+// UndeleteRecordAs restores a soft-deleted record as the User userID, who
+// becomes its LastModifiedById. An empty userID means the default user.
+func (s *MemoryStore) UndeleteRecordAs(userID, objectType, recordID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schemas[objectType]; !ok {
+		return fmt.Errorf("object type not found: %s", objectType)
+	}
+
+	record, ok := s.records[objectType][recordID]
+	if !ok {
+		return fmt.Errorf("record not found: %s", recordID)
+	}
+	if _, ok := s.deletions[objectType][recordID]; !ok {
+		return fmt.Errorf("record is not deleted: %s", recordID)
+	}
+
+	userID = s.actingUser(userID)
+	now := time.Now().UTC()
+	s.markUndeleted(objectType, record, userID, now)
+	s.cascadeUndelete(recordID, userID, now)
+
+	return nil
+}
+
+// markUndeleted restores a soft-deleted record. Callers must hold s.mu.
+func (s *MemoryStore) markUndeleted(objectType string, record Record, userID string, now time.Time) {
+	id, _ := record["Id"].(string)
+	stamp := now.Format(time.RFC3339)
+	record["IsDeleted"] = false
+	record["LastModifiedDate"] = stamp
+	record["LastModifiedById"] = userID
+	record["SystemModstamp"] = stamp
+	s.markChanged(objectType, id)
+	delete(s.deletions[objectType], id)
+	s.recordChange(ChangeTypeUndelete, objectType, id, userID, nil, nil, now)
+}
+
+// markDeleted soft-deletes a record and records who deleted it and when.
+// Callers must hold s.mu.
+func (s *MemoryStore) markDeleted(objectType string, record Record, userID string, now time.Time) {
+	id, _ := record["Id"].(string)
+	stamp := now.Format(time.RFC3339)
+	record["IsDeleted"] = true
+	record["LastModifiedDate"] = stamp
+	record["LastModifiedById"] = userID
+	record["SystemModstamp"] = stamp
+	s.markChanged(objectType, id)
+
+	if s.deletions[objectType] == nil {
+		s.deletions[objectType] = make(map[string]DeletedRecord)
+	}
+	s.deletions[objectType][id] = DeletedRecord{
+		ID:          id,
+		DeletedDate: now,
+		DeletedByID: userID,
+	}
+}
+
+// SetRecycleBinRetention sets how long deleted records stay in the recycle
+// bin before PurgeRecycleBin removes them
+func (s *MemoryStore) SetRecycleBinRetention(retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recycleBinRetention = retention
+}
+
+// PurgeRecycleBin permanently removes the records deleted longer ago than
+// the retention, returning how many were removed. Purged records can no
+// longer be undeleted or queried with queryAll.
+func (s *MemoryStore) PurgeRecycleBin() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cutoff := time.Now().UTC().Add(-s.recycleBinRetention)
+	purged := 0
+	for objectType, deletions := range s.deletions {
+		removed := map[string]bool{}
+		for id, deleted := range deletions {
+			if deleted.DeletedDate.After(cutoff) {
+				continue
+			}
+			delete(s.records[objectType], id)
+			delete(s.blobs, id)
+			delete(deletions, id)
+			s.markChanged(objectType, id)
+			removed[id] = true
+		}
+		if len(removed) == 0 {
+			continue
+		}
+
+		order := s.recordOrder[objectType][:0]
+		for _, id := range s.recordOrder[objectType] {
+			if !removed[id] {
+				order = append(order, id)
+			}
+		}
+		s.recordOrder[objectType] = order
+		purged += len(removed)
+	}
+	return purged
+}
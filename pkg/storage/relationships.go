@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+)
+
+// auditReferenceFields are lookups to User that Salesforce does not expose
+// as child relationships usable in subqueries
+var auditReferenceFields = map[string]bool{
+	"OwnerId":          true,
+	"CreatedById":      true,
+	"LastModifiedById": true,
+}
+
+// childRelationshipName returns the relationship name a lookup field gives
+// its parent, e.g. Contacts for Contact.AccountId. Custom children get the
+// __r suffix.
+func childRelationshipName(child SObjectDefinition, field FieldDefinition) string {
+	if field.ChildRelationshipName != "" {
+		return field.ChildRelationshipName
+	}
+	name := strings.ReplaceAll(child.LabelPlural, " ", "")
+	if name == "" {
+		name = child.Name + "s"
+	}
+	if child.Custom {
+		return strings.TrimSuffix(name, "__c") + "__r"
+	}
+	return name
+}
+
+// childRelationships returns the declared child relationships of objectType
+// together with those derived from lookup fields on other objects, so every
+// relationship usable in a subquery has a name. Callers must hold s.mu.
+func (s *MemoryStore) childRelationships(objectType string) []ChildRelationship {
+	declared := s.schemas[objectType].ChildRelationships
+	result := make([]ChildRelationship, 0, len(declared))
+	seen := make(map[string]bool)
+	for _, rel := range declared {
+		seen[rel.ChildSObject+"."+rel.Field] = true
+		result = append(result, rel)
+	}
+
+	names := make([]string, 0, len(s.schemas))
+	for name := range s.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		child := s.schemas[name]
+		for _, field := range child.Fields {
+			if field.Type != FieldTypeReference || field.RelationshipName == "" || auditReferenceFields[field.Name] {
+				continue
+			}
+			if !containsString(field.ReferenceTo, objectType) {
+				continue
+			}
+
+			key := child.Name + "." + field.Name
+			if seen[key] {
+				// Fill in names left empty on declared relationships
+				for i := range result {
+					if result[i].ChildSObject+"."+result[i].Field == key && result[i].RelationshipName == "" {
+						result[i].RelationshipName = childRelationshipName(child, field)
+					}
+				}
+				continue
+			}
+			seen[key] = true
+			result = append(result, ChildRelationship{
+				ChildSObject:     child.Name,
+				Field:            field.Name,
+				RelationshipName: childRelationshipName(child, field),
+				CascadeDelete:    field.CascadeDelete,
+				RestrictedDelete: field.RestrictedDelete,
+			})
+		}
+	}
+
+	return result
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
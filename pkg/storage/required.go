@@ -0,0 +1,44 @@
+package storage
+
+import sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+
+// isRequired reports whether a field must have a value on create: it is
+// createable, not nillable and not populated by default. Checkboxes are
+// never required since they default to false.
+func (f FieldDefinition) isRequired() bool {
+	return f.Createable && !f.Nillable && !f.Calculated && f.Type != FieldTypeBoolean &&
+		!f.DefaultedOnCreate && !f.hasDefault()
+}
+
+// checkRequiredFields rejects a new record missing any required field
+func checkRequiredFields(schema SObjectDefinition, record Record) error {
+	var missing []string
+	for _, field := range schema.Fields {
+		if field.isRequired() && isBlank(record[field.Name]) {
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return sferrors.NewRequiredFieldError(missing...)
+	}
+	return nil
+}
+
+// checkRequiredUpdates rejects updates clearing a required field
+func checkRequiredUpdates(schema SObjectDefinition, updates Record) error {
+	var missing []string
+	for _, field := range schema.Fields {
+		if value, ok := updates[field.Name]; ok && field.isRequired() && isBlank(value) {
+			missing = append(missing, field.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return sferrors.NewRequiredFieldError(missing...)
+	}
+	return nil
+}
+
+func isBlank(value interface{}) bool {
+	s, ok := value.(string)
+	return value == nil || ok && s == ""
+}
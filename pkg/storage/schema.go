@@ -15,7 +15,7 @@ var StandardSObjects = []SObjectDefinition{
 		Fields: []FieldDefinition{
 			{Name: "Id", Label: "Account ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
 			{Name: "Name", Label: "Account Name", Type: FieldTypeString, Length: 255, Nillable: false, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Industry", Label: "Industry", Type: FieldTypePicklist, Nillable: true, Createable: true, Updateable: true,
 				PicklistValues: []PicklistValue{
 					{Value: "Agriculture", Label: "Agriculture", Active: true},
@@ -27,6 +27,13 @@ var StandardSObjects = []SObjectDefinition{
 					{Value: "Technology", Label: "Technology", Active: true},
 				},
 			},
+			{Name: "Rating", Label: "Account Rating", Type: FieldTypePicklist, Nillable: true, Createable: true, Updateable: true,
+				PicklistValues: []PicklistValue{
+					{Value: "Hot", Label: "Hot", Active: true},
+					{Value: "Warm", Label: "Warm", Active: true},
+					{Value: "Cold", Label: "Cold", Active: true},
+				},
+			},
 			{Name: "Website", Label: "Website", Type: FieldTypeURL, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Phone", Label: "Phone", Type: FieldTypePhone, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Fax", Label: "Fax", Type: FieldTypePhone, Nillable: true, Createable: true, Updateable: true},
@@ -41,20 +48,22 @@ var StandardSObjects = []SObjectDefinition{
 					{Value: "Other", Label: "Other", Active: true},
 				},
 			},
-			{Name: "BillingStreet", Label: "Billing Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "BillingCity", Label: "Billing City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true},
-			{Name: "BillingState", Label: "Billing State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "BillingPostalCode", Label: "Billing Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true},
-			{Name: "BillingCountry", Label: "Billing Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "ShippingStreet", Label: "Shipping Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "ShippingCity", Label: "Shipping City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true},
-			{Name: "ShippingState", Label: "Shipping State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "ShippingPostalCode", Label: "Shipping Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true},
-			{Name: "ShippingCountry", Label: "Shipping Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "AnnualRevenue", Label: "Annual Revenue", Type: FieldTypeCurrency, Nillable: true, Createable: true, Updateable: true},
+			{Name: "BillingStreet", Label: "Billing Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "BillingAddress"},
+			{Name: "BillingCity", Label: "Billing City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "BillingAddress"},
+			{Name: "BillingState", Label: "Billing State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "BillingAddress"},
+			{Name: "BillingPostalCode", Label: "Billing Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "BillingAddress"},
+			{Name: "BillingCountry", Label: "Billing Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "BillingAddress"},
+			{Name: "BillingAddress", Label: "Billing Address", Type: FieldTypeAddress, Nillable: true, Createable: false, Updateable: false},
+			{Name: "ShippingStreet", Label: "Shipping Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "ShippingAddress"},
+			{Name: "ShippingCity", Label: "Shipping City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "ShippingAddress"},
+			{Name: "ShippingState", Label: "Shipping State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "ShippingAddress"},
+			{Name: "ShippingPostalCode", Label: "Shipping Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "ShippingAddress"},
+			{Name: "ShippingCountry", Label: "Shipping Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "ShippingAddress"},
+			{Name: "ShippingAddress", Label: "Shipping Address", Type: FieldTypeAddress, Nillable: true, Createable: false, Updateable: false},
+			{Name: "AnnualRevenue", Label: "Annual Revenue", Type: FieldTypeCurrency, Precision: 18, Scale: 2, Nillable: true, Createable: true, Updateable: true},
 			{Name: "NumberOfEmployees", Label: "Employees", Type: FieldTypeInteger, Nillable: true, Createable: true, Updateable: true},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
-			{Name: "ParentId", Label: "Parent Account ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account"}, RelationshipName: "Parent"},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "ParentId", Label: "Parent Account ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account"}, RelationshipName: "Parent", ChildRelationshipName: "ChildAccounts"},
 			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
@@ -63,9 +72,9 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
 		},
 		ChildRelationships: []ChildRelationship{
-			{ChildSObject: "Contact", Field: "AccountId", RelationshipName: "Contacts", CascadeDelete: false},
-			{ChildSObject: "Opportunity", Field: "AccountId", RelationshipName: "Opportunities", CascadeDelete: false},
-			{ChildSObject: "Case", Field: "AccountId", RelationshipName: "Cases", CascadeDelete: false},
+			{ChildSObject: "Contact", Field: "AccountId", RelationshipName: "Contacts", CascadeDelete: true},
+			{ChildSObject: "Opportunity", Field: "AccountId", RelationshipName: "Opportunities", CascadeDelete: true},
+			{ChildSObject: "Case", Field: "AccountId", RelationshipName: "Cases", CascadeDelete: true},
 		},
 	},
 	{
@@ -91,13 +100,14 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "Title", Label: "Title", Type: FieldTypeString, Length: 128, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Department", Label: "Department", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Birthdate", Label: "Birthdate", Type: FieldTypeDate, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "MailingStreet", Label: "Mailing Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "MailingCity", Label: "Mailing City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true},
-			{Name: "MailingState", Label: "Mailing State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "MailingPostalCode", Label: "Mailing Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true},
-			{Name: "MailingCountry", Label: "Mailing Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
+			{Name: "MailingStreet", Label: "Mailing Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "MailingAddress"},
+			{Name: "MailingCity", Label: "Mailing City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "MailingAddress"},
+			{Name: "MailingState", Label: "Mailing State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "MailingAddress"},
+			{Name: "MailingPostalCode", Label: "Mailing Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "MailingAddress"},
+			{Name: "MailingCountry", Label: "Mailing Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "MailingAddress"},
+			{Name: "MailingAddress", Label: "Mailing Address", Type: FieldTypeAddress, Nillable: true, Createable: false, Updateable: false},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
 			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
@@ -135,14 +145,15 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "Industry", Label: "Industry", Type: FieldTypePicklist, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Title", Label: "Title", Type: FieldTypeString, Length: 128, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Website", Label: "Website", Type: FieldTypeURL, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Street", Label: "Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "City", Label: "City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true},
-			{Name: "State", Label: "State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
-			{Name: "PostalCode", Label: "Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Country", Label: "Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Street", Label: "Street", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "Address"},
+			{Name: "City", Label: "City", Type: FieldTypeString, Length: 40, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "Address"},
+			{Name: "State", Label: "State/Province", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "Address"},
+			{Name: "PostalCode", Label: "Zip/Postal Code", Type: FieldTypeString, Length: 20, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "Address"},
+			{Name: "Country", Label: "Country", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true, CompoundFieldName: "Address"},
+			{Name: "Address", Label: "Address", Type: FieldTypeAddress, Nillable: true, Createable: false, Updateable: false},
 			{Name: "LeadSource", Label: "Lead Source", Type: FieldTypePicklist, Nillable: true, Createable: true, Updateable: true},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
 			{Name: "IsConverted", Label: "Converted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
 			{Name: "ConvertedAccountId", Label: "Converted Account ID", Type: FieldTypeReference, Nillable: true, Createable: false, Updateable: false, ReferenceTo: []string{"Account"}},
 			{Name: "ConvertedContactId", Label: "Converted Contact ID", Type: FieldTypeReference, Nillable: true, Createable: false, Updateable: false, ReferenceTo: []string{"Contact"}},
@@ -169,7 +180,7 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "Id", Label: "Opportunity ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
 			{Name: "Name", Label: "Opportunity Name", Type: FieldTypeString, Length: 120, Nillable: false, Createable: true, Updateable: true},
 			{Name: "AccountId", Label: "Account ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account"}, RelationshipName: "Account"},
-			{Name: "Amount", Label: "Amount", Type: FieldTypeCurrency, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Amount", Label: "Amount", Type: FieldTypeCurrency, Precision: 16, Scale: 2, Nillable: true, Createable: true, Updateable: true},
 			{Name: "CloseDate", Label: "Close Date", Type: FieldTypeDate, Nillable: false, Createable: true, Updateable: true},
 			{Name: "StageName", Label: "Stage", Type: FieldTypePicklist, Nillable: false, Createable: true, Updateable: true,
 				PicklistValues: []PicklistValue{
@@ -196,10 +207,10 @@ var StandardSObjects = []SObjectDefinition{
 			},
 			{Name: "LeadSource", Label: "Lead Source", Type: FieldTypePicklist, Nillable: true, Createable: true, Updateable: true},
 			{Name: "NextStep", Label: "Next Step", Type: FieldTypeString, Length: 255, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
 			{Name: "IsClosed", Label: "Closed", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
 			{Name: "IsWon", Label: "Won", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
 			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
@@ -220,9 +231,9 @@ var StandardSObjects = []SObjectDefinition{
 		Queryable:   true,
 		Fields: []FieldDefinition{
 			{Name: "Id", Label: "Case ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
-			{Name: "CaseNumber", Label: "Case Number", Type: FieldTypeString, Length: 30, Nillable: false, Createable: false, Updateable: false},
+			{Name: "CaseNumber", Label: "Case Number", Type: FieldTypeString, Length: 30, Nillable: false, Createable: false, Updateable: false, AutoNumber: true, DisplayFormat: DefaultAutoNumberFormat},
 			{Name: "Subject", Label: "Subject", Type: FieldTypeString, Length: 255, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Status", Label: "Status", Type: FieldTypePicklist, Nillable: false, Createable: true, Updateable: true,
 				PicklistValues: []PicklistValue{
 					{Value: "New", Label: "New", Active: true, DefaultValue: true},
@@ -251,7 +262,76 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "ContactId", Label: "Contact ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Contact"}, RelationshipName: "Contact"},
 			{Name: "IsClosed", Label: "Closed", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
 			{Name: "IsEscalated", Label: "Escalated", Type: FieldTypeBoolean, Nillable: false, Createable: true, Updateable: true},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "LastModifiedById", Label: "Last Modified By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "Contract",
+		Label:       "Contract",
+		LabelPlural: "Contracts",
+		KeyPrefix:   "800",
+		Custom:      false,
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Contract ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "ContractNumber", Label: "Contract Number", Type: FieldTypeString, Length: 30, Nillable: false, Createable: false, Updateable: false, AutoNumber: true, DisplayFormat: DefaultAutoNumberFormat},
+			{Name: "AccountId", Label: "Account ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"Account"}, RelationshipName: "Account"},
+			{Name: "Status", Label: "Status", Type: FieldTypePicklist, Nillable: false, Createable: true, Updateable: true,
+				PicklistValues: []PicklistValue{
+					{Value: "Draft", Label: "Draft", Active: true, DefaultValue: true},
+					{Value: "In Approval Process", Label: "In Approval Process", Active: true},
+					{Value: "Activated", Label: "Activated", Active: true},
+				},
+			},
+			{Name: "StartDate", Label: "Contract Start Date", Type: FieldTypeDate, Nillable: true, Createable: true, Updateable: true},
+			{Name: "EndDate", Label: "Contract End Date", Type: FieldTypeDate, Nillable: true, Createable: false, Updateable: false},
+			{Name: "ContractTerm", Label: "Contract Term", Type: FieldTypeInteger, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "LastModifiedById", Label: "Last Modified By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "Order",
+		Label:       "Order",
+		LabelPlural: "Orders",
+		KeyPrefix:   "801",
+		Custom:      false,
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Order ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "OrderNumber", Label: "Order Number", Type: FieldTypeString, Length: 30, Nillable: false, Createable: false, Updateable: false, AutoNumber: true, DisplayFormat: DefaultAutoNumberFormat},
+			{Name: "AccountId", Label: "Account ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account"}, RelationshipName: "Account"},
+			{Name: "ContractId", Label: "Contract ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Contract"}, RelationshipName: "Contract"},
+			{Name: "Status", Label: "Status", Type: FieldTypePicklist, Nillable: false, Createable: true, Updateable: true,
+				PicklistValues: []PicklistValue{
+					{Value: "Draft", Label: "Draft", Active: true, DefaultValue: true},
+					{Value: "Activated", Label: "Activated", Active: true},
+				},
+			},
+			{Name: "EffectiveDate", Label: "Order Start Date", Type: FieldTypeDate, Nillable: false, Createable: true, Updateable: true},
+			{Name: "EndDate", Label: "Order End Date", Type: FieldTypeDate, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Type", Label: "Order Type", Type: FieldTypePicklist, Nillable: true, Createable: true, Updateable: true},
+			{Name: "TotalAmount", Label: "Order Amount", Type: FieldTypeCurrency, Precision: 18, Scale: 2, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
 			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
@@ -279,8 +359,8 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "Email", Label: "Email", Type: FieldTypeEmail, Nillable: false, Createable: true, Updateable: true},
 			{Name: "Alias", Label: "Alias", Type: FieldTypeString, Length: 8, Nillable: false, Createable: true, Updateable: true},
 			{Name: "IsActive", Label: "Active", Type: FieldTypeBoolean, Nillable: false, Createable: true, Updateable: true},
-			{Name: "ProfileId", Label: "Profile ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"Profile"}},
-			{Name: "UserRoleId", Label: "Role ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"UserRole"}},
+			{Name: "ProfileId", Label: "Profile ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"Profile"}, RelationshipName: "Profile"},
+			{Name: "UserRoleId", Label: "Role ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"UserRole"}, RelationshipName: "UserRole"},
 			{Name: "Title", Label: "Title", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Department", Label: "Department", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
 			{Name: "Phone", Label: "Phone", Type: FieldTypePhone, Nillable: true, Createable: true, Updateable: true},
@@ -321,18 +401,19 @@ var StandardSObjects = []SObjectDefinition{
 					{Value: "Low", Label: "Low", Active: true},
 				},
 			},
-			{Name: "WhoId", Label: "Name ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Contact", "Lead"}},
-			{Name: "WhatId", Label: "Related To ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account", "Opportunity", "Case"}},
+			{Name: "WhoId", Label: "Name ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Contact", "Lead"}, RelationshipName: "Who", PolymorphicForeignKey: true},
+			{Name: "WhatId", Label: "Related To ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account", "Opportunity", "Case"}, RelationshipName: "What", PolymorphicForeignKey: true},
 			{Name: "ActivityDate", Label: "Due Date Only", Type: FieldTypeDate, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
 			{Name: "IsClosed", Label: "Closed", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
 			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "LastModifiedById", Label: "Last Modified By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+			{Name: "IsArchived", Label: "Archived", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
 		},
 	},
 	{
@@ -351,11 +432,65 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "StartDateTime", Label: "Start Date Time", Type: FieldTypeDatetime, Nillable: true, Createable: true, Updateable: true},
 			{Name: "EndDateTime", Label: "End Date Time", Type: FieldTypeDatetime, Nillable: true, Createable: true, Updateable: true},
 			{Name: "IsAllDayEvent", Label: "All-Day Event", Type: FieldTypeBoolean, Nillable: false, Createable: true, Updateable: true},
-			{Name: "WhoId", Label: "Name ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Contact", "Lead"}},
-			{Name: "WhatId", Label: "Related To ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account", "Opportunity", "Case"}},
+			{Name: "WhoId", Label: "Name ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Contact", "Lead"}, RelationshipName: "Who", PolymorphicForeignKey: true},
+			{Name: "WhatId", Label: "Related To ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"Account", "Opportunity", "Case"}, RelationshipName: "What", PolymorphicForeignKey: true},
 			{Name: "Location", Label: "Location", Type: FieldTypeString, Length: 255, Nillable: true, Createable: true, Updateable: true},
-			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Nillable: true, Createable: true, Updateable: true},
-			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 32000, Nillable: true, Createable: true, Updateable: true},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "LastModifiedById", Label: "Last Modified By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+			{Name: "IsArchived", Label: "Archived", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "ContentVersion",
+		Label:       "Content Version",
+		LabelPlural: "Content Versions",
+		KeyPrefix:   "068",
+		Custom:      false,
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   false,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Content Version ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Title", Label: "Title", Type: FieldTypeString, Length: 255, Nillable: true, Createable: true, Updateable: true},
+			{Name: "PathOnClient", Label: "Path On Client", Type: FieldTypeString, Length: 500, Nillable: false, Createable: true, Updateable: false},
+			{Name: "VersionData", Label: "Version Data", Type: FieldTypeBase64, Nillable: false, Createable: true, Updateable: true},
+			{Name: "ContentSize", Label: "Size", Type: FieldTypeInteger, Nillable: true, Createable: false, Updateable: false},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 1000, Nillable: true, Createable: true, Updateable: true},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "LastModifiedById", Label: "Last Modified By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "Attachment",
+		Label:       "Attachment",
+		LabelPlural: "Attachments",
+		KeyPrefix:   "00P",
+		Custom:      false,
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Attachment ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Name", Label: "File Name", Type: FieldTypeString, Length: 255, Nillable: false, Createable: true, Updateable: true},
+			{Name: "ContentType", Label: "Content Type", Type: FieldTypeString, Length: 120, Nillable: true, Createable: true, Updateable: true},
+			{Name: "Body", Label: "Body", Type: FieldTypeBase64, Nillable: false, Createable: true, Updateable: true},
+			{Name: "BodyLength", Label: "Body Length", Type: FieldTypeInteger, Nillable: true, Createable: false, Updateable: false},
+			{Name: "ParentId", Label: "Parent ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: false, ReferenceTo: []string{"Account", "Contact", "Lead", "Opportunity", "Case"}, RelationshipName: "Parent", PolymorphicForeignKey: true},
+			{Name: "Description", Label: "Description", Type: FieldTypeTextArea, Length: 500, Nillable: true, Createable: true, Updateable: true},
+			{Name: "OwnerId", Label: "Owner ID", Type: FieldTypeReference, Nillable: false, Createable: true, Updateable: true, DefaultedOnCreate: true, ReferenceTo: []string{"User"}, RelationshipName: "Owner"},
 			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
 			{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, Nillable: false, Createable: false, Updateable: false, ReferenceTo: []string{"User"}},
 			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
@@ -364,4 +499,83 @@ var StandardSObjects = []SObjectDefinition{
 			{Name: "IsDeleted", Label: "Deleted", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
 		},
 	},
+	{
+		Name:        "Organization",
+		Label:       "Organization",
+		LabelPlural: "Organizations",
+		KeyPrefix:   "00D",
+		Custom:      false,
+		Createable:  false,
+		Updateable:  false,
+		Deletable:   false,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Organization ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Name", Label: "Name", Type: FieldTypeString, Length: 80, Nillable: false, Createable: false, Updateable: false},
+			{Name: "InstanceName", Label: "Instance Name", Type: FieldTypeString, Nillable: true, Createable: false, Updateable: false},
+			{Name: "OrganizationType", Label: "Edition", Type: FieldTypePicklist, Nillable: true, Createable: false, Updateable: false},
+			{Name: "IsSandbox", Label: "Is Sandbox", Type: FieldTypeBoolean, Nillable: false, Createable: false, Updateable: false},
+			{Name: "LanguageLocaleKey", Label: "Language", Type: FieldTypePicklist, Nillable: false, Createable: false, Updateable: false},
+			{Name: "DefaultLocaleSidKey", Label: "Locale", Type: FieldTypePicklist, Nillable: false, Createable: false, Updateable: false},
+			{Name: "TimeZoneSidKey", Label: "Default Time Zone", Type: FieldTypePicklist, Nillable: false, Createable: false, Updateable: false},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "Profile",
+		Label:       "Profile",
+		LabelPlural: "Profiles",
+		KeyPrefix:   "00e",
+		Custom:      false,
+		Createable:  false,
+		Updateable:  true,
+		Deletable:   false,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Profile ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Name", Label: "Name", Type: FieldTypeString, Length: 255, Nillable: false, Createable: false, Updateable: true},
+			{Name: "UserType", Label: "User Type", Type: FieldTypePicklist, Nillable: true, Createable: false, Updateable: false},
+			{Name: "Description", Label: "Description", Type: FieldTypeString, Length: 255, Nillable: true, Createable: false, Updateable: true},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "UserRole",
+		Label:       "Role",
+		LabelPlural: "Roles",
+		KeyPrefix:   "00E",
+		Custom:      false,
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Role ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Name", Label: "Name", Type: FieldTypeString, Length: 80, Nillable: false, Createable: true, Updateable: true},
+			{Name: "DeveloperName", Label: "Developer Name", Type: FieldTypeString, Length: 80, Nillable: true, Createable: true, Updateable: true},
+			{Name: "ParentRoleId", Label: "Parent Role ID", Type: FieldTypeReference, Nillable: true, Createable: true, Updateable: true, ReferenceTo: []string{"UserRole"}},
+			{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+			{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime, Nillable: false, Createable: false, Updateable: false},
+		},
+	},
+	{
+		Name:        "RecentlyViewed",
+		Label:       "Recently Viewed",
+		LabelPlural: "Recently Viewed",
+		Custom:      false,
+		Createable:  false,
+		Updateable:  false,
+		Deletable:   false,
+		Queryable:   true,
+		Fields: []FieldDefinition{
+			{Name: "Id", Label: "Record ID", Type: FieldTypeID, Nillable: false, Createable: false, Updateable: false},
+			{Name: "Name", Label: "Name", Type: FieldTypeString, Length: 255, Nillable: true, Createable: false, Updateable: false},
+			{Name: "Type", Label: "Type", Type: FieldTypeString, Length: 255, Nillable: true, Createable: false, Updateable: false},
+			{Name: "LastViewedDate", Label: "Last Viewed Date", Type: FieldTypeDatetime, Nillable: true, Createable: false, Updateable: false},
+			{Name: "LastReferencedDate", Label: "Last Referenced Date", Type: FieldTypeDatetime, Nillable: true, Createable: false, Updateable: false},
+		},
+	},
 }
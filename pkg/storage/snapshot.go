@@ -0,0 +1,338 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/internal/idgen"
+)
+
+// storeSnapshot is the JSON form of a MemoryStore's state
+type storeSnapshot struct {
+	DefaultUserID string                                `json:"defaultUserId"`
+	Schemas       []schemaSnapshot                      `json:"schemas"`
+	Records       map[string][]Record                   `json:"records"`
+	Counters      map[string]uint64                     `json:"counters"`
+	AutoNumbers   map[string]int64                      `json:"autoNumbers,omitempty"`
+	Deletions     map[string]map[string]deletedSnapshot `json:"deletions,omitempty"`
+	Blobs         map[string]map[string][]byte          `json:"blobs,omitempty"`
+	TrackedFields map[string]map[string]bool            `json:"trackedFields,omitempty"`
+	CDCObjects    map[string]bool                       `json:"cdcObjects,omitempty"`
+	Approvals     map[string][]ApprovalLayout           `json:"approvalLayouts,omitempty"`
+	Tooling       *storeSnapshot                        `json:"tooling,omitempty"`
+}
+
+// deletedSnapshot is a DeletedRecord with the pre-cascade record it keeps
+// for rollbacks
+type deletedSnapshot struct {
+	DeletedRecord
+	Previous Record `json:"previous,omitempty"`
+}
+
+// schemaSnapshot is an SObjectDefinition with its fields in snapshot form
+type schemaSnapshot struct {
+	SObjectDefinition
+	Fields []fieldSnapshot `json:"fields"`
+}
+
+// storedField has FieldDefinition's layout without its describe-oriented
+// MarshalJSON
+type storedField FieldDefinition
+
+// fieldSnapshot adds the fields describe omits, so they survive a restore
+type fieldSnapshot struct {
+	storedField
+	ChildRelationshipName string              `json:"childRelationshipName,omitempty"`
+	Filterable            *bool               `json:"filterable,omitempty"`
+	Sortable              *bool               `json:"sortable,omitempty"`
+	Groupable             *bool               `json:"groupable,omitempty"`
+	Aggregatable          *bool               `json:"aggregatable,omitempty"`
+	ValidFor              map[string][]string `json:"validFor,omitempty"`
+	DisplayFormat         string              `json:"displayFormat,omitempty"`
+}
+
+// Snapshot serializes the store's records, schemas, ID generator counters,
+// recycle bin, field history, Change Data Capture and approval settings to
+// JSON. Restore loads the result back.
+func (s *MemoryStore) Snapshot() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot := s.snapshot(true)
+	if s.tooling != nil {
+		s.tooling.mu.RLock()
+		defer s.tooling.mu.RUnlock()
+		snapshot.Tooling = s.tooling.snapshot(true)
+	}
+	return json.Marshal(snapshot)
+}
+
+// snapshot captures the store's state, leaving the records out unless
+// withRecords is set. Callers must hold s.mu until the snapshot is marshaled.
+func (s *MemoryStore) snapshot(withRecords bool) *storeSnapshot {
+	snapshot := &storeSnapshot{
+		DefaultUserID: s.defaultUserID,
+		Records:       make(map[string][]Record),
+		Counters:      make(map[string]uint64),
+		AutoNumbers:   s.autoNumbers,
+		Deletions:     make(map[string]map[string]deletedSnapshot),
+		Blobs:         s.blobs,
+		TrackedFields: s.trackedFields,
+		CDCObjects:    s.cdcObjects,
+		Approvals:     s.approvalLayouts,
+	}
+	for objectType, deleted := range s.deletions {
+		snapshot.Deletions[objectType] = make(map[string]deletedSnapshot, len(deleted))
+		for id, deletion := range deleted {
+			snapshot.Deletions[objectType][id] = deletedSnapshot{DeletedRecord: deletion, Previous: deletion.previous}
+		}
+	}
+	for _, schema := range s.schemas {
+		snapshot.Schemas = append(snapshot.Schemas, newSchemaSnapshot(schema))
+	}
+	for objectType, ids := range s.recordOrder {
+		if !withRecords {
+			break
+		}
+		for _, id := range ids {
+			if record, ok := s.records[objectType][id]; ok {
+				snapshot.Records[objectType] = append(snapshot.Records[objectType], record)
+			}
+		}
+	}
+	for objectType, gen := range s.idGenerators {
+		snapshot.Counters[objectType] = gen.Count()
+	}
+	return snapshot
+}
+
+// Restore replaces the store's state with a snapshot taken by Snapshot.
+// Bulk jobs, recently viewed records and the operation log are cleared.
+func (s *MemoryStore) Restore(data []byte) error {
+	var snapshot storeSnapshot
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot: %w", err)
+	}
+	if err := s.restore(&snapshot); err != nil {
+		return err
+	}
+	if s.tooling != nil && snapshot.Tooling != nil {
+		return s.tooling.restore(snapshot.Tooling)
+	}
+	return nil
+}
+
+func (s *MemoryStore) restore(snapshot *storeSnapshot) error {
+	prefixes := idgen.NewRegistry()
+	schemas := make(map[string]SObjectDefinition, len(snapshot.Schemas))
+	for _, schema := range snapshot.Schemas {
+		definition := schema.definition()
+		if definition.KeyPrefix != "" {
+			if err := prefixes.Register(definition.Name, definition.KeyPrefix); err != nil {
+				return fmt.Errorf("invalid snapshot: %w", err)
+			}
+		}
+		schemas[definition.Name] = definition
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schemas = schemas
+	s.prefixes = prefixes
+	s.records = make(map[string]map[string]Record)
+	s.recordOrder = make(map[string][]string)
+	for objectType := range schemas {
+		s.records[objectType] = make(map[string]Record)
+	}
+	for objectType, records := range snapshot.Records {
+		for _, record := range records {
+			if id, ok := record["Id"].(string); ok {
+				s.putRecord(objectType, id, restoreNumbers(schemas[objectType], record))
+			}
+		}
+	}
+
+	s.idGenerators = make(map[string]*idgen.Generator)
+	for objectType, count := range snapshot.Counters {
+		s.getIDGenerator(objectType).SetCount(count)
+	}
+
+	s.deletions = make(map[string]map[string]DeletedRecord)
+	for objectType, deleted := range snapshot.Deletions {
+		s.deletions[objectType] = make(map[string]DeletedRecord, len(deleted))
+		for id, deletion := range deleted {
+			deletion.previous = restoreNumbers(schemas[objectType], deletion.Previous)
+			s.deletions[objectType][id] = deletion.DeletedRecord
+		}
+	}
+	s.blobs = snapshot.Blobs
+	if s.blobs == nil {
+		s.blobs = make(map[string]map[string][]byte)
+	}
+	s.autoNumbers = snapshot.AutoNumbers
+	if s.autoNumbers == nil {
+		s.autoNumbers = make(map[string]int64)
+	}
+	s.defaultUserID = snapshot.DefaultUserID
+	s.trackedFields = snapshot.TrackedFields
+	if s.trackedFields == nil {
+		s.trackedFields = make(map[string]map[string]bool)
+	}
+	s.cdcObjects = snapshot.CDCObjects
+	if s.cdcObjects == nil {
+		s.cdcObjects = make(map[string]bool)
+	}
+	s.approvalLayouts = snapshot.Approvals
+	if s.approvalLayouts == nil {
+		s.approvalLayouts = make(map[string][]ApprovalLayout)
+	}
+
+	s.bulkJobs = make(map[string]*BulkJob)
+	s.recentlyViewed = nil
+	s.operations = nil
+	s.changeEvents = nil
+	s.derivedIDs = make(map[string]string)
+	s.replaced = true
+	return nil
+}
+
+// restoreNumbers converts the json.Number values of a decoded record back to
+// the types records are written with: int in integer fields and float64
+// elsewhere
+func restoreNumbers(schema SObjectDefinition, record Record) Record {
+	if record == nil {
+		return nil
+	}
+	types := make(map[string]FieldType, len(schema.Fields))
+	for _, field := range schema.Fields {
+		types[field.Name] = field.Type
+	}
+	for key, value := range record {
+		record[key] = restoreNumber(types[key], value)
+	}
+	return record
+}
+
+func restoreNumber(fieldType FieldType, value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if fieldType == FieldTypeInteger {
+			if n, err := v.Int64(); err == nil {
+				return int(n)
+			}
+		}
+		if n, err := v.Float64(); err == nil {
+			return n
+		}
+		return v.String()
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = restoreNumber("", item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = restoreNumber("", item)
+		}
+	}
+	return value
+}
+
+func newSchemaSnapshot(definition SObjectDefinition) schemaSnapshot {
+	snapshot := schemaSnapshot{SObjectDefinition: definition}
+	for _, field := range definition.Fields {
+		snapshot.Fields = append(snapshot.Fields, fieldSnapshot{
+			storedField:           storedField(field),
+			ChildRelationshipName: field.ChildRelationshipName,
+			Filterable:            field.Filterable,
+			Sortable:              field.Sortable,
+			Groupable:             field.Groupable,
+			Aggregatable:          field.Aggregatable,
+			ValidFor:              field.ValidFor,
+			DisplayFormat:         field.DisplayFormat,
+		})
+	}
+	return snapshot
+}
+
+func (s schemaSnapshot) definition() SObjectDefinition {
+	definition := s.SObjectDefinition
+	definition.Fields = make([]FieldDefinition, len(s.Fields))
+	for i, snapshot := range s.Fields {
+		field := FieldDefinition(snapshot.storedField)
+		field.ChildRelationshipName = snapshot.ChildRelationshipName
+		field.Filterable = snapshot.Filterable
+		field.Sortable = snapshot.Sortable
+		field.Groupable = snapshot.Groupable
+		field.Aggregatable = snapshot.Aggregatable
+		field.ValidFor = snapshot.ValidFor
+		field.DisplayFormat = snapshot.DisplayFormat
+		definition.Fields[i] = field
+	}
+	return definition
+}
+
+// bulkJobSnapshot is the JSON form of a BulkJob, with the uploaded data and
+// results its API form leaves out
+type bulkJobSnapshot struct {
+	BulkJob
+	DisableBatchRetry bool               `json:"disableBatchRetry,omitempty"`
+	Results           []Record           `json:"results,omitempty"`
+	ResultLocators    map[string]int     `json:"resultLocators,omitempty"`
+	Header            []string           `json:"header,omitempty"`
+	Rows              [][]string         `json:"rows,omitempty"`
+	RecordResults     []BulkRecordResult `json:"recordResults,omitempty"`
+}
+
+// SnapshotBulkJob serializes a bulk job, including its uploaded data and
+// results, to JSON. Snapshot leaves bulk jobs out; stores that keep them
+// save each one with SnapshotBulkJob and load it with RestoreBulkJob.
+func (s *MemoryStore) SnapshotBulkJob(jobID string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.bulkJobs[jobID]
+	if !ok {
+		return nil, fmt.Errorf("job not found: %s", jobID)
+	}
+	return json.Marshal(bulkJobSnapshot{
+		BulkJob:           *job,
+		DisableBatchRetry: job.DisableBatchRetry,
+		Results:           job.Results,
+		ResultLocators:    job.ResultLocators,
+		Header:            job.Header,
+		Rows:              job.Rows,
+		RecordResults:     job.RecordResults,
+	})
+}
+
+// RestoreBulkJob adds a bulk job serialized by SnapshotBulkJob, replacing
+// any job with the same ID
+func (s *MemoryStore) RestoreBulkJob(data []byte) error {
+	var snapshot bulkJobSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid bulk job: %w", err)
+	}
+
+	job := snapshot.BulkJob
+	job.DisableBatchRetry = snapshot.DisableBatchRetry
+	job.Results = snapshot.Results
+	if job.Results == nil {
+		job.Results = []Record{}
+	}
+	job.ResultLocators = snapshot.ResultLocators
+	if job.ResultLocators == nil {
+		job.ResultLocators = make(map[string]int)
+	}
+	job.Header = snapshot.Header
+	job.Rows = snapshot.Rows
+	job.RecordResults = snapshot.RecordResults
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bulkJobs[job.ID] = &job
+	return nil
+}
@@ -0,0 +1,509 @@
+// Package sqlite provides a storage.Store that keeps its data in a SQLite
+// database file, so long-lived emulators survive process restarts.
+package sqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS records (
+	object_type TEXT NOT NULL,
+	id          TEXT NOT NULL,
+	position    INTEGER NOT NULL,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (object_type, id)
+);
+CREATE TABLE IF NOT EXISTS tooling_records (
+	object_type TEXT NOT NULL,
+	id          TEXT NOT NULL,
+	position    INTEGER NOT NULL,
+	data        TEXT NOT NULL,
+	PRIMARY KEY (object_type, id)
+);
+CREATE TABLE IF NOT EXISTS bulk_jobs (
+	id   TEXT PRIMARY KEY,
+	data TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS state (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);`
+
+// Store is a storage.Store backed by a SQLite database. Reads and queries
+// are served from an embedded MemoryStore, which behaves exactly like the
+// default store; every write is then saved to the database, one row per
+// record plus the schemas and ID generator counters. Only the rows of the
+// records a write touched are written. Bulk jobs and the count of API
+// requests against the daily limit are saved as they change.
+type Store struct {
+	*storage.MemoryStore
+
+	db     *sql.DB
+	saveMu sync.Mutex
+
+	position int64  // the position of the next new record row
+	state    string // the state row as last saved
+}
+
+// Open opens the SQLite database at path, creating it if needed, and loads
+// the data saved in it
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("sqlite: creating tables: %w", err)
+	}
+
+	s := &Store{
+		MemoryStore: storage.NewMemoryStore(),
+		db:          db,
+	}
+	s.MemoryStore.TrackChanges()
+	if err := s.load(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Memory returns the MemoryStore serving the store's reads
+func (s *Store) Memory() *storage.MemoryStore {
+	return s.MemoryStore
+}
+
+// Close saves the store and closes the database
+func (s *Store) Close() error {
+	if err := s.Save(); err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.db.Close()
+}
+
+// load restores the saved snapshot, if the database has one, and the saved
+// bulk jobs and API request count
+func (s *Store) load() error {
+	if err := s.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := s.loadBulkJobs(); err != nil {
+		return err
+	}
+
+	var used int
+	err := s.db.QueryRow(`SELECT value FROM state WHERE key = 'apiRequestsUsed'`).Scan(&used)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite: loading API request count: %w", err)
+	}
+	s.MemoryStore.SetAPIRequestsUsed(used)
+	return nil
+}
+
+func (s *Store) loadSnapshot() error {
+	var state string
+	err := s.db.QueryRow(`SELECT value FROM state WHERE key = 'snapshot'`).Scan(&state)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("sqlite: loading state: %w", err)
+	}
+
+	var snapshot map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(state), &snapshot); err != nil {
+		return fmt.Errorf("sqlite: invalid state: %w", err)
+	}
+	if snapshot["records"], err = s.loadRecords("records"); err != nil {
+		return err
+	}
+	if tooling, ok := snapshot["tooling"]; ok && string(tooling) != "null" {
+		var toolingSnapshot map[string]json.RawMessage
+		if err := json.Unmarshal(tooling, &toolingSnapshot); err != nil {
+			return fmt.Errorf("sqlite: invalid state: %w", err)
+		}
+		if toolingSnapshot["records"], err = s.loadRecords("tooling_records"); err != nil {
+			return err
+		}
+		if snapshot["tooling"], err = json.Marshal(toolingSnapshot); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	if err := s.MemoryStore.Restore(data); err != nil {
+		return err
+	}
+
+	// The database already holds what was just restored
+	if _, err := s.MemoryStore.TakeChanges(); err != nil {
+		return err
+	}
+	s.state = state
+	return nil
+}
+
+// loadRecords reads the records saved in table, in the order they were
+// created, as the records of a snapshot
+func (s *Store) loadRecords(table string) (json.RawMessage, error) {
+	rows, err := s.db.Query(`SELECT object_type, position, data FROM ` + table + ` ORDER BY object_type, position`)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: loading records: %w", err)
+	}
+	defer rows.Close()
+
+	records := make(map[string][]json.RawMessage)
+	for rows.Next() {
+		var objectType, data string
+		var position int64
+		if err := rows.Scan(&objectType, &position, &data); err != nil {
+			return nil, fmt.Errorf("sqlite: loading records: %w", err)
+		}
+		records[objectType] = append(records[objectType], json.RawMessage(data))
+		if position >= s.position {
+			s.position = position + 1
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("sqlite: loading records: %w", err)
+	}
+	return json.Marshal(records)
+}
+
+func (s *Store) loadBulkJobs() error {
+	rows, err := s.db.Query(`SELECT data FROM bulk_jobs`)
+	if err != nil {
+		return fmt.Errorf("sqlite: loading bulk jobs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return fmt.Errorf("sqlite: loading bulk jobs: %w", err)
+		}
+		if err := s.MemoryStore.RestoreBulkJob([]byte(data)); err != nil {
+			return fmt.Errorf("sqlite: %w", err)
+		}
+	}
+	return rows.Err()
+}
+
+// Save writes the records written since the last save, and the store's
+// schemas and counters if they changed, to the database. If saving fails,
+// the next save writes every record.
+func (s *Store) Save() error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	changes, err := s.MemoryStore.TakeChanges()
+	if err != nil {
+		return err
+	}
+	if err := s.saveChanges(changes); err != nil {
+		s.MemoryStore.TrackChanges()
+		return err
+	}
+	return nil
+}
+
+// saveChanges writes changes in one transaction. Callers must hold saveMu.
+func (s *Store) saveChanges(changes *storage.Changes) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("sqlite: saving: %w", err)
+	}
+	defer tx.Rollback()
+
+	if changes.Replaced {
+		for _, table := range []string{"records", "tooling_records"} {
+			if _, err := tx.Exec(`DELETE FROM ` + table); err != nil {
+				return fmt.Errorf("sqlite: saving records: %w", err)
+			}
+		}
+	}
+
+	position := s.position
+	for _, change := range changes.Records {
+		table := "records"
+		if change.Tooling {
+			table = "tooling_records"
+		}
+		if change.Data == nil {
+			_, err = tx.Exec(`DELETE FROM `+table+` WHERE object_type = ? AND id = ?`, change.ObjectType, change.ID)
+		} else {
+			// Rows keep their position when updated, so records load in the
+			// order they were created
+			_, err = tx.Exec(`INSERT INTO `+table+` (object_type, id, position, data) VALUES (?, ?, ?, ?)
+				ON CONFLICT (object_type, id) DO UPDATE SET data = excluded.data`,
+				change.ObjectType, change.ID, position, string(change.Data))
+			position++
+		}
+		if err != nil {
+			return fmt.Errorf("sqlite: saving records: %w", err)
+		}
+	}
+
+	state := string(changes.State)
+	if state != s.state {
+		if _, err := tx.Exec(`INSERT INTO state (key, value) VALUES ('snapshot', ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value`, state); err != nil {
+			return fmt.Errorf("sqlite: saving state: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite: saving: %w", err)
+	}
+	s.position, s.state = position, state
+	return nil
+}
+
+// saved saves the store after a write that returned err, unless it failed
+func (s *Store) saved(err error) error {
+	if err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+// CreateRecord creates a record and saves the store
+func (s *Store) CreateRecord(objectType string, record storage.Record) (string, error) {
+	id, err := s.MemoryStore.CreateRecord(objectType, record)
+	return id, s.saved(err)
+}
+
+// CreateRecordAs creates a record as userID and saves the store
+func (s *Store) CreateRecordAs(userID, objectType string, record storage.Record) (string, error) {
+	id, err := s.MemoryStore.CreateRecordAs(userID, objectType, record)
+	return id, s.saved(err)
+}
+
+// UpdateRecord updates a record and saves the store
+func (s *Store) UpdateRecord(objectType, recordID string, updates storage.Record) error {
+	return s.saved(s.MemoryStore.UpdateRecord(objectType, recordID, updates))
+}
+
+// UpdateRecordAs updates a record as userID and saves the store
+func (s *Store) UpdateRecordAs(userID, objectType, recordID string, updates storage.Record) error {
+	return s.saved(s.MemoryStore.UpdateRecordAs(userID, objectType, recordID, updates))
+}
+
+// UpsertRecordAs upserts a record by external ID as userID and saves the
+// store
+func (s *Store) UpsertRecordAs(userID, objectType, field, value string, record storage.Record) (string, bool, error) {
+	id, created, err := s.MemoryStore.UpsertRecordAs(userID, objectType, field, value, record)
+	return id, created, s.saved(err)
+}
+
+// DeleteRecord deletes a record and saves the store
+func (s *Store) DeleteRecord(objectType, recordID string) error {
+	return s.saved(s.MemoryStore.DeleteRecord(objectType, recordID))
+}
+
+// DeleteRecordAs deletes a record as userID and saves the store
+func (s *Store) DeleteRecordAs(userID, objectType, recordID string) error {
+	return s.saved(s.MemoryStore.DeleteRecordAs(userID, objectType, recordID))
+}
+
+// RestoreRecord rolls a record back and saves the store
+func (s *Store) RestoreRecord(objectType, recordID string, previous storage.Record) error {
+	return s.saved(s.MemoryStore.RestoreRecord(objectType, recordID, previous))
+}
+
+// UndeleteRecord restores a deleted record and saves the store
+func (s *Store) UndeleteRecord(objectType, recordID string) error {
+	return s.saved(s.MemoryStore.UndeleteRecord(objectType, recordID))
+}
+
+// UndeleteRecordAs restores a deleted record as userID and saves the store
+func (s *Store) UndeleteRecordAs(userID, objectType, recordID string) error {
+	return s.saved(s.MemoryStore.UndeleteRecordAs(userID, objectType, recordID))
+}
+
+// CreateRecords creates records and saves the store
+func (s *Store) CreateRecords(objectType string, records []storage.Record) ([]storage.CreateResult, error) {
+	results, err := s.MemoryStore.CreateRecords(objectType, records)
+	return results, s.saved(err)
+}
+
+// UpdateRecords updates records and saves the store
+func (s *Store) UpdateRecords(objectType string, records []storage.Record) ([]storage.UpdateResult, error) {
+	results, err := s.MemoryStore.UpdateRecords(objectType, records)
+	return results, s.saved(err)
+}
+
+// DeleteRecords deletes records and saves the store
+func (s *Store) DeleteRecords(objectType string, recordIDs []string) ([]storage.DeleteResult, error) {
+	results, err := s.MemoryStore.DeleteRecords(objectType, recordIDs)
+	return results, s.saved(err)
+}
+
+// RegisterSObject registers an object and saves the store
+func (s *Store) RegisterSObject(definition storage.SObjectDefinition) error {
+	return s.saved(s.MemoryStore.RegisterSObject(definition))
+}
+
+// AddField adds a field and saves the store
+func (s *Store) AddField(objectType string, field storage.FieldDefinition) error {
+	return s.saved(s.MemoryStore.AddField(objectType, field))
+}
+
+// UpdateField replaces a field and saves the store
+func (s *Store) UpdateField(objectType string, field storage.FieldDefinition) error {
+	return s.saved(s.MemoryStore.UpdateField(objectType, field))
+}
+
+// RemoveField removes a field and saves the store
+func (s *Store) RemoveField(objectType, fieldName string) error {
+	return s.saved(s.MemoryStore.RemoveField(objectType, fieldName))
+}
+
+// UnregisterSObject removes a custom object and saves the store
+func (s *Store) UnregisterSObject(objectType string) error {
+	return s.saved(s.MemoryStore.UnregisterSObject(objectType))
+}
+
+// RegisterPlatformEvent registers a platform event and saves the store
+func (s *Store) RegisterPlatformEvent(name string, fields ...storage.FieldDefinition) error {
+	return s.saved(s.MemoryStore.RegisterPlatformEvent(name, fields...))
+}
+
+// RegisterPicklistDependency makes a picklist dependent and saves the store
+func (s *Store) RegisterPicklistDependency(objectType string, dependency storage.PicklistDependency) error {
+	return s.saved(s.MemoryStore.RegisterPicklistDependency(objectType, dependency))
+}
+
+// EnableFieldHistory enables history tracking and saves the store
+func (s *Store) EnableFieldHistory(objectType string, fields ...string) error {
+	return s.saved(s.MemoryStore.EnableFieldHistory(objectType, fields...))
+}
+
+// Truncate removes every record of a type and saves the store
+func (s *Store) Truncate(objectType string) error {
+	return s.saved(s.MemoryStore.Truncate(objectType))
+}
+
+// Reset clears the store's data, bulk jobs and API request count and saves
+// it. Reset cannot report errors; a failed save is retried by the next write.
+func (s *Store) Reset() {
+	s.MemoryStore.Reset()
+	_ = s.Save()
+	_, _ = s.db.Exec(`DELETE FROM bulk_jobs`)
+	_, _ = s.db.Exec(`DELETE FROM state WHERE key = 'apiRequestsUsed'`)
+}
+
+// Restore replaces the store's state with a snapshot, which clears its bulk
+// jobs, and saves it
+func (s *Store) Restore(data []byte) error {
+	if err := s.saved(s.MemoryStore.Restore(data)); err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`DELETE FROM bulk_jobs`); err != nil {
+		return fmt.Errorf("sqlite: saving bulk jobs: %w", err)
+	}
+	return nil
+}
+
+// ConsumeAPIRequest counts an API request against the daily limit and
+// saves the count. A failed save is retried by the next request.
+func (s *Store) ConsumeAPIRequest() (used, max int, ok bool) {
+	used, max, ok = s.MemoryStore.ConsumeAPIRequest()
+	if ok {
+		// Concurrent requests may save out of order; keep the highest count
+		_, _ = s.db.Exec(`INSERT INTO state (key, value) VALUES ('apiRequestsUsed', ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value
+			WHERE CAST(value AS INTEGER) < CAST(excluded.value AS INTEGER)`, used)
+	}
+	return used, max, ok
+}
+
+// savedJob saves the bulk job jobID after a write that returned err, unless
+// it failed
+func (s *Store) savedJob(jobID string, err error) error {
+	if err != nil {
+		return err
+	}
+
+	// Snapshots taken under saveMu are saved in order, so the last saved
+	// is the newest
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	data, err := s.MemoryStore.SnapshotBulkJob(jobID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec(`INSERT INTO bulk_jobs (id, data) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET data = excluded.data`, jobID, string(data)); err != nil {
+		return fmt.Errorf("sqlite: saving bulk job: %w", err)
+	}
+	return nil
+}
+
+// CreateBulkJob creates a bulk job and saves it
+func (s *Store) CreateBulkJob(config storage.BulkJobConfig) (*storage.BulkJob, error) {
+	job, err := s.MemoryStore.CreateBulkJob(config)
+	if err != nil {
+		return nil, err
+	}
+	return job, s.savedJob(job.ID, nil)
+}
+
+// UpdateBulkJobState changes a bulk job's state and saves the job
+func (s *Store) UpdateBulkJobState(jobID string, state storage.JobState) error {
+	return s.savedJob(jobID, s.MemoryStore.UpdateBulkJobState(jobID, state))
+}
+
+// SetBulkJobResults sets a bulk query job's results and saves the job
+func (s *Store) SetBulkJobResults(jobID string, results []storage.Record) error {
+	return s.savedJob(jobID, s.MemoryStore.SetBulkJobResults(jobID, results))
+}
+
+// AppendBulkJobData adds uploaded CSV rows to an ingest job and saves the job
+func (s *Store) AppendBulkJobData(jobID string, header []string, rows [][]string) error {
+	return s.savedJob(jobID, s.MemoryStore.AppendBulkJobData(jobID, header, rows))
+}
+
+// SetBulkJobRecordResults sets an ingest job's per-row results and saves
+// the job
+func (s *Store) SetBulkJobRecordResults(jobID string, results []storage.BulkRecordResult) error {
+	return s.savedJob(jobID, s.MemoryStore.SetBulkJobRecordResults(jobID, results))
+}
+
+// GetBulkJobResults returns a page of a bulk job's results, saving the job
+// when the page hands out a new locator
+func (s *Store) GetBulkJobResults(jobID string, locator string, maxRecords int) (*storage.BulkJobResults, string, error) {
+	results, next, err := s.MemoryStore.GetBulkJobResults(jobID, locator, maxRecords)
+	if err != nil || next == "" {
+		return results, next, err
+	}
+	return results, next, s.savedJob(jobID, nil)
+}
+
+// DeleteBulkJob deletes a bulk job and its saved row
+func (s *Store) DeleteBulkJob(jobID string) error {
+	if err := s.MemoryStore.DeleteBulkJob(jobID); err != nil {
+		return err
+	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+	if _, err := s.db.Exec(`DELETE FROM bulk_jobs WHERE id = ?`, jobID); err != nil {
+		return fmt.Errorf("sqlite: deleting bulk job: %w", err)
+	}
+	return nil
+}
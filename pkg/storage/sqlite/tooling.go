@@ -0,0 +1,94 @@
+package sqlite
+
+import "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/storage"
+
+// Tooling returns the store of Tooling API objects. Its records are saved
+// with the rest of the store, so record writes through it save the store;
+// schema changes to Tooling API objects are saved by the next write.
+func (s *Store) Tooling() storage.Store {
+	return &toolingStore{Store: s.MemoryStore.Tooling(), owner: s}
+}
+
+// toolingStore saves its owner after each record write to the Tooling API
+// objects
+type toolingStore struct {
+	storage.Store
+	owner *Store
+}
+
+// CreateRecord creates a record and saves the store
+func (t *toolingStore) CreateRecord(objectType string, record storage.Record) (string, error) {
+	id, err := t.Store.CreateRecord(objectType, record)
+	return id, t.owner.saved(err)
+}
+
+// CreateRecordAs creates a record as userID and saves the store
+func (t *toolingStore) CreateRecordAs(userID, objectType string, record storage.Record) (string, error) {
+	id, err := t.Store.CreateRecordAs(userID, objectType, record)
+	return id, t.owner.saved(err)
+}
+
+// UpdateRecord updates a record and saves the store
+func (t *toolingStore) UpdateRecord(objectType, recordID string, updates storage.Record) error {
+	return t.owner.saved(t.Store.UpdateRecord(objectType, recordID, updates))
+}
+
+// UpdateRecordAs updates a record as userID and saves the store
+func (t *toolingStore) UpdateRecordAs(userID, objectType, recordID string, updates storage.Record) error {
+	return t.owner.saved(t.Store.UpdateRecordAs(userID, objectType, recordID, updates))
+}
+
+// UpsertRecordAs upserts a record by external ID as userID and saves the
+// store
+func (t *toolingStore) UpsertRecordAs(userID, objectType, field, value string, record storage.Record) (string, bool, error) {
+	id, created, err := t.Store.UpsertRecordAs(userID, objectType, field, value, record)
+	return id, created, t.owner.saved(err)
+}
+
+// DeleteRecord deletes a record and saves the store
+func (t *toolingStore) DeleteRecord(objectType, recordID string) error {
+	return t.owner.saved(t.Store.DeleteRecord(objectType, recordID))
+}
+
+// DeleteRecordAs deletes a record as userID and saves the store
+func (t *toolingStore) DeleteRecordAs(userID, objectType, recordID string) error {
+	return t.owner.saved(t.Store.DeleteRecordAs(userID, objectType, recordID))
+}
+
+// RestoreRecord rolls a record back and saves the store
+func (t *toolingStore) RestoreRecord(objectType, recordID string, previous storage.Record) error {
+	return t.owner.saved(t.Store.RestoreRecord(objectType, recordID, previous))
+}
+
+// UndeleteRecord restores a deleted record and saves the store
+func (t *toolingStore) UndeleteRecord(objectType, recordID string) error {
+	return t.owner.saved(t.Store.UndeleteRecord(objectType, recordID))
+}
+
+// UndeleteRecordAs restores a deleted record as userID and saves the store
+func (t *toolingStore) UndeleteRecordAs(userID, objectType, recordID string) error {
+	return t.owner.saved(t.Store.UndeleteRecordAs(userID, objectType, recordID))
+}
+
+// CreateRecords creates records and saves the store
+func (t *toolingStore) CreateRecords(objectType string, records []storage.Record) ([]storage.CreateResult, error) {
+	results, err := t.Store.CreateRecords(objectType, records)
+	return results, t.owner.saved(err)
+}
+
+// UpdateRecords updates records and saves the store
+func (t *toolingStore) UpdateRecords(objectType string, records []storage.Record) ([]storage.UpdateResult, error) {
+	results, err := t.Store.UpdateRecords(objectType, records)
+	return results, t.owner.saved(err)
+}
+
+// DeleteRecords deletes records and saves the store
+func (t *toolingStore) DeleteRecords(objectType string, recordIDs []string) ([]storage.DeleteResult, error) {
+	results, err := t.Store.DeleteRecords(objectType, recordIDs)
+	return results, t.owner.saved(err)
+}
+
+// Truncate removes every record of a type and saves the store
+func (t *toolingStore) Truncate(objectType string) error {
+	return t.owner.saved(t.Store.Truncate(objectType))
+}
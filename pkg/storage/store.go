@@ -11,10 +11,22 @@ type Record map[string]interface{}
 type Store interface {
 	// SObject operations
 	CreateRecord(objectType string, record Record) (string, error)
+	CreateRecordAs(userID, objectType string, record Record) (string, error)
 	GetRecord(objectType, recordID string) (Record, error)
 	UpdateRecord(objectType, recordID string, updates Record) error
+	UpdateRecordAs(userID, objectType, recordID string, updates Record) error
+	UpsertRecordAs(userID, objectType, field, value string, record Record) (string, bool, error)
 	DeleteRecord(objectType, recordID string) error
+	DeleteRecordAs(userID, objectType, recordID string) error
+	RestoreRecord(objectType, recordID string, previous Record) error
 	GetAllRecords(objectType string) ([]Record, error)
+	GetAllRecordsWithDeleted(objectType string) ([]Record, error)
+	GetBlob(objectType, recordID, field string) ([]byte, error)
+
+	// Recycle bin
+	GetDeleted(objectType string, start, end time.Time) ([]DeletedRecord, error)
+	UndeleteRecord(objectType, recordID string) error
+	UndeleteRecordAs(userID, objectType, recordID string) error
 
 	// Bulk operations
 	CreateRecords(objectType string, records []Record) ([]CreateResult, error)
@@ -23,24 +35,44 @@ type Store interface {
 
 	// Schema operations
 	RegisterSObject(definition SObjectDefinition) error
+	AddField(objectType string, field FieldDefinition) error
+	UpdateField(objectType string, field FieldDefinition) error
+	RemoveField(objectType, fieldName string) error
+	UnregisterSObject(objectType string) error
 	DescribeSObject(objectType string) (*SObjectDescription, error)
 	DescribeGlobal() (*GlobalDescription, error)
 	GetSObjectList() []string
 	HasSObject(objectType string) bool
+	ObjectTypeForID(id string) string
+	RegisterApprovalProcess(objectType string, process ApprovalProcess) error
+	RegisterPlatformEvent(name string, fields ...FieldDefinition) error
+	RegisterPicklistDependency(objectType string, dependency PicklistDependency) error
+	EnableFieldHistory(objectType string, fields ...string) error
+	ApprovalLayouts(objectType, processName string) ([]ApprovalLayout, error)
+
+	// Tooling API objects
+	Tooling() Store
 
 	// Bulk Job operations
 	CreateBulkJob(config BulkJobConfig) (*BulkJob, error)
 	GetBulkJob(jobID string) (*BulkJob, error)
 	UpdateBulkJobState(jobID string, state JobState) error
 	SetBulkJobResults(jobID string, results []Record) error
+	AppendBulkJobData(jobID string, header []string, rows [][]string) error
+	SetBulkJobRecordResults(jobID string, results []BulkRecordResult) error
 	GetBulkJobResults(jobID string, locator string, maxRecords int) (*BulkJobResults, string, error)
 	DeleteBulkJob(jobID string) error
 
+	// Recently viewed
+	MarkRecentlyViewed(objectType, recordID string) error
+
 	// Limits
 	GetLimits() *LimitsInfo
 	GetRecordCounts(objectTypes []string) map[string]int
 
 	// Utility
+	GetDefaultUserID() string
+	Truncate(objectType string) error
 	Reset()
 }
 
@@ -94,11 +126,63 @@ type FieldDefinition struct {
 	Updateable       bool            `json:"updateable"`
 	Unique           bool            `json:"unique,omitempty"`
 	ExternalId       bool            `json:"externalId,omitempty"`
-	DefaultValue     interface{}     `json:"defaultValue,omitempty"`
+	CaseSensitive    bool            `json:"caseSensitive"`
+	DefaultValue     interface{}     `json:"defaultValue"`
 	PicklistValues   []PicklistValue `json:"picklistValues,omitempty"`
 	ReferenceTo      []string        `json:"referenceTo,omitempty"`
 	RelationshipName string          `json:"relationshipName,omitempty"`
 	SoapType         string          `json:"soapType,omitempty"`
+
+	// DefaultValueFormula is a formula evaluated for the default on create
+	DefaultValueFormula string `json:"defaultValueFormula"`
+
+	// DefaultedOnCreate is derived by describe from the configured defaults
+	DefaultedOnCreate bool `json:"defaultedOnCreate"`
+
+	// Calculated marks formula fields, which are read-only
+	Calculated        bool   `json:"calculated"`
+	CalculatedFormula string `json:"calculatedFormula"`
+
+	// CompoundFieldName names the compound field a component belongs to,
+	// e.g. BillingAddress for BillingStreet
+	CompoundFieldName string `json:"compoundFieldName"`
+
+	// ChildRelationshipName overrides the relationship name a lookup gives
+	// its parent in describe and subqueries (e.g. ChildAccounts)
+	ChildRelationshipName string `json:"-"`
+
+	// CascadeDelete makes deleting the referenced record delete this one
+	// too, as a master-detail relationship does. RestrictedDelete instead
+	// blocks deleting the referenced record while this one refers to it.
+	CascadeDelete    bool `json:"cascadeDelete"`
+	RestrictedDelete bool `json:"restrictedDelete"`
+
+	// Filterable, Sortable, Groupable and Aggregatable override whether SOQL
+	// may use the field in WHERE, ORDER BY, GROUP BY and aggregate functions.
+	// Nil derives the capability from the field type; see IsFilterable etc.
+	Filterable   *bool `json:"-"`
+	Sortable     *bool `json:"-"`
+	Groupable    *bool `json:"-"`
+	Aggregatable *bool `json:"-"`
+
+	// ControllerName and DependentPicklist mark a dependent picklist; ValidFor
+	// maps each controlling value to its allowed values. See
+	// RegisterPicklistDependency.
+	ControllerName    string              `json:"controllerName"`
+	DependentPicklist bool                `json:"dependentPicklist"`
+	ValidFor          map[string][]string `json:"-"`
+
+	// AutoNumber marks read-only fields set on create to the next number of
+	// their sequence, rendered with DisplayFormat (e.g. CASE-{00000000})
+	AutoNumber    bool   `json:"autoNumber"`
+	DisplayFormat string `json:"-"`
+
+	// RestrictedPicklist limits a picklist to its active PicklistValues
+	RestrictedPicklist bool `json:"restrictedPicklist"`
+
+	// PolymorphicForeignKey marks reference fields that can point at more
+	// than one object type (e.g. Task.WhoId -> Contact or Lead)
+	PolymorphicForeignKey bool `json:"polymorphicForeignKey"`
 }
 
 // FieldType represents the type of a Salesforce field
@@ -131,10 +215,11 @@ const (
 
 // PicklistValue represents a picklist option
 type PicklistValue struct {
-	Value       string `json:"value"`
-	Label       string `json:"label"`
-	Active      bool   `json:"active"`
+	Value        string `json:"value"`
+	Label        string `json:"label"`
+	Active       bool   `json:"active"`
 	DefaultValue bool   `json:"defaultValue"`
+	ValidFor     string `json:"validFor,omitempty"`
 }
 
 // RecordTypeInfo represents record type information
@@ -147,16 +232,45 @@ type RecordTypeInfo struct {
 
 // ChildRelationship represents a child relationship
 type ChildRelationship struct {
-	ChildSObject       string `json:"childSObject"`
-	Field              string `json:"field"`
-	RelationshipName   string `json:"relationshipName"`
-	CascadeDelete      bool   `json:"cascadeDelete"`
+	ChildSObject     string `json:"childSObject"`
+	Field            string `json:"field"`
+	RelationshipName string `json:"relationshipName"`
+	CascadeDelete    bool   `json:"cascadeDelete"`
+	RestrictedDelete bool   `json:"restrictedDelete"`
 }
 
 // SObjectDescription is the response for describe calls
 type SObjectDescription struct {
 	SObjectDefinition
 	URLs map[string]string `json:"urls"`
+
+	// The emulator has no layouts, overrides or scopes, but reports these
+	// keys with empty values so strict deserializers find them
+	NamedLayoutInfos      []NamedLayoutInfo `json:"namedLayoutInfos"`
+	ActionOverrides       []ActionOverride  `json:"actionOverrides"`
+	NetworkScopeFieldName *string           `json:"networkScopeFieldName"`
+	SupportedScopes       []ScopeInfo       `json:"supportedScopes"`
+}
+
+// NamedLayoutInfo names an alternate layout of an SObject
+type NamedLayoutInfo struct {
+	Name string            `json:"name"`
+	URLs map[string]string `json:"urls"`
+}
+
+// ActionOverride replaces a standard action such as View or Edit
+type ActionOverride struct {
+	FormFactor         string `json:"formFactor"`
+	IsAvailableInTouch bool   `json:"isAvailableInTouch"`
+	Name               string `json:"name"`
+	PageID             string `json:"pageId"`
+	URL                string `json:"url"`
+}
+
+// ScopeInfo is a USING SCOPE value the SObject supports
+type ScopeInfo struct {
+	Label string `json:"label"`
+	Name  string `json:"name"`
 }
 
 // GlobalDescription is the response for describe global calls
@@ -186,6 +300,25 @@ type BulkJobConfig struct {
 	Object      string `json:"object"`
 	Query       string `json:"query,omitempty"`
 	ContentType string `json:"contentType,omitempty"`
+
+	// LineEnding and ColumnDelimiter shape the CSV results (default LF and COMMA)
+	LineEnding      string `json:"lineEnding,omitempty"`
+	ColumnDelimiter string `json:"columnDelimiter,omitempty"`
+
+	// DisableBatchRetry records the Sforce-Disable-Batch-Retry header; jobs
+	// never retry in the emulator, so it has no effect
+	DisableBatchRetry bool `json:"-"`
+
+	// JobType is V2Query (the default) or V2Ingest. Ingest jobs start Open
+	// so data can be uploaded.
+	JobType string `json:"-"`
+
+	// ExternalIDFieldName is the field upsert ingest jobs match rows on
+	ExternalIDFieldName string `json:"externalIdFieldName,omitempty"`
+
+	// CreatedByID is the User creating the job, who ingest jobs write
+	// records as (empty means the default user)
+	CreatedByID string `json:"-"`
 }
 
 // JobState represents the state of a bulk job
@@ -215,10 +348,20 @@ type BulkJob struct {
 	JobType                string    `json:"jobType"`
 	NumberRecordsProcessed int       `json:"numberRecordsProcessed"`
 	Query                  string    `json:"query,omitempty"`
+	LineEnding             string    `json:"lineEnding"`
+	ColumnDelimiter        string    `json:"columnDelimiter"`
+	ExternalIDFieldName    string    `json:"externalIdFieldName,omitempty"`
+	NumberRecordsFailed    int       `json:"numberRecordsFailed"`
 
 	// Internal fields (not serialized)
-	Results         []Record          `json:"-"`
-	ResultLocators  map[string]int    `json:"-"`
+	DisableBatchRetry bool           `json:"-"`
+	Results           []Record       `json:"-"`
+	ResultLocators    map[string]int `json:"-"`
+
+	// Uploaded ingest data and the outcome of each row processed so far
+	Header        []string           `json:"-"`
+	Rows          [][]string         `json:"-"`
+	RecordResults []BulkRecordResult `json:"-"`
 }
 
 // BulkJobResults represents paginated bulk job results
@@ -227,6 +370,26 @@ type BulkJobResults struct {
 	Done    bool
 }
 
+// BulkRecordResult is the outcome of processing one uploaded ingest row
+type BulkRecordResult struct {
+	ID      string
+	Created bool
+	Errors  []BulkRecordError
+	Row     []string // the uploaded values, in upload column order
+}
+
+// Success reports whether the row was processed without errors
+func (r BulkRecordResult) Success() bool {
+	return len(r.Errors) == 0
+}
+
+// BulkRecordError is a per-record error in Salesforce's statusCode/fields shape
+type BulkRecordError struct {
+	StatusCode string   `json:"statusCode"`
+	Message    string   `json:"message"`
+	Fields     []string `json:"fields"`
+}
+
 // LimitsInfo represents API limits information
 type LimitsInfo struct {
 	DailyApiRequests        LimitValue `json:"DailyApiRequests"`
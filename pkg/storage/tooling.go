@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// ToolingSObjects are the Tooling API objects. They live in a store of
+// their own so they never collide with data objects of the same name.
+var ToolingSObjects = []SObjectDefinition{
+	{
+		Name:        "ApexClass",
+		Label:       "Apex Class",
+		LabelPlural: "Apex Classes",
+		KeyPrefix:   "01p",
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: toolingFields(
+			FieldDefinition{Name: "Name", Label: "Name", Type: FieldTypeString, Length: 255, Createable: true, Updateable: true},
+			FieldDefinition{Name: "NamespacePrefix", Label: "Namespace Prefix", Type: FieldTypeString, Length: 15, Nillable: true},
+			FieldDefinition{Name: "ApiVersion", Label: "Api Version", Type: FieldTypeDouble, Createable: true, Updateable: true, DefaultValue: 58.0},
+			FieldDefinition{Name: "Status", Label: "Status", Type: FieldTypePicklist, Createable: true, Updateable: true, DefaultValue: "Active"},
+			FieldDefinition{Name: "IsValid", Label: "Is Valid", Type: FieldTypeBoolean, Createable: true, Updateable: true, DefaultValue: true},
+			FieldDefinition{Name: "Body", Label: "Body", Type: FieldTypeLongTextArea, Nillable: true, Createable: true, Updateable: true},
+			FieldDefinition{Name: "LengthWithoutComments", Label: "Size Without Comments", Type: FieldTypeInteger, Nillable: true, Createable: true, Updateable: true},
+		),
+	},
+	{
+		Name:        "ApexTrigger",
+		Label:       "Apex Trigger",
+		LabelPlural: "Apex Triggers",
+		KeyPrefix:   "01q",
+		Createable:  true,
+		Updateable:  true,
+		Deletable:   true,
+		Queryable:   true,
+		Fields: toolingFields(
+			FieldDefinition{Name: "Name", Label: "Name", Type: FieldTypeString, Length: 255, Createable: true, Updateable: true},
+			FieldDefinition{Name: "NamespacePrefix", Label: "Namespace Prefix", Type: FieldTypeString, Length: 15, Nillable: true},
+			FieldDefinition{Name: "TableEnumOrId", Label: "Custom Object Definition ID", Type: FieldTypeString, Length: 40, Createable: true},
+			FieldDefinition{Name: "ApiVersion", Label: "Api Version", Type: FieldTypeDouble, Createable: true, Updateable: true, DefaultValue: 58.0},
+			FieldDefinition{Name: "Status", Label: "Status", Type: FieldTypePicklist, Createable: true, Updateable: true, DefaultValue: "Active"},
+			FieldDefinition{Name: "IsValid", Label: "Is Valid", Type: FieldTypeBoolean, Createable: true, Updateable: true, DefaultValue: true},
+			FieldDefinition{Name: "Body", Label: "Body", Type: FieldTypeLongTextArea, Nillable: true, Createable: true, Updateable: true},
+			FieldDefinition{Name: "UsageBeforeInsert", Label: "Before Insert", Type: FieldTypeBoolean, Createable: true, Updateable: true, DefaultValue: false},
+			FieldDefinition{Name: "UsageAfterInsert", Label: "After Insert", Type: FieldTypeBoolean, Createable: true, Updateable: true, DefaultValue: false},
+			FieldDefinition{Name: "UsageBeforeUpdate", Label: "Before Update", Type: FieldTypeBoolean, Createable: true, Updateable: true, DefaultValue: false},
+			FieldDefinition{Name: "UsageAfterUpdate", Label: "After Update", Type: FieldTypeBoolean, Createable: true, Updateable: true, DefaultValue: false},
+		),
+	},
+	{
+		Name:        "CustomField",
+		Label:       "Custom Field Definition",
+		LabelPlural: "Custom Field Definitions",
+		KeyPrefix:   "00N",
+		Queryable:   true,
+		Fields: toolingFields(
+			FieldDefinition{Name: "DeveloperName", Label: "Field Name", Type: FieldTypeString, Length: 40},
+			FieldDefinition{Name: "FullName", Label: "Full Name", Type: FieldTypeString, Length: 255},
+			FieldDefinition{Name: "TableEnumOrId", Label: "Table Enum or ID", Type: FieldTypeString, Length: 40},
+			FieldDefinition{Name: "NamespacePrefix", Label: "Namespace Prefix", Type: FieldTypeString, Length: 15, Nillable: true},
+		),
+	},
+	{
+		Name:        "EntityDefinition",
+		Label:       "Entity Definition",
+		LabelPlural: "Entity Definitions",
+		Queryable:   true,
+		Fields: toolingFields(
+			FieldDefinition{Name: "DurableId", Label: "Durable ID", Type: FieldTypeString, Length: 70},
+			FieldDefinition{Name: "QualifiedApiName", Label: "Qualified API Name", Type: FieldTypeString, Length: 250},
+			FieldDefinition{Name: "DeveloperName", Label: "Developer Name", Type: FieldTypeString, Length: 40},
+			FieldDefinition{Name: "Label", Label: "Label", Type: FieldTypeString, Length: 40},
+			FieldDefinition{Name: "PluralLabel", Label: "Plural Label", Type: FieldTypeString, Length: 40},
+			FieldDefinition{Name: "KeyPrefix", Label: "Key Prefix", Type: FieldTypeString, Length: 3, Nillable: true},
+			FieldDefinition{Name: "IsCustomizable", Label: "Is Customizable", Type: FieldTypeBoolean},
+			FieldDefinition{Name: "IsQueryable", Label: "Is Queryable", Type: FieldTypeBoolean},
+			FieldDefinition{Name: "NamespacePrefix", Label: "Namespace Prefix", Type: FieldTypeString, Length: 15, Nillable: true},
+		),
+	},
+}
+
+// toolingFields adds the Id and audit fields to a tooling object's fields
+func toolingFields(fields ...FieldDefinition) []FieldDefinition {
+	result := []FieldDefinition{{Name: "Id", Label: "ID", Type: FieldTypeID}}
+	result = append(result, fields...)
+	return append(result,
+		FieldDefinition{Name: "CreatedDate", Label: "Created Date", Type: FieldTypeDatetime},
+		FieldDefinition{Name: "CreatedById", Label: "Created By ID", Type: FieldTypeReference, ReferenceTo: []string{"User"}},
+		FieldDefinition{Name: "LastModifiedDate", Label: "Last Modified Date", Type: FieldTypeDatetime},
+		FieldDefinition{Name: "LastModifiedById", Label: "Last Modified By ID", Type: FieldTypeReference, ReferenceTo: []string{"User"}},
+		FieldDefinition{Name: "SystemModstamp", Label: "System Modstamp", Type: FieldTypeDatetime},
+	)
+}
+
+// newToolingStore creates the store holding the Tooling API objects, with
+// records created as defaultUserID
+func newToolingStore(defaultUserID string) *MemoryStore {
+	store := newMemoryStore()
+	store.defaultUserID = defaultUserID
+	for _, obj := range ToolingSObjects {
+		_ = store.RegisterSObject(obj)
+	}
+	return store
+}
+
+// Tooling returns the store of Tooling API objects. Its EntityDefinition
+// and CustomField rows mirror the objects and custom fields of this store.
+func (s *MemoryStore) Tooling() Store {
+	if s.tooling == nil {
+		return s
+	}
+
+	s.mu.RLock()
+	schemas := make([]SObjectDefinition, 0, len(s.schemas))
+	for _, schema := range s.schemas {
+		schemas = append(schemas, schema)
+	}
+	s.mu.RUnlock()
+
+	s.tooling.syncSchemaRows(schemas)
+	return s.tooling
+}
+
+// syncSchemaRows rebuilds the EntityDefinition and CustomField rows from
+// schemas. Rows keep their IDs across rebuilds.
+func (s *MemoryStore) syncSchemaRows(schemas []SObjectDefinition) {
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Name < schemas[j].Name })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, objectType := range []string{"EntityDefinition", "CustomField"} {
+		s.clearRecords(objectType)
+	}
+	row := func(objectType, key string, fields Record) {
+		id, ok := s.derivedIDs[objectType+":"+key]
+		if !ok {
+			id = s.getIDGenerator(objectType).Generate()
+			s.derivedIDs[objectType+":"+key] = id
+		}
+		fields["Id"] = id
+		fields["CreatedDate"] = now
+		fields["CreatedById"] = s.defaultUserID
+		fields["LastModifiedDate"] = now
+		fields["LastModifiedById"] = s.defaultUserID
+		fields["SystemModstamp"] = now
+		fields["NamespacePrefix"] = nil
+		fields["attributes"] = map[string]interface{}{
+			"type": objectType,
+			"url":  "/services/data/v58.0/tooling/sobjects/" + objectType + "/" + id,
+		}
+		s.putRecord(objectType, id, fields)
+	}
+
+	for _, schema := range schemas {
+		var keyPrefix interface{}
+		if schema.KeyPrefix != "" {
+			keyPrefix = schema.KeyPrefix
+		}
+		row("EntityDefinition", schema.Name, Record{
+			"DurableId":        schema.Name,
+			"QualifiedApiName": schema.Name,
+			"DeveloperName":    strings.TrimSuffix(schema.Name, "__c"),
+			"Label":            schema.Label,
+			"PluralLabel":      schema.LabelPlural,
+			"KeyPrefix":        keyPrefix,
+			"IsCustomizable":   true,
+			"IsQueryable":      schema.Queryable,
+		})
+
+		for _, field := range schema.Fields {
+			if !strings.HasSuffix(field.Name, "__c") {
+				continue
+			}
+			row("CustomField", schema.Name+"."+field.Name, Record{
+				"DeveloperName": strings.TrimSuffix(field.Name, "__c"),
+				"FullName":      schema.Name + "." + field.Name,
+				"TableEnumOrId": schema.Name,
+			})
+		}
+	}
+}
+
+// resetTooling removes every tooling record, as Reset does for data
+func (s *MemoryStore) resetTooling(defaultUserID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for objectType := range s.records {
+		s.records[objectType] = make(map[string]Record)
+	}
+	s.recordOrder = make(map[string][]string)
+	s.deletions = make(map[string]map[string]DeletedRecord)
+	s.operations = nil
+	s.defaultUserID = defaultUserID
+	s.replaced = true
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// dateTimeLayouts are the datetime formats accepted on write
+var dateTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05-0700", "2006-01-02"}
+
+// validateRecord checks each value of record against its field definition:
+// the field must exist, numbers and dates must parse, strings must fit the
+// field's Length, restricted picklists only take their listed values and
+// formula fields cannot be written.
+// Null values are left to the required field checks.
+func validateRecord(schema SObjectDefinition, record Record) error {
+	fields := make(map[string]FieldDefinition, len(schema.Fields))
+	relationships := map[string]bool{}
+	for _, field := range schema.Fields {
+		fields[field.Name] = field
+		if field.RelationshipName != "" {
+			relationships[field.RelationshipName] = true
+		}
+	}
+
+	for name, value := range record {
+		field, ok := fields[name]
+		if !ok {
+			// Related records may be referenced through their relationship
+			if name == "attributes" || relationships[name] {
+				continue
+			}
+			return sferrors.NewInvalidFieldError(name, schema.Name)
+		}
+		if field.Calculated {
+			return sferrors.SalesforceError{
+				Message:   fmt.Sprintf("Unable to create/update fields: %s. Please check the security settings of this field and verify that it is read/write for your profile or permission set.", name),
+				ErrorCode: sferrors.ErrorCodeInvalidFieldForInsertUpdate,
+				Fields:    []string{name},
+			}
+		}
+		if value == nil {
+			continue
+		}
+		if err := validateValue(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkReferences checks that each reference field of record names a live
+// record of one of the field's ReferenceTo objects. IDs whose key prefix is
+// not registered, or belongs to an object outside ReferenceTo, are rejected.
+// IDs of registered objects the store has no schema for are let through,
+// since there are no records to check them against. Callers must hold s.mu.
+func (s *MemoryStore) checkReferences(schema SObjectDefinition, record Record) error {
+	for _, field := range schema.Fields {
+		if field.Type != FieldTypeReference {
+			continue
+		}
+		value, ok := record[field.Name]
+		if !ok || value == nil || value == "" {
+			continue
+		}
+
+		id, _ := value.(string)
+		target := s.prefixes.ObjectType(id)
+		if target == "" || (len(field.ReferenceTo) > 0 && !containsString(field.ReferenceTo, target)) {
+			return sferrors.SalesforceError{
+				Message:   fmt.Sprintf("%s: id value of incorrect type: %v", field.Label, value),
+				ErrorCode: sferrors.ErrorCodeInvalidCrossReferenceKey,
+				Fields:    []string{field.Name},
+			}
+		}
+		if _, ok := s.schemas[target]; !ok {
+			continue
+		}
+		if !s.liveRecord(target, id) {
+			return sferrors.SalesforceError{
+				Message:   "invalid cross reference id",
+				ErrorCode: sferrors.ErrorCodeInvalidCrossReferenceKey,
+				Fields:    []string{field.Name},
+			}
+		}
+	}
+	return nil
+}
+
+// liveRecord reports whether a record exists and is not deleted, matching
+// 15-character IDs against the first 15 characters of stored IDs. Callers
+// must hold s.mu.
+func (s *MemoryStore) liveRecord(objectType, id string) bool {
+	record, ok := s.records[objectType][id]
+	if !ok && len(id) == 15 {
+		for storedID, stored := range s.records[objectType] {
+			if strings.HasPrefix(storedID, id) {
+				record, ok = stored, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return false
+	}
+	isDeleted, _ := record["IsDeleted"].(bool)
+	return !isDeleted
+}
+
+// validateValue checks a non-null value against a field's type. Empty
+// strings are treated as null, as they are for number and date fields.
+func validateValue(field FieldDefinition, value interface{}) error {
+	if value == "" {
+		return nil
+	}
+
+	switch field.Type {
+	case FieldTypeInteger:
+		if !isInteger(value) {
+			return invalidValue(field, value, "value not of required type")
+		}
+	case FieldTypeDouble, FieldTypeCurrency, FieldTypePercent:
+		if !isNumber(value) {
+			return invalidValue(field, value, "value not of required type")
+		}
+	case FieldTypeDate:
+		if s, ok := value.(string); !ok || !parsesAs(s, "2006-01-02") {
+			return invalidValue(field, value, "invalid date")
+		}
+	case FieldTypeDatetime:
+		if s, ok := value.(string); !ok || !parsesAs(s, dateTimeLayouts...) {
+			return invalidValue(field, value, "invalid datetime")
+		}
+	case FieldTypePicklist, FieldTypeMultiPicklist:
+		if err := checkRestrictedPicklist(field, value); err != nil {
+			return err
+		}
+	}
+
+	if s, ok := value.(string); ok && field.Length > 0 && utf8.RuneCountInString(s) > field.Length {
+		return sferrors.SalesforceError{
+			Message:   fmt.Sprintf("%s: data value too large: %s (max length=%d)", field.Label, s, field.Length),
+			ErrorCode: sferrors.ErrorCodeStringTooLong,
+			Fields:    []string{field.Name},
+		}
+	}
+	return nil
+}
+
+// checkRestrictedPicklist rejects values not among a restricted picklist's
+// active values
+func checkRestrictedPicklist(field FieldDefinition, value interface{}) error {
+	if !field.RestrictedPicklist {
+		return nil
+	}
+	s, _ := value.(string)
+	values := []string{s}
+	if field.Type == FieldTypeMultiPicklist {
+		values = strings.Split(s, ";")
+	}
+
+	for _, v := range values {
+		allowed := false
+		for _, pv := range field.PicklistValues {
+			if pv.Active && pv.Value == v {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return sferrors.SalesforceError{
+				Message:   fmt.Sprintf("%s: bad value for restricted picklist field: %s", field.Name, v),
+				ErrorCode: sferrors.ErrorCodeInvalidOrNullForRestrictedPicklist,
+				Fields:    []string{field.Name},
+			}
+		}
+	}
+	return nil
+}
+
+func invalidValue(field FieldDefinition, value interface{}, reason string) error {
+	return sferrors.SalesforceError{
+		Message:   fmt.Sprintf("%s: %s: %v", field.Label, reason, value),
+		ErrorCode: sferrors.ErrorCodeInvalidField,
+		Fields:    []string{field.Name},
+	}
+}
+
+// isNumber reports whether value is a number or a string holding one, as
+// the REST API accepts both
+func isNumber(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int32, int64, float32, float64:
+		return true
+	case json.Number:
+		_, err := v.Float64()
+		return err == nil
+	case string:
+		_, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return err == nil
+	}
+	return false
+}
+
+// isInteger reports whether value is a whole number or a string holding one
+func isInteger(value interface{}) bool {
+	switch v := value.(type) {
+	case int, int32, int64:
+		return true
+	case float64:
+		return v == float64(int64(v))
+	case json.Number:
+		_, err := v.Int64()
+		return err == nil
+	case string:
+		_, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		return err == nil
+	}
+	return false
+}
+
+func parsesAs(s string, layouts ...string) bool {
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
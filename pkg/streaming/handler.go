@@ -0,0 +1,379 @@
+// Package streaming emulates the Streaming API's CometD endpoint, delivering
+// events published to channels to the clients subscribed to them
+package streaming
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MASA-JAPAN/go-salesforce-emulator/pkg/auth"
+	sferrors "github.com/MASA-JAPAN/go-salesforce-emulator/pkg/errors"
+)
+
+// DefaultTimeout is how long a /meta/connect long poll waits for events,
+// as advised by Salesforce
+const DefaultTimeout = 110 * time.Second
+
+// Message is a Bayeux message sent by a client
+type Message struct {
+	Channel                  string                 `json:"channel"`
+	ID                       string                 `json:"id,omitempty"`
+	ClientID                 string                 `json:"clientId,omitempty"`
+	Subscription             string                 `json:"subscription,omitempty"`
+	ConnectionType           string                 `json:"connectionType,omitempty"`
+	Version                  string                 `json:"version,omitempty"`
+	SupportedConnectionTypes []string               `json:"supportedConnectionTypes,omitempty"`
+	Ext                      map[string]interface{} `json:"ext,omitempty"`
+}
+
+// Reply is the response to a meta channel message
+type Reply struct {
+	Channel                  string   `json:"channel"`
+	ID                       string   `json:"id,omitempty"`
+	ClientID                 string   `json:"clientId,omitempty"`
+	Successful               bool     `json:"successful"`
+	Subscription             string   `json:"subscription,omitempty"`
+	Version                  string   `json:"version,omitempty"`
+	MinimumVersion           string   `json:"minimumVersion,omitempty"`
+	SupportedConnectionTypes []string `json:"supportedConnectionTypes,omitempty"`
+	Error                    string   `json:"error,omitempty"`
+	Advice                   *Advice  `json:"advice,omitempty"`
+}
+
+// Advice tells a client how to reconnect
+type Advice struct {
+	Reconnect string `json:"reconnect"`
+	Timeout   int64  `json:"timeout,omitempty"`
+	Interval  int64  `json:"interval"`
+}
+
+// Event is a message delivered on a subscribed channel
+type Event struct {
+	Channel string                 `json:"channel"`
+	Data    map[string]interface{} `json:"data"`
+}
+
+// client is a handshaken CometD client and the events queued for it
+type client struct {
+	subscriptions map[string]bool
+	queue         []Event
+	wake          chan struct{}
+}
+
+// Handler handles the CometD endpoint of the Streaming API
+type Handler struct {
+	authHandler *auth.Handler
+	errors      *sferrors.ErrorRecorder
+	timeout     time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*client
+	replayIDs map[string]int64 // last replayId by channel
+	done      chan struct{}
+}
+
+// NewHandler creates a new streaming handler
+func NewHandler(authHandler *auth.Handler) *Handler {
+	return &Handler{
+		authHandler: authHandler,
+		timeout:     DefaultTimeout,
+		clients:     make(map[string]*client),
+		replayIDs:   make(map[string]int64),
+		done:        make(chan struct{}),
+	}
+}
+
+// SetErrorRecorder sets the recorder that retains error responses
+func (h *Handler) SetErrorRecorder(recorder *sferrors.ErrorRecorder) {
+	h.errors = recorder
+}
+
+// SetTimeout sets how long /meta/connect waits for events (0 keeps
+// DefaultTimeout)
+func (h *Handler) SetTimeout(d time.Duration) {
+	if d > 0 {
+		h.timeout = d
+	}
+}
+
+// Close ends pending long polls, so the server can shut down
+func (h *Handler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	select {
+	case <-h.done:
+	default:
+		close(h.done)
+	}
+}
+
+// Publish delivers payload to the clients subscribed to channel and returns
+// its replayId, which increases with each event on the channel. PushTopic
+// channels (/topic/...) carry it as the event's sobject, others as its
+// payload.
+func (h *Handler) Publish(channel string, payload map[string]interface{}) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.replayIDs[channel]++
+	replayID := h.replayIDs[channel]
+	key := "payload"
+	if strings.HasPrefix(channel, "/topic/") {
+		key = "sobject"
+	}
+	event := Event{
+		Channel: channel,
+		Data: map[string]interface{}{
+			"event": map[string]interface{}{
+				"createdDate": time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+				"replayId":    replayID,
+			},
+			key: payload,
+		},
+	}
+
+	for _, c := range h.clients {
+		for subscription := range c.subscriptions {
+			if matchesChannel(subscription, channel) {
+				c.queue = append(c.queue, event)
+				select {
+				case c.wake <- struct{}{}:
+				default:
+				}
+				break
+			}
+		}
+	}
+	return replayID
+}
+
+// HandleCometD handles POST /cometd/XX.X, processing a batch of Bayeux
+// messages on the meta channels
+func (h *Handler) HandleCometD(w http.ResponseWriter, r *http.Request) {
+	if _, err := h.authHandler.ValidateRequest(r); err != nil {
+		h.respondError(w, []sferrors.SalesforceError{err.(sferrors.SalesforceError)}, http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPost {
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewMethodNotAllowedError(r.Method),
+		}, http.StatusMethodNotAllowed)
+		return
+	}
+
+	messages, err := decodeMessages(r)
+	if err != nil {
+		h.respondError(w, []sferrors.SalesforceError{
+			sferrors.NewJSONParserError(err.Error()),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	var responses []interface{}
+	for _, message := range messages {
+		switch message.Channel {
+		case "/meta/handshake":
+			responses = append(responses, h.handshake(message))
+		case "/meta/connect":
+			// Events are delivered ahead of the connect reply
+			reply, events := h.connect(r, message)
+			for _, event := range events {
+				responses = append(responses, event)
+			}
+			responses = append(responses, reply)
+		case "/meta/subscribe", "/meta/unsubscribe":
+			responses = append(responses, h.subscribe(message, message.Channel == "/meta/subscribe"))
+		case "/meta/disconnect":
+			responses = append(responses, h.disconnect(message))
+		default:
+			responses = append(responses, Reply{
+				Channel: message.Channel,
+				ID:      message.ID,
+				Error:   "403::Publish not allowed",
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(responses)
+}
+
+func (h *Handler) handshake(message Message) Reply {
+	clientID := generateClientID()
+
+	h.mu.Lock()
+	h.clients[clientID] = &client{
+		subscriptions: make(map[string]bool),
+		wake:          make(chan struct{}, 1),
+	}
+	h.mu.Unlock()
+
+	return Reply{
+		Channel:                  message.Channel,
+		ID:                       message.ID,
+		ClientID:                 clientID,
+		Successful:               true,
+		Version:                  "1.0",
+		MinimumVersion:           "1.0",
+		SupportedConnectionTypes: []string{"long-polling"},
+		Advice:                   h.advice("retry"),
+	}
+}
+
+// connect waits until events are queued for the client, the timeout passes
+// or the request ends, and returns the queued events
+func (h *Handler) connect(r *http.Request, message Message) (Reply, []Event) {
+	h.mu.Lock()
+	c, ok := h.clients[message.ClientID]
+	h.mu.Unlock()
+	if !ok {
+		return h.unknownClient(message), nil
+	}
+
+	h.mu.Lock()
+	pending := len(c.queue) > 0
+	h.mu.Unlock()
+	if !pending {
+		timer := time.NewTimer(h.timeout)
+		defer timer.Stop()
+		select {
+		case <-c.wake:
+		case <-timer.C:
+		case <-r.Context().Done():
+		case <-h.done:
+		}
+	}
+
+	h.mu.Lock()
+	events := c.queue
+	c.queue = nil
+	select {
+	case <-c.wake:
+	default:
+	}
+	h.mu.Unlock()
+
+	return Reply{
+		Channel:    message.Channel,
+		ID:         message.ID,
+		ClientID:   message.ClientID,
+		Successful: true,
+		Advice:     h.advice("retry"),
+	}, events
+}
+
+func (h *Handler) subscribe(message Message, subscribe bool) Reply {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	c, ok := h.clients[message.ClientID]
+	if !ok {
+		return h.unknownClient(message)
+	}
+	reply := Reply{
+		Channel:      message.Channel,
+		ID:           message.ID,
+		ClientID:     message.ClientID,
+		Subscription: message.Subscription,
+	}
+	if !strings.HasPrefix(message.Subscription, "/") || strings.HasPrefix(message.Subscription, "/meta/") {
+		reply.Error = "403:" + message.Subscription + ":Invalid subscription"
+		return reply
+	}
+
+	if subscribe {
+		c.subscriptions[message.Subscription] = true
+	} else {
+		delete(c.subscriptions, message.Subscription)
+	}
+	reply.Successful = true
+	return reply
+}
+
+func (h *Handler) disconnect(message Message) Reply {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[message.ClientID]; !ok {
+		return h.unknownClient(message)
+	}
+	delete(h.clients, message.ClientID)
+	return Reply{
+		Channel:    message.Channel,
+		ID:         message.ID,
+		ClientID:   message.ClientID,
+		Successful: true,
+	}
+}
+
+// unknownClient is the reply to a message from a client that has not
+// handshaken, advising it to do so
+func (h *Handler) unknownClient(message Message) Reply {
+	return Reply{
+		Channel:  message.Channel,
+		ID:       message.ID,
+		ClientID: message.ClientID,
+		Error:    "403::Unknown client",
+		Advice:   &Advice{Reconnect: "handshake"},
+	}
+}
+
+func (h *Handler) advice(reconnect string) *Advice {
+	return &Advice{Reconnect: reconnect, Timeout: h.timeout.Milliseconds()}
+}
+
+func (h *Handler) respondError(w http.ResponseWriter, errors []sferrors.SalesforceError, status int) {
+	for _, e := range errors {
+		h.errors.Record(status, e.ErrorCode, e.Message)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(errors)
+}
+
+// decodeMessages decodes a request body holding one Bayeux message or an
+// array of them
+func decodeMessages(r *http.Request) ([]Message, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		return nil, err
+	}
+	var messages []Message
+	if err := json.Unmarshal(raw, &messages); err == nil {
+		return messages, nil
+	}
+	var message Message
+	if err := json.Unmarshal(raw, &message); err != nil {
+		return nil, err
+	}
+	return []Message{message}, nil
+}
+
+// matchesChannel reports whether subscription covers channel, either
+// exactly or through a trailing * (one segment) or ** (any segments)
+// wildcard
+func matchesChannel(subscription, channel string) bool {
+	switch {
+	case subscription == channel:
+		return true
+	case strings.HasSuffix(subscription, "/**"):
+		return strings.HasPrefix(channel, strings.TrimSuffix(subscription, "**"))
+	case strings.HasSuffix(subscription, "/*"):
+		prefix := strings.TrimSuffix(subscription, "*")
+		return strings.HasPrefix(channel, prefix) && !strings.Contains(channel[len(prefix):], "/")
+	}
+	return false
+}
+
+func generateClientID() string {
+	bytes := make([]byte, 16)
+	_, _ = rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
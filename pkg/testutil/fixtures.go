@@ -9,11 +9,11 @@ import (
 
 // Fixtures helps set up test data
 type Fixtures struct {
-	store *storage.MemoryStore
+	store storage.Store
 }
 
 // NewFixtures creates a new fixtures helper
-func NewFixtures(store *storage.MemoryStore) *Fixtures {
+func NewFixtures(store storage.Store) *Fixtures {
 	return &Fixtures{store: store}
 }
 
@@ -163,6 +163,28 @@ func (f *Fixtures) LoadSampleCases(count int, accountIds, contactIds []string) (
 	return ids, nil
 }
 
+// LoadSampleApexClasses creates sample ApexClass records for the Tooling API
+func (f *Fixtures) LoadSampleApexClasses(count int) ([]string, error) {
+	ids := make([]string, count)
+
+	for i := 0; i < count; i++ {
+		name := fmt.Sprintf("SampleClass%d", i+1)
+		body := fmt.Sprintf("public class %s {\n    public static Integer value() { return %d; }\n}", name, i+1)
+
+		id, err := f.store.Tooling().CreateRecord("ApexClass", storage.Record{
+			"Name":                  name,
+			"Body":                  body,
+			"LengthWithoutComments": len(body),
+		})
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+
+	return ids, nil
+}
+
 // LoadBasicCRMData creates a basic CRM dataset
 func (f *Fixtures) LoadBasicCRMData() error {
 	// Create 10 accounts